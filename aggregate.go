@@ -0,0 +1,267 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// aggState accumulates the values of one aggregate function
+// over a group of rows. NULL values are skipped by every
+// aggregate except count(*).
+type aggState interface {
+	add(v interface{}) error
+	result() interface{}
+}
+
+// newAggState creates the accumulator for an aggregate function
+// by its (case-insensitive) name.
+func newAggState(name string, distinct bool) (aggState, error) {
+	var s aggState
+
+	switch strings.ToLower(name) {
+	case "count":
+		s = &aggCount{}
+	case "sum":
+		s = &aggSum{}
+	case "avg":
+		s = &aggAvg{}
+	case "min":
+		s = &aggMinMax{sign: -1}
+	case "max":
+		s = &aggMinMax{sign: 1}
+	case "stddev":
+		s = &aggStdDev{}
+	case "median":
+		s = &aggPercentile{p: 0.5}
+	default:
+		return nil, fmt.Errorf("unknown aggregate function: %s", name)
+	}
+
+	if distinct {
+		s = &aggDistinct{inner: s, seen: make(map[string]bool)}
+	}
+
+	return s, nil
+}
+
+// isAggregateName reports whether name is an aggregate function.
+func isAggregateName(name string) bool {
+	switch strings.ToLower(name) {
+	case "count", "sum", "avg", "min", "max", "stddev", "median":
+		return true
+	}
+	return false
+}
+
+// aggCountStar counts rows, including the ones with NULLs.
+type aggCountStar struct {
+	n int64
+}
+
+func (a *aggCountStar) add(v interface{}) error {
+	a.n++
+	return nil
+}
+
+func (a *aggCountStar) result() interface{} {
+	return a.n
+}
+
+// aggCount counts non-NULL values.
+type aggCount struct {
+	n int64
+}
+
+func (a *aggCount) add(v interface{}) error {
+	if !isNull(v) {
+		a.n++
+	}
+	return nil
+}
+
+func (a *aggCount) result() interface{} {
+	return a.n
+}
+
+// aggSum adds up values; the result stays an integer until a
+// float is seen. The sum of no values is NULL.
+type aggSum struct {
+	seen    bool
+	isFloat bool
+	i       int64
+	f       float64
+}
+
+func (a *aggSum) add(v interface{}) error {
+	if isNull(v) {
+		return nil
+	}
+	n, ok := toNumber(v)
+	if !ok {
+		return fmt.Errorf("sum: %q is not a number", toString(v))
+	}
+	a.seen = true
+	switch x := n.(type) {
+	case int64:
+		a.i += x
+		a.f += float64(x)
+	case float64:
+		a.isFloat = true
+		a.f += x
+	}
+	return nil
+}
+
+func (a *aggSum) result() interface{} {
+	if !a.seen {
+		return nil
+	}
+	if a.isFloat {
+		return a.f
+	}
+	return a.i
+}
+
+// aggAvg computes the arithmetic mean as a float.
+type aggAvg struct {
+	n   int64
+	sum float64
+}
+
+func (a *aggAvg) add(v interface{}) error {
+	if isNull(v) {
+		return nil
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return fmt.Errorf("avg: %q is not a number", toString(v))
+	}
+	a.n++
+	a.sum += f
+	return nil
+}
+
+func (a *aggAvg) result() interface{} {
+	if a.n == 0 {
+		return nil
+	}
+	return a.sum / float64(a.n)
+}
+
+// aggMinMax keeps the smallest (sign -1) or largest (sign 1) value.
+type aggMinMax struct {
+	sign int
+	v    interface{}
+}
+
+func (a *aggMinMax) add(v interface{}) error {
+	if isNull(v) {
+		return nil
+	}
+	if a.v == nil || compareValues(v, a.v)*a.sign > 0 {
+		a.v = v
+	}
+	return nil
+}
+
+func (a *aggMinMax) result() interface{} {
+	return a.v
+}
+
+// aggDistinct passes each distinct value once to its inner aggregate.
+type aggDistinct struct {
+	inner aggState
+	seen  map[string]bool
+}
+
+func (a *aggDistinct) add(v interface{}) error {
+	if isNull(v) {
+		return nil
+	}
+	k := valueKey(v)
+	if a.seen[k] {
+		return nil
+	}
+	a.seen[k] = true
+	return a.inner.add(v)
+}
+
+func (a *aggDistinct) result() interface{} {
+	return a.inner.result()
+}
+
+// aggStdDev computes the sample standard deviation (n-1) with
+// Welford's algorithm; it is NULL for fewer than two values.
+type aggStdDev struct {
+	n    int64
+	mean float64
+	m2   float64
+}
+
+func (a *aggStdDev) add(v interface{}) error {
+	if isNull(v) {
+		return nil
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return fmt.Errorf("stddev: %q is not a number", toString(v))
+	}
+	a.n++
+	d := f - a.mean
+	a.mean += d / float64(a.n)
+	a.m2 += d * (f - a.mean)
+	return nil
+}
+
+func (a *aggStdDev) result() interface{} {
+	if a.n < 2 {
+		return nil
+	}
+	return math.Sqrt(a.m2 / float64(a.n-1))
+}
+
+// aggPercentile keeps all values and returns the p-th percentile
+// (0 <= p <= 1), interpolating linearly between closest ranks.
+type aggPercentile struct {
+	p    float64
+	vals []float64
+}
+
+func (a *aggPercentile) add(v interface{}) error {
+	if isNull(v) {
+		return nil
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return fmt.Errorf("percentile: %q is not a number", toString(v))
+	}
+	a.vals = append(a.vals, f)
+	return nil
+}
+
+func (a *aggPercentile) result() interface{} {
+	if len(a.vals) == 0 {
+		return nil
+	}
+	sort.Float64s(a.vals)
+	return percentileOf(a.vals, a.p)
+}
+
+// percentileOf returns the p-th percentile of sorted values.
+func percentileOf(sorted []float64, p float64) float64 {
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 1 {
+		return sorted[len(sorted)-1]
+	}
+	rank := p * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+
+	return sorted[lo] + (sorted[hi]-sorted[lo])*frac
+}
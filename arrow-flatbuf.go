@@ -0,0 +1,344 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// A minimal FlatBuffers encoder/decoder for the Arrow IPC metadata
+// (Schema.fbs, Message.fbs and File.fbs).
+//
+// The encoder writes front to back: a vtable, then its table, then
+// the objects the table refers to, so every offset points forward
+// as the format requires. Scalars are aligned to their size and
+// struct vectors to 8 bytes, as checked by FlatBuffers verifiers.
+
+// fbField is one field (slot) of a table: a scalar of 1, 2, 4 or 8
+// bytes, or a reference to an object written by ref.
+type fbField struct {
+	size int
+	bits uint64
+	ref  func(b *fbBuilder) int
+}
+
+// fbTable is a table by field slot; absent fields have size 0.
+type fbTable []fbField
+
+func fbInt8(v uint8) fbField  { return fbField{size: 1, bits: uint64(v)} }
+func fbInt16(v int16) fbField { return fbField{size: 2, bits: uint64(uint16(v))} }
+func fbInt32(v int32) fbField { return fbField{size: 4, bits: uint64(uint32(v))} }
+func fbInt64(v int64) fbField { return fbField{size: 8, bits: uint64(v)} }
+func fbBool(v bool) fbField {
+	if v {
+		return fbInt8(1)
+	}
+	return fbInt8(0)
+}
+
+func fbRef(ref func(b *fbBuilder) int) fbField {
+	return fbField{size: 4, ref: ref}
+}
+
+func fbString(s string) fbField {
+	return fbRef(func(b *fbBuilder) int { return b.str(s) })
+}
+
+func fbSubTable(t fbTable) fbField {
+	return fbRef(func(b *fbBuilder) int { return b.table(t) })
+}
+
+func fbTables(items []fbTable) fbField {
+	return fbRef(func(b *fbBuilder) int { return b.tableVector(items) })
+}
+
+// fbStructs is a vector of n structs of 8-byte alignment.
+func fbStructs(n int, data []byte) fbField {
+	return fbRef(func(b *fbBuilder) int { return b.structVector(n, data) })
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) putU16(v uint16) {
+	b.buf = append(b.buf, byte(v), byte(v>>8))
+}
+
+func (b *fbBuilder) putU32(v uint32) {
+	b.buf = append(b.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// patch stores at pos the offset from pos to target.
+func (b *fbBuilder) patch(pos, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
+
+// table writes a vtable and its table, then the referenced objects,
+// and returns the position of the table.
+func (b *fbBuilder) table(t fbTable) int {
+	n := len(t)
+	for n > 0 && t[n-1].size == 0 {
+		n--
+	}
+
+	// lay out the fields, largest first
+	offsets := make([]int, n)
+	inline := 4 // soffset to the vtable
+	maxAlign := 4
+	for _, size := range []int{8, 4, 2, 1} {
+		for i := 0; i < n; i++ {
+			if t[i].size != size {
+				continue
+			}
+			for inline%size != 0 {
+				inline++
+			}
+			offsets[i] = inline
+			inline += size
+			if size > maxAlign {
+				maxAlign = size
+			}
+		}
+	}
+
+	b.align(2)
+	vt := len(b.buf)
+	b.putU16(uint16(4 + 2*n))
+	b.putU16(uint16(inline))
+	for i := 0; i < n; i++ {
+		b.putU16(uint16(offsets[i]))
+	}
+
+	b.align(maxAlign)
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, inline)...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(int32(pos-vt)))
+
+	for i := 0; i < n; i++ {
+		if t[i].size == 0 || t[i].ref != nil {
+			continue
+		}
+		p := pos + offsets[i]
+		switch t[i].size {
+		case 1:
+			b.buf[p] = byte(t[i].bits)
+		case 2:
+			binary.LittleEndian.PutUint16(b.buf[p:], uint16(t[i].bits))
+		case 4:
+			binary.LittleEndian.PutUint32(b.buf[p:], uint32(t[i].bits))
+		case 8:
+			binary.LittleEndian.PutUint64(b.buf[p:], t[i].bits)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		if t[i].ref != nil {
+			target := t[i].ref(b)
+			b.patch(pos+offsets[i], target)
+		}
+	}
+
+	return pos
+}
+
+func (b *fbBuilder) str(s string) int {
+	b.align(4)
+	pos := len(b.buf)
+	b.putU32(uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+func (b *fbBuilder) tableVector(items []fbTable) int {
+	b.align(4)
+	pos := len(b.buf)
+	b.putU32(uint32(len(items)))
+	b.buf = append(b.buf, make([]byte, 4*len(items))...)
+	for i := 0; i < len(items); i++ {
+		target := b.table(items[i])
+		b.patch(pos+4+4*i, target)
+	}
+	return pos
+}
+
+func (b *fbBuilder) structVector(n int, data []byte) int {
+	for len(b.buf)%4 != 0 || (len(b.buf)+4)%8 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	pos := len(b.buf)
+	b.putU32(uint32(n))
+	b.buf = append(b.buf, data...)
+	return pos
+}
+
+// finish writes a buffer with root as its root table, padded to
+// 8 bytes.
+func (b *fbBuilder) finish(root fbTable) []byte {
+	b.buf = make([]byte, 4)
+	pos := b.table(root)
+	b.patch(0, pos)
+	b.align(8)
+	return b.buf
+}
+
+// errFlatbuf is returned for metadata that cannot be decoded.
+var errFlatbuf = errors.New("arrow: invalid flatbuffer metadata")
+
+// fbReader reads a table of a FlatBuffers buffer. Out of range
+// reads panic with errFlatbuf; see fbRecover.
+type fbReader struct {
+	buf []byte
+	pos int
+}
+
+func fbCheck(buf []byte, pos, n int) {
+	if pos < 0 || n < 0 || pos+n > len(buf) {
+		panic(errFlatbuf)
+	}
+}
+
+func fbU32(buf []byte, pos int) int {
+	fbCheck(buf, pos, 4)
+	return int(binary.LittleEndian.Uint32(buf[pos:]))
+}
+
+// fbRecover turns a panic of fbReader into an error.
+func fbRecover(err *error) {
+	if r := recover(); r != nil {
+		if e, ok := r.(error); ok && e == errFlatbuf {
+			*err = errFlatbuf
+			return
+		}
+		panic(r)
+	}
+}
+
+func fbRoot(buf []byte) fbReader {
+	return fbReader{buf: buf, pos: fbU32(buf, 0)}
+}
+
+// field returns the position of a field, or 0 if it is absent.
+func (t fbReader) field(slot int) int {
+	fbCheck(t.buf, t.pos, 4)
+	vt := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	fbCheck(t.buf, vt, 4)
+	vtSize := int(binary.LittleEndian.Uint16(t.buf[vt:]))
+	o := 4 + 2*slot
+	if o+2 > vtSize {
+		return 0
+	}
+	fbCheck(t.buf, vt+o, 2)
+	off := int(binary.LittleEndian.Uint16(t.buf[vt+o:]))
+	if off == 0 {
+		return 0
+	}
+	return t.pos + off
+}
+
+func (t fbReader) uint8(slot int, def uint8) uint8 {
+	p := t.field(slot)
+	if p == 0 {
+		return def
+	}
+	fbCheck(t.buf, p, 1)
+	return t.buf[p]
+}
+
+func (t fbReader) int16(slot int, def int16) int16 {
+	p := t.field(slot)
+	if p == 0 {
+		return def
+	}
+	fbCheck(t.buf, p, 2)
+	return int16(binary.LittleEndian.Uint16(t.buf[p:]))
+}
+
+func (t fbReader) int32(slot int, def int32) int32 {
+	p := t.field(slot)
+	if p == 0 {
+		return def
+	}
+	fbCheck(t.buf, p, 4)
+	return int32(binary.LittleEndian.Uint32(t.buf[p:]))
+}
+
+func (t fbReader) int64(slot int, def int64) int64 {
+	p := t.field(slot)
+	if p == 0 {
+		return def
+	}
+	fbCheck(t.buf, p, 8)
+	return int64(binary.LittleEndian.Uint64(t.buf[p:]))
+}
+
+func (t fbReader) has(slot int) bool {
+	return t.field(slot) != 0
+}
+
+// table returns a sub-table.
+func (t fbReader) table(slot int) (fbReader, bool) {
+	p := t.field(slot)
+	if p == 0 {
+		return fbReader{}, false
+	}
+	return fbReader{buf: t.buf, pos: p + fbU32(t.buf, p)}, true
+}
+
+// vector returns the position of the first element and the length
+// of a vector field.
+func (t fbReader) vector(slot int) (int, int) {
+	p := t.field(slot)
+	if p == 0 {
+		return 0, 0
+	}
+	v := p + fbU32(t.buf, p)
+	n := fbU32(t.buf, v)
+	if n > len(t.buf) {
+		panic(errFlatbuf)
+	}
+	return v + 4, n
+}
+
+func (t fbReader) str(slot int) string {
+	start, n := t.vector(slot)
+	if n == 0 {
+		return ""
+	}
+	fbCheck(t.buf, start, n)
+	return string(t.buf[start : start+n])
+}
+
+// tableAt returns element i of a vector of tables.
+func (t fbReader) tableAt(start, i int) fbReader {
+	p := start + 4*i
+	return fbReader{buf: t.buf, pos: p + fbU32(t.buf, p)}
+}
+
+// int64At reads an int64 at an absolute position (struct fields).
+func (t fbReader) int64At(pos int) int64 {
+	fbCheck(t.buf, pos, 8)
+	return int64(binary.LittleEndian.Uint64(t.buf[pos:]))
+}
+
+func (t fbReader) int32At(pos int) int32 {
+	fbCheck(t.buf, pos, 4)
+	return int32(binary.LittleEndian.Uint32(t.buf[pos:]))
+}
+
+// float helpers for the record batch bodies
+func float64FromBits(b []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func float32FromBits(b []byte) float64 {
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+}
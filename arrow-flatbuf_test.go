@@ -0,0 +1,87 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestFlatbufRoundTrip(t *testing.T) {
+	structs := make([]byte, 16)
+	binary.LittleEndian.PutUint64(structs, 11)
+	binary.LittleEndian.PutUint64(structs[8:], 22)
+
+	buf := (&fbBuilder{}).finish(fbTable{
+		fbInt8(200),
+		fbInt16(-300),
+		{}, // absent
+		fbInt32(-70000),
+		fbInt64(-1 << 40),
+		fbBool(true),
+		fbString("name"),
+		fbSubTable(fbTable{fbInt32(5), fbString("inner")}),
+		fbTables([]fbTable{{fbInt16(1)}, {fbInt16(2)}, {}}),
+		fbStructs(2, structs),
+	})
+	if len(buf)%8 != 0 {
+		t.Fatalf("buffer of %d bytes is not padded", len(buf))
+	}
+
+	var err error
+	func() {
+		defer fbRecover(&err)
+		r := fbRoot(buf)
+		if r.uint8(0, 0) != 200 || r.int16(1, 0) != -300 || r.int32(3, 0) != -70000 || r.int64(4, 0) != -1<<40 {
+			t.Fatal("scalars")
+		}
+		if r.has(2) || r.int16(2, 9) != 9 || r.has(10) || r.int32(10, 8) != 8 {
+			t.Fatal("absent fields")
+		}
+		if r.uint8(5, 0) != 1 || r.str(6) != "name" {
+			t.Fatal("bool and string")
+		}
+		sub, ok := r.table(7)
+		if !ok || sub.int32(0, 0) != 5 || sub.str(1) != "inner" {
+			t.Fatal("sub-table")
+		}
+		start, n := r.vector(8)
+		if n != 3 || r.tableAt(start, 1).int16(0, 0) != 2 || r.tableAt(start, 2).has(0) {
+			t.Fatal("vector of tables")
+		}
+		start, n = r.vector(9)
+		if n != 2 || start%8 != 0 || r.int64At(start+8) != 22 {
+			t.Fatal("vector of structs")
+		}
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlatbufCorruptInput(t *testing.T) {
+	buf := (&fbBuilder{}).finish(fbTable{fbInt32(1), fbString("abc"), fbTables([]fbTable{{fbInt64(7)}})})
+	read := func(buf []byte) (err error) {
+		defer fbRecover(&err)
+		r := fbRoot(buf)
+		r.int32(0, 0)
+		r.str(1)
+		start, n := r.vector(2)
+		for i := 0; i < n; i++ {
+			r.tableAt(start, i).int64(0, 0)
+		}
+		return nil
+	}
+	for n := 0; n < len(buf); n++ {
+		read(buf[:n])
+	}
+	for i := 0; i < len(buf); i++ {
+		for _, b := range []byte{0x00, 0xff, 0x80} {
+			mutated := append([]byte(nil), buf...)
+			mutated[i] = b
+			read(mutated)
+		}
+	}
+	if err := read(buf[:3]); err != errFlatbuf {
+		t.Fatalf("got %v, want %v", err, errFlatbuf)
+	}
+}
@@ -0,0 +1,282 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// computedColumn is the definition of a computed column: an
+// expression or a func.
+type computedColumn struct {
+	expr sqlExpr
+	src  string
+	fn   func(Row) interface{}
+
+	// deps are the columns the expression refers to; a func
+	// depends on all columns.
+	deps []string
+
+	// seq is the creation order; a computed column can only
+	// refer to older ones.
+	seq int64
+}
+
+var computedSeq int64
+
+func (cc *computedColumn) eval(row Row) (interface{}, error) {
+	if cc.fn != nil {
+		return cc.fn(row), nil
+	}
+	return cc.expr.eval(&evalContext{rows: []Row{row}})
+}
+
+// dependsOn reports whether the column must be computed again when
+// the columns in changed have changed.
+func (cc *computedColumn) dependsOn(changed map[string]bool) bool {
+	if cc.fn != nil {
+		return true
+	}
+	for i := 0; i < len(cc.deps); i++ {
+		if changed[cc.deps[i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsComputed reports whether the column is a computed column (see
+// Cols.AddComputed).
+func (c Column) IsComputed() bool {
+	return c.computed != nil
+}
+
+// AddComputed adds a column whose value is computed from the other
+// columns of its row. expr is either an expression, written as in
+// a SQL select list:
+//
+//	qty * price
+//	first || ' ' || last
+//	CASE WHEN qty > 10 THEN 'bulk' ELSE 'retail' END
+//	IF(paid, 'yes', 'no')
+//	date_diff('day', ordered, shipped)
+//
+// or a func(Row) interface{}, which must not change the row.
+//
+// The values of the existing rows are computed, and an expression
+// that fails on one of them is an error. Values are stored like
+// those of other columns: a row added with New is computed on the
+// next call to a method of the table's Rows, and UpdateRow and
+// SetValue compute the columns that depend on the changed values
+// again (a func depends on all columns). A computed column cannot
+// be set; Materialize turns it into a plain column.
+func (c *Cols) AddComputed(name string, expr interface{}) error {
+
+	name = c.namePolicy.name(name)
+	if name == "" {
+		return errors.New("column name is blank")
+	}
+	if name == row_id {
+		return fmt.Errorf("%s is a reserved column name", name)
+	}
+	if c.Exists(name) {
+		return errors.New("column already exists")
+	}
+
+	var cc *computedColumn
+	switch x := expr.(type) {
+	case string:
+		var err error
+		if cc, err = newComputedExpr(c.Columns, x); err != nil {
+			return err
+		}
+	case func(Row) interface{}:
+		if x == nil {
+			return errors.New("computed column func is nil")
+		}
+		cc = &computedColumn{fn: x, seq: atomic.AddInt64(&computedSeq, 1)}
+	default:
+		return fmt.Errorf("computed column expression must be a string or a func(Row) interface{}, have %T", expr)
+	}
+
+	// compute the existing rows first: a failure adds nothing
+	rows := c.Rows.GetRows()
+	vals := make([]interface{}, len(rows))
+	for i := 0; i < len(rows); i++ {
+		v, err := cc.eval(rows[i])
+		if err != nil {
+			return fmt.Errorf("computed column %s: row %d: %v", name, i, err)
+		}
+		vals[i] = v
+	}
+
+	c.Columns = append(c.Columns, Column{Name: name, Type: "string", computed: cc})
+	c.Rows.SetColumns(c.Columns)
+
+	switch r := c.Rows.(type) {
+	case *Rows:
+		for i := 0; i < len(r.Rows); i++ {
+			r.Rows[i][name] = vals[i]
+		}
+	case *ColumnarRows:
+		v := r.vectorOf(name)
+		for i := 0; i < len(vals); i++ {
+			v.set(i, vals[i])
+		}
+	}
+
+	return nil
+}
+
+// newComputedExpr parses the expression of a computed column; it
+// can refer to the columns in cols.
+func newComputedExpr(cols []Column, src string) (*computedColumn, error) {
+	e, err := parseSQLExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	b := &sqlBinder{src: src, visible: 1, sources: []boundSource{{cols: cols}}}
+	if err := b.bind(e, "computed columns"); err != nil {
+		return nil, err
+	}
+
+	cc := &computedColumn{expr: e, src: src, seq: atomic.AddInt64(&computedSeq, 1)}
+	err = walkExpr(e, func(x sqlExpr) error {
+		if col, ok := x.(*exprColumn); ok {
+			if col.col == row_id {
+				return fmt.Errorf("%s cannot be used in a computed column", row_id)
+			}
+			if !containsString(cc.deps, col.col) {
+				cc.deps = append(cc.deps, col.col)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// renameSource returns the expression text with the references to
+// the columns in renamed (old name -> new name) changed.
+func (cc *computedColumn) renameSource(renamed map[string]string) string {
+	toks, err := tokenizeSQL(cc.src)
+	if err != nil {
+		return cc.src
+	}
+
+	// the spans of the references and their new names, from the
+	// last one
+	type span struct {
+		pos, end int
+		name     string
+	}
+	var spans []span
+	walkExpr(cc.expr, func(x sqlExpr) error {
+		col, ok := x.(*exprColumn)
+		if !ok {
+			return nil
+		}
+		name, ok := renamed[col.col]
+		if !ok {
+			return nil
+		}
+		for k := 0; k < len(toks); k++ {
+			if toks[k].pos != col.pos {
+				continue
+			}
+			end := toks[k].end
+			if col.qual != "" && k+2 < len(toks) {
+				end = toks[k+2].end
+			}
+			spans = append(spans, span{col.pos, end, name})
+		}
+		return nil
+	})
+	sort.Slice(spans, func(a, b int) bool { return spans[a].pos > spans[b].pos })
+
+	src := cc.src
+	for _, sp := range spans {
+		src = src[:sp.pos] + sqlQuoteName(SQLDialectStandard, sp.name) + src[sp.end:]
+	}
+	return src
+}
+
+// Materialize turns a computed column into a plain column that
+// keeps its current values.
+func (c *Cols) Materialize(name string) error {
+	j := c.namePolicy.find(c.Columns, name)
+	if j < 0 {
+		return fmt.Errorf("column not found: %s", name)
+	}
+	if c.Columns[j].computed == nil {
+		return fmt.Errorf("column %s is not computed", c.Columns[j].Name)
+	}
+
+	c.Rows.GetLastRow() // computes the pending rows
+	c.Columns[j].computed = nil
+
+	return nil
+}
+
+// computedOrder returns the indexes of the computed columns, in the
+// order they are computed.
+func computedOrder(cols []Column) []int {
+	var order []int
+	for j := 0; j < len(cols); j++ {
+		if cols[j].computed != nil {
+			order = append(order, j)
+		}
+	}
+	if len(order) > 1 {
+		sort.Slice(order, func(x, y int) bool {
+			return cols[order[x]].computed.seq < cols[order[y]].computed.seq
+		})
+	}
+	return order
+}
+
+// computeRow sets the computed columns of a row. changed names the
+// columns whose values changed, or is nil to compute all of them.
+// A column that fails is set to nil; the first error is returned.
+func computeRow(cols []Column, order []int, row Row, changed []string) error {
+	var set map[string]bool
+	if changed != nil {
+		set = make(map[string]bool, len(changed))
+		for i := 0; i < len(changed); i++ {
+			set[changed[i]] = true
+		}
+	}
+
+	var first error
+	for _, j := range order {
+		cc := cols[j].computed
+		if set != nil && !cc.dependsOn(set) {
+			continue
+		}
+		v, err := cc.eval(row)
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("computed column %s: %v", cols[j].Name, err)
+			}
+			v = nil
+		}
+		row[cols[j].Name] = v
+		if set != nil {
+			set[cols[j].Name] = true
+		}
+	}
+
+	return first
+}
+
+// checkNotComputed fails for a computed column.
+func checkNotComputed(cols []Column, j int) error {
+	if cols[j].computed != nil {
+		return fmt.Errorf("column %s is computed", cols[j].Name)
+	}
+	return nil
+}
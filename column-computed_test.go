@@ -0,0 +1,196 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddComputed(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("qty")
+		tbl.Cols.Add("price")
+		tbl.Cols.Add("first")
+		for _, r := range [][]interface{}{{2, 1.5, "a"}, {20, 1.5, "b"}, {nil, 1.5, "c"}} {
+			row := tbl.Rows.New()
+			row["qty"], row["price"], row["first"] = r[0], r[1], r[2]
+		}
+
+		if err := tbl.Cols.AddComputed("total", "qty * price"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Cols.AddComputed("kind", "CASE WHEN total > 10 THEN 'bulk' ELSE 'retail' END"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Cols.AddComputed("up", func(r Row) interface{} { return strings.ToUpper(toString(r["first"])) }); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Cols.AddComputed("big", "IF(qty > 5, 'y', 'n')"); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "[[2 1.5 a 3 retail A n] [20 1.5 b 30 bulk B y] [<nil> 1.5 c <nil> retail C n]]"
+		if got := fmt.Sprint(tableValues(tbl)); got != want {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+		for _, c := range tbl.Cols.Get() {
+			if c.IsComputed() != (c.Name == "total" || c.Name == "kind" || c.Name == "up" || c.Name == "big") {
+				t.Fatalf("storage %d: %s computed %v", storage, c.Name, c.IsComputed())
+			}
+		}
+
+		// new rows are computed when read
+		row := tbl.Rows.New()
+		row["qty"], row["price"], row["first"] = 10, 2, "z"
+		if v, _ := tbl.Rows.GetValue(3, "kind"); v != "bulk" {
+			t.Fatalf("storage %d: new row kind %v", storage, v)
+		}
+		if v, _ := tbl.Rows.GetValue(3, "up"); v != "Z" {
+			t.Fatalf("storage %d: new row up %v", storage, v)
+		}
+		tbl.Rows.InsertSingleRecord([]string{"9", "1", "q"})
+		if v, _ := tbl.Rows.GetValue(4, "up"); v != "Q" {
+			t.Fatalf("storage %d: inserted record up %v", storage, v)
+		}
+	}
+}
+
+func TestComputedRefresh(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("qty")
+		tbl.Cols.Add("price")
+		for _, q := range []interface{}{2, 20, 1} {
+			row := tbl.Rows.New()
+			row["qty"], row["price"] = q, 1.5
+		}
+		if err := tbl.Cols.AddComputed("total", "qty * price"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Cols.AddComputed("kind", "CASE WHEN total > 10 THEN 'bulk' ELSE 'retail' END"); err != nil {
+			t.Fatal(err)
+		}
+
+		// SetValue computes the chain of dependent columns
+		if err := tbl.Rows.SetValue(0, "qty", 100); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := tbl.Rows.GetValue(0, "kind"); v != "bulk" {
+			t.Fatalf("storage %d: SetValue kind %v", storage, v)
+		}
+		if err := tbl.Rows.SetValue(0, "total", 1); err == nil {
+			t.Fatalf("storage %d: setting a computed column: no error", storage)
+		}
+
+		// UpdateRow ignores values given for computed columns
+		row := tbl.Rows.GetRow(1)
+		row["qty"], row["total"] = 1, 999
+		if err := tbl.Rows.UpdateRow(row); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := tbl.Rows.GetValue(1, "total"); toString(v) != "1.5" {
+			t.Fatalf("storage %d: UpdateRow total %v", storage, v)
+		}
+
+		// a value that cannot be computed is nil
+		if err := tbl.Rows.SetValue(1, "qty", "abc"); err == nil {
+			t.Fatalf("storage %d: bad value: no error", storage)
+		}
+		if v, _ := tbl.Rows.GetValue(1, "total"); v != nil {
+			t.Fatalf("storage %d: total of a bad value %v", storage, v)
+		}
+
+		// removing a row keeps the others computed
+		if err := tbl.Rows.RemoveAt(0); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(tbl.Cols.GetData("total")); got != "[<nil> 1.5]" {
+			t.Fatalf("storage %d: after RemoveAt %s", storage, got)
+		}
+	}
+}
+
+func TestAddComputedErrors(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("qty")
+	tbl.Cols.Add("first")
+	row := tbl.Rows.New()
+	row["qty"], row["first"] = 1, "a"
+
+	for _, expr := range []interface{}{"qty *", "SUM(qty)", "_rowid_ + 1", "nope + 1", 5, "qty = ?", ""} {
+		if err := tbl.Cols.AddComputed("x", expr); err == nil {
+			t.Fatalf("%v: no error", expr)
+		}
+	}
+	if err := tbl.Cols.AddComputed("qty", "1"); err == nil {
+		t.Fatal("existing name: no error")
+	}
+
+	// an expression that fails on a row is not added
+	if err := tbl.Cols.AddComputed("d", "date_add(first, 1, 'day')"); err == nil {
+		t.Fatal("failing expression: no error")
+	}
+	if tbl.Cols.Exists("d") {
+		t.Fatal("failing expression was added")
+	}
+}
+
+func TestMaterialize(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("qty")
+	tbl.Rows.New()["qty"] = 2
+	if err := tbl.Cols.AddComputed("double", "qty * 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Cols.AddComputed("label", "'n=' || CAST(double AS TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tbl.Cols.Materialize("double"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Cols.Materialize("double"); err == nil {
+		t.Fatal("plain column: no error")
+	}
+	if err := tbl.Cols.Materialize("nope"); err == nil {
+		t.Fatal("unknown column: no error")
+	}
+
+	// the column keeps its values and can be set; columns that use
+	// it are still computed
+	if v, _ := tbl.Rows.GetValue(0, "double"); toString(v) != "4" {
+		t.Fatalf("materialized value %v", v)
+	}
+	if err := tbl.Rows.SetValue(0, "double", 5); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tbl.Rows.GetValue(0, "label"); v != "n=5" {
+		t.Fatalf("label %v", v)
+	}
+}
+
+func TestDateFunctions(t *testing.T) {
+	// date_diff counts the calendar days and months crossed
+	tbl, _ := (&Table{}).Create("e")
+	tbl.Cols.SetColumns([]Column{{Name: "a", Type: ColTypeDateTime}, {Name: "b", Type: ColTypeDateTime}})
+	row := tbl.Rows.New()
+	row["a"] = time.Date(2020, 1, 31, 10, 0, 0, 0, time.UTC)
+	row["b"] = time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)
+	ds := &Dataset{}
+	if err := ds.Add(*tbl); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ds.Query(`SELECT year(a), month(a), day(a), hour(a), weekday(a), date_add(a, 1, 'month'),
+		date_diff('day', a, b), date_diff('months', a, b), date(a), IIF(a < b, 1, 0) FROM e`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[[2020 1 31 10 5 2020-03-02 10:00:00 +0000 UTC 30 2 2020-01-31 00:00:00 +0000 UTC 1]]"
+	if got := fmt.Sprint(tableValues(res)); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,343 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InferOptions configures Cols.InferTypes. The zero value infers
+// the types of all columns from all rows, without changing the
+// values.
+type InferOptions struct {
+	// Columns are the columns to examine; default all (computed
+	// columns are left out).
+	Columns []string
+
+	// TimeLayouts are tried before the built-in layouts when a
+	// string is read as a date/time. A value that matches one of
+	// them counts as a date/time even if it is also a number.
+	TimeLayouts []string
+
+	// NullTokens are the strings that count as NULL, compared
+	// without case after trimming spaces; default "", "NA", "N/A"
+	// and "null".
+	NullTokens []string
+
+	// Threshold is the share (0 to 1) of the non-NULL values that
+	// must be of a type for the column to get that type; default
+	// 1, i.e. all of them.
+	Threshold float64
+
+	// SampleSize limits the rows examined to the first SampleSize
+	// (0 for all); Convert still converts all rows.
+	SampleSize int
+
+	// Convert converts the values to the inferred types. NULL
+	// tokens, and values that are not of the type (see Threshold),
+	// become nil.
+	Convert bool
+}
+
+// ColumnInference reports how the type of a column was inferred.
+type ColumnInference struct {
+	Column string
+
+	// Type is the inferred type, and PrevType the type before.
+	Type     string
+	PrevType string
+
+	// Count is the number of values examined, and Nulls the number
+	// of them that are NULL.
+	Count int
+	Nulls int
+
+	// Matched is the number of non-NULL values that are of Type,
+	// and Confidence is Matched / (Count - Nulls) (1 when all
+	// values are NULL).
+	Matched    int
+	Confidence float64
+
+	// Counts holds the number of non-NULL values of each kind:
+	// Integer, Float, Bool, DateTime, String and Other.
+	Counts map[string]int
+
+	// Failed holds up to 5 non-NULL values that are not of Type.
+	Failed []interface{}
+}
+
+// value kinds of type inference
+const (
+	inferInt = iota
+	inferFloat
+	inferBool
+	inferTime
+	inferString
+	inferOther
+	inferKinds
+)
+
+var inferKindNames = [inferKinds]string{ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime, ColTypeString, "Other"}
+
+// InferTypes infers the types of the columns from their values and
+// sets Column.Type. Integers widen to Float when floats are mixed
+// in, and a column whose values do not agree on a type (see
+// InferOptions.Threshold) is a String column (or "interface {}"
+// when it holds values that are not strings). Columns whose values
+// are all NULL keep their type.
+func (c *Cols) InferTypes(opts InferOptions) ([]ColumnInference, error) {
+	if opts.Threshold < 0 || opts.Threshold > 1 {
+		return nil, errors.New("threshold must be between 0 and 1")
+	}
+	if opts.Threshold == 0 {
+		opts.Threshold = 1
+	}
+	if opts.NullTokens == nil {
+		opts.NullTokens = []string{"", "NA", "N/A", "null"}
+	}
+
+	var idx []int
+	if len(opts.Columns) > 0 {
+		for _, name := range opts.Columns {
+			j := c.namePolicy.find(c.Columns, name)
+			if j < 0 {
+				return nil, fmt.Errorf("column not found: %s", name)
+			}
+			if err := checkNotComputed(c.Columns, j); err != nil {
+				return nil, err
+			}
+			idx = append(idx, j)
+		}
+	} else {
+		for j := 0; j < len(c.Columns); j++ {
+			if c.Columns[j].computed == nil {
+				idx = append(idx, j)
+			}
+		}
+	}
+
+	report := make([]ColumnInference, 0, len(idx))
+	for _, j := range idx {
+		name := c.Columns[j].Name
+		data := c.GetData(name)
+
+		sample := data
+		if opts.SampleSize > 0 && opts.SampleSize < len(sample) {
+			sample = sample[:opts.SampleSize]
+		}
+
+		ci := inferColumn(sample, &opts)
+		ci.Column = name
+		ci.PrevType = c.Columns[j].Type
+		if ci.Type == "" {
+			ci.Type = ci.PrevType
+		}
+		c.Columns[j].Type = ci.Type
+
+		if opts.Convert {
+			for i := 0; i < len(data); i++ {
+				c.Rows.SetValue(i, name, inferValue(data[i], ci.Type, &opts))
+			}
+		}
+
+		report = append(report, ci)
+	}
+
+	return report, nil
+}
+
+// inferColumn counts the kinds of the values and picks the type;
+// the type is "" when all values are NULL.
+func inferColumn(data []interface{}, opts *InferOptions) ColumnInference {
+	var counts [inferKinds]int
+	kinds := make([]int, len(data))
+
+	ci := ColumnInference{Count: len(data), Counts: map[string]int{}}
+	for i := 0; i < len(data); i++ {
+		kinds[i] = -1
+		if isInferNull(data[i], opts) {
+			ci.Nulls++
+			continue
+		}
+		kinds[i] = inferKind(data[i], opts)
+		counts[kinds[i]]++
+	}
+	for k := 0; k < inferKinds; k++ {
+		if counts[k] > 0 {
+			ci.Counts[inferKindNames[k]] = counts[k]
+		}
+	}
+
+	n := ci.Count - ci.Nulls
+	if n == 0 {
+		ci.Confidence = 1
+		return ci
+	}
+
+	var best, matched int
+	ci.Type, best, matched = pickInferType(&counts, n, opts.Threshold)
+	ci.Matched = matched
+	ci.Confidence = float64(matched) / float64(n)
+
+	if matched < n {
+		for i := 0; i < len(data) && len(ci.Failed) < 5; i++ {
+			if kinds[i] >= 0 && !inferKindIs(kinds[i], best) {
+				ci.Failed = append(ci.Failed, data[i])
+			}
+		}
+	}
+
+	return ci
+}
+
+// pickInferType picks the type of n non-NULL values from the counts
+// of their kinds: the family (numbers, bools or dates) with the most
+// values that meets the threshold, ties going to numbers and then
+// bools. It also returns the family (-1 for none) and the number of
+// values that are of the type.
+func pickInferType(counts *[inferKinds]int, n int, threshold float64) (string, int, int) {
+	numeric := counts[inferInt] + counts[inferFloat]
+	best, matched := -1, 0
+	for _, f := range []struct{ kind, n int }{{inferInt, numeric}, {inferBool, counts[inferBool]}, {inferTime, counts[inferTime]}} {
+		if f.n > matched && float64(f.n) >= threshold*float64(n) {
+			best, matched = f.kind, f.n
+		}
+	}
+
+	switch {
+	case best == inferInt && counts[inferFloat] > 0:
+		return ColTypeFloat, best, matched
+	case best >= 0:
+		return inferKindNames[best], best, matched
+	case counts[inferOther] > 0:
+		return "interface {}", best, n
+	}
+	return ColTypeString, best, n
+}
+
+// inferKindIs reports whether a value of kind k belongs to the
+// family best.
+func inferKindIs(k int, best int) bool {
+	if best == inferInt {
+		return k == inferInt || k == inferFloat
+	}
+	return k == best
+}
+
+func isInferNull(v interface{}, opts *InferOptions) bool {
+	if isNull(v) {
+		return true
+	}
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	s = strings.TrimSpace(s)
+	for _, t := range opts.NullTokens {
+		if strings.EqualFold(s, strings.TrimSpace(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// inferKind returns the kind of a non-NULL value.
+func inferKind(v interface{}, opts *InferOptions) int {
+	k, _, _ := classifyValue(v, opts.TimeLayouts)
+	return k
+}
+
+// classifyValue returns the kind of a non-NULL value, and its value
+// as a number or a time for those kinds. Strings are read with the
+// layouts first, then as numbers, bools and built-in time layouts.
+func classifyValue(v interface{}, layouts []string) (int, float64, time.Time) {
+	switch x := v.(type) {
+	case bool:
+		return inferBool, 0, time.Time{}
+	case time.Time:
+		return inferTime, 0, x
+	case *time.Time:
+		return inferTime, 0, *x
+	case string:
+		s := strings.TrimSpace(x)
+		if t, ok := parseTimeLayouts(s, layouts); ok {
+			return inferTime, 0, t
+		}
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return inferInt, float64(i), time.Time{}
+		}
+		if f, ok := parseDecimal(s); ok {
+			return inferFloat, f, time.Time{}
+		}
+		if strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+			return inferBool, 0, time.Time{}
+		}
+		if t, ok := parseTime(s); ok {
+			return inferTime, 0, t
+		}
+		return inferString, 0, time.Time{}
+	}
+	if isIntegerKind(v) {
+		f, _ := toFloat64(v)
+		return inferInt, f, time.Time{}
+	}
+	if isFloatKind(v) {
+		f, _ := toFloat64(v)
+		return inferFloat, f, time.Time{}
+	}
+	return inferOther, 0, time.Time{}
+}
+
+// parseDecimal reads s as a finite number (ParseFloat also reads
+// "inf" and "nan").
+func parseDecimal(s string) (float64, bool) {
+	if !strings.ContainsAny(s, "0123456789") {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// parseTimeLayouts parses s with the first matching layout.
+func parseTimeLayouts(s string, layouts []string) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// inferValue converts a value to an inferred type; NULL tokens and
+// values that cannot be converted are nil.
+func inferValue(v interface{}, typ string, opts *InferOptions) interface{} {
+	if isInferNull(v, opts) {
+		return nil
+	}
+	switch typ {
+	case ColTypeDateTime:
+		if s, ok := v.(string); ok {
+			if t, ok := parseTimeLayouts(strings.TrimSpace(s), opts.TimeLayouts); ok {
+				return t
+			}
+		}
+	case ColTypeString, ColTypeInteger, ColTypeFloat, ColTypeBool:
+	default:
+		return v
+	}
+	if s, ok := v.(string); ok && typ != ColTypeString {
+		s = strings.TrimSpace(s)
+		if typ == ColTypeBool && !strings.EqualFold(s, "true") && !strings.EqualFold(s, "false") {
+			return nil
+		}
+		v = s
+	}
+	x, err := castValue(v, typ)
+	if err != nil {
+		return nil
+	}
+	return x
+}
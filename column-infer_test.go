@@ -0,0 +1,134 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInferTypes(t *testing.T) {
+	cols := []string{"i", "f", "b", "d", "s", "mix", "nul", "cust", "goint"}
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		for _, c := range cols {
+			tbl.Cols.Add(c)
+		}
+		for _, r := range [][]interface{}{
+			{"1", "1.5", "true", "2020-01-02 10:00:00", "x", "1", nil, "02.01.2020", 3},
+			{" 2 ", "2", "FALSE", "2020-01-03", "y", "abc", "NA", "03.01.2020", 4.5},
+			{"NA", "", "", "", "NULL", "3", "", "", nil},
+			{"4", "inf", "true", "01/02/2020", "1", "4", "null", "04.01.2020", 5},
+		} {
+			row := tbl.Rows.New()
+			for j, c := range cols {
+				row[c] = r[j]
+			}
+		}
+
+		opts := InferOptions{TimeLayouts: []string{"02.01.2006"}, Threshold: 0.6}
+		report, err := tbl.Cols.InferTypes(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []string
+		for _, ci := range report {
+			types = append(types, ci.Type)
+		}
+		// integers widen to float; a column of NULLs keeps its type
+		if got := fmt.Sprint(types); got != "[Integer Float Bool DateTime String Integer string DateTime Float]" {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+
+		// 3 of the 4 values of mix are integers
+		mix := report[5]
+		if mix.Column != "mix" || mix.PrevType != "string" || mix.Count != 4 || mix.Nulls != 0 || mix.Matched != 3 ||
+			mix.Confidence != 0.75 || mix.Counts[ColTypeString] != 1 || fmt.Sprint(mix.Failed) != "[abc]" {
+			t.Fatalf("storage %d: mix %+v", storage, mix)
+		}
+		if s := report[4]; s.Nulls != 1 || s.Matched != 3 {
+			t.Fatalf("storage %d: s %+v", storage, s)
+		}
+
+		// without Convert the values are unchanged
+		if v, _ := tbl.Rows.GetValue(0, "i"); v != "1" {
+			t.Fatalf("storage %d: value changed to %#v", storage, v)
+		}
+
+		opts.Columns = []string{"i", "mix", "cust", "goint", "d"}
+		opts.Convert = true
+		if _, err := tbl.Cols.InferTypes(opts); err != nil {
+			t.Fatal(err)
+		}
+		want := "[1 2 <nil> 4] [1 <nil> 3 4] [3 4.5 <nil> 5]"
+		if got := fmt.Sprint(tbl.Cols.GetData("i"), tbl.Cols.GetData("mix"), tbl.Cols.GetData("goint")); got != want {
+			t.Fatalf("storage %d: converted %s", storage, got)
+		}
+		if v, _ := tbl.Rows.GetValue(1, "goint"); v != 4.5 {
+			t.Fatalf("storage %d: goint %#v", storage, v)
+		}
+		if v, _ := tbl.Rows.GetValue(1, "cust"); v != time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC) {
+			t.Fatalf("storage %d: custom layout %v", storage, v)
+		}
+		if v, _ := tbl.Rows.GetValue(3, "d"); v != time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC) {
+			t.Fatalf("storage %d: d %v", storage, v)
+		}
+	}
+}
+
+func TestInferTypesOptions(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("a")
+	for _, v := range []interface{}{"1", "2", "-", "x"} {
+		tbl.Rows.New()["a"] = v
+	}
+	if err := tbl.Cols.AddComputed("c", "a || '!'"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sample holds integers only; Convert still converts all rows
+	report, err := tbl.Cols.InferTypes(InferOptions{SampleSize: 2, Convert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Type != ColTypeInteger || report[0].Count != 2 {
+		t.Fatalf("sample %+v", report)
+	}
+	if got := fmt.Sprint(tbl.Cols.GetData("a")); got != "[1 2 <nil> <nil>]" {
+		t.Fatalf("converted %s", got)
+	}
+
+	tbl, _ = (&Table{}).Create("t")
+	tbl.Cols.Add("a")
+	for _, v := range []interface{}{"1", "-", "NA"} {
+		tbl.Rows.New()["a"] = v
+	}
+	report, err = tbl.Cols.InferTypes(InferOptions{NullTokens: []string{"-"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report[0].Type != ColTypeString || report[0].Nulls != 1 {
+		t.Fatalf("null tokens %+v", report[0])
+	}
+
+	for _, opts := range []InferOptions{{Threshold: 2}, {Threshold: -1}, {Columns: []string{"zz"}}} {
+		if _, err := tbl.Cols.InferTypes(opts); err == nil {
+			t.Fatalf("%+v: no error", opts)
+		}
+	}
+}
+
+// ResetColTypes tells integers from floats.
+func TestResetColTypes(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("a")
+	tbl.Cols.Add("b")
+	for _, r := range [][]interface{}{{"1", "1"}, {"2", "2.5"}, {"", "NA"}} {
+		row := tbl.Rows.New()
+		row["a"], row["b"] = r[0], r[1]
+	}
+	tbl.Cols.ResetColTypes()
+	if c := tbl.Cols.Get(); c[0].Type != ColTypeInteger || c[1].Type != ColTypeString {
+		t.Fatalf("types %s %s", c[0].Type, c[1].Type)
+	}
+}
@@ -0,0 +1,249 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConvertPolicy tells ChangeType what to do with values that
+// cannot be converted to the new type.
+type ConvertPolicy int
+
+const (
+	// ConvertError fails the change; nothing is changed.
+	ConvertError ConvertPolicy = iota
+
+	// ConvertNull sets the value to nil.
+	ConvertNull
+
+	// ConvertKeep leaves the value as it is.
+	ConvertKeep
+)
+
+// Drop removes columns and their values from every row. A column
+// that a computed column (that is not dropped too) refers to
+// cannot be dropped.
+func (c *Cols) Drop(names ...string) error {
+	drop := make([]bool, len(c.Columns))
+	for _, name := range names {
+		j := c.namePolicy.find(c.Columns, name)
+		if j < 0 {
+			return fmt.Errorf("column not found: %s", name)
+		}
+		drop[j] = true
+	}
+
+	for j := 0; j < len(c.Columns); j++ {
+		cc := c.Columns[j].computed
+		if drop[j] || cc == nil {
+			continue
+		}
+		for k := 0; k < len(c.Columns); k++ {
+			if drop[k] && containsString(cc.deps, c.Columns[k].Name) {
+				return fmt.Errorf("column %s is used by computed column %s", c.Columns[k].Name, c.Columns[j].Name)
+			}
+		}
+	}
+
+	var kept []Column
+	var dropped []string
+	for j := 0; j < len(c.Columns); j++ {
+		if drop[j] {
+			dropped = append(dropped, c.Columns[j].Name)
+		} else {
+			kept = append(kept, c.Columns[j])
+		}
+	}
+
+	c.Columns = kept
+	c.Rows.SetColumns(c.Columns)
+	removeRowKeys(c.Rows, dropped)
+
+	return nil
+}
+
+// Rename changes the name of a column, in every row and in the
+// computed columns that refer to it.
+func (c *Cols) Rename(oldName string, newName string) error {
+	j := c.namePolicy.find(c.Columns, oldName)
+	if j < 0 {
+		return fmt.Errorf("column not found: %s", oldName)
+	}
+	newName = c.namePolicy.name(newName)
+	if newName == "" {
+		return errors.New("column name is blank")
+	}
+	if newName == row_id {
+		return fmt.Errorf("%s is a reserved column name", newName)
+	}
+	if k := c.namePolicy.find(c.Columns, newName); k >= 0 && k != j {
+		return errors.New("column already exists")
+	}
+
+	if c.Columns[j].Name == newName {
+		return nil
+	}
+
+	names := columnNames(c.Columns)
+	names[j] = newName
+	return c.renameColumns(names)
+}
+
+// renameColumns gives the columns the names in names (one per
+// column, checked by the caller), in the rows and in the computed
+// columns, all at once.
+func (c *Cols) renameColumns(names []string) error {
+	renamed := make(map[string]string)
+	cols := make([]Column, len(c.Columns))
+	copy(cols, c.Columns)
+	for j := 0; j < len(cols); j++ {
+		if cols[j].Name != names[j] {
+			renamed[cols[j].Name] = names[j]
+			cols[j].Name = names[j]
+		}
+	}
+	if len(renamed) == 0 {
+		return nil
+	}
+
+	// the expressions are rewritten, and parsed again
+	for k := 0; k < len(cols); k++ {
+		cc := cols[k].computed
+		if cc == nil || cc.fn != nil {
+			continue
+		}
+		n, err := newComputedExpr(cols, cc.renameSource(renamed))
+		if err != nil {
+			return fmt.Errorf("computed column %s: %v", cols[k].Name, err)
+		}
+		n.seq = cc.seq
+		cols[k].computed = n
+	}
+
+	switch r := c.Rows.(type) {
+	case *Rows:
+		rows := r.GetRows()
+		vals := make(map[string]interface{}, len(renamed))
+		for i := 0; i < len(rows); i++ {
+			for old := range renamed {
+				if v, ok := rows[i][old]; ok {
+					vals[old] = v
+					delete(rows[i], old)
+				}
+			}
+			for old, v := range vals {
+				rows[i][renamed[old]] = v
+				delete(vals, old)
+			}
+		}
+	case *ColumnarRows:
+		r.flush()
+		vectors := make(map[string]*columnVector, len(renamed))
+		for old := range renamed {
+			vectors[renamed[old]] = r.vectorOf(old)
+			delete(r.vectors, old)
+		}
+		for name, v := range vectors {
+			r.vectors[name] = v
+		}
+	}
+
+	c.Columns = cols
+	c.Rows.SetColumns(c.Columns)
+
+	return nil
+}
+
+// Move moves a column to position pos (0 is the first column).
+func (c *Cols) Move(name string, pos int) error {
+	j := c.namePolicy.find(c.Columns, name)
+	if j < 0 {
+		return fmt.Errorf("column not found: %s", name)
+	}
+	if pos < 0 || pos >= len(c.Columns) {
+		return errors.New("invalid columns position")
+	}
+
+	cols := make([]Column, 0, len(c.Columns))
+	for k := 0; k < len(c.Columns); k++ {
+		if k != j {
+			cols = append(cols, c.Columns[k])
+		}
+	}
+	cols = append(cols[:pos], append([]Column{c.Columns[j]}, cols[pos:]...)...)
+
+	c.Columns = cols
+	c.Rows.SetColumns(c.Columns)
+
+	return nil
+}
+
+// ChangeType sets the type of a column (String, Integer, Float,
+// Bool or DateTime, or an alias such as int64 or text) and converts
+// its values; policy tells what to do with values that cannot be
+// converted. The type of a computed column cannot be changed.
+func (c *Cols) ChangeType(name string, newType string, policy ConvertPolicy) error {
+	j := c.namePolicy.find(c.Columns, name)
+	if j < 0 {
+		return fmt.Errorf("column not found: %s", name)
+	}
+	if err := checkNotComputed(c.Columns, j); err != nil {
+		return err
+	}
+	if policy < ConvertError || policy > ConvertKeep {
+		return fmt.Errorf("unknown convert policy %d", policy)
+	}
+
+	typ := normalizeColType(newType)
+	switch typ {
+	case ColTypeString, ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+	default:
+		return fmt.Errorf("unknown type %s", newType)
+	}
+	name = c.Columns[j].Name
+
+	// convert all values first: a failure changes nothing
+	data := c.GetData(name)
+	for i := 0; i < len(data); i++ {
+		v, err := castValue(data[i], typ)
+		if err != nil {
+			switch policy {
+			case ConvertError:
+				return fmt.Errorf("column %s: row %d: %v", name, i, err)
+			case ConvertNull:
+				v = nil
+			case ConvertKeep:
+				v = data[i]
+			}
+		}
+		data[i] = v
+	}
+
+	c.Columns[j].Type = typ
+	c.Rows.SetColumns(c.Columns)
+
+	// computed columns that depend on the column are computed again
+	var first error
+	for i := 0; i < len(data); i++ {
+		if err := c.Rows.SetValue(i, name, data[i]); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// removeRowKeys deletes keys from the row maps; ColumnarRows drops
+// the vectors of columns in SetColumns.
+func removeRowKeys(rows IRows, keys []string) {
+	r, ok := rows.(*Rows)
+	if !ok || len(keys) == 0 {
+		return
+	}
+	for i := 0; i < len(r.Rows); i++ {
+		for _, k := range keys {
+			delete(r.Rows[i], k)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+// A float with a fraction, or out of the int64 range, does not
+// convert to Integer; the policy decides what happens to it.
+func TestChangeTypeFloatToInteger(t *testing.T) {
+	vals := []interface{}{2.0, 1.5, 1e20, -3.0, "4", "4.5"}
+	for _, tc := range []struct {
+		policy ConvertPolicy
+		want   string
+	}{
+		{ConvertError, ""},
+		{ConvertNull, "[2 <nil> <nil> -3 4 <nil>]"},
+		{ConvertKeep, "[2 1.5 1e+20 -3 4 4.5]"},
+	} {
+		tbl, _ := (&Table{}).Create("t")
+		tbl.Cols.SetColumns([]Column{{Name: "x", Type: ColTypeFloat}})
+		for _, v := range vals {
+			tbl.Rows.New()["x"] = v
+		}
+
+		err := tbl.Cols.ChangeType("x", ColTypeInteger, tc.policy)
+		if tc.policy == ConvertError {
+			if err == nil {
+				t.Fatal("ConvertError: no error")
+			}
+			if got := fmt.Sprint(tbl.Cols.GetData("x")); got != fmt.Sprint(vals) || tbl.Cols.Get()[0].Type != ColTypeFloat {
+				t.Fatalf("ConvertError changed the column: %s", got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("policy %d: %v", tc.policy, err)
+		}
+		if got := fmt.Sprint(tbl.Cols.GetData("x")); got != tc.want {
+			t.Fatalf("policy %d: %s", tc.policy, got)
+		}
+	}
+}
+
+func TestCastValueInteger(t *testing.T) {
+	for _, v := range []interface{}{1.5, 1e20, -1e19, "2.5", uint64(1 << 63)} {
+		if x, err := castValue(v, ColTypeInteger); err == nil {
+			t.Fatalf("%v: got %v", v, x)
+		}
+	}
+	for _, v := range []interface{}{3.0, "3", "3e0", int8(3), uint64(3)} {
+		if x, err := castValue(v, ColTypeInteger); err != nil || x != int64(3) {
+			t.Fatalf("%v: got %v, %v", v, x, err)
+		}
+	}
+}
+
+func TestDropRenameMove(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		for _, c := range []string{"a", "b", "c"} {
+			tbl.Cols.Add(c)
+		}
+		for i, v := range []interface{}{"1", "2", "x"} {
+			row := tbl.Rows.New()
+			row["a"], row["b"], row["c"] = v, i, "c"
+		}
+		if err := tbl.Cols.AddComputed("d", "a || '-' || b"); err != nil {
+			t.Fatal(err)
+		}
+
+		// a column used by a computed column cannot be dropped
+		if err := tbl.Cols.Drop("a"); err == nil {
+			t.Fatalf("storage %d: drop a: no error", storage)
+		}
+		if err := tbl.Cols.Rename("a", "B"); err == nil {
+			t.Fatalf("storage %d: rename to an existing name: no error", storage)
+		}
+		if err := tbl.Cols.Rename("a", row_id); err == nil {
+			t.Fatalf("storage %d: rename to %s: no error", storage, row_id)
+		}
+
+		// the expression follows the rename
+		if err := tbl.Cols.Rename("a", "aa"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Rows.SetValue(0, "aa", "7"); err != nil {
+			t.Fatal(err)
+		}
+		row := tbl.Rows.New()
+		row["aa"], row["b"] = "9", 9
+		if got := fmt.Sprint(tbl.Cols.GetData("d")); got != "[7-0 2-1 x-2 9-9]" {
+			t.Fatalf("storage %d: d after rename %s", storage, got)
+		}
+		if _, ok := tbl.Rows.GetRow(0)["a"]; ok {
+			t.Fatalf("storage %d: row still has key a", storage)
+		}
+
+		if err := tbl.Cols.Move("d", 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Cols.Move("d", 9); err == nil {
+			t.Fatalf("storage %d: move out of range: no error", storage)
+		}
+		if err := tbl.Cols.Drop("c"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tbl.Rows.GetRow(1)["c"]; ok {
+			t.Fatalf("storage %d: row still has key c", storage)
+		}
+		if err := tbl.Cols.Drop("nope"); err == nil {
+			t.Fatalf("storage %d: drop unknown: no error", storage)
+		}
+
+		if got := fmt.Sprint(columnNames(tbl.Cols.Get()), tableValues(tbl)); got != "[d aa b] [[7-0 7 0] [2-1 2 1] [x-2 x 2] [9-9 9 9]]" {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+
+		// a computed column and its source can be dropped together
+		if err := tbl.Cols.Drop("aa", "d"); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(columnNames(tbl.Cols.Get())); got != "[b]" {
+			t.Fatalf("storage %d: columns %s", storage, got)
+		}
+	}
+}
+
+func TestChangeType(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		for _, v := range []interface{}{"1", "2", "x"} {
+			tbl.Rows.New()["a"] = v
+		}
+		if err := tbl.Cols.AddComputed("next", "a || '!'"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tbl.Cols.ChangeType("a", "int", ConvertError); err == nil {
+			t.Fatalf("storage %d: ConvertError: no error", storage)
+		}
+		if got := fmt.Sprint(tbl.Cols.GetData("a")); got != "[1 2 x]" {
+			t.Fatalf("storage %d: a failed change changed %s", storage, got)
+		}
+		if err := tbl.Cols.ChangeType("a", "int", ConvertKeep); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := tbl.Rows.GetValue(0, "a"); v != int64(1) {
+			t.Fatalf("storage %d: ConvertKeep %#v", storage, v)
+		}
+		if v, _ := tbl.Rows.GetValue(2, "a"); v != "x" {
+			t.Fatalf("storage %d: ConvertKeep kept %#v", storage, v)
+		}
+
+		// computed columns that use the column are computed again
+		if err := tbl.Cols.ChangeType("a", "float64", ConvertNull); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(tbl.Cols.GetData("a"), tbl.Cols.GetData("next")); got != "[1 2 <nil>] [1! 2! <nil>]" {
+			t.Fatalf("storage %d: ConvertNull %s", storage, got)
+		}
+		if typ := tbl.Cols.Get()[0].Type; typ != ColTypeFloat {
+			t.Fatalf("storage %d: type %s", storage, typ)
+		}
+
+		for _, c := range []struct{ col, typ string }{{"next", "int"}, {"a", "blob"}, {"nope", "int"}} {
+			if err := tbl.Cols.ChangeType(c.col, c.typ, ConvertNull); err == nil {
+				t.Fatalf("storage %d: %s to %s: no error", storage, c.col, c.typ)
+			}
+		}
+		if err := tbl.Cols.ChangeType("a", "int", ConvertPolicy(9)); err == nil {
+			t.Fatalf("storage %d: unknown policy: no error", storage)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ColumnNamePolicy tells how the column names of a table are
+// matched: by Exists, Lookup and the other Cols methods, by
+// GetValue and SetValue of the rows, and when files are read into
+// the table. Rows are keyed by the name stored in the column.
+type ColumnNamePolicy int
+
+const (
+	// ColumnNamesCaseInsensitive matches names regardless of case
+	// ("State" and "state" are the same column); an exact match
+	// wins. This is the default.
+	ColumnNamesCaseInsensitive ColumnNamePolicy = iota
+
+	// ColumnNamesCaseSensitive matches names exactly ("State" and
+	// "state" are two columns).
+	ColumnNamesCaseSensitive
+
+	// ColumnNamesSnakeCase stores names in snake_case ("First Name"
+	// and "firstName" become first_name) and matches names by their
+	// snake_case form.
+	ColumnNamesSnakeCase
+)
+
+var columnNamePolicies = []string{"case_insensitive", "case_sensitive", "snake_case"}
+
+func (p ColumnNamePolicy) String() string {
+	if p >= 0 && int(p) < len(columnNamePolicies) {
+		return columnNamePolicies[p]
+	}
+	return fmt.Sprintf("ColumnNamePolicy(%d)", int(p))
+}
+
+// parseColumnNamePolicy is the reverse of String; "" is the
+// default policy.
+func parseColumnNamePolicy(s string) (ColumnNamePolicy, error) {
+	if s == "" {
+		return ColumnNamesCaseInsensitive, nil
+	}
+	for i := 0; i < len(columnNamePolicies); i++ {
+		if columnNamePolicies[i] == s {
+			return ColumnNamePolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column name policy %q", s)
+}
+
+func (p ColumnNamePolicy) valid() bool {
+	return p >= 0 && int(p) < len(columnNamePolicies)
+}
+
+// name returns the name a column is stored under.
+func (p ColumnNamePolicy) name(s string) string {
+	if p == ColumnNamesSnakeCase {
+		return snakeCase(s)
+	}
+	return s
+}
+
+// same reports whether two stored names name the same column.
+func (p ColumnNamePolicy) same(a string, b string) bool {
+	if p == ColumnNamesCaseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// find returns the position of the column that name refers to, or
+// -1.
+func (p ColumnNamePolicy) find(cols []Column, name string) int {
+	switch p {
+	case ColumnNamesCaseSensitive:
+		for i := 0; i < len(cols); i++ {
+			if cols[i].Name == name {
+				return i
+			}
+		}
+		return -1
+	case ColumnNamesSnakeCase:
+		for i := 0; i < len(cols); i++ {
+			if cols[i].Name == name {
+				return i
+			}
+		}
+		s := snakeCase(name)
+		for i := 0; i < len(cols); i++ {
+			if cols[i].Name == s {
+				return i
+			}
+		}
+		return -1
+	}
+	return indexOfColumn(cols, name)
+}
+
+// snakeCase converts a name to lower case words joined by '_':
+// "Order Date", "orderDate" and "order-date" become order_date,
+// and "HTTPServer" becomes http_server. Dots (of flattened JSON
+// keys) are kept.
+func snakeCase(s string) string {
+	rs := []rune(strings.TrimSpace(s))
+	var b strings.Builder
+	var last rune
+	sep := false
+
+	for i, r := range rs {
+		if r == '.' {
+			b.WriteRune(r)
+			last, sep = r, false
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			sep = true
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				sep = true
+			}
+		}
+		if sep && last != 0 && last != '.' {
+			b.WriteByte('_')
+		}
+		r = unicode.ToLower(r)
+		b.WriteRune(r)
+		last, sep = r, false
+	}
+
+	return b.String()
+}
+
+// NamePolicy returns the column name policy of the table.
+func (c *Cols) NamePolicy() ColumnNamePolicy {
+	return c.namePolicy
+}
+
+// SetNamePolicy sets the column name policy of the table. With
+// ColumnNamesSnakeCase the existing columns are renamed; names that
+// would name the same column under the policy are an error.
+func (c *Cols) SetNamePolicy(p ColumnNamePolicy) error {
+	if !p.valid() {
+		return fmt.Errorf("unknown column name policy %d", int(p))
+	}
+
+	names := make([]string, len(c.Columns))
+	for j := 0; j < len(c.Columns); j++ {
+		names[j] = p.name(c.Columns[j].Name)
+		if names[j] == "" {
+			return fmt.Errorf("column %q has no %s name", c.Columns[j].Name, p)
+		}
+		if names[j] == row_id {
+			return fmt.Errorf("column %s: %s is a reserved column name", c.Columns[j].Name, row_id)
+		}
+		for k := 0; k < j; k++ {
+			if p.same(names[k], names[j]) {
+				return fmt.Errorf("columns %s and %s have the same %s name", c.Columns[k].Name, c.Columns[j].Name, p)
+			}
+		}
+	}
+
+	// all at once: one by one, a new name could collide with
+	// another column's name under the old policy
+	if err := c.renameColumns(names); err != nil {
+		return err
+	}
+
+	c.namePolicy = p
+	switch r := c.Rows.(type) {
+	case *Rows:
+		r.namePolicy = p
+	case *ColumnarRows:
+		r.namePolicy = p
+	}
+
+	return nil
+}
+
+// Lookup returns the column that name refers to under the column
+// name policy; its Name is the key of the column in the rows.
+func (c *Cols) Lookup(name string) (Column, bool) {
+	j := c.namePolicy.find(c.Columns, name)
+	if j < 0 {
+		return Column{}, false
+	}
+	return c.Columns[j], true
+}
@@ -0,0 +1,204 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"Order Date": "order_date", "orderDate": "order_date", "order-date": "order_date",
+		"HTTPServer": "http_server", "userID": "user_id", "  __x__ ": "x", "addr.city": "addr.city",
+		"Addr.CityName": "addr.city_name", "a1B": "a1_b", "State": "state", "!!": "",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("%q: %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestColumnNamesCaseSensitive(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		if err := tbl.Cols.SetNamePolicy(ColumnNamesCaseSensitive); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.ReadCSV(strings.NewReader("State,state\nA,b\n"), CSVOptions{Header: HeaderPresent}); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(columnNames(tbl.Cols.Get()), tableValues(tbl)); got != "[State state] [[A b]]" {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+		if _, err := tbl.Rows.GetValue(0, "STATE"); err == nil {
+			t.Fatalf("storage %d: STATE found", storage)
+		}
+		if err := tbl.Cols.InsertAt(0, Column{Name: "STATE"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// State and state are one column when case is ignored
+		if err := tbl.Cols.SetNamePolicy(ColumnNamesCaseInsensitive); err == nil {
+			t.Fatalf("storage %d: case-insensitive policy: no error", storage)
+		}
+	}
+}
+
+func TestColumnNamesSnakeCase(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("First Name")
+		tbl.Rows.New()["First Name"] = "x"
+		if err := tbl.Cols.AddComputed("Greeting", `'hi ' || "First Name"`); err != nil {
+			t.Fatal(err)
+		}
+
+		// the columns are renamed, in the expressions too
+		if err := tbl.Cols.SetNamePolicy(ColumnNamesSnakeCase); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(columnNames(tbl.Cols.Get())); got != "[first_name greeting]" {
+			t.Fatalf("storage %d: columns %s", storage, got)
+		}
+		if err := tbl.Rows.SetValue(0, "firstName", "y"); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := tbl.Rows.GetValue(0, "Greeting"); v != "hi y" {
+			t.Fatalf("storage %d: greeting %v", storage, v)
+		}
+
+		// names read from files are matched by their snake_case form
+		if err := tbl.ReadCSV(strings.NewReader("FirstName,Last Name\nz,q\n"), CSVOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.ReadJSON(strings.NewReader(`[{"lastName":"w","Zip Code":1}]`), JSONReadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		want := "[first_name greeting last_name zip_code] [[y hi y <nil> <nil>] [z hi z q <nil>] [<nil> <nil> w 1]]"
+		if got := fmt.Sprint(columnNames(tbl.Cols.Get()), tableValues(tbl)); got != want {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+
+		if c, ok := tbl.Cols.Lookup("Zip-Code"); !ok || c.Name != "zip_code" {
+			t.Fatalf("storage %d: Lookup %v", storage, c)
+		}
+		if !tbl.Cols.Exists("LAST NAME") {
+			t.Fatalf("storage %d: LAST NAME not found", storage)
+		}
+		if c := tbl.Cols.Add("Some Thing"); c == nil || c.Name != "some_thing" {
+			t.Fatalf("storage %d: Add %v", storage, c)
+		}
+	}
+}
+
+// The policy is kept by the JSON and binary formats.
+func TestColumnNamePolicyPersisted(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	if err := tbl.Cols.SetNamePolicy(ColumnNamesSnakeCase); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Cols.Add("Last Name")
+	tbl.Rows.New()["last_name"] = "q"
+
+	b, err := json.Marshal(tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"columnNames":"snake_case"`) {
+		t.Fatalf("json %s", b)
+	}
+	var fromJSON Table
+	if err := json.Unmarshal(b, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if fromJSON.Cols.NamePolicy() != ColumnNamesSnakeCase {
+		t.Fatalf("json policy %s", fromJSON.Cols.NamePolicy())
+	}
+
+	data, err := encodeTable(tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBinary, err := decodeTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromBinary.Cols.NamePolicy() != ColumnNamesSnakeCase {
+		t.Fatalf("binary policy %s", fromBinary.Cols.NamePolicy())
+	}
+	if v, _ := fromBinary.Rows.GetValue(0, "Last Name"); v != "q" {
+		t.Fatalf("binary value %v", v)
+	}
+}
+
+// Add and InsertAt do not add a column that the name policy says
+// already exists.
+func TestAddNameCollisions(t *testing.T) {
+	for _, tc := range []struct {
+		policy ColumnNamePolicy
+		names  []string
+		want   string
+	}{
+		{ColumnNamesCaseInsensitive, []string{"state", "State", "STATE", "city"}, "[state city]"},
+		{ColumnNamesCaseSensitive, []string{"state", "State", "state"}, "[state State]"},
+		{ColumnNamesSnakeCase, []string{"First Name", "firstName", "first_name", "x"}, "[first_name x]"},
+	} {
+		tbl, _ := (&Table{}).Create("t")
+		if err := tbl.Cols.SetNamePolicy(tc.policy); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range tc.names {
+			tbl.Cols.Add(n)
+		}
+		if tc.policy != ColumnNamesSnakeCase && tbl.Cols.Add(row_id) != nil {
+			t.Fatalf("%s: %s was added", tc.policy, row_id)
+		}
+		if got := fmt.Sprint(columnNames(tbl.Cols.Get())); got != tc.want {
+			t.Fatalf("%s: %s", tc.policy, got)
+		}
+		if err := tbl.Cols.InsertAt(0, Column{Name: tc.names[1], Type: ColTypeString}); err == nil && tc.policy != ColumnNamesCaseSensitive {
+			t.Fatalf("%s: InsertAt %s: no error", tc.policy, tc.names[1])
+		}
+	}
+}
+
+// SetNamePolicy renames all columns at once: names that are the same
+// under the old policy but not under the new one are fine, and a
+// failure renames nothing.
+func TestSetNamePolicyAllOrNothing(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("fooBar")
+	tbl.Cols.SetColumns(append(tbl.Cols.Get(), Column{Name: "Foo_BaR", Type: "string"}))
+	row := tbl.Rows.New()
+	row["fooBar"], row["Foo_BaR"] = 1, 2
+	if err := tbl.Cols.AddComputed("sum", "fooBar + Foo_BaR"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tbl.Cols.SetNamePolicy(ColumnNamesSnakeCase); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(columnNames(tbl.Cols.Get()), tableValues(tbl)); got != "[foo_bar foo_ba_r sum] [[1 2 3]]" {
+		t.Fatal(got)
+	}
+	if err := tbl.Rows.SetValue(0, "foo_bar", 5); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tbl.Rows.GetValue(0, "sum"); v != int64(7) {
+		t.Fatalf("sum = %v", v)
+	}
+
+	tbl, _ = (&Table{}).Create("t")
+	tbl.Cols.SetNamePolicy(ColumnNamesCaseSensitive)
+	tbl.Cols.Add("aB")
+	tbl.Cols.Add("a b")
+	tbl.Cols.Add("A_B")
+	if err := tbl.Cols.SetNamePolicy(ColumnNamesSnakeCase); err == nil {
+		t.Fatal("no error")
+	}
+	if got := fmt.Sprint(columnNames(tbl.Cols.Get())); got != "[aB a b A_B]" || tbl.Cols.NamePolicy() != ColumnNamesCaseSensitive {
+		t.Fatalf("changed: %s %s", got, tbl.Cols.NamePolicy())
+	}
+}
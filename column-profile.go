@@ -0,0 +1,443 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ProfileOptions configures Cols.Profile and Table.Profile. The
+// zero value uses the defaults.
+type ProfileOptions struct {
+	// TopK is the number of most frequent values; default 10.
+	TopK int
+
+	// Bins is the number of histogram bins; default 10.
+	Bins int
+
+	// NullTokens are the strings that count as NULL (see
+	// InferOptions); default "", "NA", "N/A" and "null".
+	NullTokens []string
+}
+
+// ColumnProfile holds the statistics of a column.
+type ColumnProfile struct {
+	Column string
+
+	// Type is the type of the column, and InferredType the type
+	// its values have (see InferTypes).
+	Type         string
+	InferredType string
+
+	// Distinct counts the values by their text, so 1 and "1" are
+	// one value (as in GetDataDistinct and the sketches).
+	Count    int
+	Nulls    int
+	Distinct int
+
+	// Min and Max are numbers for numeric columns, times for date
+	// columns, and text otherwise.
+	Min interface{}
+	Max interface{}
+
+	// Numbers is the number of numeric values; Mean, Median and
+	// StdDev (the sample standard deviation) are computed from
+	// them, and Histogram has Bins equal-width bins over them.
+	Numbers   int
+	Mean      float64
+	Median    float64
+	StdDev    float64
+	Histogram []HistogramBin
+
+	// TopValues are the most frequent values, most frequent first.
+	TopValues []ValueCount
+
+	// MinLength, MaxLength and MeanLength are the lengths (in
+	// characters) of the values as text; LengthHistogram is their
+	// distribution.
+	MinLength       int
+	MaxLength       int
+	MeanLength      float64
+	LengthHistogram []HistogramBin
+}
+
+// ValueCount is a value and the number of times it occurs.
+type ValueCount struct {
+	Value interface{}
+	Count int
+}
+
+// HistogramBin counts the values from Low up to High (the last bin
+// includes High).
+type HistogramBin struct {
+	Low   float64
+	High  float64
+	Count int
+}
+
+// profileMinParallel is the number of values from which a column
+// is profiled in parallel.
+const profileMinParallel = 100000
+
+// profileAcc accumulates the statistics of a part of a column.
+type profileAcc struct {
+	count, nulls int
+	kinds        [inferKinds]int
+	// values by their text (as the sketches and GetDataDistinct
+	// compare them), with the first value of each text
+	distinct map[string]ValueCount
+
+	// numbers: Welford mean and sum of squares
+	nums       []float64
+	mean, m2   float64
+	minF, maxF float64
+
+	minT, maxT time.Time
+	hasT       bool
+
+	minS, maxS string
+	lens       map[int]int
+	sumLen     int
+}
+
+func newProfileAcc() *profileAcc {
+	return &profileAcc{distinct: map[string]ValueCount{}, lens: map[int]int{}}
+}
+
+func (a *profileAcc) add(v interface{}, opts *InferOptions) {
+	a.count++
+	if isInferNull(v, opts) {
+		a.nulls++
+		return
+	}
+
+	kind, f, t := classifyValue(v, nil)
+	a.kinds[kind]++
+
+	switch kind {
+	case inferInt, inferFloat:
+		if len(a.nums) == 0 || f < a.minF {
+			a.minF = f
+		}
+		if len(a.nums) == 0 || f > a.maxF {
+			a.maxF = f
+		}
+		a.nums = append(a.nums, f)
+		d := f - a.mean
+		a.mean += d / float64(len(a.nums))
+		a.m2 += d * (f - a.mean)
+	case inferTime:
+		if !a.hasT || t.Before(a.minT) {
+			a.minT = t
+		}
+		if !a.hasT || t.After(a.maxT) {
+			a.maxT = t
+		}
+		a.hasT = true
+	}
+
+	s := toString(v)
+	vc, ok := a.distinct[s]
+	if !ok {
+		vc.Value = v
+	}
+	vc.Count++
+	a.distinct[s] = vc
+
+	if a.count-a.nulls == 1 || s < a.minS {
+		a.minS = s
+	}
+	if a.count-a.nulls == 1 || s > a.maxS {
+		a.maxS = s
+	}
+	n := utf8.RuneCountInString(s)
+	a.lens[n]++
+	a.sumLen += n
+}
+
+// merge adds the statistics of b to a.
+func (a *profileAcc) merge(b *profileAcc) {
+	nonNull := a.count - a.nulls
+	a.count += b.count
+	a.nulls += b.nulls
+	for k := 0; k < inferKinds; k++ {
+		a.kinds[k] += b.kinds[k]
+	}
+	for s, bc := range b.distinct {
+		vc, ok := a.distinct[s]
+		if !ok {
+			vc.Value = bc.Value
+		}
+		vc.Count += bc.Count
+		a.distinct[s] = vc
+	}
+
+	if len(b.nums) > 0 {
+		na, nb := float64(len(a.nums)), float64(len(b.nums))
+		if len(a.nums) == 0 || b.minF < a.minF {
+			a.minF = b.minF
+		}
+		if len(a.nums) == 0 || b.maxF > a.maxF {
+			a.maxF = b.maxF
+		}
+		d := b.mean - a.mean
+		a.mean += d * nb / (na + nb)
+		a.m2 += b.m2 + d*d*na*nb/(na+nb)
+		a.nums = append(a.nums, b.nums...)
+	}
+
+	if b.hasT {
+		if !a.hasT || b.minT.Before(a.minT) {
+			a.minT = b.minT
+		}
+		if !a.hasT || b.maxT.After(a.maxT) {
+			a.maxT = b.maxT
+		}
+		a.hasT = true
+	}
+
+	if b.count > b.nulls {
+		if nonNull == 0 || b.minS < a.minS {
+			a.minS = b.minS
+		}
+		if nonNull == 0 || b.maxS > a.maxS {
+			a.maxS = b.maxS
+		}
+	}
+	for n, c := range b.lens {
+		a.lens[n] += c
+	}
+	a.sumLen += b.sumLen
+}
+
+// Profile computes the statistics of a column in one pass over its
+// values; large columns are split across goroutines. The median and
+// the histogram need the numbers of the column, which are kept (8
+// bytes each) until the end; Sketch estimates quantiles in fixed
+// memory instead.
+func (c *Cols) Profile(colName string, opts ...ProfileOptions) (ColumnProfile, error) {
+	j := c.namePolicy.find(c.Columns, colName)
+	if j < 0 {
+		return ColumnProfile{}, errors.New("column not found: " + colName)
+	}
+
+	var o ProfileOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.TopK <= 0 {
+		o.TopK = 10
+	}
+	if o.Bins <= 0 {
+		o.Bins = 10
+	}
+	inf := &InferOptions{NullTokens: o.NullTokens}
+	if inf.NullTokens == nil {
+		inf.NullTokens = []string{"", "NA", "N/A", "null"}
+	}
+
+	data := c.GetData(c.Columns[j].Name)
+	a := profileData(data, inf)
+
+	p := ColumnProfile{
+		Column:   c.Columns[j].Name,
+		Type:     c.Columns[j].Type,
+		Count:    a.count,
+		Nulls:    a.nulls,
+		Distinct: len(a.distinct),
+		Numbers:  len(a.nums),
+	}
+
+	nonNull := a.count - a.nulls
+	if nonNull == 0 {
+		return p, nil
+	}
+	p.InferredType, _, _ = pickInferType(&a.kinds, nonNull, 1)
+
+	switch p.InferredType {
+	case ColTypeInteger:
+		p.Min, p.Max = int64(a.minF), int64(a.maxF)
+	case ColTypeFloat:
+		p.Min, p.Max = a.minF, a.maxF
+	case ColTypeDateTime:
+		p.Min, p.Max = a.minT, a.maxT
+	default:
+		p.Min, p.Max = a.minS, a.maxS
+	}
+
+	if len(a.nums) > 0 {
+		p.Mean = a.mean
+		if len(a.nums) > 1 {
+			p.StdDev = math.Sqrt(a.m2 / float64(len(a.nums)-1))
+		}
+		sort.Float64s(a.nums)
+		if m := len(a.nums) / 2; len(a.nums)%2 == 1 {
+			p.Median = a.nums[m]
+		} else {
+			p.Median = (a.nums[m-1] + a.nums[m]) / 2
+		}
+		p.Histogram = histogram(a.nums, a.minF, a.maxF, o.Bins, nil)
+	}
+
+	p.TopValues = topValues(a.distinct, o.TopK)
+
+	p.MinLength, p.MaxLength = -1, 0
+	for n := range a.lens {
+		if p.MinLength < 0 || n < p.MinLength {
+			p.MinLength = n
+		}
+		if n > p.MaxLength {
+			p.MaxLength = n
+		}
+	}
+	p.MeanLength = float64(a.sumLen) / float64(nonNull)
+	p.LengthHistogram = histogram(nil, float64(p.MinLength), float64(p.MaxLength), minInt(o.Bins, p.MaxLength-p.MinLength+1), a.lens)
+
+	return p, nil
+}
+
+// profileData accumulates the values, in parallel for large columns.
+func profileData(data []interface{}, opts *InferOptions) *profileAcc {
+	workers := runtime.NumCPU()
+	if len(data) < profileMinParallel || workers < 2 {
+		a := newProfileAcc()
+		for i := 0; i < len(data); i++ {
+			a.add(data[i], opts)
+		}
+		return a
+	}
+
+	parts := make([]*profileAcc, workers)
+	size := (len(data) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		from, to := w*size, minInt((w+1)*size, len(data))
+		parts[w] = newProfileAcc()
+		if from >= to {
+			continue
+		}
+		wg.Add(1)
+		go func(a *profileAcc, part []interface{}) {
+			defer wg.Done()
+			for i := 0; i < len(part); i++ {
+				a.add(part[i], opts)
+			}
+		}(parts[w], data[from:to])
+	}
+	wg.Wait()
+
+	for w := 1; w < workers; w++ {
+		parts[0].merge(parts[w])
+	}
+	return parts[0]
+}
+
+// histogram counts nums (or, when nums is nil, the values of the
+// counts map) in equal-width bins from min to max.
+func histogram(nums []float64, min, max float64, bins int, counts map[int]int) []HistogramBin {
+	if max == min {
+		bins = 1
+	}
+	width := (max - min) / float64(bins)
+
+	h := make([]HistogramBin, bins)
+	for b := 0; b < bins; b++ {
+		h[b].Low = min + float64(b)*width
+		h[b].High = min + float64(b+1)*width
+	}
+	h[bins-1].High = max
+
+	bin := func(f float64) int {
+		if width == 0 {
+			return 0
+		}
+		return minInt(int((f-min)/width), bins-1)
+	}
+	for _, f := range nums {
+		h[bin(f)].Count++
+	}
+	for n, c := range counts {
+		h[bin(float64(n))].Count += c
+	}
+
+	return h
+}
+
+// topValues returns the k most frequent values; ties are ordered
+// by their text.
+func topValues(distinct map[string]ValueCount, k int) []ValueCount {
+	all := make([]ValueCount, 0, len(distinct))
+	for _, vc := range distinct {
+		all = append(all, vc)
+	}
+	sort.Slice(all, func(x, y int) bool {
+		if all[x].Count != all[y].Count {
+			return all[x].Count > all[y].Count
+		}
+		return toString(all[x].Value) < toString(all[y].Value)
+	})
+	if len(all) > k {
+		all = all[:k]
+	}
+	return all
+}
+
+// Profile returns a table with the statistics of each column (see
+// Cols.Profile), one row per column.
+func (t *Table) Profile(opts ...ProfileOptions) (*Table, error) {
+	if t.Cols == nil || t.Rows == nil {
+		return nil, errors.New("table is not initialized")
+	}
+
+	cols := []Column{
+		{Name: "column", Type: ColTypeString},
+		{Name: "type", Type: ColTypeString},
+		{Name: "inferred_type", Type: ColTypeString},
+		{Name: "count", Type: ColTypeInteger},
+		{Name: "nulls", Type: ColTypeInteger},
+		{Name: "distinct", Type: ColTypeInteger},
+		{Name: "min", Type: "interface {}"},
+		{Name: "max", Type: "interface {}"},
+		{Name: "mean", Type: ColTypeFloat},
+		{Name: "median", Type: ColTypeFloat},
+		{Name: "stddev", Type: ColTypeFloat},
+		{Name: "min_length", Type: ColTypeInteger},
+		{Name: "max_length", Type: ColTypeInteger},
+		{Name: "mean_length", Type: ColTypeFloat},
+		{Name: "top_values", Type: "interface {}"},
+		{Name: "histogram", Type: "interface {}"},
+		{Name: "length_histogram", Type: "interface {}"},
+	}
+
+	var vals [][]interface{}
+	for _, col := range t.Cols.Get() {
+		p, err := t.Cols.Profile(col.Name, opts...)
+		if err != nil {
+			return nil, err
+		}
+		row := []interface{}{p.Column, p.Type, p.InferredType, int64(p.Count), int64(p.Nulls), int64(p.Distinct), p.Min, p.Max,
+			nil, nil, nil, nil, nil, nil, p.TopValues, p.Histogram, p.LengthHistogram}
+		if p.Numbers > 0 {
+			row[8], row[9] = p.Mean, p.Median
+			if p.Numbers > 1 {
+				row[10] = p.StdDev
+			}
+		}
+		if p.Count > p.Nulls {
+			row[11], row[12], row[13] = int64(p.MinLength), int64(p.MaxLength), p.MeanLength
+		}
+		vals = append(vals, row)
+	}
+
+	tbl, err := (&Table{}).Create(t.Name)
+	if err != nil {
+		return nil, err
+	}
+	return fillTable(tbl, cols, vals), nil
+}
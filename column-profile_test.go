@@ -0,0 +1,172 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Values with the same text are one distinct value, as for the
+// sketches and GetDataDistinct.
+func TestProfileDistinctByText(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("v")
+	for _, v := range []interface{}{int(1), int64(1), "1", 2.5, "2.5", "a", nil} {
+		tbl.Rows.New()["v"] = v
+	}
+
+	p, err := tbl.Cols.Profile("v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dist, _ := tbl.Cols.GetDataDistinct("v")
+	s, err := tbl.Cols.Sketch("v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Distinct != 3 || len(dist) != 4 || s.Distinct.Count() != 3 {
+		t.Fatalf("profile %d, GetDataDistinct %d (with NULL), sketch %d", p.Distinct, len(dist), s.Distinct.Count())
+	}
+	if top := p.TopValues[0]; top.Value != int(1) || top.Count != 3 {
+		t.Fatalf("top value %v", top)
+	}
+}
+
+func TestGetOccurrenceMatrix(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("v")
+	for _, v := range []interface{}{"a", 1, "b", "a", int64(1), "a"} {
+		tbl.Rows.New()["v"] = v
+	}
+
+	m, _ := (&Table{}).Create("m")
+	tbl.Cols.GetOccurrenceMatrix("v", m)
+	if got := fmt.Sprint(tableValues(m)); got != "[[v a 3 0.5 0] [v 1 2 0.5 0] [v b 1 0.5 1]]" {
+		t.Fatal(got)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		for _, c := range []string{"n", "s", "d"} {
+			tbl.Cols.Add(c)
+		}
+		for _, r := range [][]interface{}{
+			{"1", "apple", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{2, "kiwi", "2020-03-01"},
+			{"NA", "apple", nil},
+			{4.5, "", "2019-05-05"},
+			{2, "fig", "2021-01-01"},
+		} {
+			row := tbl.Rows.New()
+			row["n"], row["s"], row["d"] = r[0], r[1], r[2]
+		}
+
+		p, err := tbl.Cols.Profile("n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Column != "n" || p.Count != 5 || p.Nulls != 1 || p.Distinct != 3 || p.InferredType != ColTypeFloat || p.Numbers != 4 {
+			t.Fatalf("storage %d: counts %+v", storage, p)
+		}
+		if p.Min != 1.0 || p.Max != 4.5 || p.Mean != 2.375 || p.Median != 2 || math.Abs(p.StdDev-1.4930394) > 1e-6 {
+			t.Fatalf("storage %d: stats %+v", storage, p)
+		}
+		if top := p.TopValues[0]; top.Value != 2 || top.Count != 2 {
+			t.Fatalf("storage %d: top value %+v", storage, top)
+		}
+		n := 0
+		for _, b := range p.Histogram {
+			n += b.Count
+		}
+		if n != 4 || p.Histogram[0].Low != 1 || p.Histogram[len(p.Histogram)-1].High != 4.5 {
+			t.Fatalf("storage %d: histogram %+v", storage, p.Histogram)
+		}
+
+		// "" is a NULL token
+		p, err = tbl.Cols.Profile("s", ProfileOptions{TopK: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Nulls != 1 || p.Min != "apple" || p.Max != "kiwi" || p.MinLength != 3 || p.MaxLength != 5 || p.MeanLength != 4.25 ||
+			len(p.TopValues) != 1 || p.TopValues[0].Value != "apple" || p.InferredType != ColTypeString || p.Numbers != 0 {
+			t.Fatalf("storage %d: strings %+v", storage, p)
+		}
+
+		p, err = tbl.Cols.Profile("d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.InferredType != ColTypeDateTime || p.Min.(time.Time).Year() != 2019 || p.Max.(time.Time).Year() != 2021 {
+			t.Fatalf("storage %d: dates %+v", storage, p)
+		}
+
+		if _, err := tbl.Cols.Profile("zz"); err == nil {
+			t.Fatalf("storage %d: unknown column: no error", storage)
+		}
+	}
+}
+
+func TestTableProfile(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("n")
+	tbl.Cols.Add("s")
+	for _, r := range [][]interface{}{{1, "a"}, {2, nil}, {nil, "bb"}} {
+		row := tbl.Rows.New()
+		row["n"], row["s"] = r[0], r[1]
+	}
+
+	pt, err := tbl.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.Rows.Count() != 2 || pt.Cols.Count() != 17 {
+		t.Fatalf("%d rows, %d columns", pt.Rows.Count(), pt.Cols.Count())
+	}
+	var got []string
+	for _, r := range pt.Rows.GetRows() {
+		got = append(got, fmt.Sprintf("%v %v %v %v %v %v %v", r["column"], r["inferred_type"], r["count"], r["nulls"], r["distinct"], r["mean"], r["max_length"]))
+	}
+	if s := strings.Join(got, "; "); s != "n Integer 3 1 2 1.5 1; s String 3 1 2 <nil> 2" {
+		t.Fatalf("profile %s", s)
+	}
+
+	var buf bytes.Buffer
+	if err := pt.Render(&buf, RenderASCII, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A large column is profiled in parallel; the result is the same as
+// profiling it in one pass.
+func TestProfileParallel(t *testing.T) {
+	tbl, _ := (&Table{}).Create("big", ColumnStorage)
+	tbl.Cols.Add("x")
+	for i := 0; i < 2*profileMinParallel; i++ {
+		row := tbl.Rows.New()
+		if i%10 != 0 {
+			row["x"] = i % 1000
+		}
+	}
+
+	p, err := tbl.Cols.Profile("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newProfileAcc()
+	opts := &InferOptions{NullTokens: []string{""}}
+	for _, v := range tbl.Cols.GetData("x") {
+		a.add(v, opts)
+	}
+	sd := math.Sqrt(a.m2 / float64(len(a.nums)-1))
+	if p.Nulls != profileMinParallel/5 || p.Distinct != len(a.distinct) || math.Abs(p.Mean-a.mean) > 1e-9 ||
+		math.Abs(p.StdDev-sd) > 1e-6 || p.Min != int64(1) || p.Max != int64(999) {
+		t.Fatalf("parallel %+v, one pass mean %v stddev %v", p, a.mean, sd)
+	}
+}
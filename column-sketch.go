@@ -0,0 +1,191 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+)
+
+// SketchOptions sizes the sketches of Cols.Sketch; zero values take
+// the defaults of NewHyperLogLog, NewCountMinSketch and NewTDigest.
+// Sketches merge only when built with the same Precision, Epsilon
+// and Delta.
+type SketchOptions struct {
+	Precision   uint8
+	Epsilon     float64
+	Delta       float64
+	Compression float64
+
+	// NullTokens are strings counted as NULL (besides nil); the
+	// default is "", "NA", "N/A" and "null".
+	NullTokens []string
+}
+
+// ColumnSketch summarizes a column in fixed memory: distinct values,
+// value frequencies and quantiles of its numbers. Sketches of the
+// same column in different tables can be merged.
+type ColumnSketch struct {
+	Column string
+	Count  uint64
+	Nulls  uint64
+
+	Distinct    *HyperLogLog
+	Frequencies *CountMinSketch
+	Quantiles   *TDigest
+}
+
+// NewColumnSketch returns an empty sketch for a column.
+func NewColumnSketch(colName string, opts ...SketchOptions) (*ColumnSketch, error) {
+	var o SketchOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	hll, err := NewHyperLogLog(o.Precision)
+	if err != nil {
+		return nil, err
+	}
+	cms, err := NewCountMinSketch(o.Epsilon, o.Delta)
+	if err != nil {
+		return nil, err
+	}
+	td, err := NewTDigest(o.Compression)
+	if err != nil {
+		return nil, err
+	}
+	return &ColumnSketch{Column: colName, Distinct: hll, Frequencies: cms, Quantiles: td}, nil
+}
+
+// Sketch reads a column once into a ColumnSketch.
+func (c *Cols) Sketch(colName string, opts ...SketchOptions) (*ColumnSketch, error) {
+	j := c.namePolicy.find(c.Columns, colName)
+	if j < 0 {
+		return nil, errors.New("column not found: " + colName)
+	}
+
+	var o SketchOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	s, err := NewColumnSketch(c.Columns[j].Name, o)
+	if err != nil {
+		return nil, err
+	}
+	inf := &InferOptions{NullTokens: o.NullTokens}
+	if inf.NullTokens == nil {
+		inf.NullTokens = []string{"", "NA", "N/A", "null"}
+	}
+
+	for _, v := range c.GetData(c.Columns[j].Name) {
+		s.add(v, inf)
+	}
+	return s, nil
+}
+
+// ApproxDistinct estimates the number of distinct non-NULL values
+// of a column; see GetDataDistinct for the exact values.
+func (c *Cols) ApproxDistinct(colName string) (uint64, error) {
+	j := c.namePolicy.find(c.Columns, colName)
+	if j < 0 {
+		return 0, errors.New("column not found: " + colName)
+	}
+	hll, _ := NewHyperLogLog(0)
+	for _, v := range c.GetData(c.Columns[j].Name) {
+		hll.Add(v)
+	}
+	return hll.Count(), nil
+}
+
+// Add adds a value; nil is counted as NULL.
+func (s *ColumnSketch) Add(v interface{}) {
+	s.add(v, &InferOptions{})
+}
+
+func (s *ColumnSketch) add(v interface{}, opts *InferOptions) {
+	s.Count++
+	if isInferNull(v, opts) {
+		s.Nulls++
+		return
+	}
+	s.Distinct.Add(v)
+	s.Frequencies.Add(v)
+	if k, f, _ := classifyValue(v, nil); k == inferInt || k == inferFloat {
+		s.Quantiles.Add(f)
+	}
+}
+
+// Merge adds the values seen by o, e.g. the same column of another
+// table.
+func (s *ColumnSketch) Merge(o *ColumnSketch) error {
+	if o == nil {
+		return nil
+	}
+	if err := s.Distinct.Merge(o.Distinct); err != nil {
+		return err
+	}
+	if err := s.Frequencies.Merge(o.Frequencies); err != nil {
+		return err
+	}
+	if err := s.Quantiles.Merge(o.Quantiles); err != nil {
+		return err
+	}
+	s.Count += o.Count
+	s.Nulls += o.Nulls
+	return nil
+}
+
+// MarshalBinary encodes the sketch.
+func (s *ColumnSketch) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.buf.Write([]byte{'S', sketchVersion})
+	w.str(s.Column)
+	w.uvarint(s.Count)
+	w.uvarint(s.Nulls)
+	for _, m := range []encoding.BinaryMarshaler{s.Distinct, s.Frequencies, s.Quantiles} {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		w.bytes(b)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a sketch written by MarshalBinary.
+func (s *ColumnSketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != 'S' {
+		return errors.New("not a ColumnSketch")
+	}
+	if data[1] != sketchVersion {
+		return fmt.Errorf("unsupported format version %d", data[1])
+	}
+	r := &binaryReader{data: data, pos: 2}
+
+	var n ColumnSketch
+	var err error
+	if n.Column, err = r.str(); err != nil {
+		return err
+	}
+	if n.Count, err = r.uvarint(); err != nil {
+		return err
+	}
+	if n.Nulls, err = r.uvarint(); err != nil {
+		return err
+	}
+	n.Distinct, n.Frequencies, n.Quantiles = &HyperLogLog{}, &CountMinSketch{}, &TDigest{}
+	for _, u := range []encoding.BinaryUnmarshaler{n.Distinct, n.Frequencies, n.Quantiles} {
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		if err := u.UnmarshalBinary(b); err != nil {
+			return err
+		}
+	}
+	if r.pos != len(data) {
+		return errors.New("corrupt ColumnSketch")
+	}
+
+	*s = n
+	return nil
+}
@@ -0,0 +1,106 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"math"
+	"testing"
+)
+
+func TestColumnSketch(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		// the same column in two tables, named differently
+		a, _ := (&Table{}).Create("a", storage)
+		b, _ := (&Table{}).Create("b", storage)
+		a.Cols.Add("x")
+		b.Cols.Add("X")
+		for i := 0; i < 60000; i++ {
+			tbl, col := a, "x"
+			if i%2 == 1 {
+				tbl, col = b, "X"
+			}
+			row := tbl.Rows.New()
+			if i%100 == 0 {
+				row[col] = "NA"
+			} else {
+				row[col] = i % 20000
+			}
+		}
+
+		sa, err := a.Cols.Sketch("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb, err := b.Cols.Sketch("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sa.Merge(sb); err != nil {
+			t.Fatal(err)
+		}
+
+		if sa.Column != "x" || sa.Count != 60000 || sa.Nulls != 600 {
+			t.Fatalf("storage %d: count %d, nulls %d", storage, sa.Count, sa.Nulls)
+		}
+		if d := float64(sa.Distinct.Count()); math.Abs(d-19800)/19800 > 0.03 {
+			t.Fatalf("storage %d: distinct %v", storage, d)
+		}
+		if n := sa.Frequencies.Count(7); n < 3 || n > 3+uint64(0.001*float64(sa.Frequencies.Total())) {
+			t.Fatalf("storage %d: frequency of 7: %d", storage, n)
+		}
+		if q := sa.Quantiles.Quantile(0.5); math.Abs(q-10000) > 200 {
+			t.Fatalf("storage %d: median %v", storage, q)
+		}
+		if sa.Quantiles.Quantile(0) != 1 || sa.Quantiles.Quantile(1) != 19999 {
+			t.Fatalf("storage %d: min %v, max %v", storage, sa.Quantiles.Quantile(0), sa.Quantiles.Quantile(1))
+		}
+
+		n, err := a.Cols.ApproxDistinct("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(float64(n)-10000)/10000 > 0.03 {
+			t.Fatalf("storage %d: ApproxDistinct %d", storage, n)
+		}
+		if _, err := a.Cols.Sketch("zz"); err == nil {
+			t.Fatalf("storage %d: unknown column: no error", storage)
+		}
+	}
+}
+
+func TestColumnSketchMergeAndBinary(t *testing.T) {
+	s, err := NewColumnSketch("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		s.Add(i % 100)
+	}
+	s.Add(nil)
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back ColumnSketch
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if back.Column != "x" || back.Count != 1001 || back.Nulls != 1 || back.Distinct.Count() != s.Distinct.Count() ||
+		back.Frequencies.Count(7) != s.Frequencies.Count(7) || back.Quantiles.Quantile(0.9) != s.Quantiles.Quantile(0.9) {
+		t.Fatalf("read back %+v", back)
+	}
+	if err := back.UnmarshalBinary(data[:len(data)-3]); err == nil {
+		t.Fatal("truncated: no error")
+	}
+
+	other, err := NewColumnSketch("x", SketchOptions{Precision: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Merge(other); err == nil {
+		t.Fatal("different precision: no error")
+	}
+	if _, err := NewColumnSketch("x", SketchOptions{Compression: 1}); err == nil {
+		t.Fatal("bad compression: no error")
+	}
+}
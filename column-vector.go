@@ -0,0 +1,250 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"time"
+)
+
+// vecKind is the type of the values held by a columnVector.
+type vecKind uint8
+
+const (
+	vecNull vecKind = iota // no value has been set yet
+	vecInt
+	vecInt64
+	vecFloat64
+	vecString
+	vecBool
+	vecTime
+	vecAny
+)
+
+// columnVector holds the values of one column in a typed slice,
+// with a bitmap of the NULLs. The slice type is taken from the
+// first value; when a value of another type is set, the vector
+// falls back to []interface{}. Values keep their Go types.
+type columnVector struct {
+	kind  vecKind
+	n     int
+	nulls []uint64 // bit i is set when value i is nil
+
+	ints   []int
+	int64s []int64
+	floats []float64
+	strs   []string
+	bools  []bool
+	times  []time.Time
+	anys   []interface{}
+}
+
+// newColumnVector creates a vector of n nil values.
+func newColumnVector(n int) *columnVector {
+	v := &columnVector{}
+	for i := 0; i < n; i++ {
+		v.grow()
+	}
+	return v
+}
+
+func vecKindOf(v interface{}) vecKind {
+	switch v.(type) {
+	case nil:
+		return vecNull
+	case int:
+		return vecInt
+	case int64:
+		return vecInt64
+	case float64:
+		return vecFloat64
+	case string:
+		return vecString
+	case bool:
+		return vecBool
+	case time.Time:
+		return vecTime
+	}
+	return vecAny
+}
+
+func (c *columnVector) isNull(i int) bool {
+	return c.nulls[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (c *columnVector) setNull(i int, null bool) {
+	if null {
+		c.nulls[i/64] |= 1 << uint(i%64)
+	} else {
+		c.nulls[i/64] &^= 1 << uint(i%64)
+	}
+}
+
+// grow adds a nil value at the end.
+func (c *columnVector) grow() {
+	if c.n%64 == 0 {
+		c.nulls = append(c.nulls, 0)
+	}
+	switch c.kind {
+	case vecInt:
+		c.ints = append(c.ints, 0)
+	case vecInt64:
+		c.int64s = append(c.int64s, 0)
+	case vecFloat64:
+		c.floats = append(c.floats, 0)
+	case vecString:
+		c.strs = append(c.strs, "")
+	case vecBool:
+		c.bools = append(c.bools, false)
+	case vecTime:
+		c.times = append(c.times, time.Time{})
+	case vecAny:
+		c.anys = append(c.anys, nil)
+	}
+	c.n++
+	c.setNull(c.n-1, true)
+}
+
+// append adds a value at the end.
+func (c *columnVector) append(v interface{}) {
+	c.grow()
+	c.set(c.n-1, v)
+}
+
+// get returns value i.
+func (c *columnVector) get(i int) interface{} {
+	if c.isNull(i) {
+		return nil
+	}
+	switch c.kind {
+	case vecInt:
+		return c.ints[i]
+	case vecInt64:
+		return c.int64s[i]
+	case vecFloat64:
+		return c.floats[i]
+	case vecString:
+		return c.strs[i]
+	case vecBool:
+		return c.bools[i]
+	case vecTime:
+		return c.times[i]
+	case vecAny:
+		return c.anys[i]
+	}
+	return nil
+}
+
+// set sets value i.
+func (c *columnVector) set(i int, v interface{}) {
+	if v == nil {
+		c.setNull(i, true)
+		switch c.kind {
+		case vecAny:
+			c.anys[i] = nil
+		case vecString:
+			c.strs[i] = ""
+		}
+		return
+	}
+
+	k := vecKindOf(v)
+	if c.kind == vecNull {
+		c.setKind(k)
+	} else if c.kind != k && c.kind != vecAny {
+		c.toAny()
+	}
+
+	switch c.kind {
+	case vecInt:
+		c.ints[i] = v.(int)
+	case vecInt64:
+		c.int64s[i] = v.(int64)
+	case vecFloat64:
+		c.floats[i] = v.(float64)
+	case vecString:
+		c.strs[i] = v.(string)
+	case vecBool:
+		c.bools[i] = v.(bool)
+	case vecTime:
+		c.times[i] = v.(time.Time)
+	case vecAny:
+		c.anys[i] = v
+	}
+	c.setNull(i, false)
+}
+
+// setKind allocates the slice of an all-nil vector.
+func (c *columnVector) setKind(k vecKind) {
+	c.kind = k
+	switch k {
+	case vecInt:
+		c.ints = make([]int, c.n)
+	case vecInt64:
+		c.int64s = make([]int64, c.n)
+	case vecFloat64:
+		c.floats = make([]float64, c.n)
+	case vecString:
+		c.strs = make([]string, c.n)
+	case vecBool:
+		c.bools = make([]bool, c.n)
+	case vecTime:
+		c.times = make([]time.Time, c.n)
+	case vecAny:
+		c.anys = make([]interface{}, c.n)
+	}
+}
+
+// toAny moves the values to []interface{}.
+func (c *columnVector) toAny() {
+	anys := make([]interface{}, c.n)
+	for i := 0; i < c.n; i++ {
+		anys[i] = c.get(i)
+	}
+	c.ints, c.int64s, c.floats, c.strs, c.bools, c.times = nil, nil, nil, nil, nil, nil
+	c.kind = vecAny
+	c.anys = anys
+}
+
+// values returns all values of the vector.
+func (c *columnVector) values() []interface{} {
+	vals := make([]interface{}, c.n)
+	for i := 0; i < c.n; i++ {
+		vals[i] = c.get(i)
+	}
+	return vals
+}
+
+// remove drops the values i for which drop[i] is set.
+func (c *columnVector) remove(drop []bool) {
+	k := 0
+	for i := 0; i < c.n; i++ {
+		if drop[i] {
+			continue
+		}
+		if k != i {
+			c.set(k, c.get(i))
+		}
+		k++
+	}
+
+	switch c.kind {
+	case vecInt:
+		c.ints = c.ints[:k]
+	case vecInt64:
+		c.int64s = c.int64s[:k]
+	case vecFloat64:
+		c.floats = c.floats[:k]
+	case vecString:
+		c.strs = c.strs[:k]
+	case vecBool:
+		c.bools = c.bools[:k]
+	case vecTime:
+		c.times = c.times[:k]
+	case vecAny:
+		for i := k; i < c.n; i++ {
+			c.anys[i] = nil
+		}
+		c.anys = c.anys[:k]
+	}
+	c.nulls = c.nulls[:(k+63)/64]
+	c.n = k
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"sync"
 )
@@ -16,9 +15,22 @@ type IColumn interface {
 	Get() []Column
 	SetColumns(colArry []Column)
 
-	// Clear drops all columns
+	// Clear drops all columns, and their values from the rows.
 	Clear()
 
+	// Drop removes columns and their values.
+	Drop(names ...string) error
+
+	// Rename renames a column in the columns and the rows.
+	Rename(oldName string, newName string) error
+
+	// Move moves a column to another position.
+	Move(name string, pos int) error
+
+	// ChangeType sets the type of a column and converts its
+	// values.
+	ChangeType(name string, newType string, policy ConvertPolicy) error
+
 	Exists(colName string) bool
 	Count() int
 	InsertAt(pos int, col Column) error
@@ -38,6 +50,18 @@ type IColumn interface {
 	// "433" vs 433).
 	ResetColTypes()
 
+	// InferTypes infers the column types, optionally converting
+	// the values, and reports how each type was chosen.
+	InferTypes(opts InferOptions) ([]ColumnInference, error)
+
+	// Profile computes the statistics of a column.
+	Profile(colName string, opts ...ProfileOptions) (ColumnProfile, error)
+
+	// Sketch and ApproxDistinct estimate the statistics of large
+	// columns in fixed memory.
+	Sketch(colName string, opts ...SketchOptions) (*ColumnSketch, error)
+	ApproxDistinct(colName string) (uint64, error)
+
 	// GetData retrieves all values of a column.
 	GetData(colName string) []interface{}
 	ColDataCount(colName string) int
@@ -46,30 +70,44 @@ type IColumn interface {
 	// GetDataDistinct gets all distinct values of a column.
 	GetDataDistinct(colName string) ([]interface{}, []interface{})
 
+	// Lookup finds a column by name under the column name policy.
+	Lookup(name string) (Column, bool)
+
+	// NamePolicy returns the column name policy.
+	NamePolicy() ColumnNamePolicy
+
+	// SetNamePolicy sets how column names are matched (and, for
+	// snake_case, stored).
+	SetNamePolicy(p ColumnNamePolicy) error
+
+	// AddComputed adds a column computed from an expression or a
+	// func(Row) interface{}.
+	AddComputed(name string, expr interface{}) error
+
+	// Materialize turns a computed column into a plain column.
+	Materialize(name string) error
+
 	setTag(t string)
 	getTag() string
 }
 
+// ColDataNoNULL counts the values of a column that are not NULL
+// (nil or blank).
 func (c *Cols) ColDataNoNULL(colName string) int {
 
 	dataCount := 0
-	colCnt := len(c.Columns)
-	rowCnt := c.Rows.Count()
-
-	for j := 0; j < colCnt; j++ {
-		name := c.Columns[j].Name
-
-		if name == colName {
-			for i := 0; i < rowCnt; i++ {
-				row := c.Rows.GetRow(i)
-				v := row
-				if v != nil {
-					vstr := strings.TrimSpace(fmt.Sprintf("%v", v))
-					if vstr != "" {
-						dataCount++
-					}
-				}
-			}
+	j := c.namePolicy.find(c.Columns, colName)
+	if j < 0 {
+		return 0
+	}
+
+	data := c.GetData(c.Columns[j].Name)
+	for i := 0; i < len(data); i++ {
+		if isNull(data[i]) {
+			continue
+		}
+		if strings.TrimSpace(fmt.Sprintf("%v", data[i])) != "" {
+			dataCount++
 		}
 	}
 
@@ -106,6 +144,12 @@ type Column struct {
 
 	Name string `json:"name"`
 	Type string `json:"type"`
+
+	// NotNull records that the source of the column does not
+	// allow NULLs (see FromSQLRows); it is not enforced.
+	NotNull bool `json:"notNull,omitempty"`
+
+	computed *computedColumn
 }
 
 // Columns is the IColumn interface handler.
@@ -113,6 +157,8 @@ type Cols struct {
 	Columns []Column
 	Rows    IRows
 
+	namePolicy ColumnNamePolicy
+
 	wrkGrpOccurenceCount int
 }
 
@@ -126,20 +172,35 @@ func (c *Cols) GetDataDistinct(colName string) ([]interface{}, []interface{}) {
 	// create a list with the data; the list
 	// does not allow duplicates; and it has a
 	// built-in binary search...
+	// (the list does not take a blank key, so a blank value is
+	// put in its place afterwards)
 	var coll = NewCollection()
+	blank := -1
 	for i := 0; i < len(d); i++ {
 
 		// key is actually the valuoe
 		key := fmt.Sprintf("%v", d[i])
 
+		if key == "" {
+			if blank < 0 {
+				blank = coll.List.Count()
+			}
+			continue
+		}
 		coll.List.Add(key, i)
 	}
 
 	for i := 0; i < coll.List.Count(); i++ {
+		if i == blank {
+			dist = append(dist, "")
+		}
 		x, _ := coll.List.GetItem(i)
 		dist = append(dist, x.Key)
 
 	}
+	if blank >= 0 && blank == coll.List.Count() {
+		dist = append(dist, "")
+	}
 
 	return dist, d
 }
@@ -148,6 +209,10 @@ func (c *Cols) SetColumns(colArry []Column) {
 	c.Rows.SetColumns(c.Columns)
 }
 func (c *Cols) GetData(colName string) []interface{} {
+	if cr, ok := c.Rows.(*ColumnarRows); ok {
+		return cr.columnData(colName)
+	}
+
 	var d []interface{}
 	colCnt := len(c.Columns)
 	rows := c.Rows.GetRows()
@@ -163,144 +228,124 @@ func (c *Cols) GetData(colName string) []interface{} {
 	return d
 }
 func (c *Cols) Clear() {
+	names := columnNames(c.Columns)
 	c.Columns = nil
+	c.Rows.SetColumns(c.Columns)
+	removeRowKeys(c.Rows, names)
 }
+
+// Exists reports whether a column exists, matching names by the
+// column name policy.
 func (c *Cols) Exists(colName string) bool {
-	colNameLower := strings.ToLower(colName)
-	for i := 0; i < len(c.Columns); i++ {
-		if strings.ToLower(c.Columns[i].Name) == colNameLower {
-			return true
-		}
+	return c.namePolicy.find(c.Columns, colName) >= 0
+}
+
+// columnNames returns the names of cols in order.
+func columnNames(cols []Column) []string {
+	names := make([]string, len(cols))
+	for i := 0; i < len(cols); i++ {
+		names[i] = cols[i].Name
 	}
-	return false
+	return names
 }
 
-func (c *Cols) ResetColTypes() {
-	for i := 0; i < len(c.Columns); i++ {
-		colName := c.Columns[i].Name
-		distVal, _ := c.GetDataDistinct(colName)
-		if distVal == nil {
-			continue
+// indexOfColumn returns the position of a column by its name
+// (exact match first, then case-insensitive), or -1.
+func indexOfColumn(cols []Column, name string) int {
+	for i := 0; i < len(cols); i++ {
+		if cols[i].Name == name {
+			return i
 		}
+	}
+	for i := 0; i < len(cols); i++ {
+		if strings.EqualFold(cols[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
 
-		lenx := len(distVal)
-		var cntInt, cntStr, cntDate, cntBool, cntFloat64 int
-		for j := 0; j < lenx; j++ {
-
-			// if the columm has originally been defined as string, then reflect.TypeOf()
-			// still return string. e.g. Wnat: 443 (int), Have: "443" (string);
-
-			strVal := fmt.Sprintf("%v", distVal[j])
-
-			if _, err := strconv.ParseFloat(strVal, 64); err == nil {
-				cntFloat64++
-				continue
+// resolveReadColumns matches the columns of a file that is read
+// with the columns of the table, and returns the table column of
+// each. Missing columns are added with the given type ("" leaves
+// them untyped), and are NULL in the existing rows.
+func resolveReadColumns(t *Table, format string, names, types []string) ([]string, error) {
+	cols := make([]string, len(names))
+
+	for i := 0; i < len(names); i++ {
+		name := names[i]
+		c, ok := t.Cols.Lookup(name)
+		if !ok {
+			if name == row_id {
+				return nil, fmt.Errorf("%s is a reserved column name", name)
 			}
-
-			_, err := strconv.Atoi(strVal)
-			if err == nil {
-				cntInt++
-				continue
+			name = t.Cols.Add(name).Name
+			all := t.Cols.Get()
+			if types[i] != "" {
+				all[len(all)-1].Type = types[i]
 			}
-
-			// Date
-			if (strings.Contains(strVal, "/") || strings.Contains(strVal, "-")) &&
-				strings.Contains(strVal, ":") && strings.Contains(strVal, " ") {
-				_, err := convertStringToTime(strVal)
-				if err == nil {
-					cntDate++
-					continue
-				}
+			for r := 0; r < t.Rows.Count(); r++ {
+				t.Rows.SetValue(r, name, nil)
 			}
-
-			if strings.ToLower(strVal) == "false" || strings.ToLower(strVal) == "true" {
-				cntBool++
-				continue
-			}
-
-			cntStr++
+			c = all[len(all)-1]
 		}
 
-		if lenx == cntDate {
-			c.Columns[i].Type = "DateTime"
-
-		} else if lenx == cntStr {
-			c.Columns[i].Type = "String"
-
-		} else if lenx == cntInt {
-			c.Columns[i].Type = "Integer"
-
-		} else if lenx == cntBool {
-			c.Columns[i].Type = "Bool"
-
-		} else if lenx == cntFloat64 {
-			c.Columns[i].Type = "Float"
+		col := c.Name
+		if containsString(cols[:i], col) {
+			return nil, fmt.Errorf("%s: duplicate column: %s", format, name)
 		}
+		cols[i] = col
 	}
+
+	return cols, nil
 }
-func (c *Cols) GetOccurrenceMatrix(colName string, tbl *Table) {
 
-	//-----------------------------
-	// UNDONE
-	//-----------------------------
+// ResetColTypes infers the types of the columns from their values
+// (see InferTypes); only nil and blank values count as NULL.
+func (c *Cols) ResetColTypes() {
+	c.InferTypes(InferOptions{NullTokens: []string{""}})
+}
+
+// GetOccurrenceMatrix adds to tbl a row for each distinct value of a
+// column (by its text, as GetDataDistinct), in the order they first
+// occur: column_name, value, n_times_occurred, distinct_to_all_ratio
+// and is_unique (1 for a value that occurs once). The columns are
+// added to tbl when it does not have them.
+func (c *Cols) GetOccurrenceMatrix(colName string, tbl *Table) {
 
 	distint, flatData := c.GetDataDistinct(colName)
-	distLen := len(distint)
-	flatLen := len(flatData)
-	ratio := float64(distLen) / float64(flatLen)
 
-	if flatLen == distLen {
-		// Unique values, all occurances are equal to 1
-		row := tbl.Rows.New()
-		row["column_name"] = colName
-		row["is_unique"] = 1
-		tbl.Rows.UpdateRow(row)
-		return
+	counts := make(map[string]int, len(distint))
+	for i := 0; i < len(flatData); i++ {
+		counts[fmt.Sprintf("%v", flatData[i])]++
 	}
-	if distLen == 1 && flatLen > 0 {
-		row := tbl.Rows.New()
-		row["column_name"] = colName
-		row["is_unique"] = 0
-		row["n_times_occurred"] = flatData
-		row["distinct_to_all_ratio"] = ratio
-		tbl.Rows.UpdateRow(row)
-		return
-	}
-
-	if ratio > 0.99 && flatLen > 10000 {
-		// there are only a few that are different
-		row := tbl.Rows.New()
-		row["column_name"] = colName
-		row["is_unique"] = 0
-		row["n_times_occurred"] = 1
-		row["distinct_to_all_ratio"] = ratio
-		tbl.Rows.UpdateRow(row)
-		return
+	ratio := 0.0
+	if len(flatData) > 0 {
+		ratio = float64(len(distint)) / float64(len(flatData))
 	}
 
-	if distLen == 1 && flatLen > 0 {
-		row := tbl.Rows.New()
-		row["column_name"] = colName
-		row["is_unique"] = 0
-		row["n_times_occurred"] = flatData
-		row["distinct_to_all_ratio"] = ratio
-		tbl.Rows.UpdateRow(row)
-		return
+	names := []string{"column_name", "value", "n_times_occurred", "distinct_to_all_ratio", "is_unique"}
+	for i := 0; i < len(names); i++ {
+		if col, ok := tbl.Cols.Lookup(names[i]); ok {
+			names[i] = col.Name
+		} else {
+			names[i] = tbl.Cols.Add(names[i]).Name
+		}
 	}
 
 	for i := 0; i < len(distint); i++ {
-
-		val := distint[i]
-		cnt := c.GetOccurrence(colName, val, flatData)
+		val := distint[i].(string)
+		isUnique := 0
+		if counts[val] == 1 {
+			isUnique = 1
+		}
 
 		row := tbl.Rows.New()
-		row["column_name"] = colName
-		row["distinct_to_all_ratio"] = ratio
-		row["value"] = val
-		row["is_unique"] = 0
-		row["n_times_occurred"] = cnt
-
-		tbl.Rows.UpdateRow(row)
+		row[names[0]] = colName
+		row[names[1]] = val
+		row[names[2]] = counts[val]
+		row[names[3]] = ratio
+		row[names[4]] = isUnique
 	}
 }
 
@@ -383,6 +428,10 @@ func (c *Cols) InsertAt(pos int, col Column) error {
 		return errors.New("invalid columns position")
 	}
 
+	col.Name = c.namePolicy.name(col.Name)
+	if col.Name == row_id {
+		return fmt.Errorf("%s is a reserved column name", row_id)
+	}
 	if c.Exists(col.Name) {
 		return errors.New("column already exists")
 	}
@@ -442,14 +491,22 @@ func (c *Cols) setTag(t string) {
 		c.Columns[i].Tag = t
 	}
 }
+
+// Add adds an untyped column; with ColumnNamesSnakeCase, the name
+// is converted to snake_case. A name that refers to an existing
+// column under the name policy (or is _rowid_) adds nothing, and
+// Add returns nil.
 func (c *Cols) Add(name string) *Column {
 
 	colType := fmt.Sprintf("%v", reflect.TypeOf(name))
 
 	var col Column = Column{
-		Name: name,
+		Name: c.namePolicy.name(name),
 		Type: colType,
 	}
+	if col.Name == row_id || c.namePolicy.find(c.Columns, col.Name) >= 0 {
+		return nil
+	}
 
 	c.Columns = append(c.Columns, col)
 
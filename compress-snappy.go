@@ -0,0 +1,188 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Snappy block format (as used by Parquet pages; no framing).
+
+var errSnappy = errors.New("snappy: corrupt input")
+
+// snappyEncode compresses src.
+func snappyEncode(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/6+32)
+	dst = appendUvarint(dst, uint64(len(src)))
+
+	// blocks of 64 KB keep the offsets in two bytes
+	for len(src) > 0 {
+		n := len(src)
+		if n > 1<<16 {
+			n = 1 << 16
+		}
+		dst = snappyEncodeBlock(dst, src[:n])
+		src = src[n:]
+	}
+
+	return dst
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
+
+func snappyEncodeBlock(dst, src []byte) []byte {
+	const tableBits = 14
+	var table [1 << tableBits]int32 // positions + 1
+
+	hash := func(u uint32) uint32 {
+		return (u * 0x1e35a7bd) >> (32 - tableBits)
+	}
+
+	lit := 0 // start of the pending literal
+	i := 0
+	for i+4 <= len(src) {
+		u := binary.LittleEndian.Uint32(src[i:])
+		h := hash(u)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if cand < 0 || binary.LittleEndian.Uint32(src[cand:]) != u {
+			i++
+			continue
+		}
+
+		dst = snappyLiteral(dst, src[lit:i])
+
+		n := 4
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+		dst = snappyCopy(dst, i-cand, n)
+
+		i += n
+		lit = i
+	}
+
+	return snappyLiteral(dst, src[lit:])
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	n := len(lit)
+	switch {
+	case n == 0:
+		return dst
+	case n <= 60:
+		dst = append(dst, byte(n-1)<<2)
+	case n <= 1<<8:
+		dst = append(dst, 60<<2, byte(n-1))
+	default:
+		dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+	}
+	return append(dst, lit...)
+}
+
+func snappyCopy(dst []byte, offset, n int) []byte {
+	// copies of up to 64 bytes with a two-byte offset
+	for n > 0 {
+		m := n
+		if m > 64 {
+			m = 64
+			if n-m < 4 {
+				m = n - 4
+			}
+		}
+		if m >= 4 && m <= 11 && offset < 2048 {
+			dst = append(dst, byte(offset>>8)<<5|byte(m-4)<<2|1, byte(offset))
+		} else {
+			dst = append(dst, byte(m-1)<<2|2, byte(offset), byte(offset>>8))
+		}
+		n -= m
+	}
+	return dst
+}
+
+// snappyDecode decompresses src, of at most limit bytes.
+func snappyDecode(src []byte, limit int) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if limit < 0 || limit > 1<<31 {
+		limit = 1 << 31
+	}
+	if k <= 0 || n > uint64(limit) {
+		return nil, errSnappy
+	}
+	src = src[k:]
+	dst := make([]byte, 0, n)
+
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errSnappy
+				}
+				length = 0
+				for b := 0; b < extra; b++ {
+					length |= int(src[b]) << (8 * uint(b))
+				}
+				src = src[extra:]
+			}
+			length++
+			if length <= 0 || length > len(src) || len(dst)+length > int(n) {
+				return nil, errSnappy
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+
+		case 1:
+			if len(src) < 2 {
+				return nil, errSnappy
+			}
+			length = 4 + int(tag>>2)&7
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+
+		case 2:
+			if len(src) < 3 {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+
+		case 3:
+			if len(src) < 5 {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(n) {
+			return nil, errSnappy
+		}
+		// byte by byte: the copy may overlap its output
+		start := len(dst) - offset
+		for b := 0; b < length; b++ {
+			dst = append(dst, dst[start+b])
+		}
+	}
+
+	if len(dst) != int(n) {
+		return nil, errSnappy
+	}
+	return dst, nil
+}
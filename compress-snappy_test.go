@@ -0,0 +1,55 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSnappyRoundTrip(t *testing.T) {
+	for i, in := range codecInputs() {
+		out, err := snappyDecode(snappyEncode(in), -1)
+		if err != nil || !bytes.Equal(out, in) {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+}
+
+// testdata/codec/words.snappy was written by github.com/golang/snappy.
+func TestSnappyDecodeReference(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/codec/words.snappy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := snappyDecode(data, -1)
+	if err != nil || !bytes.Equal(out, codecTestInput()) {
+		t.Fatalf("decoded %d bytes: %v", len(out), err)
+	}
+}
+
+func TestSnappyCorruptInput(t *testing.T) {
+	data := snappyEncode(codecTestInput()[:4000])
+	for i := 0; i < len(data); i++ {
+		for _, b := range []byte{0x00, 0xff, data[i] ^ 1} {
+			mutated := append([]byte(nil), data...)
+			mutated[i] = b
+			snappyDecode(mutated, -1)
+		}
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := snappyDecode(data[:n], -1); err == nil {
+			t.Fatalf("truncated to %d: no error", n)
+		}
+	}
+}
+
+func TestSnappyDecodeLimit(t *testing.T) {
+	data := snappyEncode(make([]byte, 3000))
+	if _, err := snappyDecode(data, 1000); err == nil {
+		t.Fatal("no error past the limit")
+	}
+	if out, err := snappyDecode(data, 3000); err != nil || len(out) != 3000 {
+		t.Fatalf("decoded %d bytes: %v", len(out), err)
+	}
+}
@@ -0,0 +1,1150 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// Zstandard (RFC 8878) frames, for Parquet pages. The decoder
+// handles the whole format except dictionaries. The encoder finds
+// matches with a hash table and writes them with the predefined
+// FSE tables, leaving the literals uncompressed.
+
+var (
+	errZstd           = errors.New("zstd: corrupt input")
+	errZstdDictionary = errors.New("zstd: dictionaries are not supported")
+)
+
+const (
+	zstdMagic       = 0xFD2FB528
+	zstdMaxBlock    = 1 << 17
+	zstdMaxOutput   = 1 << 31
+	zstdMinMatch    = 4
+	zstdLLMaxLog    = 9
+	zstdMLMaxLog    = 9
+	zstdOFMaxLog    = 8
+	zstdHufMaxBits  = 11
+	zstdHufWeighLog = 6
+)
+
+// baselines and extra bits of the literals length and match length
+// codes
+var (
+	zstdLLBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536}
+	zstdLLBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16}
+	zstdMLBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539}
+	zstdMLBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16}
+
+	// predefined distributions
+	zstdLLDefault = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1}
+	zstdMLDefault = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1}
+	zstdOFDefault = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}
+)
+
+// zstdBackReader reads a bitstream backwards, from the last bit
+// to the first, as FSE and Huffman streams are written.
+type zstdBackReader struct {
+	in    []byte
+	off   int    // in[:off] is not loaded yet
+	value uint64 // loaded bits; the low n bits are valid
+	n     uint
+	left  int // bits not read yet; negative after an overflow
+}
+
+func (b *zstdBackReader) init(in []byte) error {
+	if len(in) == 0 || in[len(in)-1] == 0 {
+		return errZstd
+	}
+	last := in[len(in)-1]
+	hb := uint(bits.Len8(last) - 1) // the end marker
+	b.in = in
+	b.off = len(in) - 1
+	b.value = uint64(last) & (1<<hb - 1)
+	b.n = hb
+	b.left = b.off*8 + int(hb)
+	return nil
+}
+
+func (b *zstdBackReader) load() {
+	for b.n <= 56 && b.off > 0 {
+		b.off--
+		b.value = b.value<<8 | uint64(b.in[b.off])
+		b.n += 8
+	}
+}
+
+// peek returns the next nb bits (zeros past the start).
+func (b *zstdBackReader) peek(nb uint) uint64 {
+	if nb == 0 {
+		return 0
+	}
+	if b.n < nb {
+		b.load()
+	}
+	if b.n >= nb {
+		return (b.value >> (b.n - nb)) & (1<<nb - 1)
+	}
+	return (b.value & (1<<b.n - 1)) << (nb - b.n)
+}
+
+func (b *zstdBackReader) skip(nb uint) {
+	if nb > b.n {
+		b.n = 0
+	} else {
+		b.n -= nb
+	}
+	b.left -= int(nb)
+}
+
+func (b *zstdBackReader) read(nb uint) uint64 {
+	v := b.peek(nb)
+	b.skip(nb)
+	return v
+}
+
+// zstdFSE is an FSE decoding table.
+type zstdFSE struct {
+	log     uint
+	symbols []uint8
+	nbBits  []uint8
+	base    []uint16
+}
+
+// readNormCounts reads an FSE table description; it returns the
+// normalized counts, the accuracy log and the bytes read.
+func readNormCounts(in []byte, maxSymbol int, maxLog uint) ([]int16, uint, int, error) {
+	pos := uint(0) // bit position
+	total := uint(len(in)) * 8
+	read := func(n uint) uint32 {
+		var v uint32
+		for i := uint(0); i < n; i++ {
+			p := pos + i
+			if p < total && in[p/8]&(1<<(p%8)) != 0 {
+				v |= 1 << i
+			}
+		}
+		return v
+	}
+	peek := func(n uint) uint32 { return read(n) }
+
+	if len(in) == 0 {
+		return nil, 0, 0, errZstd
+	}
+	log := uint(read(4)) + 5
+	pos += 4
+	if log > maxLog {
+		return nil, 0, 0, errZstd
+	}
+
+	norm := make([]int16, 0, maxSymbol+1)
+	remaining := int32(1<<log) + 1
+	threshold := int32(1 << log)
+	nbBits := log + 1
+
+	for remaining > 1 {
+		if len(norm) > maxSymbol {
+			return nil, 0, 0, errZstd
+		}
+		max := 2*threshold - 1 - remaining
+		var count int32
+		v := int32(peek(nbBits))
+		if v&(threshold-1) < max {
+			count = v & (threshold - 1)
+			pos += nbBits - 1
+		} else {
+			count = v & (2*threshold - 1)
+			if count >= threshold {
+				count -= max
+			}
+			pos += nbBits
+		}
+		count--
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, int16(count))
+
+		if count == 0 {
+			// repeat flags: runs of zero probabilities
+			for {
+				r := read(2)
+				pos += 2
+				for i := uint32(0); i < r; i++ {
+					norm = append(norm, 0)
+				}
+				if r != 3 {
+					break
+				}
+			}
+		}
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+		if pos > total {
+			return nil, 0, 0, errZstd
+		}
+	}
+	if remaining != 1 || len(norm) > maxSymbol+1 {
+		return nil, 0, 0, errZstd
+	}
+
+	return norm, log, int((pos + 7) / 8), nil
+}
+
+// zstdSpread returns the symbol of each state of an FSE table.
+func zstdSpread(norm []int16, log uint) ([]uint8, error) {
+	size := 1 << log
+	symbols := make([]uint8, size)
+	high := size - 1
+	for s := 0; s < len(norm); s++ {
+		if norm[s] == -1 {
+			symbols[high] = uint8(s)
+			high--
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s := 0; s < len(norm); s++ {
+		for i := 0; i < int(norm[s]); i++ {
+			symbols[pos] = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, errZstd
+	}
+	return symbols, nil
+}
+
+func newZstdFSE(norm []int16, log uint) (*zstdFSE, error) {
+	symbols, err := zstdSpread(norm, log)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 1 << log
+	t := &zstdFSE{log: log, symbols: symbols, nbBits: make([]uint8, size), base: make([]uint16, size)}
+	next := make([]int, len(norm))
+	for s := 0; s < len(norm); s++ {
+		if norm[s] == -1 {
+			next[s] = 1
+		} else {
+			next[s] = int(norm[s])
+		}
+	}
+	for u := 0; u < size; u++ {
+		s := symbols[u]
+		ns := next[s]
+		next[s]++
+		nb := log - uint(bits.Len(uint(ns))-1)
+		t.nbBits[u] = uint8(nb)
+		t.base[u] = uint16(ns<<nb - size)
+	}
+
+	return t, nil
+}
+
+// newZstdRLE returns a table that always decodes one symbol.
+func newZstdRLE(symbol uint8) *zstdFSE {
+	return &zstdFSE{log: 0, symbols: []uint8{symbol}, nbBits: []uint8{0}, base: []uint16{0}}
+}
+
+var zstdDefaultTables [3]*zstdFSE
+
+func init() {
+	zstdDefaultTables[0], _ = newZstdFSE(zstdLLDefault, 6)
+	zstdDefaultTables[1], _ = newZstdFSE(zstdOFDefault, 5)
+	zstdDefaultTables[2], _ = newZstdFSE(zstdMLDefault, 6)
+}
+
+// zstdHuffman is a Huffman decoding table for the literals.
+type zstdHuffman struct {
+	maxBits uint
+	symbols []uint8
+	nbBits  []uint8
+}
+
+// readHuffman reads a Huffman tree description and returns the
+// table and the bytes read.
+func readHuffman(in []byte) (*zstdHuffman, int, error) {
+	if len(in) == 0 {
+		return nil, 0, errZstd
+	}
+
+	var weights []uint8
+	header := int(in[0])
+	size := 0
+
+	if header >= 128 {
+		// 4-bit weights
+		n := header - 127
+		size = 1 + (n+1)/2
+		if len(in) < size {
+			return nil, 0, errZstd
+		}
+		weights = make([]uint8, n)
+		for i := 0; i < n; i++ {
+			b := in[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 15
+			}
+		}
+	} else {
+		// FSE-compressed weights
+		size = 1 + header
+		if len(in) < size {
+			return nil, 0, errZstd
+		}
+		data := in[1:size]
+		norm, log, n, err := readNormCounts(data, 255, zstdHufWeighLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		t, err := newZstdFSE(norm, log)
+		if err != nil {
+			return nil, 0, err
+		}
+		var br zstdBackReader
+		if err := br.init(data[n:]); err != nil {
+			return nil, 0, err
+		}
+		s1 := br.read(log)
+		s2 := br.read(log)
+		for {
+			if len(weights) > 254 {
+				return nil, 0, errZstd
+			}
+			weights = append(weights, t.symbols[s1])
+			s1 = uint64(t.base[s1]) + br.read(uint(t.nbBits[s1]))
+			if br.left < 0 {
+				weights = append(weights, t.symbols[s2])
+				break
+			}
+			weights = append(weights, t.symbols[s2])
+			s2 = uint64(t.base[s2]) + br.read(uint(t.nbBits[s2]))
+			if br.left < 0 {
+				weights = append(weights, t.symbols[s1])
+				break
+			}
+		}
+	}
+
+	// the weight of the last symbol is implied
+	total := 0
+	for _, w := range weights {
+		if w > zstdHufMaxBits {
+			return nil, 0, errZstd
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, errZstd
+	}
+	maxBits := uint(bits.Len(uint(total)))
+	rest := 1<<maxBits - total
+	if rest&(rest-1) != 0 || maxBits > zstdHufMaxBits {
+		return nil, 0, errZstd
+	}
+	weights = append(weights, uint8(bits.Len(uint(rest))))
+	if len(weights) > 256 {
+		return nil, 0, errZstd
+	}
+
+	h := &zstdHuffman{maxBits: maxBits, symbols: make([]uint8, 1<<maxBits), nbBits: make([]uint8, 1<<maxBits)}
+	pos := 0
+	for w := uint(1); w <= maxBits; w++ {
+		for s := 0; s < len(weights); s++ {
+			if uint(weights[s]) != w {
+				continue
+			}
+			for i := 0; i < 1<<(w-1); i++ {
+				h.symbols[pos] = uint8(s)
+				h.nbBits[pos] = uint8(maxBits + 1 - w)
+				pos++
+			}
+		}
+	}
+
+	return h, size, nil
+}
+
+// decodeStream decodes n literals of one Huffman stream.
+func (h *zstdHuffman) decodeStream(dst []byte, in []byte, n int) ([]byte, error) {
+	var br zstdBackReader
+	if err := br.init(in); err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		v := br.peek(h.maxBits)
+		dst = append(dst, h.symbols[v])
+		br.skip(uint(h.nbBits[v]))
+	}
+	if br.left != 0 {
+		return nil, errZstd
+	}
+	return dst, nil
+}
+
+// zstdDecoder holds the state kept between the blocks of a frame.
+type zstdDecoder struct {
+	out     []byte
+	start   int // start of the frame in out
+	rep     [3]int
+	huffman *zstdHuffman
+	tables  [3]*zstdFSE // LL, OF, ML
+	limit   int
+}
+
+// zstdDecode decompresses one or more frames, of at most limit
+// bytes in all.
+func zstdDecode(src []byte, limit int) ([]byte, error) {
+	if limit < 0 || limit > zstdMaxOutput {
+		limit = zstdMaxOutput
+	}
+	d := &zstdDecoder{limit: limit}
+
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, errZstd
+		}
+		magic := binary.LittleEndian.Uint32(src)
+		if magic&0xFFFFFFF0 == 0x184D2A50 {
+			// skippable frame
+			if len(src) < 8 {
+				return nil, errZstd
+			}
+			n := int(binary.LittleEndian.Uint32(src[4:]))
+			if n < 0 || n > len(src)-8 {
+				return nil, errZstd
+			}
+			src = src[8+n:]
+			continue
+		}
+		if magic != zstdMagic {
+			return nil, errZstd
+		}
+
+		n, err := d.frame(src[4:])
+		if err != nil {
+			return nil, err
+		}
+		src = src[4+n:]
+	}
+
+	return d.out, nil
+}
+
+// frame decodes a frame (after the magic number) and returns the
+// bytes read.
+func (d *zstdDecoder) frame(in []byte) (int, error) {
+	if len(in) < 1 {
+		return 0, errZstd
+	}
+	fhd := in[0]
+	pos := 1
+
+	fcsFlag := fhd >> 6
+	single := fhd&0x20 != 0
+	checksum := fhd&0x04 != 0
+	dictFlag := fhd & 3
+	if fhd&0x08 != 0 {
+		return 0, errZstd
+	}
+
+	if !single {
+		pos++ // window descriptor
+	}
+	dictSize := [4]int{0, 1, 2, 4}[dictFlag]
+	if len(in) < pos+dictSize {
+		return 0, errZstd
+	}
+	for i := 0; i < dictSize; i++ {
+		if in[pos+i] != 0 {
+			return 0, errZstdDictionary
+		}
+	}
+	pos += dictSize
+
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && single {
+		fcsSize = 1
+	}
+	if len(in) < pos+fcsSize {
+		return 0, errZstd
+	}
+	contentSize := int64(-1)
+	switch fcsSize {
+	case 1:
+		contentSize = int64(in[pos])
+	case 2:
+		contentSize = int64(binary.LittleEndian.Uint16(in[pos:])) + 256
+	case 4:
+		contentSize = int64(binary.LittleEndian.Uint32(in[pos:]))
+	case 8:
+		contentSize = int64(binary.LittleEndian.Uint64(in[pos:]))
+	}
+	pos += fcsSize
+
+	d.start = len(d.out)
+	d.rep = [3]int{1, 4, 8}
+	d.huffman = nil
+	d.tables = [3]*zstdFSE{}
+
+	for {
+		if len(in) < pos+3 {
+			return 0, errZstd
+		}
+		h := uint32(in[pos]) | uint32(in[pos+1])<<8 | uint32(in[pos+2])<<16
+		pos += 3
+		last := h&1 != 0
+		size := int(h >> 3)
+
+		switch (h >> 1) & 3 {
+		case 0: // raw
+			if len(in) < pos+size {
+				return 0, errZstd
+			}
+			d.out = append(d.out, in[pos:pos+size]...)
+			pos += size
+		case 1: // RLE
+			if len(in) < pos+1 || size > zstdMaxBlock {
+				return 0, errZstd
+			}
+			for i := 0; i < size; i++ {
+				d.out = append(d.out, in[pos])
+			}
+			pos++
+		case 2: // compressed
+			if len(in) < pos+size || size > zstdMaxBlock {
+				return 0, errZstd
+			}
+			if err := d.block(in[pos : pos+size]); err != nil {
+				return 0, err
+			}
+			pos += size
+		default:
+			return 0, errZstd
+		}
+
+		if len(d.out) > d.limit {
+			return 0, errZstd
+		}
+		if last {
+			break
+		}
+	}
+
+	if contentSize >= 0 && int64(len(d.out)-d.start) != contentSize {
+		return 0, errZstd
+	}
+	if checksum {
+		pos += 4
+		if len(in) < pos {
+			return 0, errZstd
+		}
+	}
+
+	return pos, nil
+}
+
+// block decodes a compressed block.
+func (d *zstdDecoder) block(in []byte) error {
+	literals, n, err := d.literals(in)
+	if err != nil {
+		return err
+	}
+	in = in[n:]
+
+	// sequences section header
+	if len(in) < 1 {
+		return errZstd
+	}
+	nbSeq := int(in[0])
+	pos := 1
+	switch {
+	case nbSeq == 0:
+		d.out = append(d.out, literals...)
+		return nil
+	case nbSeq == 255:
+		if len(in) < 3 {
+			return errZstd
+		}
+		nbSeq = int(in[1]) + int(in[2])<<8 + 0x7F00
+		pos = 3
+	case nbSeq >= 128:
+		if len(in) < 2 {
+			return errZstd
+		}
+		nbSeq = (nbSeq-128)<<8 + int(in[1])
+		pos = 2
+	}
+
+	if len(in) < pos+1 {
+		return errZstd
+	}
+	modes := in[pos]
+	pos++
+	if modes&3 != 0 {
+		return errZstd
+	}
+
+	type tableSpec struct {
+		mode     byte
+		def      []int16
+		defLog   uint
+		maxLog   uint
+		maxSymbl int
+	}
+	specs := [3]tableSpec{
+		{modes >> 6, zstdLLDefault, 6, zstdLLMaxLog, 35},
+		{(modes >> 4) & 3, zstdOFDefault, 5, zstdOFMaxLog, 31},
+		{(modes >> 2) & 3, zstdMLDefault, 6, zstdMLMaxLog, 52},
+	}
+	for i, s := range specs {
+		switch s.mode {
+		case 0:
+			d.tables[i] = zstdDefaultTables[i]
+		case 1:
+			if len(in) < pos+1 || int(in[pos]) > s.maxSymbl {
+				return errZstd
+			}
+			d.tables[i] = newZstdRLE(in[pos])
+			pos++
+		case 2:
+			norm, log, n, err := readNormCounts(in[pos:], s.maxSymbl, s.maxLog)
+			if err != nil {
+				return err
+			}
+			if d.tables[i], err = newZstdFSE(norm, log); err != nil {
+				return err
+			}
+			pos += n
+		case 3:
+			if d.tables[i] == nil {
+				return errZstd
+			}
+		}
+	}
+
+	return d.sequences(in[pos:], nbSeq, literals)
+}
+
+// literals decodes the literals section and returns the literals
+// and the bytes read.
+func (d *zstdDecoder) literals(in []byte) ([]byte, int, error) {
+	if len(in) < 1 {
+		return nil, 0, errZstd
+	}
+	typ := in[0] & 3
+	sf := (in[0] >> 2) & 3
+
+	if typ == 0 || typ == 1 {
+		var size, hs int
+		switch sf {
+		case 0, 2:
+			size, hs = int(in[0]>>3), 1
+		case 1:
+			if len(in) < 2 {
+				return nil, 0, errZstd
+			}
+			size, hs = int(in[0]>>4)+int(in[1])<<4, 2
+		case 3:
+			if len(in) < 3 {
+				return nil, 0, errZstd
+			}
+			size, hs = int(in[0]>>4)+int(in[1])<<4+int(in[2])<<12, 3
+		}
+		if size > zstdMaxBlock {
+			return nil, 0, errZstd
+		}
+		if typ == 0 {
+			if len(in) < hs+size {
+				return nil, 0, errZstd
+			}
+			return in[hs : hs+size], hs + size, nil
+		}
+		if len(in) < hs+1 {
+			return nil, 0, errZstd
+		}
+		lit := make([]byte, size)
+		for i := range lit {
+			lit[i] = in[hs]
+		}
+		return lit, hs + 1, nil
+	}
+
+	// Huffman-compressed
+	var regen, comp, hs int
+	streams := 4
+	switch sf {
+	case 0, 1:
+		if len(in) < 3 {
+			return nil, 0, errZstd
+		}
+		h := uint32(in[0]) | uint32(in[1])<<8 | uint32(in[2])<<16
+		regen, comp, hs = int(h>>4)&0x3FF, int(h>>14)&0x3FF, 3
+		if sf == 0 {
+			streams = 1
+		}
+	case 2:
+		if len(in) < 4 {
+			return nil, 0, errZstd
+		}
+		h := binary.LittleEndian.Uint32(in)
+		regen, comp, hs = int(h>>4)&0x3FFF, int(h>>18)&0x3FFF, 4
+	case 3:
+		if len(in) < 5 {
+			return nil, 0, errZstd
+		}
+		h := uint64(binary.LittleEndian.Uint32(in)) | uint64(in[4])<<32
+		regen, comp, hs = int(h>>4)&0x3FFFF, int(h>>22)&0x3FFFF, 5
+	}
+	if regen > zstdMaxBlock || len(in) < hs+comp {
+		return nil, 0, errZstd
+	}
+	data := in[hs : hs+comp]
+
+	if typ == 2 {
+		h, n, err := readHuffman(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		d.huffman = h
+		data = data[n:]
+	} else if d.huffman == nil {
+		return nil, 0, errZstd
+	}
+
+	lit := make([]byte, 0, regen)
+	var err error
+	if streams == 1 {
+		if lit, err = d.huffman.decodeStream(lit, data, regen); err != nil {
+			return nil, 0, err
+		}
+		return lit, hs + comp, nil
+	}
+
+	if len(data) < 6 {
+		return nil, 0, errZstd
+	}
+	sizes := [4]int{
+		int(binary.LittleEndian.Uint16(data)),
+		int(binary.LittleEndian.Uint16(data[2:])),
+		int(binary.LittleEndian.Uint16(data[4:])),
+	}
+	data = data[6:]
+	sizes[3] = len(data) - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return nil, 0, errZstd
+	}
+	per := (regen + 3) / 4
+	for i := 0; i < 4; i++ {
+		n := per
+		if i == 3 {
+			n = regen - 3*per
+		}
+		if n < 0 {
+			return nil, 0, errZstd
+		}
+		if lit, err = d.huffman.decodeStream(lit, data[:sizes[i]], n); err != nil {
+			return nil, 0, err
+		}
+		data = data[sizes[i]:]
+	}
+
+	return lit, hs + comp, nil
+}
+
+// sequences decodes and executes the sequences of a block.
+func (d *zstdDecoder) sequences(in []byte, nbSeq int, literals []byte) error {
+	var br zstdBackReader
+	if err := br.init(in); err != nil {
+		return err
+	}
+	ll, of, ml := d.tables[0], d.tables[1], d.tables[2]
+	llState := br.read(ll.log)
+	ofState := br.read(of.log)
+	mlState := br.read(ml.log)
+
+	for i := 0; i < nbSeq; i++ {
+		llCode := ll.symbols[llState]
+		ofCode := of.symbols[ofState]
+		mlCode := ml.symbols[mlState]
+		if llCode > 35 || mlCode > 52 || ofCode > 31 {
+			return errZstd
+		}
+
+		offsetValue := int(1<<ofCode) + int(br.read(uint(ofCode)))
+		matchLen := int(zstdMLBase[mlCode]) + int(br.read(uint(zstdMLBits[mlCode])))
+		litLen := int(zstdLLBase[llCode]) + int(br.read(uint(zstdLLBits[llCode])))
+
+		if i < nbSeq-1 {
+			llState = uint64(ll.base[llState]) + br.read(uint(ll.nbBits[llState]))
+			mlState = uint64(ml.base[mlState]) + br.read(uint(ml.nbBits[mlState]))
+			ofState = uint64(of.base[ofState]) + br.read(uint(of.nbBits[ofState]))
+		}
+		if br.left < 0 {
+			return errZstd
+		}
+
+		// repeat offsets
+		var offset int
+		if offsetValue > 3 {
+			offset = offsetValue - 3
+			d.rep[2], d.rep[1], d.rep[0] = d.rep[1], d.rep[0], offset
+		} else {
+			idx := offsetValue
+			if litLen == 0 {
+				idx++
+			}
+			switch idx {
+			case 1:
+				offset = d.rep[0]
+			case 2:
+				offset = d.rep[1]
+				d.rep[1], d.rep[0] = d.rep[0], offset
+			case 3:
+				offset = d.rep[2]
+				d.rep[2], d.rep[1], d.rep[0] = d.rep[1], d.rep[0], offset
+			case 4:
+				offset = d.rep[0] - 1
+				if offset <= 0 {
+					return errZstd
+				}
+				d.rep[2], d.rep[1], d.rep[0] = d.rep[1], d.rep[0], offset
+			}
+		}
+
+		if litLen > len(literals) {
+			return errZstd
+		}
+		d.out = append(d.out, literals[:litLen]...)
+		literals = literals[litLen:]
+
+		if offset > len(d.out)-d.start {
+			return errZstd
+		}
+		start := len(d.out) - offset
+		for b := 0; b < matchLen; b++ {
+			d.out = append(d.out, d.out[start+b])
+		}
+	}
+	if br.left != 0 {
+		return errZstd
+	}
+
+	d.out = append(d.out, literals...)
+	return nil
+}
+
+// zstdBitWriter writes a bitstream that is read backwards by
+// zstdBackReader.
+type zstdBitWriter struct {
+	out []byte
+	acc uint64
+	n   uint
+}
+
+func (w *zstdBitWriter) add(v uint64, n uint) {
+	w.acc |= (v & (1<<n - 1)) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+// close writes the end marker.
+func (w *zstdBitWriter) close() []byte {
+	w.add(1, 1)
+	if w.n > 0 {
+		w.out = append(w.out, byte(w.acc))
+	}
+	return w.out
+}
+
+// zstdFSEEncoder is an FSE encoding table.
+type zstdFSEEncoder struct {
+	log        uint
+	states     []uint16
+	deltaBits  []int32
+	deltaState []int32
+}
+
+func newZstdFSEEncoder(norm []int16, log uint) *zstdFSEEncoder {
+	size := 1 << log
+	symbols, _ := zstdSpread(norm, log)
+
+	cumul := make([]int, len(norm)+1)
+	for s := 0; s < len(norm); s++ {
+		n := int(norm[s])
+		if n == -1 {
+			n = 1
+		}
+		cumul[s+1] = cumul[s] + n
+	}
+
+	e := &zstdFSEEncoder{
+		log:        log,
+		states:     make([]uint16, size),
+		deltaBits:  make([]int32, len(norm)),
+		deltaState: make([]int32, len(norm)),
+	}
+	for u := 0; u < size; u++ {
+		s := symbols[u]
+		e.states[cumul[s]] = uint16(size + u)
+		cumul[s]++
+	}
+
+	total := int32(0)
+	for s := 0; s < len(norm); s++ {
+		switch n := int32(norm[s]); n {
+		case 0:
+		case -1, 1:
+			e.deltaBits[s] = int32(log<<16) - int32(size)
+			e.deltaState[s] = total - 1
+			total++
+		default:
+			maxBits := int32(log) - int32(bits.Len32(uint32(n-1))-1)
+			minStatePlus := n << uint(maxBits)
+			e.deltaBits[s] = maxBits<<16 - minStatePlus
+			e.deltaState[s] = total - n
+			total += n
+		}
+	}
+
+	return e
+}
+
+func (e *zstdFSEEncoder) init(symbol uint8) uint32 {
+	nb := (e.deltaBits[symbol] + 1<<15) >> 16
+	v := nb<<16 - e.deltaBits[symbol]
+	return uint32(e.states[(v>>uint(nb))+e.deltaState[symbol]])
+}
+
+func (e *zstdFSEEncoder) encode(w *zstdBitWriter, state uint32, symbol uint8) uint32 {
+	nb := uint((int32(state) + e.deltaBits[symbol]) >> 16)
+	w.add(uint64(state), nb)
+	return uint32(e.states[int32(state>>nb)+e.deltaState[symbol]])
+}
+
+var zstdDefaultEncoders [3]*zstdFSEEncoder
+
+func init() {
+	zstdDefaultEncoders[0] = newZstdFSEEncoder(zstdLLDefault, 6)
+	zstdDefaultEncoders[1] = newZstdFSEEncoder(zstdOFDefault, 5)
+	zstdDefaultEncoders[2] = newZstdFSEEncoder(zstdMLDefault, 6)
+}
+
+// zstdCode returns the code of a length given the baselines.
+func zstdCode(base []uint32, v int) uint8 {
+	// binary search for the last base <= v
+	lo, hi := 0, len(base)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if int(base[mid]) <= v {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return uint8(lo)
+}
+
+type zstdSequence struct {
+	litLen, matchLen, offset int
+}
+
+// zstdEncode compresses src into a single frame.
+func zstdEncode(src []byte) []byte {
+	out := make([]byte, 4, len(src)/2+32)
+	binary.LittleEndian.PutUint32(out, zstdMagic)
+
+	// single segment, with the content size
+	n := len(src)
+	switch {
+	case n < 256:
+		out = append(out, 0x20, byte(n))
+	case n < 65536+256:
+		out = append(out, 0x60, 0, 0)
+		binary.LittleEndian.PutUint16(out[len(out)-2:], uint16(n-256))
+	case uint64(n) < 1<<32:
+		out = append(out, 0xA0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(out[len(out)-4:], uint32(n))
+	default:
+		out = append(out, 0xE0, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(out[len(out)-8:], uint64(n))
+	}
+
+	if n == 0 {
+		return append(out, 1, 0, 0) // an empty last raw block
+	}
+
+	const tableBits = 16
+	table := make([]int32, 1<<tableBits) // positions + 1
+	hash := func(u uint32) uint32 {
+		return (u * 2654435761) >> (32 - tableBits)
+	}
+
+	for start := 0; start < n; start += zstdMaxBlock {
+		end := start + zstdMaxBlock
+		if end > n {
+			end = n
+		}
+		last := end == n
+
+		// find the matches of the block; they may start before it
+		var seqs []zstdSequence
+		var literals []byte
+		lit := start
+		for i := start; i+zstdMinMatch <= end; {
+			u := binary.LittleEndian.Uint32(src[i:])
+			h := hash(u)
+			cand := int(table[h]) - 1
+			table[h] = int32(i + 1)
+
+			if cand < 0 || i-cand >= 1<<29-3 || binary.LittleEndian.Uint32(src[cand:]) != u {
+				i++
+				continue
+			}
+			m := zstdMinMatch
+			for i+m < end && src[cand+m] == src[i+m] && m < 65535 {
+				m++
+			}
+
+			literals = append(literals, src[lit:i]...)
+			seqs = append(seqs, zstdSequence{litLen: i - lit, matchLen: m, offset: i - cand})
+			i += m
+			lit = i
+		}
+		literals = append(literals, src[lit:end]...)
+
+		block := zstdCompressBlock(seqs, literals)
+		if block == nil || len(block) >= end-start {
+			out = zstdBlockHeader(out, last, 0, end-start)
+			out = append(out, src[start:end]...)
+			continue
+		}
+		out = zstdBlockHeader(out, last, 2, len(block))
+		out = append(out, block...)
+	}
+
+	return out
+}
+
+func zstdBlockHeader(out []byte, last bool, typ, size int) []byte {
+	h := uint32(size)<<3 | uint32(typ)<<1
+	if last {
+		h |= 1
+	}
+	return append(out, byte(h), byte(h>>8), byte(h>>16))
+}
+
+// zstdCompressBlock writes a compressed block of raw literals and
+// sequences coded with the predefined tables; nil if there are no
+// sequences.
+func zstdCompressBlock(seqs []zstdSequence, literals []byte) []byte {
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	// literals section, raw
+	var out []byte
+	ln := len(literals)
+	switch {
+	case ln < 32:
+		out = append(out, byte(ln<<3))
+	case ln < 4096:
+		out = append(out, byte(1<<2|(ln&15)<<4), byte(ln>>4))
+	default:
+		out = append(out, byte(3<<2|(ln&15)<<4), byte(ln>>4), byte(ln>>12))
+	}
+	out = append(out, literals...)
+
+	// sequences section header
+	ns := len(seqs)
+	switch {
+	case ns < 128:
+		out = append(out, byte(ns))
+	case ns < 0x7F00:
+		out = append(out, byte(ns>>8+128), byte(ns))
+	default:
+		out = append(out, 255, byte(ns-0x7F00), byte((ns-0x7F00)>>8))
+	}
+	out = append(out, 0) // predefined tables
+
+	codes := make([][3]uint8, ns) // LL, OF, ML
+	for i, s := range seqs {
+		codes[i][0] = zstdCode(zstdLLBase[:], s.litLen)
+		codes[i][1] = uint8(bits.Len(uint(s.offset+3)) - 1)
+		codes[i][2] = zstdCode(zstdMLBase[:], s.matchLen)
+	}
+
+	llEnc, ofEnc, mlEnc := zstdDefaultEncoders[0], zstdDefaultEncoders[1], zstdDefaultEncoders[2]
+	w := &zstdBitWriter{}
+	extra := func(i int) {
+		s, c := seqs[i], codes[i]
+		w.add(uint64(s.litLen)-uint64(zstdLLBase[c[0]]), uint(zstdLLBits[c[0]]))
+		w.add(uint64(s.matchLen)-uint64(zstdMLBase[c[2]]), uint(zstdMLBits[c[2]]))
+		w.add(uint64(s.offset+3)-uint64(1)<<c[1], uint(c[1]))
+	}
+
+	last := ns - 1
+	mlState := mlEnc.init(codes[last][2])
+	ofState := ofEnc.init(codes[last][1])
+	llState := llEnc.init(codes[last][0])
+	extra(last)
+	for i := ns - 2; i >= 0; i-- {
+		ofState = ofEnc.encode(w, ofState, codes[i][1])
+		mlState = mlEnc.encode(w, mlState, codes[i][2])
+		llState = llEnc.encode(w, llState, codes[i][0])
+		extra(i)
+	}
+	w.add(uint64(mlState), mlEnc.log)
+	w.add(uint64(ofState), ofEnc.log)
+	w.add(uint64(llState), llEnc.log)
+
+	out = append(out, w.close()...)
+	if len(out) > zstdMaxBlock {
+		return nil
+	}
+	return out
+}
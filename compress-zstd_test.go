@@ -0,0 +1,63 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestZstdRoundTrip(t *testing.T) {
+	for i, in := range codecInputs() {
+		out, err := zstdDecode(zstdEncode(in), -1)
+		if err != nil || !bytes.Equal(out, in) {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+}
+
+// The files in testdata/codec were written by the zstd command (at
+// levels 1 and 19, the latter with a checksum); they use Huffman
+// literals and FSE tables that zstdEncode does not write.
+func TestZstdDecodeReference(t *testing.T) {
+	want := codecTestInput()
+	for _, name := range []string{"words-1.zst", "words-19.zst"} {
+		data, err := ioutil.ReadFile("testdata/codec/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := zstdDecode(data, -1)
+		if err != nil || !bytes.Equal(out, want) {
+			t.Fatalf("%s: decoded %d bytes: %v", name, len(out), err)
+		}
+	}
+}
+
+func TestZstdCorruptInput(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/codec/words-19.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(data); i += 3 {
+		for _, b := range []byte{0x00, 0xff, data[i] ^ 1} {
+			mutated := append([]byte(nil), data...)
+			mutated[i] = b
+			zstdDecode(mutated, -1)
+		}
+	}
+	for n := 1; n < len(data); n++ {
+		if _, err := zstdDecode(data[:n], -1); err == nil {
+			t.Fatalf("truncated to %d: no error", n)
+		}
+	}
+}
+
+func TestZstdDecodeLimit(t *testing.T) {
+	data := zstdEncode(make([]byte, 300000))
+	if _, err := zstdDecode(data, 1000); err == nil {
+		t.Fatal("no error past the limit")
+	}
+	if out, err := zstdDecode(data, 300000); err != nil || len(out) != 300000 {
+		t.Fatalf("decoded %d bytes: %v", len(out), err)
+	}
+}
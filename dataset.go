@@ -7,6 +7,7 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -28,6 +29,19 @@ type IDataset interface {
 	SerializeToFile(fPath string) error
 	Deserialize(data []byte) ([]Table, error)
 	DeserializeFromFile(fPath string) ([]Table, error)
+
+	// Query runs a SQL SELECT statement against the tables
+	// of the dataset.
+	Query(sqlText string, args ...interface{}) (*Table, error)
+
+	// Exec runs a SQL INSERT, UPDATE or DELETE statement and
+	// returns the number of rows affected.
+	Exec(sqlText string, args ...interface{}) (int64, error)
+
+	// WriteXLSX writes the tables as the sheets of an Excel
+	// workbook; ReadXLSX adds a table for each sheet.
+	WriteXLSX(w io.Writer, opts XLSXOptions) error
+	ReadXLSX(r io.Reader, opts XLSXOptions) error
 }
 
 // Dataset is the handler for the IDatasetHndlr interface.
@@ -110,7 +124,10 @@ func (d *Dataset) Serialize() ([]byte, error) {
 	m := make(map[string][]byte, 0)
 	var tx = NewCollection()
 	for i := 0; i < len(d.Tables); i++ {
-		tblBytes, _ := tx.Table.Serialize(&d.Tables[i])
+		tblBytes, err := tx.Table.Serialize(&d.Tables[i])
+		if err != nil {
+			return b, fmt.Errorf("table %s: %v", d.Tables[i].Name, err)
+		}
 		m[d.Tables[i].Name] = tblBytes
 	}
 	var encoded bytes.Buffer
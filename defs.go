@@ -10,9 +10,30 @@ const (
 	Desc
 )
 
+// Storage is how a table stores its rows; see Table.Create.
+type Storage int
+
+const (
+	// RowStorage keeps a Row (map) per row.
+	RowStorage Storage = iota
+
+	// ColumnStorage keeps a typed slice per column (ColumnarRows).
+	ColumnStorage
+)
+
 const (
 	// row_id is the array-index of a Row. It is only
 	// used by IRow to locate a row in the []Row array.
 	row_id         = "_rowid_"
 	col_start_indx = 0
 )
+
+// Column types as set by ResetColTypes. Column.Type may also hold
+// a Go type name (e.g. "string" from Cols.Add).
+const (
+	ColTypeString   = "String"
+	ColTypeInteger  = "Integer"
+	ColTypeFloat    = "Float"
+	ColTypeBool     = "Bool"
+	ColTypeDateTime = "DateTime"
+)
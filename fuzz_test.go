@@ -0,0 +1,98 @@
+// (c) Kamiar Bahri
+
+//go:build go1.18
+// +build go1.18
+
+package collections
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The readers of binary formats must return an error for any
+// input they cannot read, never panic; e.g.
+//
+//	go test -fuzz=FuzzReadParquet
+
+func addSeedFiles(f *testing.F, pattern string) {
+	files, _ := filepath.Glob(filepath.Join("testdata", pattern))
+	for _, p := range files {
+		if data, err := ioutil.ReadFile(p); err == nil {
+			f.Add(data)
+		}
+	}
+}
+
+func FuzzReadArrowIPC(f *testing.F) {
+	tbl := fuzzSeedTable()
+	var stream, file bytes.Buffer
+	tbl.WriteArrowIPC(&stream)
+	tbl.WriteArrowFile(&file)
+	f.Add(stream.Bytes())
+	f.Add(file.Bytes())
+	addSeedFiles(f, "arrow/*")
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tbl, _ := (&Table{}).Create("t")
+		tbl.ReadArrowIPC(bytes.NewReader(data))
+	})
+}
+
+func FuzzReadParquet(f *testing.F) {
+	for _, c := range parquetCompressions {
+		var buf bytes.Buffer
+		fuzzSeedTable().WriteParquet(&buf, ParquetOptions{Compression: c})
+		f.Add(buf.Bytes())
+	}
+	addSeedFiles(f, "parquet/v1-none.parquet")
+	addSeedFiles(f, "parquet/v2-snappy.parquet")
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tbl, _ := (&Table{}).Create("t")
+		tbl.ReadParquet(bytes.NewReader(data))
+	})
+}
+
+func FuzzZstdDecode(f *testing.F) {
+	f.Add(zstdEncode([]byte("abcabcabcabc hello hello hello")))
+	addSeedFiles(f, "codec/*.zst")
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		zstdDecode(data, 1<<20)
+	})
+}
+
+func FuzzSnappyDecode(f *testing.F) {
+	f.Add(snappyEncode([]byte("abcabcabcabc hello hello hello")))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		snappyDecode(data, 1<<20)
+	})
+}
+
+func FuzzDecodeThrift(f *testing.F) {
+	f.Add(encodeThrift(tStruct{{1, "abc"}, {2, []tStruct{{{1, int32(1)}}}}, {3, 1.5}, {20, true}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeThrift(data)
+	})
+}
+
+func fuzzSeedTable() *Table {
+	tbl, _ := (&Table{}).Create("t")
+	for _, c := range []string{"id", "price", "name"} {
+		tbl.Cols.Add(c)
+	}
+	for i, name := range []string{"apple", "", "pear"} {
+		row := tbl.Rows.New()
+		row["id"] = int64(i)
+		row["price"] = float64(i) / 2
+		if name != "" {
+			row["name"] = name
+		}
+	}
+	return tbl
+}
@@ -0,0 +1,82 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// newTestTable creates a table with string columns and rows of
+// values (one per column).
+func newTestTable(t *testing.T, storage Storage, cols []string, rows ...[]interface{}) *Table {
+	t.Helper()
+	tbl, err := (&Table{}).Create("t", storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cols {
+		tbl.Cols.Add(c)
+	}
+	for _, r := range rows {
+		row := tbl.Rows.New()
+		for j, c := range cols {
+			row[c] = r[j]
+		}
+	}
+	return tbl
+}
+
+// tableValues returns the values of the rows, in column order.
+func tableValues(tbl *Table) [][]interface{} {
+	var out [][]interface{}
+	cols := tbl.Cols.Get()
+	for _, r := range tbl.Rows.GetRows() {
+		vals := make([]interface{}, len(cols))
+		for j, c := range cols {
+			vals[j] = r[c.Name]
+		}
+		out = append(out, vals)
+	}
+	return out
+}
+
+// codecTestInput returns text with a few blocks of random bytes;
+// testdata/codec holds it compressed by the reference zstd and
+// snappy encoders.
+func codecTestInput() []byte {
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta"}
+	x := uint64(1)
+	next := func() uint64 {
+		x = x*6364136223846793005 + 1442695040888963407
+		return x >> 33
+	}
+	var b []byte
+	for i := 0; i < 6000; i++ {
+		b = append(b, words[next()%uint64(len(words))]...)
+		b = append(b, byte('0'+next()%3), ' ')
+		if i%2000 == 0 {
+			for k := 0; k < 1000; k++ {
+				b = append(b, byte(next()))
+			}
+		}
+	}
+	return b
+}
+
+// codecInputs returns inputs of different shapes for the codecs.
+func codecInputs() [][]byte {
+	ints := make([]byte, 8*5000)
+	for i := 0; i < 5000; i++ {
+		binary.LittleEndian.PutUint64(ints[8*i:], uint64(i*3))
+	}
+	return [][]byte{
+		{},
+		[]byte("a"),
+		[]byte("abcabcabcabcabcabcabc"),
+		bytes.Repeat([]byte("hello world, "), 1000),
+		bytes.Repeat([]byte{0}, 200000),
+		ints,
+		codecTestInput(),
+	}
+}
@@ -0,0 +1,339 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// Parquet value encodings: the RLE/bit-packing hybrid (levels and
+// dictionary indices), and the delta and byte-stream-split
+// encodings, which are only read.
+
+var errParquetData = errors.New("corrupt page data")
+
+// bitWidth returns the number of bits needed for values up to max.
+func bitWidth(max uint64) uint {
+	return uint(bits.Len64(max))
+}
+
+// rleEncode appends values in the RLE/bit-packing hybrid encoding:
+// runs of 8 or more equal values are RLE runs, the rest is
+// bit-packed in groups of 8.
+func rleEncode(dst []byte, values []uint32, width uint) []byte {
+	byteWidth := int(width+7) / 8
+	runLen := func(i int) int {
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		return j - i
+	}
+
+	i := 0
+	for i < len(values) {
+		if n := runLen(i); n >= 8 {
+			dst = appendUvarint(dst, uint64(n)<<1)
+			for b := 0; b < byteWidth; b++ {
+				dst = append(dst, byte(values[i]>>(8*uint(b))))
+			}
+			i += n
+			continue
+		}
+
+		// bit-pack groups of 8 until a run starts; only the last
+		// group may be padded
+		start := i
+		for i < len(values) {
+			i += 8
+			if i >= len(values) || runLen(i) >= 8 {
+				break
+			}
+		}
+		end := i
+		if end > len(values) {
+			end = len(values)
+		}
+		groups := (i - start) / 8
+		if (i-start)%8 != 0 {
+			groups++
+		}
+		i = end
+
+		dst = appendUvarint(dst, uint64(groups)<<1|1)
+		dst = packBits(dst, values[start:end], width, groups*8)
+	}
+
+	return dst
+}
+
+// packBits appends n values (zero padded) of width bits, LSB first.
+func packBits(dst []byte, values []uint32, width uint, n int) []byte {
+	var acc uint64
+	var nb uint
+	for i := 0; i < n; i++ {
+		var v uint32
+		if i < len(values) {
+			v = values[i]
+		}
+		acc |= uint64(v) << nb
+		nb += width
+		for nb >= 8 {
+			dst = append(dst, byte(acc))
+			acc >>= 8
+			nb -= 8
+		}
+	}
+	if nb > 0 {
+		dst = append(dst, byte(acc))
+	}
+	return dst
+}
+
+// unpackBits reads n values of width bits, LSB first; missing bytes
+// read as zeros.
+func unpackBits(out []uint32, src []byte, width uint, n int) []uint32 {
+	var acc uint64
+	var nb uint
+	pos := 0
+	mask := uint64(1)<<width - 1
+	for i := 0; i < n; i++ {
+		for nb < width {
+			var b byte
+			if pos < len(src) {
+				b = src[pos]
+			}
+			pos++
+			acc |= uint64(b) << nb
+			nb += 8
+		}
+		out = append(out, uint32(acc&mask))
+		acc >>= width
+		nb -= width
+	}
+	return out
+}
+
+// rleDecode reads n values of the RLE/bit-packing hybrid encoding.
+func rleDecode(src []byte, width uint, n int) ([]uint32, error) {
+	if width > 32 {
+		return nil, errParquetData
+	}
+	out := make([]uint32, 0, minInt(n, 1<<16))
+	byteWidth := int(width+7) / 8
+	pos := 0
+
+	for len(out) < n {
+		header, k := binary.Uvarint(src[pos:])
+		if k <= 0 {
+			return nil, errParquetData
+		}
+		pos += k
+
+		if header&1 == 0 {
+			count := int(header >> 1)
+			if pos+byteWidth > len(src) || count == 0 {
+				return nil, errParquetData
+			}
+			var v uint32
+			for b := 0; b < byteWidth; b++ {
+				v |= uint32(src[pos+b]) << (8 * uint(b))
+			}
+			pos += byteWidth
+			if count > n-len(out) {
+				count = n - len(out)
+			}
+			for c := 0; c < count; c++ {
+				out = append(out, v)
+			}
+			continue
+		}
+
+		groups := int(header >> 1)
+		if groups == 0 || pos >= len(src) && width > 0 {
+			return nil, errParquetData
+		}
+		count := groups * 8
+		size := groups * int(width)
+		if count > n-len(out) {
+			count = n - len(out)
+		}
+		end := pos + size
+		if end > len(src) {
+			end = len(src) // a short last run
+		}
+		out = unpackBits(out, src[pos:end], width, count)
+		pos = end
+	}
+
+	return out, nil
+}
+
+// deltaDecode reads values in the DELTA_BINARY_PACKED encoding and
+// returns them with the number of bytes read.
+func deltaDecode(src []byte) ([]int64, int, error) {
+	pos := 0
+	uvarint := func() uint64 {
+		v, k := binary.Uvarint(src[pos:])
+		if k <= 0 {
+			pos = -1
+			return 0
+		}
+		pos += k
+		return v
+	}
+	varint := func() int64 {
+		v, k := binary.Varint(src[pos:])
+		if k <= 0 {
+			pos = -1
+			return 0
+		}
+		pos += k
+		return v
+	}
+
+	blockSize := uvarint()
+	if pos < 0 {
+		return nil, 0, errParquetData
+	}
+	miniBlocks := uvarint()
+	if pos < 0 {
+		return nil, 0, errParquetData
+	}
+	total := uvarint()
+	if pos < 0 {
+		return nil, 0, errParquetData
+	}
+	first := varint()
+	if pos < 0 || miniBlocks == 0 || blockSize%miniBlocks != 0 || blockSize%128 != 0 ||
+		total > uint64(len(src))*64+1 {
+		return nil, 0, errParquetData
+	}
+	perMini := int(blockSize / miniBlocks)
+
+	out := make([]int64, 0, total)
+	if total > 0 {
+		out = append(out, first)
+	}
+	last := uint64(first)
+	var buf []uint32
+
+	for uint64(len(out)) < total {
+		minDelta := uint64(varint())
+		if pos < 0 || pos+int(miniBlocks) > len(src) {
+			return nil, 0, errParquetData
+		}
+		widths := src[pos : pos+int(miniBlocks)]
+		pos += int(miniBlocks)
+
+		for m := 0; m < int(miniBlocks) && uint64(len(out)) < total; m++ {
+			w := uint(widths[m])
+			if w > 64 {
+				return nil, 0, errParquetData
+			}
+			size := perMini * int(w) / 8
+			if pos+size > len(src) {
+				return nil, 0, errParquetData
+			}
+			data := src[pos : pos+size]
+			pos += size
+
+			for i := 0; i < perMini && uint64(len(out)) < total; i++ {
+				var v uint64
+				if w <= 32 {
+					if i == 0 {
+						buf = unpackBits(buf[:0], data, w, perMini)
+					}
+					v = uint64(buf[i])
+				} else {
+					v = readBits64(data, uint(i)*w, w)
+				}
+				last += minDelta + v
+				out = append(out, int64(last))
+			}
+		}
+	}
+
+	return out, pos, nil
+}
+
+// readBits64 reads width bits at a bit position, LSB first.
+func readBits64(src []byte, pos, width uint) uint64 {
+	var v uint64
+	for i := uint(0); i < width; i++ {
+		p := pos + i
+		if src[p/8]&(1<<(p%8)) != 0 {
+			v |= 1 << i
+		}
+	}
+	return v
+}
+
+// deltaLengthDecode reads n byte arrays in the
+// DELTA_LENGTH_BYTE_ARRAY encoding.
+func deltaLengthDecode(src []byte, n int) ([][]byte, error) {
+	lengths, pos, err := deltaDecode(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(lengths) < n {
+		return nil, errParquetData
+	}
+
+	out := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		l := lengths[i]
+		if l < 0 || int64(pos)+l > int64(len(src)) {
+			return nil, errParquetData
+		}
+		out[i] = src[pos : pos+int(l)]
+		pos += int(l)
+	}
+	return out, nil
+}
+
+// deltaByteArrayDecode reads n byte arrays in the DELTA_BYTE_ARRAY
+// (incremental) encoding.
+func deltaByteArrayDecode(src []byte, n int) ([][]byte, error) {
+	prefixes, pos, err := deltaDecode(src)
+	if err != nil {
+		return nil, err
+	}
+	suffixes, err := deltaLengthDecode(src[pos:], n)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefixes) < n {
+		return nil, errParquetData
+	}
+
+	out := make([][]byte, n)
+	var prev []byte
+	for i := 0; i < n; i++ {
+		p := prefixes[i]
+		if p < 0 || p > int64(len(prev)) {
+			return nil, errParquetData
+		}
+		v := make([]byte, 0, int(p)+len(suffixes[i]))
+		v = append(append(v, prev[:p]...), suffixes[i]...)
+		out[i] = v
+		prev = v
+	}
+	return out, nil
+}
+
+// byteStreamSplitDecode joins the byte streams of n values of
+// width bytes.
+func byteStreamSplitDecode(src []byte, width, n int) ([]byte, error) {
+	if len(src) < width*n {
+		return nil, errParquetData
+	}
+	out := make([]byte, width*n)
+	for i := 0; i < n; i++ {
+		for k := 0; k < width; k++ {
+			out[i*width+k] = src[k*n+i]
+		}
+	}
+	return out, nil
+}
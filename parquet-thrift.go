@@ -0,0 +1,391 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// A minimal Thrift compact protocol encoder/decoder for the Parquet
+// metadata (parquet.thrift). Structs are handled generically: a
+// tStruct is a list of fields by id, written from Go values and
+// read back into Go values.
+
+// compact protocol types
+const (
+	tStop      = 0
+	tTrue      = 1
+	tFalse     = 2
+	tByte      = 3
+	tI16       = 4
+	tI32       = 5
+	tI64       = 6
+	tDouble    = 7
+	tBinary    = 8
+	tList      = 9
+	tSet       = 10
+	tMap       = 11
+	tStructTyp = 12
+)
+
+// tField is a field of a thrift struct. When writing, v is one of
+// bool, int8, int16, int32, int64, float64, string, []byte,
+// tStruct, []int32, []string or []tStruct. When reading, integers
+// are int64, strings []byte and lists []interface{}.
+type tField struct {
+	id int16
+	v  interface{}
+}
+
+// tStruct is a thrift struct; fields are written in order.
+type tStruct []tField
+
+// errThrift is returned for metadata that cannot be decoded.
+var errThrift = errors.New("parquet: invalid thrift metadata")
+
+// encodeThrift returns the compact encoding of a struct.
+func encodeThrift(s tStruct) []byte {
+	w := &thriftWriter{}
+	w.writeStruct(s)
+	return w.buf
+}
+
+type thriftWriter struct {
+	buf []byte
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	for v >= 0x80 {
+		w.buf = append(w.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) binary(b []byte) {
+	w.varint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *thriftWriter) listHeader(elemType byte, n int) {
+	if n < 15 {
+		w.buf = append(w.buf, byte(n<<4)|elemType)
+		return
+	}
+	w.buf = append(w.buf, 0xF0|elemType)
+	w.varint(uint64(n))
+}
+
+func thriftType(v interface{}) byte {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return tTrue
+		}
+		return tFalse
+	case int8:
+		return tByte
+	case int16:
+		return tI16
+	case int32:
+		return tI32
+	case int64:
+		return tI64
+	case float64:
+		return tDouble
+	case string, []byte:
+		return tBinary
+	case tStruct:
+		return tStructTyp
+	case []int32, []string, []tStruct:
+		return tList
+	}
+	panic("parquet: unsupported thrift value")
+}
+
+func (w *thriftWriter) writeStruct(s tStruct) {
+	var last int16
+	for _, f := range s {
+		typ := thriftType(f.v)
+		if d := f.id - last; d > 0 && d <= 15 {
+			w.buf = append(w.buf, byte(d<<4)|typ)
+		} else {
+			w.buf = append(w.buf, typ)
+			w.zigzag(int64(f.id))
+		}
+		last = f.id
+		w.writeValue(f.v)
+	}
+	w.buf = append(w.buf, tStop)
+}
+
+func (w *thriftWriter) writeValue(v interface{}) {
+	switch x := v.(type) {
+	case bool:
+		// the value is in the field type
+	case int8:
+		w.buf = append(w.buf, byte(x))
+	case int16:
+		w.zigzag(int64(x))
+	case int32:
+		w.zigzag(int64(x))
+	case int64:
+		w.zigzag(x)
+	case float64:
+		w.buf = append(w.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(w.buf[len(w.buf)-8:], math.Float64bits(x))
+	case string:
+		w.binary([]byte(x))
+	case []byte:
+		w.binary(x)
+	case tStruct:
+		w.writeStruct(x)
+	case []int32:
+		w.listHeader(tI32, len(x))
+		for i := 0; i < len(x); i++ {
+			w.zigzag(int64(x[i]))
+		}
+	case []string:
+		w.listHeader(tBinary, len(x))
+		for i := 0; i < len(x); i++ {
+			w.binary([]byte(x[i]))
+		}
+	case []tStruct:
+		w.listHeader(tStructTyp, len(x))
+		for i := 0; i < len(x); i++ {
+			w.writeStruct(x[i])
+		}
+	}
+}
+
+// decodeThrift decodes a struct at the start of data, and returns
+// it with the number of bytes it takes.
+func decodeThrift(data []byte) (tStruct, int, error) {
+	r := &thriftReader{buf: data}
+	s, err := r.readStruct(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, r.pos, nil
+}
+
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errThrift
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errThrift
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	v, err := r.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (r *thriftReader) binary() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errThrift
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// maxThriftDepth limits the nesting of structs and lists.
+const maxThriftDepth = 64
+
+func (r *thriftReader) readStruct(depth int) (tStruct, error) {
+	if depth > maxThriftDepth {
+		return nil, errThrift
+	}
+
+	var s tStruct
+	var last int16
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == tStop {
+			return s, nil
+		}
+
+		typ := b & 0x0F
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			v, err := r.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		last = id
+
+		var v interface{}
+		switch typ {
+		case tTrue:
+			v = true
+		case tFalse:
+			v = false
+		default:
+			if v, err = r.readValue(typ, depth); err != nil {
+				return nil, err
+			}
+		}
+		s = append(s, tField{id: id, v: v})
+	}
+}
+
+func (r *thriftReader) readValue(typ byte, depth int) (interface{}, error) {
+	switch typ {
+	case tTrue, tFalse:
+		// a bool in a list or map is a byte
+		b, err := r.byte()
+		return b == tTrue, err
+	case tByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		return r.zigzag()
+	case tDouble:
+		if r.pos+8 > len(r.buf) {
+			return nil, errThrift
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case tBinary:
+		return r.binary()
+	case tStructTyp:
+		return r.readStruct(depth + 1)
+	case tList, tSet:
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(b >> 4)
+		if n == 15 {
+			if n, err = r.varint(); err != nil {
+				return nil, err
+			}
+		}
+		if n > uint64(len(r.buf)-r.pos) {
+			return nil, errThrift
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if list[i], err = r.readValue(b&0x0F, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case tMap:
+		n, err := r.varint()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		kv, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.buf)-r.pos) {
+			return nil, errThrift
+		}
+		// maps are not used by parquet; the entries are skipped
+		for i := uint64(0); i < n; i++ {
+			if _, err := r.readValue(kv>>4, depth+1); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(kv&0x0F, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	return nil, errThrift
+}
+
+// field returns the value of a field, or nil if it is absent.
+func (s tStruct) field(id int16) interface{} {
+	for i := 0; i < len(s); i++ {
+		if s[i].id == id {
+			return s[i].v
+		}
+	}
+	return nil
+}
+
+func (s tStruct) has(id int16) bool {
+	return s.field(id) != nil
+}
+
+func (s tStruct) int(id int16, def int64) int64 {
+	if v, ok := s.field(id).(int64); ok {
+		return v
+	}
+	return def
+}
+
+func (s tStruct) bool(id int16, def bool) bool {
+	if v, ok := s.field(id).(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (s tStruct) bytes(id int16) []byte {
+	v, _ := s.field(id).([]byte)
+	return v
+}
+
+func (s tStruct) str(id int16) string {
+	return string(s.bytes(id))
+}
+
+func (s tStruct) sub(id int16) tStruct {
+	v, _ := s.field(id).(tStruct)
+	return v
+}
+
+func (s tStruct) list(id int16) []interface{} {
+	v, _ := s.field(id).([]interface{})
+	return v
+}
+
+// union returns the id of the field that is set in a union, or 0.
+func (s tStruct) union() int16 {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[0].id
+}
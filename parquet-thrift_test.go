@@ -0,0 +1,87 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestThriftRoundTrip(t *testing.T) {
+	in := tStruct{
+		{1, int32(-7)},
+		{2, true},
+		{3, false},
+		{4, int64(1) << 40},
+		{5, "name"},
+		{6, []byte{0, 1, 2}},
+		{7, 2.5},
+		{8, int8(-3)},
+		{9, int16(300)},
+		{40, tStruct{{1, int32(1)}, {2, []string{"a", "bc"}}}},
+		{41, []int32{1, -2, 3}},
+		{42, []tStruct{{{1, int64(5)}}, {{1, int64(6)}}}},
+	}
+	data := encodeThrift(in)
+	s, n, err := decodeThrift(append(data, 0xAA))
+	if err != nil || n != len(data) {
+		t.Fatalf("read %d of %d bytes: %v", n, len(data), err)
+	}
+	if s.int(1, 0) != -7 || !s.bool(2, false) || s.bool(3, true) || s.int(4, 0) != 1<<40 {
+		t.Fatalf("ints and bools: %v", s)
+	}
+	if s.str(5) != "name" || !bytes.Equal(s.bytes(6), []byte{0, 1, 2}) || s.field(7) != 2.5 {
+		t.Fatalf("binary and double: %v", s)
+	}
+	if s.int(8, 0) != -3 || s.int(9, 0) != 300 {
+		t.Fatalf("byte and i16: %v", s)
+	}
+	if sub := s.sub(40); sub.int(1, 0) != 1 || fmt.Sprintf("%s", sub.list(2)) != "[a bc]" {
+		t.Fatalf("struct: %v", sub)
+	}
+	if got := fmt.Sprint(s.list(41)); got != "[1 -2 3]" {
+		t.Fatalf("list: %s", got)
+	}
+	if l := s.list(42); len(l) != 2 || l[1].(tStruct).int(1, 0) != 6 {
+		t.Fatalf("list of structs: %v", l)
+	}
+	if s.has(10) || s.int(10, 99) != 99 {
+		t.Fatal("absent field")
+	}
+}
+
+// The bytes are those of the Thrift compact protocol: short and
+// long field headers, a list, a bool in the field type and a nested
+// struct.
+func TestThriftCompactEncoding(t *testing.T) {
+	in := tStruct{
+		{1, int32(1)},
+		{2, []string{"ab"}},
+		{20, int64(-2)},
+		{21, true},
+		{22, tStruct{{1, false}}},
+	}
+	want := []byte{0x15, 0x02, 0x19, 0x18, 0x02, 'a', 'b', 0x06, 0x28, 0x03, 0x11, 0x1C, 0x12, 0x00, 0x00}
+	if got := encodeThrift(in); !bytes.Equal(got, want) {
+		t.Fatalf("got % x\nwant % x", got, want)
+	}
+}
+
+func TestThriftCorruptInput(t *testing.T) {
+	data := encodeThrift(tStruct{{1, "abc"}, {2, []tStruct{{{1, int32(1)}}}}, {3, 1.5}})
+	for n := 0; n < len(data); n++ {
+		if _, _, err := decodeThrift(data[:n]); err == nil {
+			t.Fatalf("truncated to %d: no error", n)
+		}
+	}
+
+	// structs nested too deeply
+	deep := bytes.Repeat([]byte{0x1C}, 10000)
+	if _, _, err := decodeThrift(deep); err == nil {
+		t.Fatal("deep nesting: no error")
+	}
+	// a list longer than the input
+	if _, _, err := decodeThrift([]byte{0x19, 0xF8, 0xFF, 0xFF, 0xFF, 0x0F}); err == nil {
+		t.Fatal("long list: no error")
+	}
+}
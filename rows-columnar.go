@@ -0,0 +1,367 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ColumnarRows is an IRows that stores the values column by column
+// in typed slices with NULL bitmaps, instead of a map per row. Use
+// it with Create(name, ColumnStorage).
+//
+// Rows are views: GetRow and GetRows build a Row from the columns,
+// so changes to them are only stored by UpdateRow (or SetValue).
+// The Row returned by New (or passed to Add) is stored on the next
+// call to any method of the table's Rows, so it can be filled in
+// as usual. Keys that are not columns are not stored.
+type ColumnarRows struct {
+	Columns    []Column
+	Tags       []RowTags
+	RowHashes  []RowHash
+	SharedData []SharedDataItem
+
+	// tag name -> row indexes; nil when it needs to be built
+	tagIndex map[string][]int
+
+	vectors map[string]*columnVector
+	n       int
+
+	// rows returned by New/Add that are not yet stored
+	pending    []Row
+	pendingIdx []int
+
+	// set by Cols.SetNamePolicy
+	namePolicy ColumnNamePolicy
+}
+
+func newColumnarRows() *ColumnarRows {
+	return &ColumnarRows{vectors: make(map[string]*columnVector)}
+}
+
+// flush computes and stores the pending rows.
+func (r *ColumnarRows) flush() {
+	if len(r.pending) == 0 {
+		return
+	}
+	order := computedOrder(r.Columns)
+	for p := 0; p < len(r.pending); p++ {
+		if len(order) > 0 {
+			computeRow(r.Columns, order, r.pending[p], nil)
+		}
+		r.store(r.pendingIdx[p], r.pending[p])
+	}
+	r.pending = r.pending[:0]
+	r.pendingIdx = r.pendingIdx[:0]
+}
+
+// store writes the column values of row to row i.
+func (r *ColumnarRows) store(i int, row Row) {
+	for j := 0; j < len(r.Columns); j++ {
+		r.vectorOf(r.Columns[j].Name).set(i, row[r.Columns[j].Name])
+	}
+}
+
+// vectorOf returns the vector of a column, creating it if needed.
+func (r *ColumnarRows) vectorOf(name string) *columnVector {
+	v := r.vectors[name]
+	if v == nil {
+		v = newColumnVector(r.n)
+		r.vectors[name] = v
+	}
+	return v
+}
+
+// view builds the Row of row i.
+func (r *ColumnarRows) view(i int) Row {
+	row := make(Row, len(r.Columns)+1)
+	row[row_id] = i
+	for j := 0; j < len(r.Columns); j++ {
+		row[r.Columns[j].Name] = r.vectorOf(r.Columns[j].Name).get(i)
+	}
+	return row
+}
+
+// appendRow adds a row of nils and returns its index.
+func (r *ColumnarRows) appendRow() int {
+	for j := 0; j < len(r.Columns); j++ {
+		r.vectorOf(r.Columns[j].Name).grow()
+	}
+	r.Tags = append(r.Tags, nil)
+	r.n++
+	return r.n - 1
+}
+
+func (r *ColumnarRows) New() Row {
+	r.flush()
+
+	i := r.appendRow()
+	row := r.view(i)
+
+	r.pending = append(r.pending, row)
+	r.pendingIdx = append(r.pendingIdx, i)
+
+	return row
+}
+
+func (r *ColumnarRows) Add(row Row) {
+	r.flush()
+
+	i := r.appendRow()
+	r.pending = append(r.pending, row)
+	r.pendingIdx = append(r.pendingIdx, i)
+}
+
+// SetColumns sets the columns; the values of columns that are kept
+// (by name) are kept, new columns are nil.
+func (r *ColumnarRows) SetColumns(cols []Column) {
+	r.flush()
+
+	r.Columns = cols
+
+	vectors := make(map[string]*columnVector, len(cols))
+	for j := 0; j < len(cols); j++ {
+		vectors[cols[j].Name] = r.vectorOf(cols[j].Name)
+	}
+	r.vectors = vectors
+}
+
+func (r *ColumnarRows) GetColumns() []Column {
+	return r.Columns
+}
+
+func (r *ColumnarRows) Count() int {
+	return r.n
+}
+
+// GetJSON returns the rows as a JSON array of objects; the keys
+// are _rowid_ followed by the columns in order.
+func (r *ColumnarRows) GetJSON() string {
+	r.flush()
+	names := append([]string{row_id}, columnNames(r.Columns)...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < r.n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSONObject(&buf, r.view(i), names); err != nil {
+			return ""
+		}
+	}
+	buf.WriteByte(']')
+
+	return buf.String()
+}
+
+func (r *ColumnarRows) GetRowJSON(inx int) string {
+	row := r.GetRow(inx)
+	if row == nil {
+		return "null"
+	}
+	names := append([]string{row_id}, columnNames(r.Columns)...)
+
+	var buf bytes.Buffer
+	if err := encodeJSONObject(&buf, row, names); err != nil {
+		return ""
+	}
+
+	return buf.String()
+}
+
+// GetRows builds a view of every row.
+func (r *ColumnarRows) GetRows() []Row {
+	r.flush()
+
+	rows := make([]Row, r.n)
+	for i := 0; i < r.n; i++ {
+		rows[i] = r.view(i)
+	}
+	return rows
+}
+
+func (r *ColumnarRows) GetRow(indx int) Row {
+	r.flush()
+
+	if indx < 0 || indx >= r.n {
+		return nil
+	}
+	return r.view(indx)
+}
+
+func (r *ColumnarRows) GetLastRow() Row {
+	return r.GetRow(r.n - 1)
+}
+
+func (r *ColumnarRows) GetRowIndex(row Row) int {
+	if i, ok := row[row_id].(int); ok {
+		return i
+	}
+	return -1
+}
+
+func (r *ColumnarRows) GetLastRowIndex() int {
+	return r.n - 1
+}
+
+// UpdateRow stores the column values of row (located by _rowid_),
+// and computes its computed columns.
+func (r *ColumnarRows) UpdateRow(row Row) error {
+	r.flush()
+
+	i := r.GetRowIndex(row)
+	if i < 0 || i >= r.n {
+		return errors.New("out of bound index")
+	}
+
+	order := computedOrder(r.Columns)
+	if len(order) == 0 {
+		r.store(i, row)
+		return nil
+	}
+
+	m := r.view(i)
+	for j := 0; j < len(r.Columns); j++ {
+		if r.Columns[j].computed == nil {
+			m[r.Columns[j].Name] = row[r.Columns[j].Name]
+		}
+	}
+	err := computeRow(r.Columns, order, m, nil)
+	r.store(i, m)
+
+	return err
+}
+
+// GetValue returns the value of a column in row i.
+func (r *ColumnarRows) GetValue(i int, colName string) (interface{}, error) {
+	r.flush()
+
+	if i < 0 || i >= r.n {
+		return nil, errors.New("out of bound index")
+	}
+	j := r.namePolicy.find(r.Columns, colName)
+	if j < 0 {
+		return nil, fmt.Errorf("column not found: %s", colName)
+	}
+	return r.vectorOf(r.Columns[j].Name).get(i), nil
+}
+
+// SetValue sets the value of a column in row i, and computes the
+// computed columns that depend on it.
+func (r *ColumnarRows) SetValue(i int, colName string, v interface{}) error {
+	r.flush()
+
+	if i < 0 || i >= r.n {
+		return errors.New("out of bound index")
+	}
+	j := r.namePolicy.find(r.Columns, colName)
+	if j < 0 {
+		return fmt.Errorf("column not found: %s", colName)
+	}
+	if err := checkNotComputed(r.Columns, j); err != nil {
+		return err
+	}
+	r.vectorOf(r.Columns[j].Name).set(i, v)
+
+	if order := computedOrder(r.Columns); len(order) > 0 {
+		m := r.view(i)
+		err := computeRow(r.Columns, order, m, []string{r.Columns[j].Name})
+		r.store(i, m)
+		return err
+	}
+
+	return nil
+}
+
+// columnData returns all values of a column, read from its vector.
+func (r *ColumnarRows) columnData(colName string) []interface{} {
+	r.flush()
+
+	v := r.vectors[colName]
+	if v == nil {
+		return nil
+	}
+	return v.values()
+}
+
+// InsertRecords reads a two-dim. string arrary into the Table.
+// Note: there is perfomance hit when verbose is on
+func (r *ColumnarRows) InsertRecords(input [][]string, verbose bool) {
+	recordCount := len(input)
+	fmtCount := fmt.Sprintf("%v", formatNumber(int64(recordCount)))
+
+	for i := 0; i < recordCount; i++ {
+		if verbose {
+			fmt.Printf("\rcreating data-table: row %v of %s", formatNumber(int64(i)), fmtCount)
+		}
+		r.InsertSingleRecord(input[i])
+	}
+}
+
+func (r *ColumnarRows) InsertSingleRecord(input []string) {
+	r.flush()
+
+	i := r.appendRow()
+
+	// missing fields are left nil; extra fields are ignored
+	for j := col_start_indx; j < len(r.Columns) && j < len(input); j++ {
+		r.vectorOf(r.Columns[j].Name).set(i, input[j])
+	}
+
+	if order := computedOrder(r.Columns); len(order) > 0 {
+		m := r.view(i)
+		computeRow(r.Columns, order, m, nil)
+		r.store(i, m)
+	}
+}
+
+// RemoveAt removes rows (by index); the rows after them move up.
+func (r *ColumnarRows) RemoveAt(rowIndexes ...int) error {
+	r.flush()
+
+	drop, err := dropMask(rowIndexes, r.n)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range r.vectors {
+		v.remove(drop)
+	}
+	k := 0
+	for i := 0; i < r.n && i < len(r.Tags); i++ {
+		if !drop[i] {
+			r.Tags[k] = r.Tags[i]
+			k++
+		}
+	}
+	r.Tags = r.Tags[:k]
+	r.tagIndex = nil
+
+	n := 0
+	for i := 0; i < r.n; i++ {
+		if !drop[i] {
+			n++
+		}
+	}
+	r.n = n
+	r.pruneSharedData()
+
+	return nil
+}
+
+func (r *ColumnarRows) Clear() {
+	r.pending = r.pending[:0]
+	r.pendingIdx = r.pendingIdx[:0]
+	r.n = 0
+	r.Tags = make([]RowTags, 0)
+	r.tagIndex = nil
+	r.SharedData = nil
+
+	vectors := make(map[string]*columnVector, len(r.Columns))
+	for j := 0; j < len(r.Columns); j++ {
+		vectors[r.Columns[j].Name] = newColumnVector(0)
+	}
+	r.vectors = vectors
+}
@@ -0,0 +1,40 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Changes to a row are stored by SetValue and UpdateRow with both
+// storages; with column storage a row from GetRow is a copy.
+func TestRowChangesAreStored(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl := newTestTable(t, storage, []string{"a", "b"},
+			[]interface{}{int64(1), "x"},
+			[]interface{}{int64(2), "y"},
+		)
+		if err := tbl.Cols.AddComputed("c", "a * 10"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tbl.Rows.SetValue(0, "a", int64(3)); err != nil {
+			t.Fatal(err)
+		}
+		row := tbl.Rows.GetRow(1)
+		row["a"], row["b"] = int64(4), "z"
+		if err := tbl.Rows.UpdateRow(row); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(tableValues(tbl)); got != "[[3 x 30] [4 z 40]]" {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+
+		if storage == ColumnStorage {
+			tbl.Rows.GetRow(0)["b"] = "lost"
+			if v, _ := tbl.Rows.GetValue(0, "b"); v != "x" {
+				t.Fatalf("GetRow is not a copy: b = %v", v)
+			}
+		}
+	}
+}
@@ -5,13 +5,14 @@ package collections
 type Row map[string]interface{}
 
 // Tag provides additional info that can be added to a row.
-// Each has an associated tag, which can be empty.
+// A row can have several tags, with different names.
 type Tag struct {
 	Name string      // this is not unique; it helps to group related rows
 	Data interface{} //optional user-data
 }
 
-// SharedDataItem is a data is linked to rows by tag name.
+// SharedDataItem is a data is linked to rows by tag name; it is
+// removed when no row has the tag anymore.
 type SharedDataItem struct {
 	TagName string
 	Data    interface{}
@@ -28,10 +29,24 @@ type RowHash struct {
 type Rows struct {
 	Rows    []Row
 	Columns []Column
-	Tags    []Tag
+
+	// Tags holds the tags of each row. It was a []Tag (one tag per
+	// row) before rows could have several tags; Tags[i][0] is what
+	// Tags[i] was, and GetTag and SetTag work as before.
+	Tags []RowTags
 
 	// TODO:
 	RowHashes []RowHash
 
 	SharedData []SharedDataItem
+
+	// rows from this index on have not been computed yet
+	// (see Cols.AddComputed)
+	evaluated int
+
+	// set by Cols.SetNamePolicy
+	namePolicy ColumnNamePolicy
+
+	// tag name -> row indexes; nil when it needs to be built
+	tagIndex map[string][]int
 }
@@ -0,0 +1,158 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+)
+
+// findSharedData returns the position of the item of a tag, or -1.
+func findSharedData(items []SharedDataItem, tagName string) int {
+	for i := 0; i < len(items); i++ {
+		if items[i].TagName == tagName {
+			return i
+		}
+	}
+	return -1
+}
+
+// addSharedData checks that the tag of item has rows (index[name])
+// and no item yet, and appends item.
+func addSharedData(items []SharedDataItem, index map[string][]int, item SharedDataItem) ([]SharedDataItem, error) {
+	if item.TagName == "" {
+		return items, errors.New("tag name is blank")
+	}
+	// the tag-name of the shared-data must exist in the row-tags' list
+	if len(index[item.TagName]) == 0 {
+		return items, fmt.Errorf("no rows found by tag name: %s", item.TagName)
+	}
+	if findSharedData(items, item.TagName) >= 0 {
+		return items, errors.New("shared data item already exists")
+	}
+	return append(items, item), nil
+}
+
+func updateSharedData(items []SharedDataItem, item SharedDataItem) error {
+	i := findSharedData(items, item.TagName)
+	if i < 0 {
+		return fmt.Errorf("shared data item not found: %s", item.TagName)
+	}
+	items[i].Data = item.Data
+	return nil
+}
+
+func removeSharedData(items []SharedDataItem, tagName string) ([]SharedDataItem, error) {
+	i := findSharedData(items, tagName)
+	if i < 0 {
+		return items, fmt.Errorf("shared data item not found: %s", tagName)
+	}
+	return append(items[:i:i], items[i+1:]...), nil
+}
+
+// pruneSharedData drops the items of tags that no row has.
+func pruneSharedData(items []SharedDataItem, index map[string][]int) []SharedDataItem {
+	var kept []SharedDataItem
+	for _, it := range items {
+		if len(index[it.TagName]) > 0 {
+			kept = append(kept, it)
+		}
+	}
+	return kept
+}
+
+// AddSharedData adds the data of a tag; at least one row must have
+// the tag, and it must not have data yet.
+func (r *Rows) AddSharedData(sharedDataItem SharedDataItem) error {
+	_, index := r.tags()
+	items, err := addSharedData(r.SharedData, index, sharedDataItem)
+	r.SharedData = items
+	return err
+}
+
+// UpdateSharedData replaces the data of a tag.
+func (r *Rows) UpdateSharedData(sharedDataItem SharedDataItem) error {
+	return updateSharedData(r.SharedData, sharedDataItem)
+}
+
+// RemoveSharedData removes the data of a tag.
+func (r *Rows) RemoveSharedData(tagName string) error {
+	items, err := removeSharedData(r.SharedData, tagName)
+	r.SharedData = items
+	return err
+}
+
+// GetSharedData returns the data of a tag, or a blank item.
+func (r *Rows) GetSharedData(tagName string) SharedDataItem {
+	item, _ := r.LookupSharedData(tagName)
+	return item
+}
+
+// LookupSharedData returns the data of a tag, and whether it has any.
+func (r *Rows) LookupSharedData(tagName string) (SharedDataItem, bool) {
+	if i := findSharedData(r.SharedData, tagName); i >= 0 {
+		return r.SharedData[i], true
+	}
+	return SharedDataItem{}, false
+}
+
+// GetSharedDataItems returns the shared data of all tags.
+func (r *Rows) GetSharedDataItems() []SharedDataItem {
+	return append([]SharedDataItem(nil), r.SharedData...)
+}
+
+// pruneSharedData drops the shared data of tags that no row has.
+func (r *Rows) pruneSharedData() {
+	if len(r.SharedData) == 0 {
+		return
+	}
+	_, index := r.tags()
+	r.SharedData = pruneSharedData(r.SharedData, index)
+}
+
+// AddSharedData adds the data of a tag; at least one row must have
+// the tag, and it must not have data yet.
+func (r *ColumnarRows) AddSharedData(sharedDataItem SharedDataItem) error {
+	_, index := r.tags()
+	items, err := addSharedData(r.SharedData, index, sharedDataItem)
+	r.SharedData = items
+	return err
+}
+
+// UpdateSharedData replaces the data of a tag.
+func (r *ColumnarRows) UpdateSharedData(sharedDataItem SharedDataItem) error {
+	return updateSharedData(r.SharedData, sharedDataItem)
+}
+
+// RemoveSharedData removes the data of a tag.
+func (r *ColumnarRows) RemoveSharedData(tagName string) error {
+	items, err := removeSharedData(r.SharedData, tagName)
+	r.SharedData = items
+	return err
+}
+
+// GetSharedData returns the data of a tag, or a blank item.
+func (r *ColumnarRows) GetSharedData(tagName string) SharedDataItem {
+	item, _ := r.LookupSharedData(tagName)
+	return item
+}
+
+// LookupSharedData returns the data of a tag, and whether it has any.
+func (r *ColumnarRows) LookupSharedData(tagName string) (SharedDataItem, bool) {
+	if i := findSharedData(r.SharedData, tagName); i >= 0 {
+		return r.SharedData[i], true
+	}
+	return SharedDataItem{}, false
+}
+
+// GetSharedDataItems returns the shared data of all tags.
+func (r *ColumnarRows) GetSharedDataItems() []SharedDataItem {
+	return append([]SharedDataItem(nil), r.SharedData...)
+}
+
+func (r *ColumnarRows) pruneSharedData() {
+	if len(r.SharedData) == 0 {
+		return
+	}
+	_, index := r.tags()
+	r.SharedData = pruneSharedData(r.SharedData, index)
+}
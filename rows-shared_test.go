@@ -0,0 +1,154 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSharedData(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		for i := 1; i <= 3; i++ {
+			tbl.Rows.New()["a"] = i
+		}
+		rs := tbl.Rows
+		rs.AddTag(0, Tag{Name: "x"})
+		rs.AddTag(2, Tag{Name: "y"})
+
+		if err := rs.AddSharedData(SharedDataItem{TagName: "z", Data: 1}); err == nil {
+			t.Fatalf("storage %d: no row has the tag: no error", storage)
+		}
+		if err := rs.AddSharedData(SharedDataItem{TagName: "x", Data: "dx"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.AddSharedData(SharedDataItem{TagName: "x", Data: "dx"}); err == nil {
+			t.Fatalf("storage %d: adding twice: no error", storage)
+		}
+		rs.AddSharedData(SharedDataItem{TagName: "y", Data: 5})
+
+		if err := rs.UpdateSharedData(SharedDataItem{TagName: "x", Data: "dx2"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.UpdateSharedData(SharedDataItem{TagName: "q"}); err == nil {
+			t.Fatalf("storage %d: updating a missing item: no error", storage)
+		}
+		if it, ok := rs.LookupSharedData("x"); !ok || it.Data != "dx2" {
+			t.Fatalf("storage %d: lookup %v, %v", storage, it, ok)
+		}
+		if it, ok := rs.LookupSharedData("q"); ok || it.TagName != "" || rs.GetSharedData("q").TagName != "" {
+			t.Fatalf("storage %d: lookup of a missing item %v", storage, it)
+		}
+		if got := fmt.Sprint(rs.GetSharedDataItems()); got != "[{x dx2} {y 5}]" {
+			t.Fatalf("storage %d: items %s", storage, got)
+		}
+
+		if err := rs.RemoveSharedData("y"); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.RemoveSharedData("y"); err == nil {
+			t.Fatalf("storage %d: removing twice: no error", storage)
+		}
+		if got := fmt.Sprint(rs.GetSharedDataItems()); got != "[{x dx2}]" {
+			t.Fatalf("storage %d: after remove %s", storage, got)
+		}
+	}
+}
+
+// An item goes when the last row with its tag goes.
+func TestSharedDataCleanup(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		for i := 1; i <= 4; i++ {
+			tbl.Rows.New()["a"] = i
+		}
+		rs := tbl.Rows
+		rs.AddTag(0, Tag{Name: "x"})
+		rs.AddTag(2, Tag{Name: "x"})
+		rs.AddTag(3, Tag{Name: "y"})
+		rs.AddSharedData(SharedDataItem{TagName: "x"})
+		rs.AddSharedData(SharedDataItem{TagName: "y"})
+
+		rs.RemoveAt(0)
+		if _, ok := rs.LookupSharedData("x"); !ok {
+			t.Fatalf("storage %d: x removed while a row has the tag", storage)
+		}
+		rs.RemoveTag(1, "x")
+		if _, ok := rs.LookupSharedData("x"); ok {
+			t.Fatalf("storage %d: x kept after RemoveTag", storage)
+		}
+		rs.SetTag(2, Tag{Name: "w"})
+		if _, ok := rs.LookupSharedData("y"); ok {
+			t.Fatalf("storage %d: y kept after SetTag", storage)
+		}
+
+		rs.AddSharedData(SharedDataItem{TagName: "w"})
+		rs.RemoveByTag("w")
+		if len(rs.GetSharedDataItems()) != 0 || rs.Count() != 2 {
+			t.Fatalf("storage %d: after RemoveByTag %v, %d rows", storage, rs.GetSharedDataItems(), rs.Count())
+		}
+
+		rs.AddTag(0, Tag{Name: "k"})
+		rs.AddSharedData(SharedDataItem{TagName: "k"})
+		rs.Clear()
+		if len(rs.GetSharedDataItems()) != 0 {
+			t.Fatalf("storage %d: after Clear %v", storage, rs.GetSharedDataItems())
+		}
+	}
+}
+
+func TestSharedDataPersist(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		tbl.Rows.New()["a"] = 1
+		tbl.Rows.New()["a"] = 2
+		tbl.Rows.AddTag(0, Tag{Name: "x"})
+		tbl.Rows.AddTag(1, Tag{Name: "y"})
+		tbl.Rows.AddSharedData(SharedDataItem{TagName: "x", Data: "dx"})
+		tbl.Rows.AddSharedData(SharedDataItem{TagName: "y", Data: int64(5)})
+		const want = "[{x dx} {y 5}]"
+
+		b, err := tbl.Serialize(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := tbl.Deserialize(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(back.Rows.GetSharedDataItems()); got != want {
+			t.Fatalf("storage %d: binary %s", storage, got)
+		}
+
+		j, err := tbl.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		back = &Table{}
+		if err := back.UnmarshalJSON(j); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(back.Rows.GetSharedDataItems()); got != want {
+			t.Fatalf("storage %d: JSON %s", storage, got)
+		}
+
+		ds := &Dataset{}
+		if err := ds.Add(*tbl); err != nil {
+			t.Fatal(err)
+		}
+		b, err = ds.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbls, err := ds.Deserialize(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(tbls[0].Rows.GetSharedDataItems()); got != want {
+			t.Fatalf("storage %d: dataset %s", storage, got)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RowTags are the tags of a row, in the order they were added; a
+// row has at most one tag of each name.
+type RowTags []Tag
+
+// find returns the position of the tag named name, or -1.
+func (t RowTags) find(name string) int {
+	for i := 0; i < len(t); i++ {
+		if t[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// buildTagIndex maps each tag name to the (ascending) indexes of the
+// rows that have it.
+func buildTagIndex(tags []RowTags) map[string][]int {
+	index := make(map[string][]int)
+	for i := 0; i < len(tags); i++ {
+		for _, t := range tags[i] {
+			index[t.Name] = append(index[t.Name], i)
+		}
+	}
+	return index
+}
+
+// indexAdd and indexRemove keep a tag index in step with a change
+// to row i; they do nothing to an index that is not built yet.
+func indexAdd(index map[string][]int, name string, i int) {
+	if index == nil {
+		return
+	}
+	ids := index[name]
+	k := sort.SearchInts(ids, i)
+	ids = append(ids, 0)
+	copy(ids[k+1:], ids[k:])
+	ids[k] = i
+	index[name] = ids
+}
+
+func indexRemove(index map[string][]int, name string, i int) {
+	if index == nil {
+		return
+	}
+	ids := index[name]
+	k := sort.SearchInts(ids, i)
+	if k == len(ids) || ids[k] != i {
+		return
+	}
+	if len(ids) == 1 {
+		delete(index, name)
+		return
+	}
+	index[name] = append(ids[:k], ids[k+1:]...)
+}
+
+// setRowTags replaces the tags of row i.
+func setRowTags(tags []RowTags, index map[string][]int, i int, t RowTags) error {
+	if i < 0 || i >= len(tags) {
+		return errors.New("out of bound index")
+	}
+	for _, old := range tags[i] {
+		indexRemove(index, old.Name, i)
+	}
+	tags[i] = t
+	for _, tg := range t {
+		indexAdd(index, tg.Name, i)
+	}
+	return nil
+}
+
+// addRowTag adds a tag to row i, or replaces the data of its tag of
+// the same name.
+func addRowTag(tags []RowTags, index map[string][]int, i int, tag Tag) error {
+	if i < 0 || i >= len(tags) {
+		return errors.New("out of bound index")
+	}
+	if tag.Name == "" {
+		return errors.New("tag name is blank")
+	}
+	if k := tags[i].find(tag.Name); k >= 0 {
+		tags[i][k].Data = tag.Data
+		return nil
+	}
+	tags[i] = append(tags[i], tag)
+	indexAdd(index, tag.Name, i)
+	return nil
+}
+
+func removeRowTag(tags []RowTags, index map[string][]int, i int, name string) error {
+	if i < 0 || i >= len(tags) {
+		return errors.New("out of bound index")
+	}
+	k := tags[i].find(name)
+	if k < 0 {
+		return fmt.Errorf("row %d has no tag %s", i, name)
+	}
+	tags[i] = append(tags[i][:k:k], tags[i][k+1:]...)
+	indexRemove(index, name, i)
+	return nil
+}
+
+// rowTagsOf returns the tags of row i, or nil.
+func rowTagsOf(tags []RowTags, i int) RowTags {
+	if i < 0 || i >= len(tags) {
+		return nil
+	}
+	return tags[i]
+}
+
+// tagSlice sizes tags to n rows; added rows have no tags.
+func tagSlice(tags []RowTags, n int) []RowTags {
+	for len(tags) < n {
+		tags = append(tags, nil)
+	}
+	return tags[:n]
+}
+
+// tags returns the tags of the rows, and their index (built on the
+// first tag query after a change that moves rows).
+func (r *Rows) tags() ([]RowTags, map[string][]int) {
+	if len(r.Tags) != len(r.Rows) {
+		r.Tags = tagSlice(r.Tags, len(r.Rows))
+		r.tagIndex = nil
+	}
+	if r.tagIndex == nil {
+		r.tagIndex = buildTagIndex(r.Tags)
+	}
+	return r.Tags, r.tagIndex
+}
+
+// SetTag replaces the tags of a row with tag; a tag with a blank
+// name removes them.
+func (r *Rows) SetTag(i int, tag Tag) error {
+	tags, index := r.tags()
+	var t RowTags
+	if tag.Name != "" {
+		t = RowTags{tag}
+	}
+	if err := setRowTags(tags, index, i, t); err != nil {
+		return err
+	}
+	r.pruneSharedData()
+	return nil
+}
+
+// GetTag returns the first tag of a row; it is blank when the row
+// has no tags or does not exist.
+func (r *Rows) GetTag(i int) Tag {
+	if t := rowTagsOf(r.Tags, i); len(t) > 0 {
+		return t[0]
+	}
+	return Tag{}
+}
+
+// GetTags returns the tags of a row.
+func (r *Rows) GetTags(i int) []Tag {
+	return append([]Tag(nil), rowTagsOf(r.Tags, i)...)
+}
+
+// HasTag reports whether a row has a tag.
+func (r *Rows) HasTag(i int, tagName string) bool {
+	return rowTagsOf(r.Tags, i).find(tagName) >= 0
+}
+
+// AddTag adds a tag to a row; if the row already has a tag of that
+// name, its data is replaced.
+func (r *Rows) AddTag(i int, tag Tag) error {
+	tags, index := r.tags()
+	return addRowTag(tags, index, i, tag)
+}
+
+// RemoveTag removes a tag from a row (and the shared data of the
+// tag, if no other row has it).
+func (r *Rows) RemoveTag(i int, tagName string) error {
+	tags, index := r.tags()
+	if err := removeRowTag(tags, index, i, tagName); err != nil {
+		return err
+	}
+	r.pruneSharedData()
+	return nil
+}
+
+// GetRowIndexesByTag returns the indexes of the rows that have a tag,
+// in ascending order.
+func (r *Rows) GetRowIndexesByTag(tagName string) []int {
+	_, index := r.tags()
+	return append([]int(nil), index[tagName]...)
+}
+
+// GetRowsByTagName returns the rows that have a tag.
+func (r *Rows) GetRowsByTagName(tagName string) []Row {
+	r.compute()
+
+	_, index := r.tags()
+	var rows []Row
+	for _, i := range index[tagName] {
+		rows = append(rows, r.Rows[i])
+	}
+	return rows
+}
+
+// UpdateByTag calls fn with each row that has a tag, and stores the
+// changes as UpdateRow does; it returns the number of rows updated.
+func (r *Rows) UpdateByTag(tagName string, fn func(row Row)) (int, error) {
+	return updateByTag(r, tagName, fn)
+}
+
+// RemoveByTag removes the rows that have a tag, and returns their
+// number.
+func (r *Rows) RemoveByTag(tagName string) (int, error) {
+	ids := r.GetRowIndexesByTag(tagName)
+	return len(ids), r.RemoveAt(ids...)
+}
+
+func (r *ColumnarRows) tags() ([]RowTags, map[string][]int) {
+	if len(r.Tags) != r.n {
+		r.Tags = tagSlice(r.Tags, r.n)
+		r.tagIndex = nil
+	}
+	if r.tagIndex == nil {
+		r.tagIndex = buildTagIndex(r.Tags)
+	}
+	return r.Tags, r.tagIndex
+}
+
+// SetTag replaces the tags of a row with tag; a tag with a blank
+// name removes them.
+func (r *ColumnarRows) SetTag(i int, tag Tag) error {
+	tags, index := r.tags()
+	var t RowTags
+	if tag.Name != "" {
+		t = RowTags{tag}
+	}
+	if err := setRowTags(tags, index, i, t); err != nil {
+		return err
+	}
+	r.pruneSharedData()
+	return nil
+}
+
+// GetTag returns the first tag of a row; it is blank when the row
+// has no tags or does not exist.
+func (r *ColumnarRows) GetTag(i int) Tag {
+	if t := rowTagsOf(r.Tags, i); len(t) > 0 {
+		return t[0]
+	}
+	return Tag{}
+}
+
+// GetTags returns the tags of a row.
+func (r *ColumnarRows) GetTags(i int) []Tag {
+	return append([]Tag(nil), rowTagsOf(r.Tags, i)...)
+}
+
+// HasTag reports whether a row has a tag.
+func (r *ColumnarRows) HasTag(i int, tagName string) bool {
+	return rowTagsOf(r.Tags, i).find(tagName) >= 0
+}
+
+// AddTag adds a tag to a row; if the row already has a tag of that
+// name, its data is replaced.
+func (r *ColumnarRows) AddTag(i int, tag Tag) error {
+	tags, index := r.tags()
+	return addRowTag(tags, index, i, tag)
+}
+
+// RemoveTag removes a tag from a row (and the shared data of the
+// tag, if no other row has it).
+func (r *ColumnarRows) RemoveTag(i int, tagName string) error {
+	tags, index := r.tags()
+	if err := removeRowTag(tags, index, i, tagName); err != nil {
+		return err
+	}
+	r.pruneSharedData()
+	return nil
+}
+
+// GetRowIndexesByTag returns the indexes of the rows that have a tag,
+// in ascending order.
+func (r *ColumnarRows) GetRowIndexesByTag(tagName string) []int {
+	_, index := r.tags()
+	return append([]int(nil), index[tagName]...)
+}
+
+// GetRowsByTagName returns the rows that have a tag.
+func (r *ColumnarRows) GetRowsByTagName(tagName string) []Row {
+	r.flush()
+
+	_, index := r.tags()
+	var rows []Row
+	for _, i := range index[tagName] {
+		rows = append(rows, r.view(i))
+	}
+	return rows
+}
+
+// UpdateByTag calls fn with each row that has a tag, and stores the
+// changes as UpdateRow does; it returns the number of rows updated.
+func (r *ColumnarRows) UpdateByTag(tagName string, fn func(row Row)) (int, error) {
+	return updateByTag(r, tagName, fn)
+}
+
+// RemoveByTag removes the rows that have a tag, and returns their
+// number.
+func (r *ColumnarRows) RemoveByTag(tagName string) (int, error) {
+	ids := r.GetRowIndexesByTag(tagName)
+	return len(ids), r.RemoveAt(ids...)
+}
+
+func updateByTag(r IRows, tagName string, fn func(row Row)) (int, error) {
+	ids := r.GetRowIndexesByTag(tagName)
+	for n, i := range ids {
+		row := r.GetRow(i)
+		fn(row)
+		row[row_id] = i
+		if err := r.UpdateRow(row); err != nil {
+			return n, err
+		}
+	}
+	return len(ids), nil
+}
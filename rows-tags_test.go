@@ -0,0 +1,179 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The single-tag API works as before multiple tags per row.
+func TestSingleTagAPI(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("a")
+	row := Row{"a": 1}
+	tbl.Rows.Add(row)
+	tbl.Rows.Add(Row{"a": 2})
+	if row[row_id] != 0 {
+		t.Fatalf("Add: %s = %v", row_id, row[row_id])
+	}
+
+	if err := tbl.Rows.SetTag(1, Tag{Name: "x", Data: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Rows.SetTag(2, Tag{Name: "x"}); err == nil {
+		t.Fatal("SetTag of a missing row: no error")
+	}
+	rows := tbl.Rows.(*Rows)
+	if got := fmt.Sprint(tbl.Rows.GetTag(0), tbl.Rows.GetTag(1), rows.Tags[1][0]); got != "{ <nil>} {x 7} {x 7}" {
+		t.Fatal(got)
+	}
+}
+
+func TestRowTags(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		for i := 1; i <= 5; i++ {
+			tbl.Rows.New()["a"] = i
+		}
+		rs := tbl.Rows
+
+		// a row holds several tags; adding a name again replaces it
+		rs.AddTag(1, Tag{Name: "x", Data: "d1"})
+		rs.AddTag(3, Tag{Name: "x"})
+		rs.AddTag(3, Tag{Name: "y", Data: 7})
+		rs.AddTag(4, Tag{Name: "y"})
+		rs.AddTag(1, Tag{Name: "x", Data: "d2"})
+		if got := fmt.Sprint(rs.GetRowIndexesByTag("x"), rs.GetRowIndexesByTag("y"), rs.GetTags(1), rs.GetTags(3)); got != "[1 3] [3 4] [{x d2}] [{x <nil>} {y 7}]" {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+		if rs.GetTag(3).Name != "x" || !rs.HasTag(3, "y") || rs.HasTag(0, "y") || len(rs.GetRowIndexesByTag("nope")) != 0 {
+			t.Fatalf("storage %d: GetTag %v", storage, rs.GetTag(3))
+		}
+
+		// SetTag replaces all the tags of a row; an empty tag clears them
+		rs.SetTag(3, Tag{Name: "z"})
+		if got := fmt.Sprint(rs.GetRowIndexesByTag("x"), rs.GetRowIndexesByTag("y"), rs.GetRowIndexesByTag("z")); got != "[1] [4] [3]" {
+			t.Fatalf("storage %d: SetTag %s", storage, got)
+		}
+		rs.SetTag(3, Tag{})
+		if len(rs.GetTags(3)) != 0 || len(rs.GetRowIndexesByTag("z")) != 0 {
+			t.Fatalf("storage %d: cleared %v", storage, rs.GetTags(3))
+		}
+
+		if err := rs.RemoveTag(1, "x"); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.RemoveTag(1, "x"); err == nil {
+			t.Fatalf("storage %d: removing a missing tag: no error", storage)
+		}
+
+		// rows added later have no tags until given one
+		rs.New()["a"] = 6
+		if rs.GetTag(5).Name != "" || len(rs.GetRowsByTagName("y")) != 1 {
+			t.Fatalf("storage %d: new row %v", storage, rs.GetTags(5))
+		}
+		rs.AddTag(5, Tag{Name: "y"})
+		if got := fmt.Sprint(rs.GetRowIndexesByTag("y")); got != "[4 5]" {
+			t.Fatalf("storage %d: new row tagged %s", storage, got)
+		}
+	}
+}
+
+func TestRowTagsBounds(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		tbl.Rows.New()["a"] = 1
+		rs := tbl.Rows
+
+		for _, i := range []int{-1, 1} {
+			if err := rs.SetTag(i, Tag{Name: "x"}); err == nil {
+				t.Fatalf("storage %d: SetTag(%d): no error", storage, i)
+			}
+			if err := rs.AddTag(i, Tag{Name: "x"}); err == nil {
+				t.Fatalf("storage %d: AddTag(%d): no error", storage, i)
+			}
+			if err := rs.RemoveTag(i, "x"); err == nil {
+				t.Fatalf("storage %d: RemoveTag(%d): no error", storage, i)
+			}
+			if rs.GetTag(i).Name != "" || rs.GetTags(i) != nil || rs.HasTag(i, "x") {
+				t.Fatalf("storage %d: GetTag(%d) %v", storage, i, rs.GetTag(i))
+			}
+		}
+		if err := rs.AddTag(0, Tag{}); err == nil {
+			t.Fatalf("storage %d: tag without a name: no error", storage)
+		}
+	}
+}
+
+func TestByTag(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		for i := 1; i <= 5; i++ {
+			tbl.Rows.New()["a"] = i
+		}
+		rs := tbl.Rows
+		rs.AddTag(1, Tag{Name: "x"})
+		rs.AddTag(3, Tag{Name: "x"})
+		rs.AddTag(3, Tag{Name: "y"})
+		rs.AddTag(4, Tag{Name: "y"})
+
+		n, err := rs.UpdateByTag("y", func(r Row) { r["a"] = 100 })
+		if err != nil || n != 2 {
+			t.Fatalf("storage %d: UpdateByTag %d, %v", storage, n, err)
+		}
+		if got := fmt.Sprint(tableValues(tbl)); got != "[[1] [2] [3] [100] [100]]" {
+			t.Fatalf("storage %d: updated %s", storage, got)
+		}
+
+		// the index follows the rows that move up
+		n, err = rs.RemoveByTag("x")
+		if err != nil || n != 2 {
+			t.Fatalf("storage %d: RemoveByTag %d, %v", storage, n, err)
+		}
+		if got := fmt.Sprint(tableValues(tbl), rs.GetRowIndexesByTag("y"), rs.GetRowIndexesByTag("x")); got != "[[1] [3] [100]] [2] []" {
+			t.Fatalf("storage %d: removed %s", storage, got)
+		}
+		if n, err := rs.RemoveByTag("nope"); err != nil || n != 0 {
+			t.Fatalf("storage %d: RemoveByTag of a missing tag %d, %v", storage, n, err)
+		}
+	}
+}
+
+func TestRowTagsPersist(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("t", storage)
+		tbl.Cols.Add("a")
+		for i := 1; i <= 3; i++ {
+			tbl.Rows.New()["a"] = i
+		}
+		tbl.Rows.AddTag(1, Tag{Name: "x"})
+		tbl.Rows.AddTag(1, Tag{Name: "y", Data: int64(7)})
+		tbl.Rows.AddTag(2, Tag{Name: "y"})
+
+		b, err := tbl.Serialize(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromBinary, err := tbl.Deserialize(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j, err := tbl.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromJSON := &Table{}
+		if err := fromJSON.UnmarshalJSON(j); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, back := range []*Table{fromBinary, fromJSON} {
+			if got := fmt.Sprint(back.Rows.GetRowIndexesByTag("y"), back.Rows.GetTags(1)); got != "[1 2] [{x <nil>} {y 7}]" {
+				t.Fatalf("storage %d: read back %s", storage, got)
+			}
+		}
+	}
+}
@@ -3,7 +3,6 @@ package collections
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
@@ -15,7 +14,8 @@ type IRows interface {
 	// New creates an empty row and returns its map.
 	New() Row
 
-	// Add adds a row the Rows array.
+	// Add adds a row the Rows array. With row storage the map
+	// itself becomes the row, and its _rowid_ is set.
 	Add(row Row)
 
 	SetColumns(cols []Column)
@@ -29,27 +29,69 @@ type IRows interface {
 	// GetJSON returns a json representation of the entire table.
 	GetJSON() string
 
+	// GetRows, GetRow and GetLastRow return the rows. With column
+	// storage they are copies: a change to them is only stored by
+	// UpdateRow or SetValue, which work with both storages.
 	GetRows() []Row
 	GetRow(rowIndex int) Row
 	GetLastRow() Row
 
 	GetRowIndex(row Row) int
 	GetLastRowIndex() int
+
+	// UpdateRow stores the values of a row (located by _rowid_) and
+	// computes its computed columns.
 	UpdateRow(irow Row) error
 
+	// GetValue and SetValue read and write the value of a column
+	// in a row (by index).
+	GetValue(rowIndex int, colName string) (interface{}, error)
+	SetValue(rowIndex int, colName string, v interface{}) error
+
 	GetRowJSON(i int) string
 
-	GetRowsByTagName(tagName string) []Row
+	// ScanStruct sets the fields of a struct (dst is a pointer)
+	// from a row.
+	ScanStruct(rowIndex int, dst interface{}) error
 
-	SetTag(rowIndex int, tag Tag)
+	// A row can have several tags, each with a different name.
+	// SetTag replaces the tags of a row (it returns an error for a
+	// row that does not exist), AddTag and RemoveTag add
+	// and remove one; GetTag returns the first.
+	SetTag(rowIndex int, tag Tag) error
 	GetTag(rowIndex int) Tag
+	GetTags(rowIndex int) []Tag
+	HasTag(rowIndex int, tagName string) bool
+	AddTag(rowIndex int, tag Tag) error
+	RemoveTag(rowIndex int, tagName string) error
+
+	// GetRowsByTagName and GetRowIndexesByTag return the rows that
+	// have a tag (from an index of the tags).
+	GetRowsByTagName(tagName string) []Row
+	GetRowIndexesByTag(tagName string) []int
+
+	// UpdateByTag calls fn with each row that has a tag and stores
+	// the changes; RemoveByTag removes those rows. Both return the
+	// number of rows.
+	UpdateByTag(tagName string, fn func(row Row)) (int, error)
+	RemoveByTag(tagName string) (int, error)
+
+	// RemoveAt removes rows (by index); the rows after them move
+	// up and their _rowid_ becomes their new index.
+	RemoveAt(rowIndexes ...int) error
 
 	// TODO:
-	// RemoveAt(rowINdex int)
 	// Remove(row Row)
 
+	// Shared data is linked to the rows of a tag, and is removed
+	// with the tag from the last of them. GetSharedData returns a
+	// blank item when there is none; LookupSharedData reports it.
 	AddSharedData(sharedDataItem SharedDataItem) error
+	UpdateSharedData(sharedDataItem SharedDataItem) error
+	RemoveSharedData(tagName string) error
 	GetSharedData(tagName string) SharedDataItem
+	LookupSharedData(tagName string) (SharedDataItem, bool)
+	GetSharedDataItems() []SharedDataItem
 
 	// InsertRecords creates new rows from a two demintional array of string.
 	// Example of input is a result-set from reading CSV file.
@@ -68,33 +110,30 @@ func (r *Rows) Add(row Row) {
 
 	i := newRow[row_id].(int)
 
+	row[row_id] = i
 	r.Rows[i] = row
 }
-func (r *Rows) AddSharedData(sharedDataItem SharedDataItem) error {
-
-	if sharedDataItem.TagName == "" {
-		return fmt.Errorf("tag name is blank")
-	}
-	// the tag-name of the shared-data muste exist in the row-tags' list
-	tagCount := len(r.GetRowsByTagName(sharedDataItem.TagName))
+func (r *Rows) Clear() {
+	r.Rows = make([]Row, 0)
+	r.Tags = make([]RowTags, 0)
+	r.tagIndex = nil
+	r.SharedData = nil
+	r.evaluated = 0
+}
 
-	if tagCount < 1 {
-		return fmt.Errorf("now rows found by tag name: %s", sharedDataItem.TagName)
+// compute sets the computed columns of the rows added since the
+// last call (see Cols.AddComputed).
+func (r *Rows) compute() {
+	if r.evaluated >= len(r.Rows) {
+		r.evaluated = len(r.Rows)
+		return
 	}
-
-	for i := 0; i < len(r.SharedData); i++ {
-		if r.SharedData[i].TagName == sharedDataItem.TagName {
-			return errors.New("shared data item alreay exists")
+	if order := computedOrder(r.Columns); len(order) > 0 {
+		for i := r.evaluated; i < len(r.Rows); i++ {
+			computeRow(r.Columns, order, r.Rows[i], nil)
 		}
 	}
-
-	r.SharedData = append(r.SharedData, sharedDataItem)
-
-	return nil
-}
-
-func (r *Rows) Clear() {
-	r.Rows = make([]Row, 0)
+	r.evaluated = len(r.Rows)
 }
 
 func (r *Rows) Count() int {
@@ -105,8 +144,54 @@ func (r *Rows) Count() int {
 // TODO:
 // func (r *Rows) Remove(row Row) {
 // }
-// func (r *Rows) RemoveAt(i int) {
-// }
+
+// RemoveAt removes rows (by index); the rows after them move up
+// and their _rowid_ becomes their new index.
+func (r *Rows) RemoveAt(rowIndexes ...int) error {
+	r.compute()
+
+	drop, err := dropMask(rowIndexes, len(r.Rows))
+	if err != nil {
+		return err
+	}
+
+	k := 0
+	for i := 0; i < len(r.Rows); i++ {
+		if drop[i] {
+			continue
+		}
+		r.Rows[k] = r.Rows[i]
+		r.Rows[k][row_id] = k
+		if i < len(r.Tags) {
+			r.Tags[k] = r.Tags[i]
+		}
+		k++
+	}
+	for i := k; i < len(r.Rows); i++ {
+		r.Rows[i] = nil
+	}
+	r.Rows = r.Rows[:k]
+	if len(r.Tags) > k {
+		r.Tags = r.Tags[:k]
+	}
+	r.tagIndex = nil
+	r.pruneSharedData()
+	r.evaluated = k
+
+	return nil
+}
+
+// dropMask returns which of n rows are in rowIndexes.
+func dropMask(rowIndexes []int, n int) ([]bool, error) {
+	drop := make([]bool, n)
+	for _, i := range rowIndexes {
+		if i < 0 || i >= n {
+			return nil, errors.New("out of bound index")
+		}
+		drop[i] = true
+	}
+	return drop, nil
+}
 
 func (r *Rows) createNewRecordsWorker(instance string, from int, to int, input [][]string, verbose bool, wg *sync.WaitGroup) {
 	if wg != nil {
@@ -127,18 +212,42 @@ func (r *Rows) GetColumns() []Column {
 	return r.Columns
 }
 
+// GetJSON returns the rows as a JSON array of objects; the keys
+// are _rowid_ followed by the columns in order.
 func (r *Rows) GetJSON() string {
-	b, _ := json.Marshal(r.Rows)
-	b = bytes.ReplaceAll(b, []byte(`\"`), []byte(`"`))
+	r.compute()
+	names := append([]string{row_id}, columnNames(r.Columns)...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < len(r.Rows); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSONObject(&buf, r.Rows[i], names); err != nil {
+			return ""
+		}
+	}
+	buf.WriteByte(']')
 
-	return string(b)
+	return buf.String()
 }
 
+// GetRowJSON returns one row as a JSON object (null if the index
+// is out of range).
 func (r *Rows) GetRowJSON(inx int) string {
-	b, _ := json.Marshal(r.GetRow(inx))
-	b = bytes.ReplaceAll(b, []byte(`\"`), []byte(`"`))
+	row := r.GetRow(inx)
+	if row == nil {
+		return "null"
+	}
+	names := append([]string{row_id}, columnNames(r.Columns)...)
+
+	var buf bytes.Buffer
+	if err := encodeJSONObject(&buf, row, names); err != nil {
+		return ""
+	}
 
-	return string(b)
+	return buf.String()
 }
 
 func (r *Rows) GetLastRowIndex() int {
@@ -146,6 +255,7 @@ func (r *Rows) GetLastRowIndex() int {
 }
 
 func (r *Rows) GetRow(indx int) Row {
+	r.compute()
 
 	if indx < 0 {
 		return nil
@@ -160,6 +270,7 @@ func (r *Rows) GetRow(indx int) Row {
 }
 
 func (r *Rows) GetLastRow() Row {
+	r.compute()
 
 	if len(r.Rows) == 0 {
 		return nil
@@ -169,43 +280,14 @@ func (r *Rows) GetLastRow() Row {
 }
 
 func (r *Rows) GetRows() []Row {
+	r.compute()
 	return r.Rows
 }
 
-func (r *Rows) GetRowsByTagName(tagName string) []Row {
-
-	var rows []Row
-
-	for i := 0; i < len(r.Rows); i++ {
-		tg := r.Tags[i].Name
-
-		if tg == tagName {
-			rows = append(rows, r.Rows[i])
-		}
-	}
-
-	return rows
-}
-
 func (r *Rows) GetRowIndex(row Row) int {
 	return row[row_id].(int)
 }
 
-func (r *Rows) GetTag(i int) Tag {
-	return r.Tags[i]
-}
-
-func (r *Rows) GetSharedData(tagName string) SharedDataItem {
-
-	for i := 0; i < len(r.SharedData); i++ {
-		if r.SharedData[i].TagName == tagName {
-			return r.SharedData[i]
-		}
-	}
-
-	return SharedDataItem{}
-}
-
 // InsertRecords reads a two-dim. string arrary into the Table.
 // Note: there is perfomance hit when verbose is on
 func (r *Rows) InsertRecords(input [][]string, verbose bool) {
@@ -244,33 +326,22 @@ func (r *Rows) InsertSingleRecord(input []string) {
 	colLen := len(r.Columns)
 	oneRow := r.New()
 
-	for j := col_start_indx; j < colLen; j++ {
+	// missing fields are left nil; extra fields are ignored
+	for j := col_start_indx; j < colLen && j < len(input); j++ {
 		oneRow[r.Columns[j].Name] = input[j]
 	}
 }
 
 func (r *Rows) New() Row {
-	var row Row
+	r.compute()
 
-	row = make(map[string]interface{}, 1)
-	lastInx := r.GetLastRowIndex()
+	row := make(Row, len(r.Columns)+1)
 
-	if lastInx < 0 {
-		lastInx = 0
-	}
+	// the index the row is added at
+	row[row_id] = len(r.Rows)
 
-	for {
-		if row[row_id] == nil {
-			row[row_id] = lastInx
-			break
-		} else {
-			lastInx++
-		}
-	}
-
-	// Add an empty tag
-	var tag = Tag{Name: "", Data: nil}
-	r.Tags = append(r.Tags, tag)
+	// the row has no tags
+	r.Tags = append(r.Tags, nil)
 
 	for i := col_start_indx; i < len(r.Columns); i++ {
 		row[r.Columns[i].Name] = nil
@@ -285,10 +356,46 @@ func (r *Rows) SetColumns(cols []Column) {
 	r.Columns = cols
 }
 
-func (r *Rows) SetTag(i int, tag Tag) {
-	r.Tags[i] = tag
+// GetValue returns the value of a column in row i.
+func (r *Rows) GetValue(i int, colName string) (interface{}, error) {
+	r.compute()
+
+	if i < 0 || i >= len(r.Rows) {
+		return nil, errors.New("out of bound index")
+	}
+	j := r.namePolicy.find(r.Columns, colName)
+	if j < 0 {
+		return nil, fmt.Errorf("column not found: %s", colName)
+	}
+	return r.Rows[i][r.Columns[j].Name], nil
 }
 
+// SetValue sets the value of a column in row i, and computes the
+// computed columns that depend on it.
+func (r *Rows) SetValue(i int, colName string, v interface{}) error {
+	r.compute()
+
+	if i < 0 || i >= len(r.Rows) {
+		return errors.New("out of bound index")
+	}
+	j := r.namePolicy.find(r.Columns, colName)
+	if j < 0 {
+		return fmt.Errorf("column not found: %s", colName)
+	}
+	if err := checkNotComputed(r.Columns, j); err != nil {
+		return err
+	}
+	r.Rows[i][r.Columns[j].Name] = v
+
+	if order := computedOrder(r.Columns); len(order) > 0 {
+		return computeRow(r.Columns, order, r.Rows[i], []string{r.Columns[j].Name})
+	}
+
+	return nil
+}
+
+// UpdateRow stores the column values of row (located by _rowid_),
+// and computes its computed columns.
 func (r *Rows) UpdateRow(row Row) error {
 
 	i := r.GetRowIndex(row)
@@ -299,7 +406,13 @@ func (r *Rows) UpdateRow(row Row) error {
 	m := r.GetRow(i)
 	for k := 0; k < len(r.Columns); k++ {
 		colName := r.Columns[k].Name
-		m[colName] = row[colName]
+		if r.Columns[k].computed == nil {
+			m[colName] = row[colName]
+		}
+	}
+
+	if order := computedOrder(r.Columns); len(order) > 0 {
+		return computeRow(r.Columns, order, m, nil)
 	}
 
 	return nil
@@ -0,0 +1,152 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CountMinSketch estimates how often values occur. An estimate is
+// never below the true count, and exceeds it by at most
+// epsilon*Total() with probability 1-delta. Values are compared by
+// their text.
+type CountMinSketch struct {
+	width  uint32
+	depth  uint32
+	counts []uint64
+	total  uint64
+}
+
+// countMinMaxCells limits the size of a sketch (128 MB of counters).
+const countMinMaxCells = 1 << 24
+
+// NewCountMinSketch returns an empty sketch for the given error
+// bounds (both between 0 and 1; 0 for the defaults of 0.001 and
+// 0.01). Bounds that need more than 2^24 counters are an error.
+func NewCountMinSketch(epsilon float64, delta float64) (*CountMinSketch, error) {
+	if epsilon == 0 {
+		epsilon = 0.001
+	}
+	if delta == 0 {
+		delta = 0.01
+	}
+	if epsilon < 0 || epsilon >= 1 || delta < 0 || delta >= 1 {
+		return nil, errors.New("epsilon and delta must be between 0 and 1")
+	}
+	wf, df := math.Ceil(math.E/epsilon), math.Ceil(math.Log(1/delta))
+	if wf*df > countMinMaxCells {
+		return nil, fmt.Errorf("epsilon %g and delta %g need too many counters (the limit is %d)", epsilon, delta, countMinMaxCells)
+	}
+	w, d := uint32(wf), uint32(df)
+	return &CountMinSketch{width: w, depth: d, counts: make([]uint64, w*d)}, nil
+}
+
+// Add counts one occurrence of a value; NULLs are ignored.
+func (s *CountMinSketch) Add(v interface{}) {
+	s.AddCount(v, 1)
+}
+
+// AddCount counts n occurrences of a value.
+func (s *CountMinSketch) AddCount(v interface{}, n uint64) {
+	if isNull(v) {
+		return
+	}
+	x := hashValue(v)
+	for i := uint32(0); i < s.depth; i++ {
+		s.counts[i*s.width+s.cell(x, i)] += n
+	}
+	s.total += n
+}
+
+// Count returns the estimated number of occurrences of a value.
+func (s *CountMinSketch) Count(v interface{}) uint64 {
+	if isNull(v) {
+		return 0
+	}
+	x := hashValue(v)
+	var min uint64
+	for i := uint32(0); i < s.depth; i++ {
+		c := s.counts[i*s.width+s.cell(x, i)]
+		if i == 0 || c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Total returns the number of occurrences counted.
+func (s *CountMinSketch) Total() uint64 {
+	return s.total
+}
+
+// cell returns the column of row i for a hash (double hashing).
+func (s *CountMinSketch) cell(x uint64, i uint32) uint32 {
+	h1, h2 := uint32(x), uint32(x>>32)
+	return (h1 + i*h2) % s.width
+}
+
+// Merge adds the counts of o; both must have the same dimensions.
+func (s *CountMinSketch) Merge(o *CountMinSketch) error {
+	if o == nil {
+		return nil
+	}
+	if o.width != s.width || o.depth != s.depth {
+		return fmt.Errorf("cannot merge CountMinSketch of %dx%d into %dx%d", o.depth, o.width, s.depth, s.width)
+	}
+	for i, c := range o.counts {
+		s.counts[i] += c
+	}
+	s.total += o.total
+	return nil
+}
+
+// MarshalBinary encodes the sketch.
+func (s *CountMinSketch) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.buf.Write([]byte{'C', sketchVersion})
+	w.uvarint(uint64(s.depth))
+	w.uvarint(uint64(s.width))
+	w.uvarint(s.total)
+	for _, c := range s.counts {
+		w.uvarint(c)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a sketch written by MarshalBinary.
+func (s *CountMinSketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != 'C' {
+		return errors.New("not a CountMinSketch")
+	}
+	if data[1] != sketchVersion {
+		return fmt.Errorf("unsupported format version %d", data[1])
+	}
+	r := &binaryReader{data: data, pos: 2}
+	var dims [3]uint64
+	for i := range dims {
+		v, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		dims[i] = v
+	}
+	d, w := dims[0], dims[1]
+	if d == 0 || w == 0 || d > math.MaxUint32 || w > math.MaxUint32 || d*w > countMinMaxCells || d*w > uint64(len(data)) {
+		return errors.New("corrupt CountMinSketch")
+	}
+	counts := make([]uint64, d*w)
+	for i := range counts {
+		v, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		counts[i] = v
+	}
+	if r.pos != len(data) {
+		return errors.New("corrupt CountMinSketch")
+	}
+
+	s.depth, s.width, s.total, s.counts = uint32(d), uint32(w), dims[2], counts
+	return nil
+}
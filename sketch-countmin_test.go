@@ -0,0 +1,64 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"testing"
+)
+
+func TestCountMinSketchCounts(t *testing.T) {
+	s, err := NewCountMinSketch(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		s.Add(i % 10)
+	}
+	s.AddCount("x", 5)
+	s.Add(nil)
+	if s.Total() != 1005 {
+		t.Fatalf("total %d", s.Total())
+	}
+	if n := s.Count(3); n < 100 || n > 102 {
+		t.Fatalf("count of 3: %d", n)
+	}
+	if n := s.Count("3"); n != s.Count(3) {
+		t.Fatalf("3 and \"3\" differ: %d", n)
+	}
+	if n := s.Count("x"); n != 5 {
+		t.Fatalf("count of x: %d", n)
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r CountMinSketch
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Merge(s); err != nil || r.Count("x") != 10 || r.Total() != 2010 {
+		t.Fatalf("merge: %v %d %d", err, r.Count("x"), r.Total())
+	}
+}
+
+// Bounds that need too many counters are an error, not a huge
+// allocation or an overflow.
+func TestCountMinSketchSize(t *testing.T) {
+	for _, b := range [][2]float64{{1e-9, 0.01}, {1e-7, 1e-9}, {1e-4, 1e-300}, {5e-324, 0.5}, {0.5, 5e-324}} {
+		if _, err := NewCountMinSketch(b[0], b[1]); err == nil {
+			t.Fatalf("epsilon %g, delta %g: no error", b[0], b[1])
+		}
+	}
+	for _, b := range [][2]float64{{-1, 0.1}, {0.1, 1}} {
+		if _, err := NewCountMinSketch(b[0], b[1]); err == nil {
+			t.Fatalf("epsilon %g, delta %g: no error", b[0], b[1])
+		}
+	}
+	s, err := NewCountMinSketch(1e-6, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(s.width)*int(s.depth) > countMinMaxCells {
+		t.Fatalf("%dx%d", s.depth, s.width)
+	}
+}
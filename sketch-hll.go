@@ -0,0 +1,140 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct values it has seen,
+// in 2^precision bytes and with a standard error of about
+// 1.04/sqrt(2^precision) (0.8% for the default precision of 14).
+// Values are compared by their text, as in GetDataDistinct.
+type HyperLogLog struct {
+	p   uint8
+	reg []uint8
+}
+
+// NewHyperLogLog returns an empty HyperLogLog; precision is 4 to
+// 18, or 0 for the default of 14.
+func NewHyperLogLog(precision uint8) (*HyperLogLog, error) {
+	if precision == 0 {
+		precision = 14
+	}
+	if precision < 4 || precision > 18 {
+		return nil, errors.New("precision must be between 4 and 18")
+	}
+	return &HyperLogLog{p: precision, reg: make([]uint8, 1<<precision)}, nil
+}
+
+// Add adds a value; NULLs are ignored.
+func (h *HyperLogLog) Add(v interface{}) {
+	if isNull(v) {
+		return
+	}
+	h.addHash(hashValue(v))
+}
+
+func (h *HyperLogLog) addHash(x uint64) {
+	i := x >> (64 - h.p)
+	w := x<<h.p | 1<<(h.p-1)
+	if r := uint8(bits.LeadingZeros64(w) + 1); r > h.reg[i] {
+		h.reg[i] = r
+	}
+}
+
+// Count returns the estimated number of distinct values.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.reg))
+
+	var sum float64
+	zeros := 0
+	for _, r := range h.reg {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.reg) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// small range: linear counting
+		e = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(e + 0.5)
+}
+
+// Merge adds the values seen by o; both must have the same
+// precision.
+func (h *HyperLogLog) Merge(o *HyperLogLog) error {
+	if o == nil {
+		return nil
+	}
+	if o.p != h.p {
+		return fmt.Errorf("cannot merge HyperLogLog of precision %d into %d", o.p, h.p)
+	}
+	for i, r := range o.reg {
+		if r > h.reg[i] {
+			h.reg[i] = r
+		}
+	}
+	return nil
+}
+
+// MarshalBinary encodes the HyperLogLog.
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 3+len(h.reg))
+	b = append(b, 'H', sketchVersion, h.p)
+	return append(b, h.reg...), nil
+}
+
+// UnmarshalBinary decodes a HyperLogLog written by MarshalBinary.
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 || data[0] != 'H' {
+		return errors.New("not a HyperLogLog")
+	}
+	if data[1] != sketchVersion {
+		return fmt.Errorf("unsupported format version %d", data[1])
+	}
+	p := data[2]
+	if p < 4 || p > 18 || len(data) != 3+(1<<p) {
+		return errors.New("corrupt HyperLogLog")
+	}
+	h.p = p
+	h.reg = append([]uint8(nil), data[3:]...)
+	return nil
+}
+
+// sketchVersion is the version of the binary format of sketches.
+const sketchVersion = 1
+
+// hashValue hashes the text of a value (64-bit FNV-1a, mixed with
+// the MurmurHash3 finalizer to spread the bits).
+func hashValue(v interface{}) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(toString(v)))
+	x := f.Sum64()
+
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
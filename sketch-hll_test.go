@@ -0,0 +1,83 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	h, err := NewHyperLogLog(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Count() != 0 {
+		t.Fatalf("empty: %d", h.Count())
+	}
+
+	// small counts are exact; values are compared by their text
+	for i := 0; i < 100; i++ {
+		h.Add(i % 37)
+		h.Add(nil)
+	}
+	h.Add("5")
+	if h.Count() != 37 {
+		t.Fatalf("small: %d", h.Count())
+	}
+
+	for _, n := range []int{1000, 100000} {
+		h, _ := NewHyperLogLog(0)
+		for i := 0; i < 3*n; i++ {
+			h.Add(i % n)
+		}
+		if e := math.Abs(float64(h.Count())-float64(n)) / float64(n); e > 0.03 {
+			t.Fatalf("%d distinct: estimate %d", n, h.Count())
+		}
+	}
+
+	for _, p := range []uint8{3, 19} {
+		if _, err := NewHyperLogLog(p); err == nil {
+			t.Fatalf("precision %d: no error", p)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, _ := NewHyperLogLog(12)
+	b, _ := NewHyperLogLog(12)
+	for i := 0; i < 20000; i++ {
+		if i%2 == 0 {
+			a.Add(i)
+		} else {
+			b.Add(i)
+		}
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if e := math.Abs(float64(a.Count())-20000) / 20000; e > 0.05 {
+		t.Fatalf("merged estimate %d", a.Count())
+	}
+
+	c, _ := NewHyperLogLog(10)
+	if err := a.Merge(c); err == nil {
+		t.Fatal("different precision: no error")
+	}
+
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back HyperLogLog
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if back.Count() != a.Count() {
+		t.Fatalf("read back %d, want %d", back.Count(), a.Count())
+	}
+	for _, bad := range [][]byte{nil, data[:len(data)-1], append([]byte{'X'}, data[1:]...)} {
+		if err := back.UnmarshalBinary(bad); err == nil {
+			t.Fatalf("%d bytes: no error", len(bad))
+		}
+	}
+}
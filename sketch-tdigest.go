@@ -0,0 +1,221 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// TDigest estimates quantiles of numbers. It keeps about
+// compression clusters, and is most accurate near the tails.
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min         float64
+	max         float64
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// NewTDigest returns an empty TDigest; compression is 20 to 1000,
+// or 0 for the default of 100.
+func NewTDigest(compression float64) (*TDigest, error) {
+	if compression == 0 {
+		compression = 100
+	}
+	if compression < 20 || compression > 1000 {
+		return nil, errors.New("compression must be between 20 and 1000")
+	}
+	return &TDigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}, nil
+}
+
+// Add adds a number; NaN is ignored.
+func (d *TDigest) Add(x float64) {
+	d.add(x, 1)
+}
+
+func (d *TDigest) add(x float64, w float64) {
+	if math.IsNaN(x) || w <= 0 {
+		return
+	}
+	d.buffer = append(d.buffer, centroid{x, w})
+	d.count += w
+	if x < d.min {
+		d.min = x
+	}
+	if x > d.max {
+		d.max = x
+	}
+	if len(d.buffer) >= int(5*d.compression) {
+		d.compress()
+	}
+}
+
+// Count returns the number of numbers added.
+func (d *TDigest) Count() uint64 {
+	return uint64(d.count)
+}
+
+// Min returns the smallest number added, or NaN.
+func (d *TDigest) Min() float64 {
+	if d.count == 0 {
+		return math.NaN()
+	}
+	return d.min
+}
+
+// Max returns the largest number added, or NaN.
+func (d *TDigest) Max() float64 {
+	if d.count == 0 {
+		return math.NaN()
+	}
+	return d.max
+}
+
+// Quantile returns the estimated q-quantile (0 to 1), e.g. 0.5 for
+// the median; NaN when empty.
+func (d *TDigest) Quantile(q float64) float64 {
+	if d.count == 0 || q < 0 || q > 1 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	d.compress()
+
+	cs := d.centroids
+	if len(cs) == 1 {
+		return cs[0].mean
+	}
+
+	// each centroid's mean sits at the middle of its weight
+	index := q * d.count
+	left, pos, cum := d.min, 0.0, 0.0
+	for _, c := range cs {
+		mid := cum + c.weight/2
+		if index < mid {
+			return interpolate(left, pos, c.mean, mid, index)
+		}
+		left, pos = c.mean, mid
+		cum += c.weight
+	}
+	return interpolate(left, pos, d.max, d.count, index)
+}
+
+func interpolate(x0 float64, p0 float64, x1 float64, p1 float64, p float64) float64 {
+	if p1 <= p0 {
+		return x1
+	}
+	return x0 + (x1-x0)*(p-p0)/(p1-p0)
+}
+
+// Merge adds the numbers seen by o.
+func (d *TDigest) Merge(o *TDigest) error {
+	if o == nil || o.count == 0 {
+		return nil
+	}
+	o.compress()
+	min, max := d.min, d.max
+	for _, c := range o.centroids {
+		d.add(c.mean, c.weight)
+	}
+	d.min, d.max = math.Min(min, o.min), math.Max(max, o.max)
+	return nil
+}
+
+// compress merges the buffer into the centroids, joining neighbours
+// while they fit in one unit of the k1 scale function.
+func (d *TDigest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.centroids, d.buffer...)
+	d.buffer = nil
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	k := func(q float64) float64 {
+		return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+	}
+
+	out := make([]centroid, 0, int(d.compression))
+	cur := all[0]
+	pos := 0.0
+	kLeft := k(0)
+	for _, c := range all[1:] {
+		q := (pos + cur.weight + c.weight) / d.count
+		if k(q)-kLeft <= 1 {
+			cur.mean += (c.mean - cur.mean) * c.weight / (cur.weight + c.weight)
+			cur.weight += c.weight
+			continue
+		}
+		out = append(out, cur)
+		pos += cur.weight
+		kLeft = k(pos / d.count)
+		cur = c
+	}
+	d.centroids = append(out, cur)
+}
+
+// MarshalBinary encodes the TDigest.
+func (d *TDigest) MarshalBinary() ([]byte, error) {
+	d.compress()
+	w := &binaryWriter{}
+	w.buf.Write([]byte{'T', sketchVersion})
+	for _, f := range []float64{d.compression, d.min, d.max} {
+		w.float(f)
+	}
+	w.uvarint(uint64(len(d.centroids)))
+	for _, c := range d.centroids {
+		w.float(c.mean)
+		w.float(c.weight)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a TDigest written by MarshalBinary.
+func (d *TDigest) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != 'T' {
+		return errors.New("not a TDigest")
+	}
+	if data[1] != sketchVersion {
+		return fmt.Errorf("unsupported format version %d", data[1])
+	}
+	r := &binaryReader{data: data, pos: 2}
+
+	var head [3]float64
+	for i := range head {
+		f, err := r.float()
+		if err != nil {
+			return err
+		}
+		head[i] = f
+	}
+	n, err := r.count()
+	if err != nil {
+		return err
+	}
+	cs := make([]centroid, n)
+	count := 0.0
+	for i := range cs {
+		if cs[i].mean, err = r.float(); err != nil {
+			return err
+		}
+		if cs[i].weight, err = r.float(); err != nil {
+			return err
+		}
+		if cs[i].weight <= 0 || (i > 0 && cs[i].mean < cs[i-1].mean) {
+			return errors.New("corrupt TDigest")
+		}
+		count += cs[i].weight
+	}
+	if r.pos != len(data) || head[0] < 20 || head[0] > 1000 {
+		return errors.New("corrupt TDigest")
+	}
+
+	*d = TDigest{compression: head[0], min: head[1], max: head[2], centroids: cs, count: count}
+	return nil
+}
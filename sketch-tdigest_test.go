@@ -0,0 +1,80 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTDigest(t *testing.T) {
+	d, err := NewTDigest(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(d.Quantile(0.5)) || !math.IsNaN(d.Min()) || !math.IsNaN(d.Max()) {
+		t.Fatal("empty digest is not NaN")
+	}
+	d.Add(5)
+	d.Add(math.NaN())
+	if d.Quantile(0.3) != 5 || d.Count() != 1 {
+		t.Fatalf("one number: %v, count %d", d.Quantile(0.3), d.Count())
+	}
+
+	d, _ = NewTDigest(0)
+	for i := 100000; i >= 1; i-- {
+		d.Add(float64(i))
+	}
+	if d.Count() != 100000 || d.Min() != 1 || d.Max() != 100000 || d.Quantile(0) != 1 || d.Quantile(1) != 100000 {
+		t.Fatalf("count %d, min %v, max %v", d.Count(), d.Min(), d.Max())
+	}
+	for _, q := range []float64{0.01, 0.25, 0.5, 0.9, 0.999} {
+		if got := d.Quantile(q); math.Abs(got-q*100000) > 0.01*100000 {
+			t.Fatalf("quantile %v: %v", q, got)
+		}
+	}
+	if len(d.centroids) > 2*int(d.compression) {
+		t.Fatalf("%d centroids", len(d.centroids))
+	}
+	if !math.IsNaN(d.Quantile(1.5)) {
+		t.Fatal("quantile 1.5 is not NaN")
+	}
+
+	for _, c := range []float64{10, 2000} {
+		if _, err := NewTDigest(c); err == nil {
+			t.Fatalf("compression %v: no error", c)
+		}
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	a, _ := NewTDigest(0)
+	b, _ := NewTDigest(0)
+	for i := 1; i <= 10000; i++ {
+		if i <= 5000 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Count() != 10000 || a.Min() != 1 || a.Max() != 10000 || math.Abs(a.Quantile(0.5)-5000) > 100 {
+		t.Fatalf("merged: count %d, min %v, max %v, median %v", a.Count(), a.Min(), a.Max(), a.Quantile(0.5))
+	}
+
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back TDigest
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if back.Count() != a.Count() || back.Quantile(0.9) != a.Quantile(0.9) || back.Min() != 1 {
+		t.Fatalf("read back: count %d, p90 %v", back.Count(), back.Quantile(0.9))
+	}
+	if err := back.UnmarshalBinary(data[:len(data)-3]); err == nil {
+		t.Fatal("truncated: no error")
+	}
+}
@@ -0,0 +1,320 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+)
+
+// sqlResult is the outcome of an INSERT, UPDATE or DELETE; lastRow
+// is the index of the last inserted row (-1 if none).
+type sqlResult struct {
+	affected int64
+	lastRow  int64
+}
+
+// Exec runs an INSERT, UPDATE or DELETE statement against the
+// tables of the dataset and returns the number of rows affected.
+//
+//	INSERT INTO t [(col, ...)] VALUES (expr, ...), ...
+//	INSERT INTO t [(col, ...)] SELECT ...
+//	UPDATE t SET col = expr, ... [WHERE cond]
+//	DELETE FROM t [WHERE cond]
+//
+// Values are converted to the type of typed columns; a value that
+// cannot be converted fails the statement, and nothing is changed.
+// Placeholders work as in Query.
+func (d *Dataset) Exec(sqlText string, args ...interface{}) (int64, error) {
+
+	stmt, err := parseStatement(sqlText)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := d.execStmt(sqlText, stmt, args)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.affected, nil
+}
+
+// stmtParams returns the number of placeholders of a statement.
+func stmtParams(stmt interface{}) int {
+	switch x := stmt.(type) {
+	case *selectStmt:
+		return x.nParams
+	case *insertStmt:
+		return x.nParams
+	case *updateStmt:
+		return x.nParams
+	case *deleteStmt:
+		return x.nParams
+	}
+	return 0
+}
+
+// execStmt runs a parsed INSERT, UPDATE or DELETE statement.
+func (d *Dataset) execStmt(src string, stmt interface{}, args []interface{}) (sqlResult, error) {
+
+	if n := stmtParams(stmt); n > len(args) {
+		return sqlResult{}, fmt.Errorf("sql: statement has %d placeholder(s) but %d argument(s) were given", n, len(args))
+	}
+
+	switch x := stmt.(type) {
+	case *insertStmt:
+		return d.execInsert(src, x, args)
+	case *updateStmt:
+		return d.execUpdate(src, x, args)
+	case *deleteStmt:
+		return d.execDelete(src, x, args)
+	}
+
+	toks, _ := tokenizeSQL(src)
+	return sqlResult{}, newSQLError(src, toks[0].pos, "SELECT", "SELECT is not run by Exec; use Query")
+}
+
+// dmlTable finds the target table of a statement and binds its
+// expressions to it.
+func (d *Dataset) dmlTable(src string, name string, pos int) (*Table, *sqlBinder, error) {
+	tbl := d.getTable(name)
+	if tbl == nil {
+		return nil, nil, newSQLError(src, pos, name, "no such table: %s", name)
+	}
+	if tbl.Cols == nil || tbl.Rows == nil {
+		return nil, nil, fmt.Errorf("sql: table %s is not initialized", tbl.Name)
+	}
+
+	b := &sqlBinder{src: src, visible: 1}
+	b.sources = []boundSource{{name: tbl.Name, alias: tbl.Name, tbl: tbl, cols: tbl.Cols.Get()}}
+
+	return tbl, b, nil
+}
+
+// dmlColumn returns the index of a target column of an INSERT or
+// UPDATE.
+func dmlColumn(src string, cols []Column, name string, pos int) (int, error) {
+	if name == row_id {
+		return -1, newSQLError(src, pos, name, "%s cannot be set", row_id)
+	}
+	j := indexOfColumn(cols, name)
+	if j < 0 {
+		return -1, newSQLError(src, pos, name, "no such column: %s", name)
+	}
+	return j, nil
+}
+
+// dmlValue converts a value to the type of a typed column.
+func dmlValue(col Column, v interface{}) (interface{}, error) {
+	typ := typedColType(col)
+	if typ == "" {
+		return v, nil
+	}
+	x, err := castValue(v, typ)
+	if err != nil {
+		return nil, fmt.Errorf("sql: column %s: %v", col.Name, err)
+	}
+	return x, nil
+}
+
+func (d *Dataset) execInsert(src string, stmt *insertStmt, args []interface{}) (sqlResult, error) {
+	res := sqlResult{lastRow: -1}
+
+	tbl, b, err := d.dmlTable(src, stmt.table, stmt.pos)
+	if err != nil {
+		return res, err
+	}
+	cols := tbl.Cols.Get()
+
+	// the target columns
+	var target []int
+	if len(stmt.cols) == 0 {
+		for j := 0; j < len(cols); j++ {
+			target = append(target, j)
+		}
+	}
+	for k := 0; k < len(stmt.cols); k++ {
+		j, err := dmlColumn(src, cols, stmt.cols[k], stmt.colPos[k])
+		if err != nil {
+			return res, err
+		}
+		for _, t := range target {
+			if t == j {
+				return res, newSQLError(src, stmt.colPos[k], stmt.cols[k], "column %s is given more than once", stmt.cols[k])
+			}
+		}
+		target = append(target, j)
+	}
+
+	// the rows to insert
+	var rows [][]interface{}
+	if stmt.query != nil {
+		qt, err := d.execSelect(src, stmt.query, args)
+		if err != nil {
+			return res, err
+		}
+		rcols := qt.Cols.Get()
+		if len(rcols) != len(target) {
+			return res, fmt.Errorf("sql: INSERT has %d target column(s) but the SELECT returns %d", len(target), len(rcols))
+		}
+		data := qt.Rows.GetRows()
+		for i := 0; i < len(data); i++ {
+			vals := make([]interface{}, len(rcols))
+			for j := 0; j < len(rcols); j++ {
+				vals[j] = data[i][rcols[j].Name]
+			}
+			rows = append(rows, vals)
+		}
+	} else {
+		b.visible = 0 // VALUES cannot refer to columns
+		ctx := &evalContext{args: args}
+		for i := 0; i < len(stmt.values); i++ {
+			exprs := stmt.values[i]
+			if len(exprs) != len(target) {
+				return res, newSQLError(src, exprs[0].position(), "", "VALUES list %d has %d value(s) but %d column(s) are set", i+1, len(exprs), len(target))
+			}
+			vals := make([]interface{}, len(exprs))
+			for j := 0; j < len(exprs); j++ {
+				if err := b.bind(exprs[j], "VALUES"); err != nil {
+					return res, err
+				}
+				if vals[j], err = exprs[j].eval(ctx); err != nil {
+					return res, err
+				}
+			}
+			rows = append(rows, vals)
+		}
+	}
+
+	// convert all values first: a failure changes nothing
+	for i := 0; i < len(rows); i++ {
+		for k := 0; k < len(target); k++ {
+			if rows[i][k], err = dmlValue(cols[target[k]], rows[i][k]); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	for i := 0; i < len(rows); i++ {
+		row := tbl.Rows.New()
+		for k := 0; k < len(target); k++ {
+			row[cols[target[k]].Name] = rows[i][k]
+		}
+	}
+
+	res.affected = int64(len(rows))
+	if len(rows) > 0 {
+		res.lastRow = int64(tbl.Rows.Count() - 1)
+	}
+
+	return res, nil
+}
+
+func (d *Dataset) execUpdate(src string, stmt *updateStmt, args []interface{}) (sqlResult, error) {
+	res := sqlResult{lastRow: -1}
+
+	tbl, b, err := d.dmlTable(src, stmt.table, stmt.pos)
+	if err != nil {
+		return res, err
+	}
+	cols := tbl.Cols.Get()
+
+	target := make([]int, len(stmt.sets))
+	for k := 0; k < len(stmt.sets); k++ {
+		s := stmt.sets[k]
+		if target[k], err = dmlColumn(src, cols, s.col, s.pos); err != nil {
+			return res, err
+		}
+		for x := 0; x < k; x++ {
+			if target[x] == target[k] {
+				return res, newSQLError(src, s.pos, s.col, "column %s is set more than once", s.col)
+			}
+		}
+		if err := b.bind(s.expr, "UPDATE"); err != nil {
+			return res, err
+		}
+	}
+	if err := b.bind(stmt.where, "WHERE"); err != nil {
+		return res, err
+	}
+
+	// evaluate against the old values, then write
+	var idx []int
+	var vals [][]interface{}
+	data := tbl.Rows.GetRows()
+	for i := 0; i < len(data); i++ {
+		ctx := &evalContext{rows: []Row{data[i]}, args: args}
+		if ok, err := dmlMatch(stmt.where, ctx); err != nil {
+			return res, err
+		} else if !ok {
+			continue
+		}
+		v := make([]interface{}, len(target))
+		for k := 0; k < len(target); k++ {
+			x, err := stmt.sets[k].expr.eval(ctx)
+			if err != nil {
+				return res, err
+			}
+			if v[k], err = dmlValue(cols[target[k]], x); err != nil {
+				return res, err
+			}
+		}
+		idx = append(idx, i)
+		vals = append(vals, v)
+	}
+
+	for n := 0; n < len(idx); n++ {
+		for k := 0; k < len(target); k++ {
+			if err := tbl.Rows.SetValue(idx[n], cols[target[k]].Name, vals[n][k]); err != nil {
+				return res, err
+			}
+		}
+	}
+	res.affected = int64(len(idx))
+
+	return res, nil
+}
+
+func (d *Dataset) execDelete(src string, stmt *deleteStmt, args []interface{}) (sqlResult, error) {
+	res := sqlResult{lastRow: -1}
+
+	tbl, b, err := d.dmlTable(src, stmt.table, stmt.pos)
+	if err != nil {
+		return res, err
+	}
+	if err := b.bind(stmt.where, "WHERE"); err != nil {
+		return res, err
+	}
+
+	var idx []int
+	data := tbl.Rows.GetRows()
+	for i := 0; i < len(data); i++ {
+		ok, err := dmlMatch(stmt.where, &evalContext{rows: []Row{data[i]}, args: args})
+		if err != nil {
+			return res, err
+		}
+		if ok {
+			idx = append(idx, i)
+		}
+	}
+
+	if err := tbl.Rows.RemoveAt(idx...); err != nil {
+		return res, err
+	}
+	res.affected = int64(len(idx))
+
+	return res, nil
+}
+
+// dmlMatch reports whether a row satisfies the WHERE clause (nil
+// matches all rows).
+func dmlMatch(where sqlExpr, ctx *evalContext) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	v, err := where.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	ok, _ := toBool(v)
+	return ok, nil
+}
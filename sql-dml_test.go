@@ -0,0 +1,109 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecInsertUpdateDelete(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl, _ := (&Table{}).Create("people", storage)
+		tbl.Cols.SetColumns([]Column{
+			{Name: "id", Type: ColTypeInteger}, {Name: "name", Type: ColTypeString},
+			{Name: "score", Type: ColTypeFloat}, {Name: "born", Type: ColTypeDateTime}, {Name: "note"},
+		})
+		ds := &Dataset{}
+		if err := ds.Add(*tbl); err != nil {
+			t.Fatal(err)
+		}
+		people := ds.getTable("people")
+
+		// values are converted to the column types; ? and $n are
+		// placeholders
+		n, err := ds.Exec(`INSERT INTO people (id, name, score, born) VALUES (1, 'a', 1.5, '2020-01-02'), (2, 'b', ?, NULL), ($3, 'c', 3, NULL)`, "2.5", nil, "3")
+		if err != nil || n != 3 {
+			t.Fatalf("storage %d: insert %d, %v", storage, n, err)
+		}
+		want := "[[1 a 1.5 2020-01-02 00:00:00 +0000 UTC <nil>] [2 b 2.5 <nil> <nil>] [3 c 3 <nil> <nil>]]"
+		if got := fmt.Sprint(tableValues(people)); got != want {
+			t.Fatalf("storage %d: %s", storage, got)
+		}
+		if v, _ := people.Rows.GetValue(1, "score"); v != 2.5 {
+			t.Fatalf("storage %d: score %#v", storage, v)
+		}
+		if v, _ := people.Rows.GetValue(0, "born"); v != time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC) {
+			t.Fatalf("storage %d: born %#v", storage, v)
+		}
+
+		// a failed statement changes nothing
+		if _, err := ds.Exec(`INSERT INTO people (id) VALUES (4), ('x')`); err == nil {
+			t.Fatalf("storage %d: cast: no error", storage)
+		}
+		if people.Rows.Count() != 3 {
+			t.Fatalf("storage %d: %d rows after a failed insert", storage, people.Rows.Count())
+		}
+
+		n, err = ds.Exec(`UPDATE people SET score = score * 2, note = name || '!' WHERE id >= 2`)
+		if err != nil || n != 2 {
+			t.Fatalf("storage %d: update %d, %v", storage, n, err)
+		}
+		if got := fmt.Sprint(people.Cols.GetData("score"), people.Cols.GetData("note")); got != "[1.5 5 6] [<nil> b! c!]" {
+			t.Fatalf("storage %d: updated %s", storage, got)
+		}
+
+		// row ids are renumbered after a delete
+		n, err = ds.Exec(`DELETE FROM people WHERE id = 2`)
+		if err != nil || n != 1 || people.Rows.Count() != 2 {
+			t.Fatalf("storage %d: delete %d, %v", storage, n, err)
+		}
+		if r := people.Rows.GetRow(1); r[row_id] != 1 || r["name"] != "c" {
+			t.Fatalf("storage %d: row %v", storage, r)
+		}
+
+		n, err = ds.Exec(`INSERT INTO people SELECT id + 10, name, score, born, note FROM people`)
+		if err != nil || n != 2 {
+			t.Fatalf("storage %d: insert select %d, %v", storage, n, err)
+		}
+		if got := fmt.Sprint(people.Cols.GetData("id")); got != "[1 3 11 13]" {
+			t.Fatalf("storage %d: ids %s", storage, got)
+		}
+
+		n, err = ds.Exec(`DELETE FROM people;`)
+		if err != nil || n != 4 || people.Rows.Count() != 0 {
+			t.Fatalf("storage %d: delete all %d, %v", storage, n, err)
+		}
+	}
+}
+
+func TestExecErrors(t *testing.T) {
+	tbl, _ := (&Table{}).Create("people")
+	tbl.Cols.SetColumns([]Column{{Name: "id", Type: ColTypeInteger}, {Name: "name"}})
+	ds := &Dataset{}
+	if err := ds.Add(*tbl); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{
+		`UPDATE people SET nope = 1`,
+		`UPDATE people SET id = 1, ID = 2`,
+		`UPDATE people SET _rowid_ = 1`,
+		`INSERT INTO nope VALUES (1)`,
+		`INSERT INTO people (id, name) VALUES (1)`,
+		`INSERT INTO people (id) VALUES (id)`,
+		`DELETE FROM people WHERE count(*) > 1`,
+		`SELECT 1`,
+	} {
+		if _, err := ds.Exec(q); err == nil {
+			t.Fatalf("%s: no error", q)
+		}
+	}
+	if _, err := ds.Exec(`DELETE FROM people WHERE id = ?`); err == nil {
+		t.Fatal("missing argument: no error")
+	}
+	if _, err := ds.Query(`  DELETE FROM people`); err == nil || !strings.Contains(err.Error(), "not a query") {
+		t.Fatalf("Query with DELETE: %v", err)
+	}
+}
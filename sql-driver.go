@@ -0,0 +1,316 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DriverName is the name of the database/sql driver that serves
+// the registered datasets:
+//
+//	collections.RegisterDataset("sales", ds)
+//	db, err := sql.Open(collections.DriverName, "sales")
+const DriverName = "collections"
+
+func init() {
+	sql.Register(DriverName, &sqlDriver{})
+}
+
+// driverDatasets are the datasets registered by name; locks holds
+// a mutex per dataset, which serializes the statements run on it.
+var driverDatasets = struct {
+	sync.Mutex
+	byName map[string]*Dataset
+	locks  map[*Dataset]*sync.Mutex
+}{byName: map[string]*Dataset{}, locks: map[*Dataset]*sync.Mutex{}}
+
+// RegisterDataset makes a dataset available to database/sql as
+// sql.Open("collections", name); a dataset already registered under
+// that name is replaced. SELECT statements are run by Query, and
+// INSERT, UPDATE and DELETE change d.Tables. Statements run through
+// the driver are serialized, but they are not synchronized with
+// direct use of d.
+func RegisterDataset(name string, d *Dataset) error {
+	if d == nil {
+		return errors.New("dataset is nil")
+	}
+
+	driverDatasets.Lock()
+	defer driverDatasets.Unlock()
+
+	driverDatasets.byName[name] = d
+	if driverDatasets.locks[d] == nil {
+		driverDatasets.locks[d] = &sync.Mutex{}
+	}
+
+	return nil
+}
+
+// UnregisterDataset removes a dataset registered by RegisterDataset;
+// connections already open keep working.
+func UnregisterDataset(name string) {
+	driverDatasets.Lock()
+	defer driverDatasets.Unlock()
+
+	d := driverDatasets.byName[name]
+	if d == nil {
+		return
+	}
+	delete(driverDatasets.byName, name)
+	for _, x := range driverDatasets.byName {
+		if x == d {
+			return
+		}
+	}
+	delete(driverDatasets.locks, d)
+}
+
+type sqlDriver struct{}
+
+// Open opens a connection to the dataset registered as name.
+func (sqlDriver) Open(name string) (driver.Conn, error) {
+	driverDatasets.Lock()
+	defer driverDatasets.Unlock()
+
+	d := driverDatasets.byName[name]
+	if d == nil {
+		return nil, fmt.Errorf("collections: no dataset registered as %q", name)
+	}
+
+	return &sqlConn{d: d, mu: driverDatasets.locks[d]}, nil
+}
+
+type sqlConn struct {
+	d  *Dataset
+	mu *sync.Mutex
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext parses the statement; syntax errors are returned
+// here as *SQLError.
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := parseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlDriverStmt{c: c, src: query, stmt: stmt}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return nil
+}
+
+// Begin fails: the driver has no transactions.
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("collections: transactions are not supported")
+}
+
+type sqlDriverStmt struct {
+	c    *sqlConn
+	src  string
+	stmt interface{}
+}
+
+func (s *sqlDriverStmt) Close() error {
+	return nil
+}
+
+func (s *sqlDriverStmt) NumInput() int {
+	return stmtParams(s.stmt)
+}
+
+func (s *sqlDriverStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlDriverStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+// ExecContext runs an INSERT, UPDATE or DELETE statement.
+func (s *sqlDriverStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	vals, err := driverArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	res, err := s.c.d.execStmt(s.src, s.stmt, vals)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryContext runs a SELECT statement.
+func (s *sqlDriverStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	sel, ok := s.stmt.(*selectStmt)
+	if !ok {
+		_, err := parseSQL(s.src) // the "not a query" error
+		return nil, err
+	}
+	vals, err := driverArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) < sel.nParams {
+		return nil, fmt.Errorf("sql: statement has %d placeholder(s) but %d argument(s) were given", sel.nParams, len(vals))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	tbl, err := s.c.d.execSelect(s.src, sel, vals)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlDriverRows{cols: tbl.Cols.Get(), rows: tbl.Rows.GetRows()}, nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i := 0; i < len(args); i++ {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: args[i]}
+	}
+	return nv
+}
+
+// driverArgs returns the values of the placeholders; []byte values
+// are passed as strings.
+func driverArgs(args []driver.NamedValue) ([]interface{}, error) {
+	vals := make([]interface{}, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i].Name != "" {
+			return nil, fmt.Errorf("collections: named parameters are not supported (%s)", args[i].Name)
+		}
+		v := args[i].Value
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// LastInsertId returns the row index of the last row inserted.
+func (r sqlResult) LastInsertId() (int64, error) {
+	if r.lastRow < 0 {
+		return 0, errors.New("collections: no row was inserted")
+	}
+	return r.lastRow, nil
+}
+
+func (r sqlResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+// sqlDriverRows iterates the result of a query.
+type sqlDriverRows struct {
+	cols []Column
+	rows []Row
+	i    int
+}
+
+func (r *sqlDriverRows) Columns() []string {
+	return columnNames(r.cols)
+}
+
+func (r *sqlDriverRows) Close() error {
+	r.rows = nil
+	return nil
+}
+
+func (r *sqlDriverRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	row := r.rows[r.i]
+	r.i++
+	for j := 0; j < len(r.cols) && j < len(dest); j++ {
+		dest[j] = driverColumnValue(r.cols[j], row[r.cols[j].Name])
+	}
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns INTEGER, FLOAT, BOOL, DATETIME
+// or TEXT, or "" for an untyped column.
+func (r *sqlDriverRows) ColumnTypeDatabaseTypeName(j int) string {
+	switch typedColType(r.cols[j]) {
+	case ColTypeInteger:
+		return "INTEGER"
+	case ColTypeFloat:
+		return "FLOAT"
+	case ColTypeBool:
+		return "BOOL"
+	case ColTypeDateTime:
+		return "DATETIME"
+	case ColTypeString:
+		return "TEXT"
+	}
+	return ""
+}
+
+func (r *sqlDriverRows) ColumnTypeScanType(j int) reflect.Type {
+	switch typedColType(r.cols[j]) {
+	case ColTypeInteger:
+		return reflect.TypeOf(int64(0))
+	case ColTypeFloat:
+		return reflect.TypeOf(float64(0))
+	case ColTypeBool:
+		return reflect.TypeOf(false)
+	case ColTypeDateTime:
+		return reflect.TypeOf(time.Time{})
+	case ColTypeString:
+		return reflect.TypeOf("")
+	}
+	return reflect.TypeOf((*interface{})(nil)).Elem()
+}
+
+func (r *sqlDriverRows) ColumnTypeNullable(j int) (nullable, ok bool) {
+	return !r.cols[j].NotNull, true
+}
+
+// driverColumnValue converts a value to a driver.Value: the values
+// of typed columns are converted to int64, float64, bool, time.Time
+// or string; other values keep their kind, and values of other
+// types are passed as text.
+func driverColumnValue(col Column, v interface{}) driver.Value {
+	if isNull(v) {
+		return nil
+	}
+	if typ := typedColType(col); typ != "" {
+		if x, err := castValue(v, typ); err == nil {
+			v = x
+		}
+	}
+
+	v = driverValue(v)
+	switch x := v.(type) {
+	case int64, float64, bool, string, []byte, time.Time:
+		return x
+	case driver.Valuer:
+		if dv, err := x.Value(); err == nil && driver.IsValue(dv) {
+			return dv
+		}
+	}
+	return toString(v)
+}
@@ -0,0 +1,160 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openPeople registers a dataset with an empty people table and
+// opens it with the driver.
+func openPeople(t *testing.T, name string, storage Storage) *sql.DB {
+	tbl, _ := (&Table{}).Create("people", storage)
+	tbl.Cols.SetColumns([]Column{
+		{Name: "id", Type: ColTypeInteger}, {Name: "name", Type: ColTypeString},
+		{Name: "score", Type: ColTypeFloat}, {Name: "born", Type: ColTypeDateTime}, {Name: "note"},
+	})
+	ds := &Dataset{}
+	if err := ds.Add(*tbl); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterDataset(name, ds); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(DriverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		UnregisterDataset(name)
+	})
+	return db
+}
+
+func TestDriver(t *testing.T) {
+	db := openPeople(t, "driver", RowStorage)
+
+	stmt, err := db.Prepare(`INSERT INTO people (id, name, score, born, note) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	born := time.Date(1990, 5, 6, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		res, err := stmt.Exec(i, string(rune('a'+i)), float32(i)/2, born, []byte("x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, _ := res.LastInsertId(); id != int64(i) {
+			t.Fatalf("LastInsertId %d, want %d", id, i)
+		}
+	}
+	stmt.Close()
+
+	res, err := db.Exec(`UPDATE people SET note = NULL WHERE id > $1`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("RowsAffected %d", n)
+	}
+
+	rows, err := db.Query(`SELECT id, name, score, born, note FROM people WHERE id >= ? ORDER BY id DESC`, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, ct := range cts {
+		types = append(types, ct.DatabaseTypeName())
+	}
+	if got := fmt.Sprint(types); got != "[INTEGER TEXT FLOAT DATETIME TEXT]" {
+		t.Fatalf("column types %s", got)
+	}
+
+	k := 0
+	for rows.Next() {
+		var id int
+		var name string
+		var score float64
+		var b time.Time
+		var note sql.NullString
+		if err := rows.Scan(&id, &name, &score, &b, &note); err != nil {
+			t.Fatal(err)
+		}
+		if id != 4-k || name != string(rune('a'+id)) || score != float64(id)/2 || !b.Equal(born) || note.Valid != (id <= 2) {
+			t.Fatalf("row %d: %v %v %v %v %v", k, id, name, score, b, note)
+		}
+		k++
+	}
+	if err := rows.Err(); err != nil || k != 4 {
+		t.Fatalf("%d rows, %v", k, err)
+	}
+	rows.Close()
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n); err != nil || n != 5 {
+		t.Fatalf("count %d, %v", n, err)
+	}
+}
+
+func TestDriverErrors(t *testing.T) {
+	db := openPeople(t, "driver_errors", RowStorage)
+
+	if _, err := db.Exec(`DELETE FROM people WHERE id = ?`); err == nil {
+		t.Fatal("missing argument: no error")
+	}
+	if _, err := db.Query(`SELEC 1`); err == nil {
+		t.Fatal("syntax: no error")
+	} else if _, ok := err.(*SQLError); !ok {
+		t.Fatalf("syntax error is %T", err)
+	}
+	if _, err := db.Begin(); err == nil {
+		t.Fatal("Begin: no error")
+	}
+	if _, err := db.Exec(`INSERT INTO people (id) VALUES (:x)`, sql.Named("x", 1)); err == nil {
+		t.Fatal("named argument: no error")
+	}
+
+	unknown, _ := sql.Open(DriverName, "nope")
+	if err := unknown.Ping(); err == nil {
+		t.Fatal("unknown dataset: no error")
+	}
+	unknown.Close()
+}
+
+// Statements on a dataset are serialized.
+func TestDriverConcurrent(t *testing.T) {
+	db := openPeople(t, "driver_concurrent", ColumnStorage)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := db.Exec(`INSERT INTO people (id, name) VALUES (?, ?)`, g*100+i, "x"); err != nil {
+					t.Error(err)
+					return
+				}
+				var n int
+				if err := db.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n); err != nil || n != 400 {
+		t.Fatalf("count %d, %v", n, err)
+	}
+}
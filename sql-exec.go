@@ -0,0 +1,858 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// boundSource is a FROM-clause table resolved against a Dataset.
+type boundSource struct {
+	name  string
+	alias string
+	tbl   *Table
+	cols  []Column
+}
+
+// outColumn is one column of a query result.
+type outColumn struct {
+	name string
+	typ  string
+	expr sqlExpr
+}
+
+// orderKey is an ORDER BY item; it either points to an output
+// column (outIdx) or is evaluated per row/group.
+type orderKey struct {
+	outIdx int
+	expr   sqlExpr
+	desc   bool
+}
+
+// sqlGroup is a GROUP BY bucket; rows is the first row of the group.
+type sqlGroup struct {
+	rows   []Row
+	states []aggState
+}
+
+// sqlBinder resolves column references against the sources of
+// a statement.
+type sqlBinder struct {
+	src     string
+	sources []boundSource
+
+	// visible is the number of sources a reference may resolve
+	// to (ON clauses only see the tables joined so far).
+	visible int
+}
+
+// Query runs a SELECT statement against the tables of the dataset
+// and returns the result as a new table. Placeholders are written
+// as ? (in order) or $1, $2... and are filled from args.
+//
+// Supported: SELECT [DISTINCT] expressions and *, FROM with
+// [INNER] JOIN, LEFT/RIGHT/FULL [OUTER] JOIN, CROSS JOIN (equality
+// conditions are hash-joined), WHERE, GROUP BY,
+// HAVING, ORDER BY, LIMIT/OFFSET; the aggregates COUNT, SUM, AVG,
+// MIN, MAX, STDDEV, MEDIAN; CASE, CAST, IN, BETWEEN, LIKE, IS NULL and a set of
+// scalar functions. Errors in the statement are returned as
+// *SQLError and point to the offending position.
+func (d *Dataset) Query(sqlText string, args ...interface{}) (*Table, error) {
+
+	stmt, err := parseSQL(sqlText)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.nParams > len(args) {
+		return nil, fmt.Errorf("sql: statement has %d placeholder(s) but %d argument(s) were given", stmt.nParams, len(args))
+	}
+
+	return d.execSelect(sqlText, stmt, args)
+}
+
+// getTable finds a table by its name (case-insensitive).
+func (d *Dataset) getTable(name string) *Table {
+	for i := 0; i < len(d.Tables); i++ {
+		if d.Tables[i].Name == name {
+			return &d.Tables[i]
+		}
+	}
+	for i := 0; i < len(d.Tables); i++ {
+		if strings.EqualFold(d.Tables[i].Name, name) {
+			return &d.Tables[i]
+		}
+	}
+	return nil
+}
+
+func (d *Dataset) execSelect(src string, stmt *selectStmt, args []interface{}) (*Table, error) {
+
+	b := &sqlBinder{src: src}
+
+	// FROM
+	for i := 0; i < len(stmt.sources); i++ {
+		s := stmt.sources[i]
+		tbl := d.getTable(s.name)
+		if tbl == nil {
+			return nil, newSQLError(src, s.pos, s.name, "no such table: %s", s.name)
+		}
+		alias := s.alias
+		if alias == "" {
+			alias = tbl.Name
+		}
+		for j := 0; j < len(b.sources); j++ {
+			if strings.EqualFold(b.sources[j].alias, alias) {
+				return nil, newSQLError(src, s.pos, s.name, "table name or alias %s is used more than once", alias)
+			}
+		}
+		b.sources = append(b.sources, boundSource{name: tbl.Name, alias: alias, tbl: tbl, cols: tbl.Cols.Get()})
+	}
+
+	// ON clauses see the tables joined so far.
+	for i := 1; i < len(stmt.sources); i++ {
+		b.visible = i + 1
+		if err := b.bind(stmt.sources[i].on, "JOIN conditions"); err != nil {
+			return nil, err
+		}
+	}
+	b.visible = len(b.sources)
+
+	if err := b.bind(stmt.where, "WHERE"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(stmt.groupBy); i++ {
+		if err := b.bind(stmt.groupBy[i], "GROUP BY"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Select list
+	outCols, err := b.expandSelectList(stmt.items)
+	if err != nil {
+		return nil, err
+	}
+
+	// ORDER BY may refer to output columns by name or position.
+	var keys []orderKey
+	for i := 0; i < len(stmt.orderBy); i++ {
+		k, err := b.resolveOrderItem(stmt.orderBy[i], outCols)
+		if err != nil {
+			return nil, err
+		}
+		if stmt.distinct && k.outIdx < 0 {
+			return nil, newSQLError(src, k.expr.position(), "", "for SELECT DISTINCT, ORDER BY expressions must appear in the select list")
+		}
+		keys = append(keys, k)
+	}
+
+	// Aggregates
+	var aggs []*exprFunc
+	collect := func(e sqlExpr) error {
+		return walkExpr(e, func(x sqlExpr) error {
+			fn, ok := x.(*exprFunc)
+			if !ok || !isAggregateName(fn.name) {
+				return nil
+			}
+			for i := 0; i < len(fn.args); i++ {
+				if err := b.rejectAggregates(fn.args[i], "aggregate function arguments"); err != nil {
+					return err
+				}
+			}
+			fn.agg = len(aggs)
+			aggs = append(aggs, fn)
+			return nil
+		})
+	}
+	for i := 0; i < len(outCols); i++ {
+		if err := collect(outCols[i].expr); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.bind(stmt.having, "HAVING"); err != nil {
+		return nil, err
+	}
+	if err := collect(stmt.having); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(keys); i++ {
+		if err := collect(keys[i].expr); err != nil {
+			return nil, err
+		}
+	}
+
+	grouped := len(stmt.groupBy) > 0 || len(aggs) > 0
+	if stmt.having != nil && !grouped {
+		return nil, newSQLError(src, stmt.having.position(), "", "HAVING requires GROUP BY or an aggregate function")
+	}
+
+	// FROM / JOIN / WHERE
+	tuples, err := b.joinSources(stmt, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var outRows [][]interface{}
+	var sortVals [][]interface{}
+
+	emit := func(ctx *evalContext) error {
+		vals := make([]interface{}, len(outCols))
+		for j := 0; j < len(outCols); j++ {
+			v, err := outCols[j].expr.eval(ctx)
+			if err != nil {
+				return err
+			}
+			vals[j] = v
+		}
+		sv := make([]interface{}, len(keys))
+		for j := 0; j < len(keys); j++ {
+			if keys[j].outIdx >= 0 {
+				sv[j] = vals[keys[j].outIdx]
+				continue
+			}
+			v, err := keys[j].expr.eval(ctx)
+			if err != nil {
+				return err
+			}
+			sv[j] = v
+		}
+		outRows = append(outRows, vals)
+		sortVals = append(sortVals, sv)
+		return nil
+	}
+
+	if !grouped {
+		for i := 0; i < len(tuples); i++ {
+			if err := emit(&evalContext{rows: tuples[i], args: args}); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		groups, err := groupTuples(tuples, stmt.groupBy, aggs, len(b.sources), args)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(groups); i++ {
+			ctx := &evalContext{rows: groups[i].rows, args: args, aggs: make([]interface{}, len(aggs))}
+			for j := 0; j < len(aggs); j++ {
+				ctx.aggs[j] = groups[i].states[j].result()
+			}
+			if stmt.having != nil {
+				v, err := stmt.having.eval(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if ok, _ := toBool(v); !ok {
+					continue
+				}
+			}
+			if err := emit(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// DISTINCT
+	if stmt.distinct {
+		seen := make(map[string]bool)
+		var dr, ds [][]interface{}
+		for i := 0; i < len(outRows); i++ {
+			k := valuesKey(outRows[i])
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			dr = append(dr, outRows[i])
+			ds = append(ds, sortVals[i])
+		}
+		outRows, sortVals = dr, ds
+	}
+
+	// ORDER BY
+	if len(keys) > 0 {
+		idx := make([]int, len(outRows))
+		for i := 0; i < len(idx); i++ {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(x, y int) bool {
+			for k := 0; k < len(keys); k++ {
+				c := compareValues(sortVals[idx[x]][k], sortVals[idx[y]][k])
+				if c == 0 {
+					continue
+				}
+				if keys[k].desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+		sorted := make([][]interface{}, len(outRows))
+		for i := 0; i < len(idx); i++ {
+			sorted[i] = outRows[idx[i]]
+		}
+		outRows = sorted
+	}
+
+	// LIMIT / OFFSET
+	if outRows, err = applyLimit(outRows, stmt, args); err != nil {
+		return nil, err
+	}
+
+	return buildResultTable(outCols, outRows)
+}
+
+// bind resolves the column references of e; clause names the
+// clause for errors about misplaced aggregates.
+func (b *sqlBinder) bind(e sqlExpr, clause string) error {
+	if e == nil {
+		return nil
+	}
+	if clause != "" && clause != "HAVING" {
+		if err := b.rejectAggregates(e, clause); err != nil {
+			return err
+		}
+	}
+	return walkExpr(e, func(x sqlExpr) error {
+		if c, ok := x.(*exprColumn); ok {
+			return b.resolveColumn(c)
+		}
+		return nil
+	})
+}
+
+func (b *sqlBinder) rejectAggregates(e sqlExpr, clause string) error {
+	return walkExpr(e, func(x sqlExpr) error {
+		if fn, ok := x.(*exprFunc); ok && isAggregateName(fn.name) {
+			return newSQLError(b.src, fn.pos, strings.ToUpper(fn.name), "aggregate functions are not allowed in %s", clause)
+		}
+		return nil
+	})
+}
+
+// findSource returns the index of the source with the given alias
+// (or table name), or -1.
+func (b *sqlBinder) findSource(qual string) int {
+	for i := 0; i < b.visible; i++ {
+		if strings.EqualFold(b.sources[i].alias, qual) {
+			return i
+		}
+	}
+	for i := 0; i < b.visible; i++ {
+		if strings.EqualFold(b.sources[i].name, qual) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findColumn returns the row-map key of a column of source i
+// (exact match first, then case-insensitive), or "".
+func (b *sqlBinder) findColumn(i int, name string) string {
+	if name == row_id {
+		return row_id
+	}
+	cols := b.sources[i].cols
+	if j := indexOfColumn(cols, name); j >= 0 {
+		return cols[j].Name
+	}
+	return ""
+}
+
+func (b *sqlBinder) resolveColumn(c *exprColumn) error {
+	if c.qual != "" {
+		i := b.findSource(c.qual)
+		if i < 0 {
+			return newSQLError(b.src, c.pos, c.qual, "no such table: %s", c.qual)
+		}
+		col := b.findColumn(i, c.name)
+		if col == "" {
+			return newSQLError(b.src, c.pos, c.qual+"."+c.name, "no such column: %s.%s", c.qual, c.name)
+		}
+		c.src, c.col = i, col
+		return nil
+	}
+
+	found := -1
+	for i := 0; i < b.visible; i++ {
+		col := b.findColumn(i, c.name)
+		if col == "" {
+			continue
+		}
+		if found >= 0 {
+			return newSQLError(b.src, c.pos, c.name, "ambiguous column name: %s", c.name)
+		}
+		found = i
+		c.src, c.col = i, col
+	}
+	if found < 0 {
+		return newSQLError(b.src, c.pos, c.name, "no such column: %s", c.name)
+	}
+
+	return nil
+}
+
+// columnType returns the declared type of a bound column reference.
+func (b *sqlBinder) columnType(c *exprColumn) string {
+	if c.col == row_id {
+		return ColTypeInteger
+	}
+	cols := b.sources[c.src].cols
+	for j := 0; j < len(cols); j++ {
+		if cols[j].Name == c.col {
+			return cols[j].Type
+		}
+	}
+	return ""
+}
+
+// expandSelectList binds the select items and expands * and t.*.
+func (b *sqlBinder) expandSelectList(items []selectItem) ([]outColumn, error) {
+	var out []outColumn
+
+	addStar := func(i int) {
+		cols := b.sources[i].cols
+		for j := 0; j < len(cols); j++ {
+			e := &exprColumn{name: cols[j].Name, src: i, col: cols[j].Name}
+			name := cols[j].Name
+			if len(b.sources) > 1 && b.nameInOtherSource(i, name) {
+				name = b.sources[i].alias + "." + name
+			}
+			out = append(out, outColumn{name: name, typ: cols[j].Type, expr: e})
+		}
+	}
+
+	for i := 0; i < len(items); i++ {
+		it := items[i]
+
+		if it.star {
+			if len(b.sources) == 0 {
+				return nil, newSQLError(b.src, it.pos, "*", "no tables specified")
+			}
+			if it.qual == "" {
+				for s := 0; s < len(b.sources); s++ {
+					addStar(s)
+				}
+				continue
+			}
+			s := b.findSource(it.qual)
+			if s < 0 {
+				return nil, newSQLError(b.src, it.pos, it.qual, "no such table: %s", it.qual)
+			}
+			addStar(s)
+			continue
+		}
+
+		if err := b.bind(it.expr, ""); err != nil {
+			return nil, err
+		}
+
+		oc := outColumn{name: it.alias, expr: it.expr}
+		if c, ok := it.expr.(*exprColumn); ok {
+			if oc.name == "" {
+				oc.name = c.col
+			}
+			oc.typ = b.columnType(c)
+		}
+		if oc.name == "" {
+			oc.name = it.text
+		}
+		out = append(out, oc)
+	}
+
+	// Result column names must be unique.
+	used := make(map[string]bool)
+	for i := 0; i < len(out); i++ {
+		name := out[i].name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s_%d", out[i].name, n)
+		}
+		used[strings.ToLower(name)] = true
+		out[i].name = name
+	}
+
+	return out, nil
+}
+
+func (b *sqlBinder) nameInOtherSource(i int, name string) bool {
+	for s := 0; s < len(b.sources); s++ {
+		if s != i && b.findColumn(s, name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *sqlBinder) resolveOrderItem(oi orderItem, outCols []outColumn) (orderKey, error) {
+	k := orderKey{outIdx: -1, expr: oi.expr, desc: oi.desc}
+
+	switch x := oi.expr.(type) {
+	case *exprLiteral:
+		if n, ok := x.val.(int64); ok {
+			if n < 1 || int(n) > len(outCols) {
+				return k, newSQLError(b.src, x.pos, fmt.Sprintf("%d", n), "ORDER BY position %d is out of range", n)
+			}
+			k.outIdx = int(n) - 1
+			return k, nil
+		}
+	case *exprColumn:
+		if x.qual == "" {
+			for i := 0; i < len(outCols); i++ {
+				if strings.EqualFold(outCols[i].name, x.name) {
+					k.outIdx = i
+					return k, nil
+				}
+			}
+		}
+	}
+
+	if err := b.bind(oi.expr, ""); err != nil {
+		return k, err
+	}
+
+	// a qualified name of a selected column is that column
+	if x, ok := oi.expr.(*exprColumn); ok {
+		for i := 0; i < len(outCols); i++ {
+			if c, ok := outCols[i].expr.(*exprColumn); ok && c.src == x.src && c.col == x.col {
+				k.outIdx = i
+				break
+			}
+		}
+	}
+
+	return k, nil
+}
+
+// joinSources builds the joined rows of the FROM clause (one Row
+// per source) and applies the WHERE clause.
+func (b *sqlBinder) joinSources(stmt *selectStmt, args []interface{}) ([][]Row, error) {
+	n := len(b.sources)
+	var tuples [][]Row
+
+	if n == 0 {
+		tuples = append(tuples, []Row{})
+	} else {
+		rows := b.sources[0].tbl.Rows.GetRows()
+		for i := 0; i < len(rows); i++ {
+			t := make([]Row, n)
+			t[0] = rows[i]
+			tuples = append(tuples, t)
+		}
+	}
+
+	for s := 1; s < n; s++ {
+		on := stmt.sources[s].on
+		kind := stmt.sources[s].join
+		rows := b.sources[s].tbl.Rows.GetRows()
+		rMatched := make([]bool, len(rows))
+		var joined [][]Row
+
+		// Equality conditions between this table and the ones
+		// before it are looked up in a hash index.
+		lExprs, rExprs := equiJoinExprs(on, s)
+		var index map[string][]int
+		if len(rExprs) > 0 {
+			var err error
+			if index, err = exprHashIndex(rows, rExprs, s, n, args); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := 0; i < len(tuples); i++ {
+			candidates := allIndexes(len(rows))
+			if index != nil {
+				k, ok, err := exprKey(lExprs, &evalContext{rows: tuples[i], args: args})
+				if err != nil {
+					return nil, err
+				}
+				candidates = nil
+				if ok {
+					candidates = index[k]
+				}
+			}
+
+			matched := false
+			for _, j := range candidates {
+				t := make([]Row, n)
+				copy(t, tuples[i])
+				t[s] = rows[j]
+				if on != nil {
+					v, err := on.eval(&evalContext{rows: t, args: args})
+					if err != nil {
+						return nil, err
+					}
+					if ok, _ := toBool(v); !ok {
+						continue
+					}
+				}
+				matched = true
+				rMatched[j] = true
+				joined = append(joined, t)
+			}
+			if !matched && (kind == joinLeft || kind == joinFull) {
+				t := make([]Row, n)
+				copy(t, tuples[i])
+				joined = append(joined, t)
+			}
+		}
+
+		if kind == joinRight || kind == joinFull {
+			for j := 0; j < len(rows); j++ {
+				if !rMatched[j] {
+					t := make([]Row, n)
+					t[s] = rows[j]
+					joined = append(joined, t)
+				}
+			}
+		}
+
+		tuples = joined
+	}
+
+	if stmt.where == nil {
+		return tuples, nil
+	}
+
+	var filtered [][]Row
+	for i := 0; i < len(tuples); i++ {
+		v, err := stmt.where.eval(&evalContext{rows: tuples[i], args: args})
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := toBool(v); ok {
+			filtered = append(filtered, tuples[i])
+		}
+	}
+
+	return filtered, nil
+}
+
+// equiJoinExprs finds the conditions of the form a = b (joined by
+// AND) in an ON clause where one side reads only source s and the
+// other only the sources before it.
+func equiJoinExprs(on sqlExpr, s int) ([]sqlExpr, []sqlExpr) {
+	var lExprs, rExprs []sqlExpr
+
+	var visit func(e sqlExpr)
+	visit = func(e sqlExpr) {
+		be, ok := e.(*exprBinary)
+		if !ok {
+			return
+		}
+		if be.op == "AND" {
+			visit(be.l)
+			visit(be.r)
+			return
+		}
+		if be.op != "=" && be.op != "==" {
+			return
+		}
+		lMin, lMax, lok := exprSources(be.l)
+		rMin, rMax, rok := exprSources(be.r)
+		if !lok || !rok {
+			return
+		}
+		switch {
+		case lMax < s && rMin == s && rMax == s:
+			lExprs = append(lExprs, be.l)
+			rExprs = append(rExprs, be.r)
+		case rMax < s && lMin == s && lMax == s:
+			lExprs = append(lExprs, be.r)
+			rExprs = append(rExprs, be.l)
+		}
+	}
+	visit(on)
+
+	return lExprs, rExprs
+}
+
+// exprSources returns the lowest and highest source index read by
+// e; ok is false if e reads no column or calls an aggregate.
+func exprSources(e sqlExpr) (min int, max int, ok bool) {
+	min, max, ok = -1, -1, true
+	walkExpr(e, func(x sqlExpr) error {
+		switch c := x.(type) {
+		case *exprColumn:
+			if min < 0 || c.src < min {
+				min = c.src
+			}
+			if c.src > max {
+				max = c.src
+			}
+		case *exprFunc:
+			if isAggregateName(c.name) {
+				ok = false
+			}
+		}
+		return nil
+	})
+	return min, max, ok && max >= 0
+}
+
+// exprHashIndex maps the key of exprs (evaluated for each row of
+// source s) to the indexes of the rows; NULL keys are left out.
+func exprHashIndex(rows []Row, exprs []sqlExpr, s int, n int, args []interface{}) (map[string][]int, error) {
+	index := make(map[string][]int, len(rows))
+	t := make([]Row, n)
+	for j := 0; j < len(rows); j++ {
+		t[s] = rows[j]
+		k, ok, err := exprKey(exprs, &evalContext{rows: t, args: args})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			index[k] = append(index[k], j)
+		}
+	}
+	return index, nil
+}
+
+// exprKey evaluates exprs into a join key; the second return value
+// is false if any value is NULL.
+func exprKey(exprs []sqlExpr, ctx *evalContext) (string, bool, error) {
+	vals := make([]interface{}, len(exprs))
+	for i := 0; i < len(exprs); i++ {
+		v, err := exprs[i].eval(ctx)
+		if err != nil {
+			return "", false, err
+		}
+		if isNull(v) {
+			return "", false, nil
+		}
+		vals[i] = v
+	}
+	return joinKey(vals), true, nil
+}
+
+// groupTuples puts the rows into GROUP BY buckets (in order of first
+// appearance) and feeds the aggregates. Without GROUP BY all rows
+// form one group, even when there are none.
+func groupTuples(tuples [][]Row, groupBy []sqlExpr, aggs []*exprFunc, nSources int, args []interface{}) ([]*sqlGroup, error) {
+	var groups []*sqlGroup
+	index := make(map[string]*sqlGroup)
+
+	newGroup := func(rows []Row) (*sqlGroup, error) {
+		g := &sqlGroup{rows: rows}
+		for i := 0; i < len(aggs); i++ {
+			var st aggState
+			if aggs[i].star {
+				st = &aggCountStar{}
+			} else {
+				var err error
+				if st, err = newAggState(aggs[i].name, aggs[i].distinct); err != nil {
+					return nil, err
+				}
+			}
+			g.states = append(g.states, st)
+		}
+		groups = append(groups, g)
+		return g, nil
+	}
+
+	for i := 0; i < len(tuples); i++ {
+		ctx := &evalContext{rows: tuples[i], args: args}
+
+		keyVals := make([]interface{}, len(groupBy))
+		for j := 0; j < len(groupBy); j++ {
+			v, err := groupBy[j].eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			keyVals[j] = v
+		}
+		key := valuesKey(keyVals)
+
+		g := index[key]
+		if g == nil {
+			var err error
+			if g, err = newGroup(tuples[i]); err != nil {
+				return nil, err
+			}
+			index[key] = g
+		}
+
+		for j := 0; j < len(aggs); j++ {
+			var v interface{}
+			if !aggs[j].star {
+				var err error
+				if v, err = aggs[j].args[0].eval(ctx); err != nil {
+					return nil, err
+				}
+			}
+			if err := g.states[j].add(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(groups) == 0 && len(groupBy) == 0 {
+		if _, err := newGroup(make([]Row, nSources)); err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+func applyLimit(rows [][]interface{}, stmt *selectStmt, args []interface{}) ([][]interface{}, error) {
+	ctx := &evalContext{args: args}
+
+	if stmt.offset != nil {
+		v, err := stmt.offset.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := toInt64(v)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("sql: OFFSET must be a non-negative integer")
+		}
+		if int(n) >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[n:]
+	}
+
+	if stmt.limit != nil {
+		v, err := stmt.limit.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := toInt64(v)
+		if !ok {
+			return nil, fmt.Errorf("sql: LIMIT must be an integer")
+		}
+		if n >= 0 && int(n) < len(rows) {
+			rows = rows[:n]
+		}
+	}
+
+	return rows, nil
+}
+
+// buildResultTable creates the result table of a query.
+func buildResultTable(outCols []outColumn, outRows [][]interface{}) (*Table, error) {
+	tbl, err := (&Table{}).Create("query")
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]Column, len(outCols))
+	for j := 0; j < len(outCols); j++ {
+		cols[j] = Column{Name: outCols[j].name, Type: outCols[j].typ}
+		if cols[j].Type != "" {
+			continue
+		}
+		for i := 0; i < len(outRows); i++ {
+			if !isNull(outRows[i][j]) {
+				cols[j].Type = colTypeOf(outRows[i][j])
+				break
+			}
+		}
+		if cols[j].Type == "" {
+			cols[j].Type = ColTypeString
+		}
+	}
+
+	return fillTable(tbl, cols, outRows), nil
+}
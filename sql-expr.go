@@ -0,0 +1,600 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// sqlExpr is a node of a parsed expression.
+type sqlExpr interface {
+	eval(ctx *evalContext) (interface{}, error)
+	position() int
+}
+
+// evalContext holds what an expression is evaluated against: one
+// row per source table (nil for the missing side of an outer join),
+// the placeholder arguments, and the aggregate results of the
+// current group.
+type evalContext struct {
+	rows []Row
+	args []interface{}
+	aggs []interface{}
+}
+
+type exprLiteral struct {
+	val interface{}
+	pos int
+}
+
+type exprParam struct {
+	index int // 0-based
+	pos   int
+}
+
+// exprColumn references a column; src and col are set when
+// the expression is bound to its sources.
+type exprColumn struct {
+	qual string
+	name string
+	pos  int
+	src  int
+	col  string
+}
+
+type exprUnary struct {
+	op  string
+	x   sqlExpr
+	pos int
+}
+
+type exprBinary struct {
+	op   string
+	l, r sqlExpr
+	pos  int
+}
+
+type exprIsNull struct {
+	x   sqlExpr
+	not bool
+	pos int
+}
+
+type exprIn struct {
+	x    sqlExpr
+	list []sqlExpr
+	not  bool
+	pos  int
+}
+
+type exprBetween struct {
+	x, lo, hi sqlExpr
+	not       bool
+	pos       int
+}
+
+type exprLike struct {
+	x, pattern sqlExpr
+	not        bool
+	pos        int
+}
+
+type exprCase struct {
+	operand sqlExpr
+	whens   []sqlExpr
+	thens   []sqlExpr
+	els     sqlExpr
+	pos     int
+}
+
+type exprCast struct {
+	x   sqlExpr
+	typ string
+	pos int
+}
+
+// exprFunc is a scalar or aggregate function call. For aggregates
+// agg is the index of the result in evalContext.aggs.
+type exprFunc struct {
+	name     string
+	args     []sqlExpr
+	star     bool
+	distinct bool
+	agg      int
+	pos      int
+}
+
+func (e *exprLiteral) position() int { return e.pos }
+func (e *exprParam) position() int   { return e.pos }
+func (e *exprColumn) position() int  { return e.pos }
+func (e *exprUnary) position() int   { return e.pos }
+func (e *exprBinary) position() int  { return e.pos }
+func (e *exprIsNull) position() int  { return e.pos }
+func (e *exprIn) position() int      { return e.pos }
+func (e *exprBetween) position() int { return e.pos }
+func (e *exprLike) position() int    { return e.pos }
+func (e *exprCase) position() int    { return e.pos }
+func (e *exprCast) position() int    { return e.pos }
+func (e *exprFunc) position() int    { return e.pos }
+
+func (e *exprLiteral) eval(ctx *evalContext) (interface{}, error) {
+	return e.val, nil
+}
+
+func (e *exprParam) eval(ctx *evalContext) (interface{}, error) {
+	if e.index >= len(ctx.args) {
+		return nil, fmt.Errorf("missing argument for placeholder %d", e.index+1)
+	}
+	return ctx.args[e.index], nil
+}
+
+func (e *exprColumn) eval(ctx *evalContext) (interface{}, error) {
+	if e.src >= len(ctx.rows) {
+		return nil, fmt.Errorf("column %s is not available here", e.name)
+	}
+	r := ctx.rows[e.src]
+	if r == nil {
+		return nil, nil
+	}
+	return r[e.col], nil
+}
+
+func (e *exprUnary) eval(ctx *evalContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil || isNull(v) {
+		return nil, err
+	}
+
+	switch e.op {
+	case "NOT":
+		b, ok := toBool(v)
+		if !ok {
+			return nil, nil
+		}
+		return !b, nil
+	case "-":
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %q", toString(v))
+		}
+		if i, ok := n.(int64); ok {
+			return -i, nil
+		}
+		return -n.(float64), nil
+	case "+":
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a number", toString(v))
+		}
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", e.op)
+}
+
+func (e *exprBinary) eval(ctx *evalContext) (interface{}, error) {
+	switch e.op {
+	case "AND", "OR":
+		return e.evalLogical(ctx)
+	}
+
+	l, err := e.l.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.r.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(l) || isNull(r) {
+		return nil, nil
+	}
+
+	switch e.op {
+	case "=", "==":
+		return compareValues(l, r) == 0, nil
+	case "<>", "!=":
+		return compareValues(l, r) != 0, nil
+	case "<":
+		return compareValues(l, r) < 0, nil
+	case "<=":
+		return compareValues(l, r) <= 0, nil
+	case ">":
+		return compareValues(l, r) > 0, nil
+	case ">=":
+		return compareValues(l, r) >= 0, nil
+	case "||":
+		return toString(l) + toString(r), nil
+	}
+
+	return arithmetic(e.op, l, r)
+}
+
+// evalLogical implements three-valued AND/OR.
+func (e *exprBinary) evalLogical(ctx *evalContext) (interface{}, error) {
+	l, err := e.l.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lb, lok := toBool(l)
+
+	// short-circuit
+	if lok && e.op == "AND" && !lb {
+		return false, nil
+	}
+	if lok && e.op == "OR" && lb {
+		return true, nil
+	}
+
+	r, err := e.r.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rb, rok := toBool(r)
+
+	if e.op == "AND" {
+		if rok && !rb {
+			return false, nil
+		}
+		if !lok || !rok {
+			return nil, nil
+		}
+		return true, nil
+	}
+
+	if rok && rb {
+		return true, nil
+	}
+	if !lok || !rok {
+		return nil, nil
+	}
+	return false, nil
+}
+
+// arithmetic applies + - * / % to two non-NULL values. Integers
+// stay integers; division by zero yields NULL.
+func arithmetic(op string, l, r interface{}) (interface{}, error) {
+	ln, lok := toNumber(l)
+	rn, rok := toNumber(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %q and %q", op, toString(l), toString(r))
+	}
+
+	li, lInt := ln.(int64)
+	ri, rInt := rn.(int64)
+	if lInt && rInt {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/":
+			if ri == 0 {
+				return nil, nil
+			}
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, nil
+			}
+			return li % ri, nil
+		}
+	}
+
+	lf, _ := toFloat64(ln)
+	rf, _ := toFloat64(rn)
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, nil
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, nil
+		}
+		return math.Mod(lf, rf), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func (e *exprIsNull) eval(ctx *evalContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return isNull(v) != e.not, nil
+}
+
+func (e *exprIn) eval(ctx *evalContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil || isNull(v) {
+		return nil, err
+	}
+
+	sawNull := false
+	for i := 0; i < len(e.list); i++ {
+		item, err := e.list[i].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if isNull(item) {
+			sawNull = true
+			continue
+		}
+		if compareValues(v, item) == 0 {
+			return !e.not, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+
+	return e.not, nil
+}
+
+func (e *exprBetween) eval(ctx *evalContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lo, err := e.lo.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := e.hi.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(v) || isNull(lo) || isNull(hi) {
+		return nil, nil
+	}
+
+	in := compareValues(v, lo) >= 0 && compareValues(v, hi) <= 0
+
+	return in != e.not, nil
+}
+
+func (e *exprLike) eval(ctx *evalContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := e.pattern.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(v) || isNull(p) {
+		return nil, nil
+	}
+
+	return likeMatch(toString(v), toString(p)) != e.not, nil
+}
+
+// likeMatch matches s against a LIKE pattern; % matches any
+// sequence of characters and _ exactly one.
+func likeMatch(s, pattern string) bool {
+	for len(pattern) > 0 {
+		pr, pw := utf8.DecodeRuneInString(pattern)
+		switch pr {
+		case '%':
+			for len(pattern) > 0 && pattern[0] == '%' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); {
+				if likeMatch(s[i:], pattern) {
+					return true
+				}
+				if i == len(s) {
+					break
+				}
+				_, w := utf8.DecodeRuneInString(s[i:])
+				i += w
+			}
+			return false
+		case '_':
+			if s == "" {
+				return false
+			}
+			_, sw := utf8.DecodeRuneInString(s)
+			s = s[sw:]
+			pattern = pattern[pw:]
+		default:
+			sr, sw := utf8.DecodeRuneInString(s)
+			if s == "" || sr != pr {
+				return false
+			}
+			s = s[sw:]
+			pattern = pattern[pw:]
+		}
+	}
+	return s == ""
+}
+
+func (e *exprCase) eval(ctx *evalContext) (interface{}, error) {
+	var operand interface{}
+	var err error
+
+	if e.operand != nil {
+		if operand, err = e.operand.eval(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < len(e.whens); i++ {
+		w, err := e.whens[i].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := false
+		if e.operand != nil {
+			matched = !isNull(operand) && !isNull(w) && compareValues(operand, w) == 0
+		} else {
+			b, ok := toBool(w)
+			matched = ok && b
+		}
+		if matched {
+			return e.thens[i].eval(ctx)
+		}
+	}
+
+	if e.els != nil {
+		return e.els.eval(ctx)
+	}
+
+	return nil, nil
+}
+
+func (e *exprCast) eval(ctx *evalContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// CAST truncates fractions to integers
+	if normalizeColType(e.typ) == ColTypeInteger && !isIntegerKind(v) {
+		if f, ok := toFloat64(v); ok {
+			if i, ok := floatToInt64(math.Trunc(f)); ok {
+				return i, nil
+			}
+		}
+	}
+	return castValue(v, e.typ)
+}
+
+// castValue converts v to one of the ColType... types (any name
+// understood by normalizeColType is accepted). A number with a
+// fraction, or out of range, is not an Integer.
+func castValue(v interface{}, typ string) (interface{}, error) {
+	if isNull(v) {
+		return nil, nil
+	}
+
+	switch normalizeColType(typ) {
+	case ColTypeString:
+		return toString(v), nil
+	case ColTypeInteger:
+		if i, ok := toInt64(v); ok {
+			return i, nil
+		}
+		if f, ok := toFloat64(v); ok {
+			if i, ok := floatToInt64(f); ok {
+				return i, nil
+			}
+			break
+		}
+		if b, ok := v.(bool); ok {
+			if b {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case ColTypeFloat:
+		if f, ok := toFloat64(v); ok {
+			return f, nil
+		}
+	case ColTypeBool:
+		if b, ok := toBool(v); ok {
+			return b, nil
+		}
+	case ColTypeDateTime:
+		if t, ok := toTime(v); ok {
+			return t, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %s", typ)
+	}
+
+	return nil, fmt.Errorf("cannot convert %q to %s", toString(v), normalizeColType(typ))
+}
+
+func (e *exprFunc) eval(ctx *evalContext) (interface{}, error) {
+	if e.agg >= 0 {
+		if e.agg >= len(ctx.aggs) {
+			return nil, fmt.Errorf("aggregate function %s is not allowed here", strings.ToUpper(e.name))
+		}
+		return ctx.aggs[e.agg], nil
+	}
+
+	f, ok := sqlFunctions[strings.ToLower(e.name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", e.name)
+	}
+
+	args := make([]interface{}, len(e.args))
+	for i := 0; i < len(e.args); i++ {
+		v, err := e.args[i].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	v, err := f.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", strings.ToLower(e.name), err)
+	}
+
+	return v, nil
+}
+
+// walkExpr calls fn for e and each of its sub-expressions; it
+// stops at the first error.
+func walkExpr(e sqlExpr, fn func(sqlExpr) error) error {
+	if e == nil {
+		return nil
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+
+	var kids []sqlExpr
+
+	switch x := e.(type) {
+	case *exprUnary:
+		kids = []sqlExpr{x.x}
+	case *exprBinary:
+		kids = []sqlExpr{x.l, x.r}
+	case *exprIsNull:
+		kids = []sqlExpr{x.x}
+	case *exprIn:
+		kids = append([]sqlExpr{x.x}, x.list...)
+	case *exprBetween:
+		kids = []sqlExpr{x.x, x.lo, x.hi}
+	case *exprLike:
+		kids = []sqlExpr{x.x, x.pattern}
+	case *exprCase:
+		kids = append(kids, x.operand)
+		for i := 0; i < len(x.whens); i++ {
+			kids = append(kids, x.whens[i], x.thens[i])
+		}
+		kids = append(kids, x.els)
+	case *exprCast:
+		kids = []sqlExpr{x.x}
+	case *exprFunc:
+		kids = x.args
+	}
+
+	for i := 0; i < len(kids); i++ {
+		if err := walkExpr(kids[i], fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
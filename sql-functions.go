@@ -0,0 +1,265 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sqlFunc describes a scalar function; maxArgs < 0 means the
+// function takes any number of arguments (at least minArgs).
+type sqlFunc struct {
+	minArgs int
+	maxArgs int
+	fn      func(args []interface{}) (interface{}, error)
+}
+
+// sqlFunctions holds the scalar functions, keyed by lower-case name.
+var sqlFunctions = map[string]sqlFunc{
+	"upper":     {1, 1, nullSafe(func(a []interface{}) (interface{}, error) { return strings.ToUpper(toString(a[0])), nil })},
+	"lower":     {1, 1, nullSafe(func(a []interface{}) (interface{}, error) { return strings.ToLower(toString(a[0])), nil })},
+	"trim":      {1, 1, nullSafe(func(a []interface{}) (interface{}, error) { return strings.TrimSpace(toString(a[0])), nil })},
+	"ltrim":     {1, 1, nullSafe(func(a []interface{}) (interface{}, error) { return strings.TrimLeft(toString(a[0]), " \t\r\n"), nil })},
+	"rtrim":     {1, 1, nullSafe(func(a []interface{}) (interface{}, error) { return strings.TrimRight(toString(a[0]), " \t\r\n"), nil })},
+	"length":    {1, 1, nullSafe(sqlLength)},
+	"len":       {1, 1, nullSafe(sqlLength)},
+	"substr":    {2, 3, nullSafe(sqlSubstr)},
+	"substring": {2, 3, nullSafe(sqlSubstr)},
+	"replace":   {3, 3, nullSafe(sqlReplace)},
+	"concat":    {1, -1, sqlConcat},
+	"coalesce":  {1, -1, sqlCoalesce},
+	"ifnull":    {2, 2, sqlCoalesce},
+	"nullif":    {2, 2, sqlNullIf},
+	"abs":       {1, 1, nullSafe(sqlAbs)},
+	"round":     {1, 2, nullSafe(sqlRound)},
+	"floor":     {1, 1, nullSafe(mathFunc(math.Floor))},
+	"ceil":      {1, 1, nullSafe(mathFunc(math.Ceil))},
+	"ceiling":   {1, 1, nullSafe(mathFunc(math.Ceil))},
+	"sqrt":      {1, 1, nullSafe(mathFunc(math.Sqrt))},
+	"if":        {3, 3, sqlIf},
+	"iif":       {3, 3, sqlIf},
+	"now":       {0, 0, func(a []interface{}) (interface{}, error) { return time.Now(), nil }},
+	"date":      {1, 1, nullSafe(sqlDate)},
+	"year":      {1, 1, nullSafe(datePart(func(t time.Time) int { return t.Year() }))},
+	"month":     {1, 1, nullSafe(datePart(func(t time.Time) int { return int(t.Month()) }))},
+	"day":       {1, 1, nullSafe(datePart(func(t time.Time) int { return t.Day() }))},
+	"hour":      {1, 1, nullSafe(datePart(func(t time.Time) int { return t.Hour() }))},
+	"minute":    {1, 1, nullSafe(datePart(func(t time.Time) int { return t.Minute() }))},
+	"second":    {1, 1, nullSafe(datePart(func(t time.Time) int { return t.Second() }))},
+	"weekday":   {1, 1, nullSafe(datePart(func(t time.Time) int { return int(t.Weekday()) }))},
+	"date_add":  {3, 3, nullSafe(sqlDateAdd)},
+	"date_diff": {3, 3, nullSafe(sqlDateDiff)},
+}
+
+// nullSafe wraps fn so that it returns NULL if any argument is NULL.
+func nullSafe(fn func(args []interface{}) (interface{}, error)) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		for i := 0; i < len(args); i++ {
+			if isNull(args[i]) {
+				return nil, nil
+			}
+		}
+		return fn(args)
+	}
+}
+
+func sqlLength(a []interface{}) (interface{}, error) {
+	return int64(utf8.RuneCountInString(toString(a[0]))), nil
+}
+
+// sqlSubstr returns a substring; start is 1-based.
+func sqlSubstr(a []interface{}) (interface{}, error) {
+	r := []rune(toString(a[0]))
+
+	start, ok := toInt64(a[1])
+	if !ok {
+		return nil, errors.New("start must be an integer")
+	}
+	if start < 1 {
+		start = 1
+	}
+	from := int(start - 1)
+	if from > len(r) {
+		return "", nil
+	}
+
+	to := len(r)
+	if len(a) > 2 {
+		n, ok := toInt64(a[2])
+		if !ok {
+			return nil, errors.New("length must be an integer")
+		}
+		if n < 0 {
+			n = 0
+		}
+		if from+int(n) < to {
+			to = from + int(n)
+		}
+	}
+
+	return string(r[from:to]), nil
+}
+
+func sqlReplace(a []interface{}) (interface{}, error) {
+	return strings.ReplaceAll(toString(a[0]), toString(a[1]), toString(a[2])), nil
+}
+
+// sqlConcat joins its arguments; NULLs are skipped.
+func sqlConcat(a []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for i := 0; i < len(a); i++ {
+		sb.WriteString(toString(a[i]))
+	}
+	return sb.String(), nil
+}
+
+func sqlCoalesce(a []interface{}) (interface{}, error) {
+	for i := 0; i < len(a); i++ {
+		if !isNull(a[i]) {
+			return a[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func sqlNullIf(a []interface{}) (interface{}, error) {
+	if !isNull(a[0]) && !isNull(a[1]) && compareValues(a[0], a[1]) == 0 {
+		return nil, nil
+	}
+	return a[0], nil
+}
+
+func sqlAbs(a []interface{}) (interface{}, error) {
+	n, ok := toNumber(a[0])
+	if !ok {
+		return nil, errors.New("argument is not a number")
+	}
+	if i, ok := n.(int64); ok {
+		if i < 0 {
+			return -i, nil
+		}
+		return i, nil
+	}
+	return math.Abs(n.(float64)), nil
+}
+
+func sqlRound(a []interface{}) (interface{}, error) {
+	f, ok := toFloat64(a[0])
+	if !ok {
+		return nil, errors.New("argument is not a number")
+	}
+	var places int64
+	if len(a) > 1 {
+		if places, ok = toInt64(a[1]); !ok {
+			return nil, errors.New("decimal places must be an integer")
+		}
+	}
+	p := math.Pow(10, float64(places))
+
+	return math.Round(f*p) / p, nil
+}
+
+func mathFunc(fn func(float64) float64) func(a []interface{}) (interface{}, error) {
+	return func(a []interface{}) (interface{}, error) {
+		f, ok := toFloat64(a[0])
+		if !ok {
+			return nil, errors.New("argument is not a number")
+		}
+		return fn(f), nil
+	}
+}
+
+// sqlIf returns its second argument when the first is true, and
+// the third otherwise (also when the condition is NULL).
+func sqlIf(a []interface{}) (interface{}, error) {
+	if b, ok := toBool(a[0]); ok && b {
+		return a[1], nil
+	}
+	return a[2], nil
+}
+
+func sqlDate(a []interface{}) (interface{}, error) {
+	t, ok := toTime(a[0])
+	if !ok {
+		return nil, errors.New("argument is not a date")
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+}
+
+// datePart returns a function that extracts a part of a date.
+func datePart(fn func(time.Time) int) func(a []interface{}) (interface{}, error) {
+	return func(a []interface{}) (interface{}, error) {
+		t, ok := toTime(a[0])
+		if !ok {
+			return nil, errors.New("argument is not a date")
+		}
+		return int64(fn(t)), nil
+	}
+}
+
+// sqlDateAdd adds n units (year, month, day, hour, minute or
+// second) to a date: date_add(d, n, 'day').
+func sqlDateAdd(a []interface{}) (interface{}, error) {
+	t, ok := toTime(a[0])
+	if !ok {
+		return nil, errors.New("argument is not a date")
+	}
+	n, ok := toInt64(a[1])
+	if !ok {
+		return nil, errors.New("the number of units must be an integer")
+	}
+
+	switch dateUnit(a[2]) {
+	case "year":
+		return t.AddDate(int(n), 0, 0), nil
+	case "month":
+		return t.AddDate(0, int(n), 0), nil
+	case "day":
+		return t.AddDate(0, 0, int(n)), nil
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case "minute":
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case "second":
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+	return nil, errors.New("unknown unit: " + toString(a[2]))
+}
+
+// sqlDateDiff returns the number of units from start to end:
+// date_diff('day', start, end). Years, months and days count the
+// calendar boundaries crossed; hours, minutes and seconds count
+// whole units.
+func sqlDateDiff(a []interface{}) (interface{}, error) {
+	start, ok1 := toTime(a[1])
+	end, ok2 := toTime(a[2])
+	if !ok1 || !ok2 {
+		return nil, errors.New("argument is not a date")
+	}
+
+	switch dateUnit(a[0]) {
+	case "year":
+		return int64(end.Year() - start.Year()), nil
+	case "month":
+		return int64((end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())), nil
+	case "day":
+		s := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		e := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+		return int64(e.Sub(s).Hours() / 24), nil
+	case "hour":
+		return int64(end.Sub(start) / time.Hour), nil
+	case "minute":
+		return int64(end.Sub(start) / time.Minute), nil
+	case "second":
+		return int64(end.Sub(start) / time.Second), nil
+	}
+	return nil, errors.New("unknown unit: " + toString(a[0]))
+}
+
+// dateUnit returns the singular, lower-case name of a unit.
+func dateUnit(v interface{}) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(toString(v))), "s")
+}
@@ -0,0 +1,218 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type sqlTokenKind int
+
+const (
+	tkEOF sqlTokenKind = iota
+	tkIdent
+	tkQuotedIdent
+	tkString
+	tkNumber
+	tkParam
+	tkOp
+)
+
+// sqlToken is one lexical unit of a SQL statement; pos and end are
+// the byte offsets of the token in the statement text.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+	end  int
+}
+
+// SQLError is returned for a statement that cannot be parsed or
+// bound to the tables of a Dataset. Line and Column are 1-based
+// and point to the offending token.
+type SQLError struct {
+	Msg    string
+	Pos    int
+	Line   int
+	Column int
+	Near   string
+}
+
+func (e *SQLError) Error() string {
+	if e.Near == "" {
+		return fmt.Sprintf("sql: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+	}
+	return fmt.Sprintf("sql: %s at line %d, column %d near %q", e.Msg, e.Line, e.Column, e.Near)
+}
+
+// newSQLError creates a SQLError for the byte offset pos of src.
+func newSQLError(src string, pos int, near string, format string, a ...interface{}) *SQLError {
+	if pos > len(src) {
+		pos = len(src)
+	}
+	line := 1 + strings.Count(src[:pos], "\n")
+	lineStart := strings.LastIndex(src[:pos], "\n") + 1
+	col := 1 + utf8.RuneCountInString(src[lineStart:pos])
+
+	return &SQLError{
+		Msg:    fmt.Sprintf(format, a...),
+		Pos:    pos,
+		Line:   line,
+		Column: col,
+		Near:   near,
+	}
+}
+
+// tokenizeSQL splits a statement into tokens. Strings are single
+// quoted (a quote inside a string is doubled); identifiers may be
+// quoted with double quotes, backticks or brackets.
+func tokenizeSQL(src string) ([]sqlToken, error) {
+	var toks []sqlToken
+	i := 0
+
+	for i < len(src) {
+		r, w := utf8.DecodeRuneInString(src[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += w
+
+		case r == '-' && strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, newSQLError(src, i, "", "unterminated comment")
+			}
+			i += end + 4
+
+		case r == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(src) {
+				if src[i] == '\'' {
+					if i+1 < len(src) && src[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if !closed {
+				return nil, newSQLError(src, start, "", "unterminated string")
+			}
+			toks = append(toks, sqlToken{tkString, sb.String(), start, i})
+
+		case r == '"' || r == '`' || r == '[':
+			start := i
+			closer := byte(r)
+			if r == '[' {
+				closer = ']'
+			}
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(src) {
+				if src[i] == closer {
+					if closer != ']' && i+1 < len(src) && src[i+1] == closer {
+						sb.WriteByte(closer)
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if !closed {
+				return nil, newSQLError(src, start, "", "unterminated quoted identifier")
+			}
+			toks = append(toks, sqlToken{tkQuotedIdent, sb.String(), start, i})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && isASCIIDigit(src[i+1])):
+			start := i
+			for i < len(src) && isASCIIDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				i++
+				for i < len(src) && isASCIIDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isASCIIDigit(src[j]) {
+					i = j
+					for i < len(src) && isASCIIDigit(src[i]) {
+						i++
+					}
+				}
+			}
+			toks = append(toks, sqlToken{tkNumber, src[start:i], start, i})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(src) {
+				r, w := utf8.DecodeRuneInString(src[i:])
+				if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$') {
+					break
+				}
+				i += w
+			}
+			toks = append(toks, sqlToken{tkIdent, src[start:i], start, i})
+
+		case r == '?':
+			toks = append(toks, sqlToken{tkParam, "?", i, i + 1})
+			i++
+
+		case r == '$' && i+1 < len(src) && isASCIIDigit(src[i+1]):
+			start := i
+			i++
+			for i < len(src) && isASCIIDigit(src[i]) {
+				i++
+			}
+			toks = append(toks, sqlToken{tkParam, src[start:i], start, i})
+
+		default:
+			op := ""
+			for _, o := range []string{"<>", "!=", "<=", ">=", "||", "==", "=", "<", ">",
+				"+", "-", "*", "/", "%", "(", ")", ",", ".", ";"} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, newSQLError(src, i, string(r), "unexpected character")
+			}
+			toks = append(toks, sqlToken{tkOp, op, i, i + len(op)})
+			i += len(op)
+		}
+	}
+
+	toks = append(toks, sqlToken{tkEOF, "", len(src), len(src)})
+
+	return toks, nil
+}
+
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
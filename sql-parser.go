@@ -0,0 +1,1113 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"strconv"
+	"strings"
+)
+
+type joinKind int
+
+const (
+	joinNone joinKind = iota
+	joinInner
+	joinLeft
+	joinRight
+	joinFull
+	joinCross
+)
+
+// sqlSource is a table in the FROM clause; all but the first are
+// joined to the ones before them.
+type sqlSource struct {
+	name  string
+	alias string
+	pos   int
+	join  joinKind
+	on    sqlExpr
+}
+
+// selectItem is one entry of the select list; star is set for
+// * and qual.*.
+type selectItem struct {
+	expr  sqlExpr
+	alias string
+	star  bool
+	qual  string
+	text  string
+	pos   int
+}
+
+type orderItem struct {
+	expr sqlExpr
+	desc bool
+}
+
+// selectStmt is a parsed SELECT statement.
+type selectStmt struct {
+	distinct bool
+	items    []selectItem
+	sources  []sqlSource
+	where    sqlExpr
+	groupBy  []sqlExpr
+	having   sqlExpr
+	orderBy  []orderItem
+	limit    sqlExpr
+	offset   sqlExpr
+	nParams  int
+}
+
+// insertStmt is a parsed INSERT statement; the rows come from
+// VALUES lists or from a SELECT.
+type insertStmt struct {
+	table   string
+	pos     int
+	cols    []string
+	colPos  []int
+	values  [][]sqlExpr
+	query   *selectStmt
+	nParams int
+}
+
+// setItem is one col = expr of an UPDATE.
+type setItem struct {
+	col  string
+	pos  int
+	expr sqlExpr
+}
+
+// updateStmt is a parsed UPDATE statement.
+type updateStmt struct {
+	table   string
+	pos     int
+	sets    []setItem
+	where   sqlExpr
+	nParams int
+}
+
+// deleteStmt is a parsed DELETE statement.
+type deleteStmt struct {
+	table   string
+	pos     int
+	where   sqlExpr
+	nParams int
+}
+
+// sqlReserved are the keywords that end an expression, so they
+// cannot be used as a bare alias.
+var sqlReserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"HAVING": true, "ORDER": true, "LIMIT": true, "OFFSET": true, "JOIN": true,
+	"INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true,
+	"CROSS": true, "ON": true, "AS": true, "AND": true, "OR": true, "NOT": true,
+	"ASC": true, "DESC": true, "CASE": true, "WHEN": true, "THEN": true,
+	"ELSE": true, "END": true, "IS": true, "NULL": true, "IN": true,
+	"BETWEEN": true, "LIKE": true, "DISTINCT": true, "UNION": true,
+	"INSERT": true, "INTO": true, "VALUES": true, "UPDATE": true, "SET": true,
+	"DELETE": true,
+}
+
+type sqlParser struct {
+	src      string
+	toks     []sqlToken
+	p        int
+	nextArg  int
+	maxParam int
+}
+
+// parseSQL parses a single SELECT statement.
+func parseSQL(src string) (*selectStmt, error) {
+	stmt, err := parseStatement(src)
+	if err != nil {
+		return nil, err
+	}
+
+	sel, ok := stmt.(*selectStmt)
+	if !ok {
+		toks, _ := tokenizeSQL(src)
+		kw := strings.ToUpper(toks[0].text) // INSERT, UPDATE or DELETE
+		return nil, newSQLError(src, toks[0].pos, kw, "%s is not a query; use Exec", kw)
+	}
+
+	return sel, nil
+}
+
+// parseStatement parses a single SELECT, INSERT, UPDATE or DELETE
+// statement; the result is a *selectStmt, *insertStmt, *updateStmt
+// or *deleteStmt.
+func parseStatement(src string) (interface{}, error) {
+	toks, err := tokenizeSQL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &sqlParser{src: src, toks: toks}
+
+	var stmt interface{}
+	switch {
+	case ps.isKeyword("INSERT"):
+		stmt, err = ps.parseInsert()
+	case ps.isKeyword("UPDATE"):
+		stmt, err = ps.parseUpdate()
+	case ps.isKeyword("DELETE"):
+		stmt, err = ps.parseDelete()
+	default:
+		stmt, err = ps.parseSelect()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ps.isOp(";") {
+		ps.p++
+	}
+	if ps.peek().kind != tkEOF {
+		return nil, ps.errorf("syntax error")
+	}
+
+	switch x := stmt.(type) {
+	case *selectStmt:
+		x.nParams = ps.maxParam
+	case *insertStmt:
+		x.nParams = ps.maxParam
+	case *updateStmt:
+		x.nParams = ps.maxParam
+	case *deleteStmt:
+		x.nParams = ps.maxParam
+	}
+
+	return stmt, nil
+}
+
+// parseSQLExpr parses a single expression that is not part of a
+// statement (the expression of a computed column).
+func parseSQLExpr(src string) (sqlExpr, error) {
+	toks, err := tokenizeSQL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &sqlParser{src: src, toks: toks}
+
+	e, err := ps.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if ps.peek().kind != tkEOF {
+		return nil, ps.errorf("syntax error")
+	}
+
+	err = walkExpr(e, func(x sqlExpr) error {
+		if p, ok := x.(*exprParam); ok {
+			return newSQLError(src, p.pos, "", "placeholders are not allowed here")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (ps *sqlParser) peek() sqlToken {
+	return ps.toks[ps.p]
+}
+
+func (ps *sqlParser) next() sqlToken {
+	t := ps.toks[ps.p]
+	if t.kind != tkEOF {
+		ps.p++
+	}
+	return t
+}
+
+// prevEnd is the end offset of the last consumed token.
+func (ps *sqlParser) prevEnd() int {
+	if ps.p == 0 {
+		return 0
+	}
+	return ps.toks[ps.p-1].end
+}
+
+func (ps *sqlParser) isKeyword(kw string) bool {
+	t := ps.peek()
+	return t.kind == tkIdent && strings.EqualFold(t.text, kw)
+}
+
+func (ps *sqlParser) acceptKeyword(kw string) bool {
+	if ps.isKeyword(kw) {
+		ps.p++
+		return true
+	}
+	return false
+}
+
+func (ps *sqlParser) expectKeyword(kw string) error {
+	if !ps.acceptKeyword(kw) {
+		return ps.errorf("expected %s", kw)
+	}
+	return nil
+}
+
+func (ps *sqlParser) isOp(op string) bool {
+	t := ps.peek()
+	return t.kind == tkOp && t.text == op
+}
+
+func (ps *sqlParser) acceptOp(op string) bool {
+	if ps.isOp(op) {
+		ps.p++
+		return true
+	}
+	return false
+}
+
+func (ps *sqlParser) expectOp(op string) error {
+	if !ps.acceptOp(op) {
+		return ps.errorf("expected %q", op)
+	}
+	return nil
+}
+
+// errorf reports an error at the current token.
+func (ps *sqlParser) errorf(format string, a ...interface{}) error {
+	t := ps.peek()
+	return newSQLError(ps.src, t.pos, ps.src[t.pos:t.end], format, a...)
+}
+
+// parseIdent reads a plain or quoted identifier.
+func (ps *sqlParser) parseIdent(what string) (string, int, error) {
+	t := ps.peek()
+	if t.kind == tkQuotedIdent || (t.kind == tkIdent && !sqlReserved[strings.ToUpper(t.text)]) {
+		ps.p++
+		return t.text, t.pos, nil
+	}
+	return "", t.pos, ps.errorf("expected %s", what)
+}
+
+func (ps *sqlParser) parseSelect() (*selectStmt, error) {
+	var err error
+	stmt := &selectStmt{}
+
+	if err = ps.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	if ps.acceptKeyword("DISTINCT") {
+		stmt.distinct = true
+	} else {
+		ps.acceptKeyword("ALL")
+	}
+
+	for {
+		item, err := ps.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.items = append(stmt.items, item)
+		if !ps.acceptOp(",") {
+			break
+		}
+	}
+
+	if ps.acceptKeyword("FROM") {
+		if stmt.sources, err = ps.parseFrom(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ps.acceptKeyword("WHERE") {
+		if stmt.where, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ps.acceptKeyword("GROUP") {
+		if err = ps.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := ps.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.groupBy = append(stmt.groupBy, e)
+			if !ps.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	if ps.acceptKeyword("HAVING") {
+		if stmt.having, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ps.acceptKeyword("ORDER") {
+		if err = ps.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := ps.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			oi := orderItem{expr: e}
+			if ps.acceptKeyword("DESC") {
+				oi.desc = true
+			} else {
+				ps.acceptKeyword("ASC")
+			}
+			stmt.orderBy = append(stmt.orderBy, oi)
+			if !ps.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	if ps.acceptKeyword("LIMIT") {
+		if stmt.limit, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+		if ps.acceptOp(",") {
+			// LIMIT offset, count
+			stmt.offset = stmt.limit
+			if stmt.limit, err = ps.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ps.acceptKeyword("OFFSET") {
+		if stmt.offset, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseInsert parses
+//
+//	INSERT INTO t [(col, ...)] VALUES (expr, ...), ... | SELECT ...
+func (ps *sqlParser) parseInsert() (*insertStmt, error) {
+	var err error
+	stmt := &insertStmt{}
+
+	if err = ps.expectKeyword("INSERT"); err != nil {
+		return nil, err
+	}
+	if err = ps.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	if stmt.table, stmt.pos, err = ps.parseIdent("table name"); err != nil {
+		return nil, err
+	}
+
+	if ps.acceptOp("(") {
+		for {
+			name, pos, err := ps.parseIdent("column name")
+			if err != nil {
+				return nil, err
+			}
+			stmt.cols = append(stmt.cols, name)
+			stmt.colPos = append(stmt.colPos, pos)
+			if !ps.acceptOp(",") {
+				break
+			}
+		}
+		if err = ps.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if ps.isKeyword("SELECT") {
+		if stmt.query, err = ps.parseSelect(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+
+	if err = ps.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err = ps.expectOp("("); err != nil {
+			return nil, err
+		}
+		var row []sqlExpr
+		for {
+			e, err := ps.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, e)
+			if !ps.acceptOp(",") {
+				break
+			}
+		}
+		if err = ps.expectOp(")"); err != nil {
+			return nil, err
+		}
+		stmt.values = append(stmt.values, row)
+		if !ps.acceptOp(",") {
+			break
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseUpdate parses
+//
+//	UPDATE t SET col = expr, ... [WHERE expr]
+func (ps *sqlParser) parseUpdate() (*updateStmt, error) {
+	var err error
+	stmt := &updateStmt{}
+
+	if err = ps.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	if stmt.table, stmt.pos, err = ps.parseIdent("table name"); err != nil {
+		return nil, err
+	}
+	if err = ps.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+
+	for {
+		var item setItem
+		if item.col, item.pos, err = ps.parseIdent("column name"); err != nil {
+			return nil, err
+		}
+		if err = ps.expectOp("="); err != nil {
+			return nil, err
+		}
+		if item.expr, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+		stmt.sets = append(stmt.sets, item)
+		if !ps.acceptOp(",") {
+			break
+		}
+	}
+
+	if ps.acceptKeyword("WHERE") {
+		if stmt.where, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseDelete parses
+//
+//	DELETE FROM t [WHERE expr]
+func (ps *sqlParser) parseDelete() (*deleteStmt, error) {
+	var err error
+	stmt := &deleteStmt{}
+
+	if err = ps.expectKeyword("DELETE"); err != nil {
+		return nil, err
+	}
+	if err = ps.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if stmt.table, stmt.pos, err = ps.parseIdent("table name"); err != nil {
+		return nil, err
+	}
+
+	if ps.acceptKeyword("WHERE") {
+		if stmt.where, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+func (ps *sqlParser) parseSelectItem() (selectItem, error) {
+	start := ps.peek()
+	item := selectItem{pos: start.pos}
+
+	if ps.acceptOp("*") {
+		item.star = true
+		return item, nil
+	}
+
+	// qual.*
+	if (start.kind == tkIdent || start.kind == tkQuotedIdent) &&
+		ps.toks[ps.p+1].kind == tkOp && ps.toks[ps.p+1].text == "." &&
+		ps.toks[ps.p+2].kind == tkOp && ps.toks[ps.p+2].text == "*" {
+		ps.p += 3
+		item.star = true
+		item.qual = start.text
+		return item, nil
+	}
+
+	e, err := ps.parseExpr()
+	if err != nil {
+		return item, err
+	}
+	item.expr = e
+	item.text = ps.src[start.pos:ps.prevEnd()]
+
+	if ps.acceptKeyword("AS") {
+		t := ps.peek()
+		if t.kind != tkIdent && t.kind != tkQuotedIdent && t.kind != tkString {
+			return item, ps.errorf("expected alias")
+		}
+		ps.p++
+		item.alias = t.text
+	} else if t := ps.peek(); t.kind == tkQuotedIdent || (t.kind == tkIdent && !sqlReserved[strings.ToUpper(t.text)]) {
+		ps.p++
+		item.alias = t.text
+	}
+
+	return item, nil
+}
+
+func (ps *sqlParser) parseTableRef(join joinKind) (sqlSource, error) {
+	var src sqlSource
+	var err error
+
+	src.join = join
+	if src.name, src.pos, err = ps.parseIdent("table name"); err != nil {
+		return src, err
+	}
+
+	if ps.acceptKeyword("AS") {
+		if src.alias, _, err = ps.parseIdent("alias"); err != nil {
+			return src, err
+		}
+	} else if t := ps.peek(); t.kind == tkQuotedIdent || (t.kind == tkIdent && !sqlReserved[strings.ToUpper(t.text)]) {
+		ps.p++
+		src.alias = t.text
+	}
+
+	return src, nil
+}
+
+func (ps *sqlParser) parseFrom() ([]sqlSource, error) {
+	var sources []sqlSource
+
+	first, err := ps.parseTableRef(joinNone)
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, first)
+
+	for {
+		var kind joinKind
+
+		switch {
+		case ps.acceptOp(","):
+			kind = joinCross
+		case ps.acceptKeyword("CROSS"):
+			if err := ps.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			kind = joinCross
+		case ps.acceptKeyword("INNER"):
+			if err := ps.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			kind = joinInner
+		case ps.acceptKeyword("LEFT"):
+			ps.acceptKeyword("OUTER")
+			if err := ps.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			kind = joinLeft
+		case ps.acceptKeyword("RIGHT"):
+			ps.acceptKeyword("OUTER")
+			if err := ps.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			kind = joinRight
+		case ps.acceptKeyword("FULL"):
+			ps.acceptKeyword("OUTER")
+			if err := ps.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			kind = joinFull
+		case ps.acceptKeyword("JOIN"):
+			kind = joinInner
+		default:
+			return sources, nil
+		}
+
+		src, err := ps.parseTableRef(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		if kind != joinCross {
+			if err := ps.expectKeyword("ON"); err != nil {
+				return nil, err
+			}
+			if src.on, err = ps.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+
+		sources = append(sources, src)
+	}
+}
+
+// parseExpr parses an expression; precedence from low to high:
+// OR, AND, NOT, comparison/IS/IN/BETWEEN/LIKE, + -, * / %, ||, unary.
+func (ps *sqlParser) parseExpr() (sqlExpr, error) {
+	return ps.parseOr()
+}
+
+func (ps *sqlParser) parseOr() (sqlExpr, error) {
+	l, err := ps.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for ps.isKeyword("OR") {
+		pos := ps.next().pos
+		r, err := ps.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: "OR", l: l, r: r, pos: pos}
+	}
+	return l, nil
+}
+
+func (ps *sqlParser) parseAnd() (sqlExpr, error) {
+	l, err := ps.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for ps.isKeyword("AND") {
+		pos := ps.next().pos
+		r, err := ps.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: "AND", l: l, r: r, pos: pos}
+	}
+	return l, nil
+}
+
+func (ps *sqlParser) parseNot() (sqlExpr, error) {
+	if ps.isKeyword("NOT") {
+		pos := ps.next().pos
+		x, err := ps.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op: "NOT", x: x, pos: pos}, nil
+	}
+	return ps.parsePredicate()
+}
+
+func (ps *sqlParser) parsePredicate() (sqlExpr, error) {
+	l, err := ps.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := ps.peek()
+
+		if t.kind == tkOp {
+			switch t.text {
+			case "=", "==", "<>", "!=", "<", "<=", ">", ">=":
+				ps.p++
+				r, err := ps.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				l = &exprBinary{op: t.text, l: l, r: r, pos: t.pos}
+				continue
+			}
+			return l, nil
+		}
+
+		if ps.acceptKeyword("IS") {
+			not := ps.acceptKeyword("NOT")
+			if err := ps.expectKeyword("NULL"); err != nil {
+				return nil, err
+			}
+			l = &exprIsNull{x: l, not: not, pos: t.pos}
+			continue
+		}
+
+		not := false
+		if ps.isKeyword("NOT") {
+			nt := ps.toks[ps.p+1]
+			if nt.kind == tkIdent && (strings.EqualFold(nt.text, "IN") ||
+				strings.EqualFold(nt.text, "BETWEEN") || strings.EqualFold(nt.text, "LIKE")) {
+				ps.p++
+				not = true
+			} else {
+				return l, nil
+			}
+		}
+
+		switch {
+		case ps.acceptKeyword("IN"):
+			if err := ps.expectOp("("); err != nil {
+				return nil, err
+			}
+			in := &exprIn{x: l, not: not, pos: t.pos}
+			for {
+				e, err := ps.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				in.list = append(in.list, e)
+				if !ps.acceptOp(",") {
+					break
+				}
+			}
+			if err := ps.expectOp(")"); err != nil {
+				return nil, err
+			}
+			l = in
+
+		case ps.acceptKeyword("BETWEEN"):
+			lo, err := ps.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if err := ps.expectKeyword("AND"); err != nil {
+				return nil, err
+			}
+			hi, err := ps.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			l = &exprBetween{x: l, lo: lo, hi: hi, not: not, pos: t.pos}
+
+		case ps.acceptKeyword("LIKE"):
+			p, err := ps.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			l = &exprLike{x: l, pattern: p, not: not, pos: t.pos}
+
+		default:
+			return l, nil
+		}
+	}
+}
+
+func (ps *sqlParser) parseAdditive() (sqlExpr, error) {
+	l, err := ps.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for ps.isOp("+") || ps.isOp("-") {
+		t := ps.next()
+		r, err := ps.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: t.text, l: l, r: r, pos: t.pos}
+	}
+	return l, nil
+}
+
+func (ps *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	l, err := ps.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for ps.isOp("*") || ps.isOp("/") || ps.isOp("%") {
+		t := ps.next()
+		r, err := ps.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: t.text, l: l, r: r, pos: t.pos}
+	}
+	return l, nil
+}
+
+func (ps *sqlParser) parseConcat() (sqlExpr, error) {
+	l, err := ps.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for ps.isOp("||") {
+		t := ps.next()
+		r, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: "||", l: l, r: r, pos: t.pos}
+	}
+	return l, nil
+}
+
+func (ps *sqlParser) parseUnary() (sqlExpr, error) {
+	if ps.isOp("-") || ps.isOp("+") {
+		t := ps.next()
+		x, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op: t.text, x: x, pos: t.pos}, nil
+	}
+	return ps.parsePrimary()
+}
+
+func (ps *sqlParser) parsePrimary() (sqlExpr, error) {
+	t := ps.peek()
+
+	switch t.kind {
+	case tkNumber:
+		ps.p++
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &exprLiteral{val: i, pos: t.pos}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, newSQLError(ps.src, t.pos, t.text, "invalid number")
+		}
+		return &exprLiteral{val: f, pos: t.pos}, nil
+
+	case tkString:
+		ps.p++
+		return &exprLiteral{val: t.text, pos: t.pos}, nil
+
+	case tkParam:
+		ps.p++
+		idx := ps.nextArg
+		if t.text != "?" {
+			n, err := strconv.Atoi(t.text[1:])
+			if err != nil || n < 1 {
+				return nil, newSQLError(ps.src, t.pos, t.text, "invalid placeholder")
+			}
+			idx = n - 1
+		} else {
+			ps.nextArg++
+		}
+		if idx+1 > ps.maxParam {
+			ps.maxParam = idx + 1
+		}
+		return &exprParam{index: idx, pos: t.pos}, nil
+
+	case tkOp:
+		if t.text == "(" {
+			ps.p++
+			e, err := ps.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := ps.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+
+	case tkQuotedIdent:
+		return ps.parseColumnRef()
+
+	case tkIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			ps.p++
+			return &exprLiteral{val: nil, pos: t.pos}, nil
+		case "TRUE":
+			ps.p++
+			return &exprLiteral{val: true, pos: t.pos}, nil
+		case "FALSE":
+			ps.p++
+			return &exprLiteral{val: false, pos: t.pos}, nil
+		case "CASE":
+			return ps.parseCase()
+		case "CAST":
+			return ps.parseCast()
+		}
+
+		if ps.toks[ps.p+1].kind == tkOp && ps.toks[ps.p+1].text == "(" {
+			return ps.parseFunc()
+		}
+		if sqlReserved[strings.ToUpper(t.text)] {
+			break
+		}
+		return ps.parseColumnRef()
+	}
+
+	if t.kind == tkEOF {
+		return nil, ps.errorf("unexpected end of statement, expected an expression")
+	}
+
+	return nil, ps.errorf("expected an expression")
+}
+
+func (ps *sqlParser) parseColumnRef() (sqlExpr, error) {
+	t := ps.next()
+	col := &exprColumn{name: t.text, pos: t.pos}
+
+	if ps.acceptOp(".") {
+		name, _, err := ps.parseIdent("column name")
+		if err != nil {
+			return nil, err
+		}
+		col.qual = col.name
+		col.name = name
+	}
+
+	return col, nil
+}
+
+func (ps *sqlParser) parseFunc() (sqlExpr, error) {
+	t := ps.next()
+	ps.p++ // (
+
+	fn := &exprFunc{name: strings.ToLower(t.text), agg: -1, pos: t.pos}
+
+	if ps.acceptOp(")") {
+		return ps.checkFunc(fn)
+	}
+
+	if ps.isOp("*") {
+		ps.p++
+		fn.star = true
+		if err := ps.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return ps.checkFunc(fn)
+	}
+
+	if ps.acceptKeyword("DISTINCT") {
+		fn.distinct = true
+	}
+
+	for {
+		e, err := ps.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		fn.args = append(fn.args, e)
+		if !ps.acceptOp(",") {
+			break
+		}
+	}
+	if err := ps.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	return ps.checkFunc(fn)
+}
+
+// checkFunc validates the name and argument count of a function call.
+func (ps *sqlParser) checkFunc(fn *exprFunc) (sqlExpr, error) {
+	near := ps.src[fn.pos : fn.pos+len(fn.name)]
+
+	if isAggregateName(fn.name) {
+		if fn.star && fn.name != "count" {
+			return nil, newSQLError(ps.src, fn.pos, near, "%s(*) is not supported", strings.ToUpper(fn.name))
+		}
+		if !fn.star && len(fn.args) != 1 {
+			return nil, newSQLError(ps.src, fn.pos, near, "%s takes exactly one argument", strings.ToUpper(fn.name))
+		}
+		return fn, nil
+	}
+
+	if fn.star || fn.distinct {
+		return nil, newSQLError(ps.src, fn.pos, near, "%s is not an aggregate function", strings.ToUpper(fn.name))
+	}
+
+	f, ok := sqlFunctions[fn.name]
+	if !ok {
+		return nil, newSQLError(ps.src, fn.pos, near, "no such function: %s", near)
+	}
+	if len(fn.args) < f.minArgs || (f.maxArgs >= 0 && len(fn.args) > f.maxArgs) {
+		return nil, newSQLError(ps.src, fn.pos, near, "wrong number of arguments for %s", strings.ToUpper(fn.name))
+	}
+
+	return fn, nil
+}
+
+func (ps *sqlParser) parseCase() (sqlExpr, error) {
+	var err error
+	t := ps.next()
+	c := &exprCase{pos: t.pos}
+
+	if !ps.isKeyword("WHEN") {
+		if c.operand, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for ps.acceptKeyword("WHEN") {
+		w, err := ps.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := ps.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		th, err := ps.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.whens = append(c.whens, w)
+		c.thens = append(c.thens, th)
+	}
+	if len(c.whens) == 0 {
+		return nil, ps.errorf("expected WHEN")
+	}
+
+	if ps.acceptKeyword("ELSE") {
+		if c.els, err = ps.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if err := ps.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (ps *sqlParser) parseCast() (sqlExpr, error) {
+	t := ps.next()
+	if err := ps.expectOp("("); err != nil {
+		return nil, err
+	}
+	x, err := ps.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+
+	tt := ps.peek()
+	if tt.kind != tkIdent {
+		return nil, ps.errorf("expected a type name")
+	}
+	ps.p++
+	typ := normalizeColType(tt.text)
+	switch typ {
+	case ColTypeString, ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+	default:
+		return nil, newSQLError(ps.src, tt.pos, tt.text, "unknown type %s", tt.text)
+	}
+
+	// VARCHAR(20), DECIMAL(10,2)...
+	if ps.acceptOp("(") {
+		for !ps.isOp(")") && ps.peek().kind != tkEOF {
+			ps.p++
+		}
+		if err := ps.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ps.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	return &exprCast{x: x, typ: typ, pos: t.pos}, nil
+}
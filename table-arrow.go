@@ -0,0 +1,953 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// Arrow type ids (the Type union of Schema.fbs).
+const (
+	arrowNull        = 1
+	arrowInt         = 2
+	arrowFloat       = 3
+	arrowBinary      = 4
+	arrowUtf8        = 5
+	arrowBool        = 6
+	arrowDate        = 8
+	arrowTimestamp   = 10
+	arrowLargeBinary = 19
+	arrowLargeUtf8   = 20
+)
+
+const (
+	// message header types (Message.fbs)
+	arrowSchemaMessage     = 1
+	arrowDictionaryMessage = 2
+	arrowRecordBatch       = 3
+
+	// MetadataVersion V4 and V5
+	arrowMetadataV4 = 3
+	arrowMetadataV5 = 4
+
+	// rows per record batch
+	arrowBatchSize = 65536
+
+	// time units of Timestamp
+	arrowSecond      = 0
+	arrowMillisecond = 1
+	arrowMicrosecond = 2
+	arrowNanosecond  = 3
+)
+
+var arrowMagic = []byte("ARROW1")
+
+// arrowField is a field of a schema that is read, with the name of
+// the table column it goes to.
+type arrowField struct {
+	name      string
+	col       string
+	id        uint8
+	bitWidth  int
+	signed    bool
+	precision int16
+	unit      int16
+}
+
+// WriteArrowIPC writes the table in the Arrow IPC stream format,
+// which can be read with pyarrow.ipc.open_stream (pandas, polars).
+// Columns are mapped by type: Integer to int64, Float to double,
+// Bool to bool, DateTime to timestamp[us, UTC] and String to utf8.
+// The type of untyped columns (e.g. added by Cols.Add) is taken
+// from their values; columns of mixed values are written as utf8
+// and columns without values as null. NULLs are kept.
+func (t *Table) WriteArrowIPC(w io.Writer) error {
+	return t.writeArrow(w, false)
+}
+
+// WriteArrowFile writes the table in the Arrow IPC file format
+// (Feather v2), which can be read with pyarrow.feather or
+// pandas.read_feather. The columns are mapped as by WriteArrowIPC.
+func (t *Table) WriteArrowFile(w io.Writer) error {
+	return t.writeArrow(w, true)
+}
+
+// arrowWriter writes IPC messages and keeps track of the position
+// and the blocks of the record batches (for the file footer).
+type arrowWriter struct {
+	w      *bufio.Writer
+	pos    int64
+	blocks []byte
+	n      int
+}
+
+func (aw *arrowWriter) write(p []byte) error {
+	n, err := aw.w.Write(p)
+	aw.pos += int64(n)
+	return err
+}
+
+func (aw *arrowWriter) writeU32(v uint32) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return aw.write(b[:])
+}
+
+// message writes an encapsulated message: the continuation marker,
+// the metadata length, the metadata and the body.
+func (aw *arrowWriter) message(headerType uint8, header fbTable, body []byte) error {
+	meta := new(fbBuilder).finish(fbTable{
+		fbInt16(arrowMetadataV5),
+		fbInt8(headerType),
+		fbSubTable(header),
+		fbInt64(int64(len(body))),
+	})
+
+	offset := aw.pos
+	if err := aw.writeU32(0xFFFFFFFF); err != nil {
+		return err
+	}
+	if err := aw.writeU32(uint32(len(meta))); err != nil {
+		return err
+	}
+	if err := aw.write(meta); err != nil {
+		return err
+	}
+	if err := aw.write(body); err != nil {
+		return err
+	}
+
+	if headerType == arrowRecordBatch {
+		var block [24]byte
+		binary.LittleEndian.PutUint64(block[0:], uint64(offset))
+		binary.LittleEndian.PutUint32(block[8:], uint32(8+len(meta)))
+		binary.LittleEndian.PutUint64(block[16:], uint64(len(body)))
+		aw.blocks = append(aw.blocks, block[:]...)
+		aw.n++
+	}
+
+	return nil
+}
+
+func (t *Table) writeArrow(w io.Writer, file bool) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+
+	cols := t.Cols.Get()
+	data := make([][]interface{}, len(cols))
+	types := make([]uint8, len(cols))
+	for j := 0; j < len(cols); j++ {
+		data[j] = t.Cols.GetData(cols[j].Name)
+		types[j] = arrowTypeOf(cols[j], data[j])
+	}
+	schema := arrowSchema(cols, types)
+
+	aw := &arrowWriter{w: bufio.NewWriterSize(w, 64*1024)}
+
+	if file {
+		if err := aw.write(append(append([]byte{}, arrowMagic...), 0, 0)); err != nil {
+			return err
+		}
+	}
+	if err := aw.message(arrowSchemaMessage, schema, nil); err != nil {
+		return err
+	}
+
+	n := t.Rows.Count()
+	for start := 0; start < n; start += arrowBatchSize {
+		end := start + arrowBatchSize
+		if end > n {
+			end = n
+		}
+
+		body := &arrowBody{}
+		for j := 0; j < len(cols); j++ {
+			if err := body.add(cols[j].Name, types[j], data[j][start:end], start); err != nil {
+				return err
+			}
+		}
+
+		batch := fbTable{
+			fbInt64(int64(end - start)),
+			fbStructs(len(body.nodes)/16, body.nodes),
+			fbStructs(len(body.buffers)/16, body.buffers),
+		}
+		if err := aw.message(arrowRecordBatch, batch, body.data); err != nil {
+			return err
+		}
+	}
+
+	// end of stream
+	if err := aw.writeU32(0xFFFFFFFF); err != nil {
+		return err
+	}
+	if err := aw.writeU32(0); err != nil {
+		return err
+	}
+
+	if file {
+		footer := new(fbBuilder).finish(fbTable{
+			fbInt16(arrowMetadataV5),
+			fbSubTable(schema),
+			fbStructs(0, nil),
+			fbStructs(aw.n, aw.blocks),
+		})
+		if err := aw.write(footer); err != nil {
+			return err
+		}
+		if err := aw.writeU32(uint32(len(footer))); err != nil {
+			return err
+		}
+		if err := aw.write(arrowMagic); err != nil {
+			return err
+		}
+	}
+
+	return aw.w.Flush()
+}
+
+// arrowTypeOf returns the Arrow type of a column.
+func arrowTypeOf(col Column, vals []interface{}) uint8 {
+
+	// "string" is the type set by Cols.Add, which says nothing
+	// about the values.
+	if col.Type != "string" {
+		switch normalizeColType(col.Type) {
+		case ColTypeInteger:
+			return arrowInt
+		case ColTypeFloat:
+			return arrowFloat
+		case ColTypeBool:
+			return arrowBool
+		case ColTypeDateTime:
+			return arrowTimestamp
+		case ColTypeString:
+			return arrowUtf8
+		}
+	}
+
+	typ := ""
+	for i := 0; i < len(vals); i++ {
+		if isNull(vals[i]) {
+			continue
+		}
+		vt := colTypeOf(vals[i])
+		switch {
+		case typ == "":
+			typ = vt
+		case typ == vt:
+		case typ == ColTypeInteger && vt == ColTypeFloat,
+			typ == ColTypeFloat && vt == ColTypeInteger:
+			typ = ColTypeFloat
+		default:
+			return arrowUtf8
+		}
+	}
+
+	switch typ {
+	case "":
+		return arrowNull
+	case ColTypeInteger:
+		return arrowInt
+	case ColTypeFloat:
+		return arrowFloat
+	case ColTypeBool:
+		return arrowBool
+	case ColTypeDateTime:
+		return arrowTimestamp
+	case "[]uint8":
+		return arrowBinary
+	}
+	return arrowUtf8
+}
+
+// arrowSchema builds the Schema table; all fields are nullable.
+func arrowSchema(cols []Column, types []uint8) fbTable {
+	fields := make([]fbTable, len(cols))
+
+	for j := 0; j < len(cols); j++ {
+		var typ fbTable
+		switch types[j] {
+		case arrowInt:
+			typ = fbTable{fbInt32(64), fbBool(true)}
+		case arrowFloat:
+			typ = fbTable{fbInt16(2)} // DOUBLE
+		case arrowTimestamp:
+			typ = fbTable{fbInt16(arrowMicrosecond), fbString("UTC")}
+		}
+
+		fields[j] = fbTable{
+			fbString(cols[j].Name),
+			fbBool(true),
+			fbInt8(types[j]),
+			fbSubTable(typ),
+			{},            // dictionary
+			fbTables(nil), // children
+		}
+	}
+
+	return fbTable{{}, fbTables(fields)}
+}
+
+// arrowBody is the body of a record batch: the field nodes and
+// buffers (as FieldNode and Buffer structs) and the buffer data.
+type arrowBody struct {
+	nodes   []byte
+	buffers []byte
+	data    []byte
+}
+
+func (b *arrowBody) node(length, nulls int) {
+	var s [16]byte
+	binary.LittleEndian.PutUint64(s[0:], uint64(length))
+	binary.LittleEndian.PutUint64(s[8:], uint64(nulls))
+	b.nodes = append(b.nodes, s[:]...)
+}
+
+// buffer adds a buffer, padded to 8 bytes.
+func (b *arrowBody) buffer(p []byte) {
+	var s [16]byte
+	binary.LittleEndian.PutUint64(s[0:], uint64(len(b.data)))
+	binary.LittleEndian.PutUint64(s[8:], uint64(len(p)))
+	b.buffers = append(b.buffers, s[:]...)
+
+	b.data = append(b.data, p...)
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+}
+
+// add adds the values of a column; first is the index of the first
+// row (for errors).
+func (b *arrowBody) add(name string, typ uint8, vals []interface{}, first int) error {
+	n := len(vals)
+	if typ == arrowNull {
+		b.node(n, n)
+		return nil
+	}
+
+	valid := make([]byte, (n+7)/8)
+	nulls := 0
+	invalid := func(i int, v interface{}, colType string) error {
+		return fmt.Errorf("arrow: column %s, row %d: cannot convert %v to %s", name, first+i, v, colType)
+	}
+
+	var data, offsets []byte
+	switch typ {
+	case arrowInt, arrowFloat, arrowTimestamp:
+		data = make([]byte, 8*n)
+	case arrowBool:
+		data = make([]byte, (n+7)/8)
+	case arrowUtf8, arrowBinary:
+		offsets = make([]byte, 4*(n+1))
+	}
+
+	for i := 0; i < n; i++ {
+		v := vals[i]
+		if isNull(v) {
+			nulls++
+		} else {
+			valid[i/8] |= 1 << uint(i%8)
+
+			switch typ {
+			case arrowInt:
+				x, ok := toInt64(v)
+				if !ok {
+					return invalid(i, v, ColTypeInteger)
+				}
+				binary.LittleEndian.PutUint64(data[8*i:], uint64(x))
+
+			case arrowFloat:
+				x, ok := toFloat64(v)
+				if !ok {
+					return invalid(i, v, ColTypeFloat)
+				}
+				binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(x))
+
+			case arrowBool:
+				x, ok := toBool(v)
+				if !ok {
+					return invalid(i, v, ColTypeBool)
+				}
+				if x {
+					data[i/8] |= 1 << uint(i%8)
+				}
+
+			case arrowTimestamp:
+				x, ok := toTime(v)
+				if !ok {
+					return invalid(i, v, ColTypeDateTime)
+				}
+				us := x.Unix()*1000000 + int64(x.Nanosecond()/1000)
+				binary.LittleEndian.PutUint64(data[8*i:], uint64(us))
+
+			case arrowBinary, arrowUtf8:
+				if p, ok := v.([]byte); ok {
+					data = append(data, p...)
+				} else {
+					data = append(data, toString(v)...)
+				}
+			}
+		}
+
+		if offsets != nil {
+			if len(data) > math.MaxInt32 {
+				return fmt.Errorf("arrow: column %s: too much data in one batch", name)
+			}
+			binary.LittleEndian.PutUint32(offsets[4*(i+1):], uint32(len(data)))
+		}
+	}
+
+	b.node(n, nulls)
+	if nulls == 0 {
+		valid = nil
+	}
+	b.buffer(valid)
+	if offsets != nil {
+		b.buffer(offsets)
+	}
+	b.buffer(data)
+
+	return nil
+}
+
+// ReadArrowIPC reads an Arrow IPC stream, or an Arrow IPC file
+// (Feather v2), into the table. Columns are matched by name; new
+// columns get the type of the field: Integer for ints, Float for
+// floats, Bool, DateTime for timestamps and dates (in UTC), and
+// String for strings. Binary values are read as []byte. Nested and
+// dictionary-encoded types, and compressed batches, are not
+// supported.
+func (t *Table) ReadArrowIPC(r io.Reader) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	ar := &arrowReader{tbl: t}
+
+	head, _ := br.Peek(len(arrowMagic))
+	if bytes.Equal(head, arrowMagic) {
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		return ar.readFile(data)
+	}
+
+	return ar.readStream(br)
+}
+
+// arrowReader reads messages into a table.
+type arrowReader struct {
+	tbl    *Table
+	fields []arrowField
+}
+
+// readArrowMessage reads the metadata of the next message; it
+// returns nil at the end of the stream.
+func readArrowMessage(r io.Reader) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("arrow: %v", err)
+	}
+
+	n := binary.LittleEndian.Uint32(b[:])
+	if n == 0xFFFFFFFF {
+		// continuation marker; before 0.15 the length came first
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, fmt.Errorf("arrow: %v", err)
+		}
+		n = binary.LittleEndian.Uint32(b[:])
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if int32(n) < 0 {
+		return nil, errFlatbuf
+	}
+
+	// read as it comes, so that a corrupt length does not allocate
+	// more than the stream has
+	var meta bytes.Buffer
+	if _, err := io.CopyN(&meta, r, int64(n)); err != nil {
+		return nil, fmt.Errorf("arrow: %v", err)
+	}
+
+	return meta.Bytes(), nil
+}
+
+// parseArrowMessage decodes the metadata of a message.
+func parseArrowMessage(meta []byte) (headerType uint8, header fbReader, bodyLength int64, err error) {
+	defer fbRecover(&err)
+
+	m := fbRoot(meta)
+	if v := m.int16(0, 0); v < arrowMetadataV4 {
+		return 0, header, 0, fmt.Errorf("arrow: unsupported metadata version V%d", v+1)
+	}
+	headerType = m.uint8(1, 0)
+	header, ok := m.table(2)
+	if !ok {
+		return 0, header, 0, errFlatbuf
+	}
+	bodyLength = m.int64(3, 0)
+	if bodyLength < 0 {
+		return 0, header, 0, errFlatbuf
+	}
+
+	return headerType, header, bodyLength, nil
+}
+
+func (ar *arrowReader) readStream(r io.Reader) error {
+	for {
+		meta, err := readArrowMessage(r)
+		if err != nil {
+			return err
+		}
+		if meta == nil {
+			return nil
+		}
+
+		headerType, header, bodyLength, err := parseArrowMessage(meta)
+		if err != nil {
+			return err
+		}
+
+		var body bytes.Buffer
+		if _, err := io.CopyN(&body, r, bodyLength); err != nil {
+			return fmt.Errorf("arrow: %v", err)
+		}
+
+		if err := ar.message(headerType, header, body.Bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+func (ar *arrowReader) readFile(data []byte) (err error) {
+	n := len(data)
+	if n < 2*len(arrowMagic)+4 || !bytes.Equal(data[n-len(arrowMagic):], arrowMagic) {
+		return errors.New("arrow: not an Arrow file")
+	}
+	footerLen := int(int32(binary.LittleEndian.Uint32(data[n-10:])))
+	footerStart := n - 10 - footerLen
+	if footerLen <= 0 || footerStart < 8 {
+		return errFlatbuf
+	}
+
+	defer fbRecover(&err)
+
+	footer := fbRoot(data[footerStart : n-10])
+	schema, ok := footer.table(1)
+	if !ok {
+		return errFlatbuf
+	}
+	if _, nDict := footer.vector(2); nDict > 0 {
+		return errors.New("arrow: dictionary-encoded columns are not supported")
+	}
+	if err := ar.schema(schema); err != nil {
+		return err
+	}
+
+	start, nBlocks := footer.vector(3)
+	for i := 0; i < nBlocks; i++ {
+		offset := footer.int64At(start + 24*i)
+		if offset < 0 || offset >= int64(footerStart) {
+			return errFlatbuf
+		}
+
+		r := bytes.NewReader(data[offset:footerStart])
+		meta, err := readArrowMessage(r)
+		if err != nil {
+			return err
+		}
+		if meta == nil {
+			return errFlatbuf
+		}
+		headerType, header, bodyLength, err := parseArrowMessage(meta)
+		if err != nil {
+			return err
+		}
+		if headerType != arrowRecordBatch {
+			return errFlatbuf
+		}
+
+		bodyStart := int64(footerStart) - int64(r.Len())
+		if bodyLength > int64(r.Len()) {
+			return errFlatbuf
+		}
+		if err := ar.batch(header, data[bodyStart:bodyStart+bodyLength]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ar *arrowReader) message(headerType uint8, header fbReader, body []byte) error {
+	switch headerType {
+	case arrowSchemaMessage:
+		if ar.fields != nil {
+			return errors.New("arrow: more than one schema in the stream")
+		}
+		return ar.schema(header)
+	case arrowRecordBatch:
+		if ar.fields == nil {
+			return errors.New("arrow: record batch before the schema")
+		}
+		return ar.batch(header, body)
+	case arrowDictionaryMessage:
+		return errors.New("arrow: dictionary-encoded columns are not supported")
+	}
+	return fmt.Errorf("arrow: unsupported message type %d", headerType)
+}
+
+// schema reads the fields and adds the missing columns.
+func (ar *arrowReader) schema(s fbReader) (err error) {
+	defer fbRecover(&err)
+
+	if s.int16(0, 0) != 0 {
+		return errors.New("arrow: big-endian data is not supported")
+	}
+
+	ar.fields = make([]arrowField, 0)
+	start, n := s.vector(1)
+	for i := 0; i < n; i++ {
+		f := s.tableAt(start, i)
+		af := arrowField{name: f.str(0), id: f.uint8(2, 0)}
+		if af.name == "" {
+			af.name = fmt.Sprintf("col_%d", i+1)
+		}
+		if f.has(4) {
+			return fmt.Errorf("arrow: column %s: dictionary-encoded columns are not supported", af.name)
+		}
+
+		typ, _ := f.table(3)
+		switch af.id {
+		case arrowInt:
+			af.bitWidth = int(typ.int32(0, 0))
+			af.signed = typ.uint8(1, 0) != 0
+			switch af.bitWidth {
+			case 8, 16, 32, 64:
+			default:
+				return fmt.Errorf("arrow: column %s: unsupported int width %d", af.name, af.bitWidth)
+			}
+		case arrowFloat:
+			af.precision = typ.int16(0, 0)
+			if af.precision != 1 && af.precision != 2 {
+				return fmt.Errorf("arrow: column %s: half floats are not supported", af.name)
+			}
+		case arrowDate:
+			af.unit = typ.int16(0, arrowMillisecond)
+		case arrowTimestamp:
+			af.unit = typ.int16(0, 0)
+		case arrowNull, arrowBinary, arrowUtf8, arrowBool, arrowLargeBinary, arrowLargeUtf8:
+		default:
+			return fmt.Errorf("arrow: column %s: unsupported type (id %d)", af.name, af.id)
+		}
+
+		ar.fields = append(ar.fields, af)
+	}
+
+	return ar.resolveColumns()
+}
+
+// resolveColumns matches the fields with the columns of the table,
+// adding the missing ones.
+func (ar *arrowReader) resolveColumns() error {
+	names := make([]string, len(ar.fields))
+	types := make([]string, len(ar.fields))
+	for i := 0; i < len(ar.fields); i++ {
+		names[i] = ar.fields[i].name
+		types[i] = arrowColType(ar.fields[i].id)
+	}
+
+	cols, err := resolveReadColumns(ar.tbl, "arrow", names, types)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(ar.fields); i++ {
+		ar.fields[i].col = cols[i]
+	}
+	return nil
+}
+
+// arrowColType returns the column type for an Arrow type; "" for
+// null columns, which are left untyped.
+func arrowColType(id uint8) string {
+	switch id {
+	case arrowInt:
+		return ColTypeInteger
+	case arrowFloat:
+		return ColTypeFloat
+	case arrowBool:
+		return ColTypeBool
+	case arrowDate, arrowTimestamp:
+		return ColTypeDateTime
+	case arrowUtf8, arrowLargeUtf8:
+		return ColTypeString
+	case arrowBinary, arrowLargeBinary:
+		return "[]uint8"
+	}
+	return ""
+}
+
+// batch reads a record batch into new rows.
+func (ar *arrowReader) batch(b fbReader, body []byte) (err error) {
+	defer fbRecover(&err)
+
+	if b.has(3) {
+		return errors.New("arrow: compressed record batches are not supported")
+	}
+	length := b.int64(0, 0)
+	nodes, nNodes := b.vector(1)
+	buffers, nBuffers := b.vector(2)
+	if length < 0 || nNodes != len(ar.fields) {
+		return errors.New("arrow: record batch does not match the schema")
+	}
+	// every column but a null one takes at least a bit per row
+	maxLength := int64(math.MaxInt32)
+	for j := 0; j < len(ar.fields); j++ {
+		if ar.fields[j].id != arrowNull {
+			maxLength = 8 * int64(len(body))
+			break
+		}
+	}
+	if length > maxLength {
+		return errors.New("arrow: record batch length out of range")
+	}
+
+	next := 0
+	buffer := func() ([]byte, error) {
+		if next >= nBuffers {
+			return nil, errors.New("arrow: record batch does not match the schema")
+		}
+		offset := b.int64At(buffers + 16*next)
+		size := b.int64At(buffers + 16*next + 8)
+		next++
+		if offset < 0 || size < 0 || offset > int64(len(body)) || size > int64(len(body))-offset {
+			return nil, errors.New("arrow: buffer out of range")
+		}
+		return body[offset : offset+size], nil
+	}
+
+	vals := make([][]interface{}, len(ar.fields))
+	for j := 0; j < len(ar.fields); j++ {
+		n := b.int64At(nodes + 16*j)
+		nulls := b.int64At(nodes + 16*j + 8)
+		if n != length {
+			return errors.New("arrow: record batch does not match the schema")
+		}
+		vals[j], err = ar.fields[j].values(int(n), nulls, buffer)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < int(length); i++ {
+		row := ar.tbl.Rows.New()
+		for j := 0; j < len(ar.fields); j++ {
+			row[ar.fields[j].col] = vals[j][i]
+		}
+	}
+
+	return nil
+}
+
+// values decodes the values of a field from its buffers.
+func (f *arrowField) values(n int, nulls int64, buffer func() ([]byte, error)) ([]interface{}, error) {
+	vals := make([]interface{}, n)
+	if f.id == arrowNull {
+		return vals, nil
+	}
+
+	short := fmt.Errorf("arrow: column %s: buffer too short", f.name)
+
+	valid, err := buffer()
+	if err != nil {
+		return nil, err
+	}
+	if nulls < 0 || nulls > int64(n) {
+		return nil, fmt.Errorf("arrow: column %s: invalid null count %d", f.name, nulls)
+	}
+	if nulls > 0 && len(valid) < (n+7)/8 {
+		return nil, short
+	}
+	isValid := func(i int) bool {
+		return nulls == 0 || valid[i/8]&(1<<uint(i%8)) != 0
+	}
+
+	switch f.id {
+	case arrowUtf8, arrowBinary, arrowLargeUtf8, arrowLargeBinary:
+		offsets, err := buffer()
+		if err != nil {
+			return nil, err
+		}
+		data, err := buffer()
+		if err != nil {
+			return nil, err
+		}
+		large := f.id == arrowLargeUtf8 || f.id == arrowLargeBinary
+		w := 4
+		if large {
+			w = 8
+		}
+		if n > 0 && len(offsets) < w*(n+1) {
+			return nil, short
+		}
+		offset := func(i int) int64 {
+			if large {
+				return int64(binary.LittleEndian.Uint64(offsets[8*i:]))
+			}
+			return int64(int32(binary.LittleEndian.Uint32(offsets[4*i:])))
+		}
+
+		for i := 0; i < n; i++ {
+			if !isValid(i) {
+				continue
+			}
+			start, end := offset(i), offset(i+1)
+			if start < 0 || end < start || end > int64(len(data)) {
+				return nil, fmt.Errorf("arrow: column %s: invalid offsets", f.name)
+			}
+			if f.id == arrowUtf8 || f.id == arrowLargeUtf8 {
+				vals[i] = string(data[start:end])
+			} else {
+				vals[i] = append([]byte{}, data[start:end]...)
+			}
+		}
+		return vals, nil
+	}
+
+	data, err := buffer()
+	if err != nil {
+		return nil, err
+	}
+
+	width := 8
+	switch f.id {
+	case arrowBool:
+		width = 0
+		if len(data) < (n+7)/8 {
+			return nil, short
+		}
+	case arrowInt:
+		width = f.bitWidth / 8
+	case arrowFloat:
+		if f.precision == 1 {
+			width = 4
+		}
+	case arrowDate:
+		if f.unit == 0 {
+			width = 4
+		}
+	}
+	if len(data) < width*n {
+		return nil, short
+	}
+
+	for i := 0; i < n; i++ {
+		if !isValid(i) {
+			continue
+		}
+		p := data[width*i:]
+
+		switch f.id {
+		case arrowBool:
+			vals[i] = data[i/8]&(1<<uint(i%8)) != 0
+
+		case arrowInt:
+			vals[i] = arrowInt64(p, f.bitWidth, f.signed)
+
+		case arrowFloat:
+			if width == 4 {
+				vals[i] = float32FromBits(p)
+			} else {
+				vals[i] = float64FromBits(p)
+			}
+
+		case arrowDate:
+			if width == 4 {
+				days := int64(int32(binary.LittleEndian.Uint32(p)))
+				vals[i] = time.Unix(days*86400, 0).UTC()
+			} else {
+				vals[i] = arrowTime(int64(binary.LittleEndian.Uint64(p)), arrowMillisecond)
+			}
+
+		case arrowTimestamp:
+			vals[i] = arrowTime(int64(binary.LittleEndian.Uint64(p)), f.unit)
+		}
+	}
+
+	return vals, nil
+}
+
+// arrowInt64 reads an integer; uint64 values that do not fit in an
+// int64 are returned as uint64.
+func arrowInt64(p []byte, bitWidth int, signed bool) interface{} {
+	switch bitWidth {
+	case 8:
+		if signed {
+			return int64(int8(p[0]))
+		}
+		return int64(p[0])
+	case 16:
+		x := binary.LittleEndian.Uint16(p)
+		if signed {
+			return int64(int16(x))
+		}
+		return int64(x)
+	case 32:
+		x := binary.LittleEndian.Uint32(p)
+		if signed {
+			return int64(int32(x))
+		}
+		return int64(x)
+	}
+	x := binary.LittleEndian.Uint64(p)
+	if signed || x <= math.MaxInt64 {
+		return int64(x)
+	}
+	return x
+}
+
+// arrowTime converts a timestamp in the given unit to a UTC time.
+func arrowTime(v int64, unit int16) time.Time {
+	var perSec int64
+	switch unit {
+	case arrowSecond:
+		return time.Unix(v, 0).UTC()
+	case arrowMillisecond:
+		perSec = 1000
+	case arrowMicrosecond:
+		perSec = 1000000
+	default:
+		perSec = 1000000000
+	}
+
+	sec, frac := v/perSec, v%perSec
+	if frac < 0 {
+		sec--
+		frac += perSec
+	}
+	return time.Unix(sec, frac*(1000000000/perSec)).UTC()
+}
@@ -0,0 +1,143 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func arrowTestTable(t *testing.T) *Table {
+	tbl := newTestTable(t, RowStorage, []string{"id", "price", "name", "ok", "at", "none", "n"},
+		[]interface{}{int64(1), 1.5, "apple", true, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), nil, int64(7)},
+		[]interface{}{int64(2), nil, "", false, nil, nil, int64(8)},
+		[]interface{}{nil, -2.25, nil, nil, time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC), nil, int64(9)},
+	)
+	return tbl
+}
+
+func TestArrowIPCAndFileRoundTrip(t *testing.T) {
+	for _, file := range []bool{false, true} {
+		src := arrowTestTable(t)
+		var buf bytes.Buffer
+		var err error
+		if file {
+			err = src.WriteArrowFile(&buf)
+		} else {
+			err = src.WriteArrowIPC(&buf)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, _ := (&Table{}).Create("t")
+		if err := dst.ReadArrowIPC(&buf); err != nil {
+			t.Fatalf("file=%v: %v", file, err)
+		}
+		if got, want := fmt.Sprint(tableValues(dst)), fmt.Sprint(tableValues(src)); got != want {
+			t.Fatalf("file=%v:\n got %s\nwant %s", file, got, want)
+		}
+	}
+}
+
+// The files in testdata/arrow were written by the Arrow Go library
+// (a stream and a file, each with the same record batch twice).
+func TestArrowReferenceFiles(t *testing.T) {
+	utc := time.UTC
+	batch := [][]interface{}{
+		{int64(-1), int64(255), uint64(1 << 63), 0.5, time.Date(2019, 4, 14, 0, 0, 0, 0, utc), time.Unix(0, -1).UTC(), "a", true, nil},
+		{nil, int64(1), uint64(5), 1.0, time.Date(1969, 12, 31, 0, 0, 0, 0, utc), time.Unix(0, 1500000000123456789).UTC(), nil, false, nil},
+		{int64(7), int64(2), uint64(0), 2.0, time.Date(1970, 1, 1, 0, 0, 0, 0, utc), nil, "ccc", nil, nil},
+	}
+	want := fmt.Sprint(append(batch, batch...))
+	for _, name := range []string{"reference.arrows", "reference.arrow"} {
+		f, err := os.Open("testdata/arrow/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl, _ := (&Table{}).Create("t")
+		err = tbl.ReadArrowIPC(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var names []string
+		for _, c := range tbl.Cols.Get() {
+			names = append(names, c.Name)
+		}
+		if got := fmt.Sprint(names); got != "[i32 u8 u64 f32 d32 tsns s b nul]" {
+			t.Fatalf("%s: columns %s", name, got)
+		}
+		if got := fmt.Sprint(tableValues(tbl)); got != want {
+			t.Fatalf("%s:\n got %s\nwant %s", name, got, want)
+		}
+	}
+}
+
+// Corrupted input must give an error, not a panic.
+func TestArrowCorruptInput(t *testing.T) {
+	for _, file := range []bool{false, true} {
+		var buf bytes.Buffer
+		if file {
+			arrowTestTable(t).WriteArrowFile(&buf)
+		} else {
+			arrowTestTable(t).WriteArrowIPC(&buf)
+		}
+		data := buf.Bytes()
+		for i := 0; i < len(data); i++ {
+			for _, b := range []byte{0x00, 0xff, 0x80, 0x7f, data[i] ^ 1} {
+				mutated := append([]byte(nil), data...)
+				mutated[i] = b
+				readArrowNoPanic(t, mutated, fmt.Sprintf("file=%v byte %d = %#x", file, i, b))
+			}
+		}
+		for n := 0; n < len(data); n++ {
+			readArrowNoPanic(t, data[:n], fmt.Sprintf("file=%v truncated to %d", file, n))
+		}
+	}
+}
+
+// A buffer whose offset plus size overflows is out of range.
+func TestArrowBufferOverflow(t *testing.T) {
+	le := func(vs ...int64) []byte {
+		b := make([]byte, 8*len(vs))
+		for i, v := range vs {
+			binary.LittleEndian.PutUint64(b[8*i:], uint64(v))
+		}
+		return b
+	}
+	meta := (&fbBuilder{}).finish(fbTable{
+		fbInt64(1),
+		fbStructs(1, le(1, 0)),
+		fbStructs(2, le(0, 0, math.MaxInt64, 2)),
+	})
+	tbl, _ := (&Table{}).Create("t")
+	ar := &arrowReader{tbl: tbl, fields: []arrowField{{name: "n", col: "n", id: arrowInt, bitWidth: 64, signed: true}}}
+	tbl.Cols.Add("n")
+
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("panic: %v", r)
+			}
+		}()
+		err = ar.batch(fbRoot(meta), make([]byte, 8))
+	}()
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func readArrowNoPanic(t *testing.T, data []byte, what string) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s: panic: %v", what, r)
+		}
+	}()
+	tbl, _ := (&Table{}).Create("t")
+	tbl.ReadArrowIPC(bytes.NewReader(data))
+}
@@ -0,0 +1,758 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sort"
+	"time"
+)
+
+// The binary table format (all integers are varints unless noted):
+//
+//	magic      "GCTB" (4 bytes)
+//	version    uint16, big-endian
+//	name       string
+//	names      column name policy (since version 2)
+//	storage    RowStorage or ColumnStorage (since version 2)
+//	columns    count, then name, type and tag of each column
+//	computed   count, then the column index and expression of each
+//	           computed column, in the order they are computed
+//	           (since version 2)
+//	rows       count, then for each row: _rowid_, one value per
+//	           column, and the number of other keys of the row
+//	           followed by key/value pairs
+//	tags       count (one per row), then for each row the number
+//	           of its tags and the name and data of each (version
+//	           1: one tag per row, its name and data)
+//	row hashes count, then MD5 and row id of each hash
+//	shared     count, then tag name and data of each item
+//	checksum   CRC-32 (IEEE) of all preceding bytes, uint32 big-endian
+//
+// A string is its length followed by its bytes. A value is a kind
+// byte followed by its data; values of types not listed below are
+// gob-encoded and must be registered with gob.Register (the types
+// of this package and slices and maps of the basic types are
+// registered by the package). Map keys and the other keys of a row
+// are written in sorted order, so that the same table is always
+// written to the same bytes. Columns computed by a func are written
+// as plain columns.
+const (
+	binaryMagic   = "GCTB"
+	binaryVersion = 2
+)
+
+// value kinds of the binary format
+const (
+	binNil byte = iota
+	binString
+	binInt
+	binInt8
+	binInt16
+	binInt32
+	binInt64
+	binUint
+	binUint8
+	binUint16
+	binUint32
+	binUint64
+	binFloat32
+	binFloat64
+	binTrue
+	binFalse
+	binTime
+	binBytes
+	binList
+	binMap
+	binGob
+)
+
+// gobValue wraps values that are gob-encoded.
+type gobValue struct {
+	V interface{}
+}
+
+func init() {
+	for _, v := range []interface{}{
+		Row{}, []Row{}, Tag{}, RowTags{}, SharedDataItem{},
+		[]string{}, []int{}, []int64{}, []float64{}, []bool{}, []time.Time{},
+		map[string]string{}, map[string]int{}, map[string]int64{},
+		map[string]float64{}, map[string]bool{},
+	} {
+		gob.Register(v)
+	}
+}
+
+// binaryWriter appends the items of the format to a buffer.
+type binaryWriter struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *binaryWriter) uvarint(n uint64) {
+	k := binary.PutUvarint(w.tmp[:], n)
+	w.buf.Write(w.tmp[:k])
+}
+
+func (w *binaryWriter) varint(n int64) {
+	k := binary.PutVarint(w.tmp[:], n)
+	w.buf.Write(w.tmp[:k])
+}
+
+func (w *binaryWriter) float(f float64) {
+	binary.BigEndian.PutUint64(w.tmp[:8], math.Float64bits(f))
+	w.buf.Write(w.tmp[:8])
+}
+
+func (w *binaryWriter) str(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *binaryWriter) value(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		w.buf.WriteByte(binNil)
+	case string:
+		w.buf.WriteByte(binString)
+		w.str(x)
+	case int:
+		w.buf.WriteByte(binInt)
+		w.varint(int64(x))
+	case int8:
+		w.buf.WriteByte(binInt8)
+		w.varint(int64(x))
+	case int16:
+		w.buf.WriteByte(binInt16)
+		w.varint(int64(x))
+	case int32:
+		w.buf.WriteByte(binInt32)
+		w.varint(int64(x))
+	case int64:
+		w.buf.WriteByte(binInt64)
+		w.varint(x)
+	case uint:
+		w.buf.WriteByte(binUint)
+		w.uvarint(uint64(x))
+	case uint8:
+		w.buf.WriteByte(binUint8)
+		w.uvarint(uint64(x))
+	case uint16:
+		w.buf.WriteByte(binUint16)
+		w.uvarint(uint64(x))
+	case uint32:
+		w.buf.WriteByte(binUint32)
+		w.uvarint(uint64(x))
+	case uint64:
+		w.buf.WriteByte(binUint64)
+		w.uvarint(x)
+	case float32:
+		w.buf.WriteByte(binFloat32)
+		binary.BigEndian.PutUint32(w.tmp[:4], math.Float32bits(x))
+		w.buf.Write(w.tmp[:4])
+	case float64:
+		w.buf.WriteByte(binFloat64)
+		binary.BigEndian.PutUint64(w.tmp[:8], math.Float64bits(x))
+		w.buf.Write(w.tmp[:8])
+	case bool:
+		if x {
+			w.buf.WriteByte(binTrue)
+		} else {
+			w.buf.WriteByte(binFalse)
+		}
+	case time.Time:
+		b, err := x.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		w.buf.WriteByte(binTime)
+		w.bytes(b)
+	case []byte:
+		w.buf.WriteByte(binBytes)
+		w.bytes(x)
+	case []interface{}:
+		w.buf.WriteByte(binList)
+		w.uvarint(uint64(len(x)))
+		for i := 0; i < len(x); i++ {
+			if err := w.value(x[i]); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		w.buf.WriteByte(binMap)
+		w.uvarint(uint64(len(x)))
+		for _, k := range sortedKeys(x) {
+			w.str(k)
+			if err := w.value(x[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		var gb bytes.Buffer
+		if err := gob.NewEncoder(&gb).Encode(&gobValue{V: v}); err != nil {
+			return fmt.Errorf("cannot encode value of type %T: %v", v, err)
+		}
+		w.buf.WriteByte(binGob)
+		w.bytes(gb.Bytes())
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// binaryReader reads the items of the format from a byte slice.
+type binaryReader struct {
+	data []byte
+	pos  int
+}
+
+var errBinaryTruncated = errors.New("unexpected end of data")
+
+func (r *binaryReader) uvarint() (uint64, error) {
+	n, k := binary.Uvarint(r.data[r.pos:])
+	if k <= 0 {
+		return 0, errBinaryTruncated
+	}
+	r.pos += k
+	return n, nil
+}
+
+func (r *binaryReader) varint() (int64, error) {
+	n, k := binary.Varint(r.data[r.pos:])
+	if k <= 0 {
+		return 0, errBinaryTruncated
+	}
+	r.pos += k
+	return n, nil
+}
+
+func (r *binaryReader) float() (float64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+}
+
+// count reads a count and checks that it is not larger than the
+// number of bytes left (every item takes at least one byte).
+func (r *binaryReader) count() (int, error) {
+	n, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		return 0, errBinaryTruncated
+	}
+	return int(n), nil
+}
+
+func (r *binaryReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, errBinaryTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *binaryReader) bytes() ([]byte, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	return r.next(n)
+}
+
+func (r *binaryReader) str() (string, error) {
+	b, err := r.bytes()
+	return string(b), err
+}
+
+func (r *binaryReader) value() (interface{}, error) {
+	kb, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kb[0] {
+	case binNil:
+		return nil, nil
+	case binString:
+		return r.str()
+	case binInt, binInt8, binInt16, binInt32, binInt64:
+		n, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		switch kb[0] {
+		case binInt:
+			return int(n), nil
+		case binInt8:
+			return int8(n), nil
+		case binInt16:
+			return int16(n), nil
+		case binInt32:
+			return int32(n), nil
+		}
+		return n, nil
+	case binUint, binUint8, binUint16, binUint32, binUint64:
+		n, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		switch kb[0] {
+		case binUint:
+			return uint(n), nil
+		case binUint8:
+			return uint8(n), nil
+		case binUint16:
+			return uint16(n), nil
+		case binUint32:
+			return uint32(n), nil
+		}
+		return n, nil
+	case binFloat32:
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case binFloat64:
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case binTrue:
+		return true, nil
+	case binFalse:
+		return false, nil
+	case binTime:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		var tm time.Time
+		if err := tm.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		return tm, nil
+	case binBytes:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case binList:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			if list[i], err = r.value(); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case binMap:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := r.str()
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = r.value(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case binGob:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		var gv gobValue
+		if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&gv); err != nil {
+			return nil, err
+		}
+		return gv.V, nil
+	}
+
+	return nil, fmt.Errorf("unknown value kind %d", kb[0])
+}
+
+// isBinaryTable reports whether data starts with the magic of the
+// binary table format. The high byte of the version is zero, which
+// never occurs in the base64 text of the earlier format.
+func isBinaryTable(data []byte) bool {
+	return len(data) > len(binaryMagic) && string(data[:len(binaryMagic)]) == binaryMagic &&
+		data[len(binaryMagic)] == 0
+}
+
+// encodeTable writes a table in the binary format.
+func encodeTable(tbl *Table) ([]byte, error) {
+
+	if tbl == nil || tbl.Cols == nil || tbl.Rows == nil {
+		return nil, errors.New("table is not initialized")
+	}
+
+	w := &binaryWriter{}
+	w.buf.WriteString(binaryMagic)
+	binary.BigEndian.PutUint16(w.tmp[:2], binaryVersion)
+	w.buf.Write(w.tmp[:2])
+
+	w.str(tbl.Name)
+	w.uvarint(uint64(tbl.Cols.NamePolicy()))
+	storage := RowStorage
+	if _, ok := tbl.Rows.(*ColumnarRows); ok {
+		storage = ColumnStorage
+	}
+	w.uvarint(uint64(storage))
+
+	cols := tbl.Cols.Get()
+	w.uvarint(uint64(len(cols)))
+	for i := 0; i < len(cols); i++ {
+		w.str(cols[i].Name)
+		w.str(cols[i].Type)
+		w.str(cols[i].Tag)
+	}
+
+	var computed []int
+	for _, j := range computedOrder(cols) {
+		if cols[j].computed.fn == nil {
+			computed = append(computed, j)
+		}
+	}
+	w.uvarint(uint64(len(computed)))
+	for _, j := range computed {
+		w.uvarint(uint64(j))
+		w.str(cols[j].computed.src)
+	}
+
+	isCol := make(map[string]bool, len(cols)+1)
+	isCol[row_id] = true
+	for i := 0; i < len(cols); i++ {
+		isCol[cols[i].Name] = true
+	}
+
+	rows := tbl.Rows.GetRows()
+	w.uvarint(uint64(len(rows)))
+	for i := 0; i < len(rows); i++ {
+		if err := w.value(rows[i][row_id]); err != nil {
+			return nil, err
+		}
+		for j := 0; j < len(cols); j++ {
+			if err := w.value(rows[i][cols[j].Name]); err != nil {
+				return nil, fmt.Errorf("row %d, column %s: %v", i, cols[j].Name, err)
+			}
+		}
+
+		// keys that are not columns
+		var extra []string
+		for _, k := range sortedKeys(rows[i]) {
+			if !isCol[k] {
+				extra = append(extra, k)
+			}
+		}
+		w.uvarint(uint64(len(extra)))
+		for _, k := range extra {
+			w.str(k)
+			if err := w.value(rows[i][k]); err != nil {
+				return nil, fmt.Errorf("row %d, key %s: %v", i, k, err)
+			}
+		}
+	}
+
+	var tags []RowTags
+	var hashes []RowHash
+	var shared []SharedDataItem
+	switch rs := tbl.Rows.(type) {
+	case *Rows:
+		tags, hashes, shared = rs.Tags, rs.RowHashes, rs.SharedData
+	case *ColumnarRows:
+		tags, hashes, shared = rs.Tags, rs.RowHashes, rs.SharedData
+	}
+
+	tags = tagSlice(tags, len(rows))
+	w.uvarint(uint64(len(tags)))
+	for i := 0; i < len(tags); i++ {
+		w.uvarint(uint64(len(tags[i])))
+		for _, t := range tags[i] {
+			w.str(t.Name)
+			if err := w.value(t.Data); err != nil {
+				return nil, fmt.Errorf("row %d, tag %s: %v", i, t.Name, err)
+			}
+		}
+	}
+
+	w.uvarint(uint64(len(hashes)))
+	for i := 0; i < len(hashes); i++ {
+		w.str(hashes[i].MD5)
+		w.varint(int64(hashes[i].RowID))
+	}
+
+	w.uvarint(uint64(len(shared)))
+	for i := 0; i < len(shared); i++ {
+		w.str(shared[i].TagName)
+		if err := w.value(shared[i].Data); err != nil {
+			return nil, fmt.Errorf("shared data %s: %v", shared[i].TagName, err)
+		}
+	}
+
+	binary.BigEndian.PutUint32(w.tmp[:4], crc32.ChecksumIEEE(w.buf.Bytes()))
+	w.buf.Write(w.tmp[:4])
+
+	return w.buf.Bytes(), nil
+}
+
+// decodeTable reads a table written by encodeTable.
+func decodeTable(data []byte) (*Table, error) {
+
+	if !isBinaryTable(data) {
+		return nil, errors.New("not a binary table")
+	}
+	if len(data) < len(binaryMagic)+2+4 {
+		return nil, errBinaryTruncated
+	}
+	version := binary.BigEndian.Uint16(data[len(binaryMagic):])
+	if version < 1 || version > binaryVersion {
+		return nil, fmt.Errorf("unsupported format version %d", version)
+	}
+
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	r := &binaryReader{data: body, pos: len(binaryMagic) + 2}
+
+	name, err := r.str()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := ColumnNamesCaseInsensitive
+	storage := RowStorage
+	if version >= 2 {
+		p, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		policy = ColumnNamePolicy(p)
+		if !policy.valid() {
+			return nil, fmt.Errorf("unknown column name policy %d", p)
+		}
+		s, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		storage = Storage(s)
+		if storage != RowStorage && storage != ColumnStorage {
+			return nil, fmt.Errorf("unknown storage %d", s)
+		}
+	}
+
+	nCols, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	cols := make([]Column, nCols)
+	for i := 0; i < nCols; i++ {
+		if cols[i].Name, err = r.str(); err != nil {
+			return nil, err
+		}
+		if cols[i].Type, err = r.str(); err != nil {
+			return nil, err
+		}
+		if cols[i].Tag, err = r.str(); err != nil {
+			return nil, err
+		}
+	}
+
+	if version >= 2 {
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		order := make([]int, n)
+		srcs := make([]string, n)
+		computed := make([]bool, nCols)
+		for i := 0; i < n; i++ {
+			j, err := r.uvarint()
+			if err != nil {
+				return nil, err
+			}
+			if j >= uint64(nCols) || computed[j] {
+				return nil, fmt.Errorf("invalid computed column %d", j)
+			}
+			computed[j] = true
+			order[i] = int(j)
+			if srcs[i], err = r.str(); err != nil {
+				return nil, err
+			}
+		}
+
+		// an expression refers to the plain columns and to the
+		// computed columns before it
+		var visible []Column
+		for j := 0; j < nCols; j++ {
+			if !computed[j] {
+				visible = append(visible, cols[j])
+			}
+		}
+		for i, j := range order {
+			cc, err := newComputedExpr(visible, srcs[i])
+			if err != nil {
+				return nil, fmt.Errorf("computed column %s: %v", cols[j].Name, err)
+			}
+			cols[j].computed = cc
+			visible = append(visible, cols[j])
+		}
+	}
+
+	nRows, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]Row, nRows)
+	for i := 0; i < nRows; i++ {
+		row := make(Row, nCols+1)
+		if row[row_id], err = r.value(); err != nil {
+			return nil, err
+		}
+		if id, ok := row[row_id].(int); !ok || id != i {
+			return nil, fmt.Errorf("row %d: invalid %s %v", i, row_id, row[row_id])
+		}
+		for j := 0; j < nCols; j++ {
+			if row[cols[j].Name], err = r.value(); err != nil {
+				return nil, err
+			}
+		}
+		nExtra, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < nExtra; j++ {
+			k, err := r.str()
+			if err != nil {
+				return nil, err
+			}
+			if row[k], err = r.value(); err != nil {
+				return nil, err
+			}
+		}
+		rows[i] = row
+	}
+
+	nTags, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]RowTags, nTags)
+	for i := 0; i < nTags; i++ {
+		n := 1
+		if version >= 2 {
+			if n, err = r.count(); err != nil {
+				return nil, err
+			}
+		}
+		for j := 0; j < n; j++ {
+			var t Tag
+			if t.Name, err = r.str(); err != nil {
+				return nil, err
+			}
+			if t.Data, err = r.value(); err != nil {
+				return nil, err
+			}
+			// blank tags of earlier versions mean "no tag"
+			if t.Name != "" && tags[i].find(t.Name) < 0 {
+				tags[i] = append(tags[i], t)
+			}
+		}
+	}
+
+	nHashes, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]RowHash, nHashes)
+	for i := 0; i < nHashes; i++ {
+		if hashes[i].MD5, err = r.str(); err != nil {
+			return nil, err
+		}
+		id, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i].RowID = int(id)
+	}
+
+	nShared, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	shared := make([]SharedDataItem, nShared)
+	for i := 0; i < nShared; i++ {
+		if shared[i].TagName, err = r.str(); err != nil {
+			return nil, err
+		}
+		if shared[i].Data, err = r.value(); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.pos != len(body) {
+		return nil, errors.New("unexpected data after the table")
+	}
+
+	tbl, err := (&Table{}).Create("", storage)
+	if err != nil {
+		return nil, err
+	}
+	tbl.Name = name
+	tbl.Cols.SetNamePolicy(policy)
+	tbl.Cols.SetColumns(cols)
+
+	// the values of the computed columns are read, not computed
+	switch rs := tbl.Rows.(type) {
+	case *Rows:
+		rs.Rows = rows
+		rs.evaluated = len(rows)
+		rs.Tags = tagSlice(tags, len(rows))
+		rs.RowHashes = hashes
+		rs.SharedData = shared
+	case *ColumnarRows:
+		for i := 0; i < len(rows); i++ {
+			rs.store(rs.appendRow(), rows[i])
+		}
+		rs.Tags = tagSlice(tags, len(rows))
+		rs.RowHashes = hashes
+		rs.SharedData = shared
+	}
+
+	return tbl, nil
+}
@@ -0,0 +1,202 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func binaryTestTable(t *testing.T, storage Storage) *Table {
+	tbl := newTestTable(t, storage, []string{"qty", "price", "Name"},
+		[]interface{}{int64(2), 1.5, "a"},
+		[]interface{}{int64(3), nil, "b"},
+		[]interface{}{int64(4), 0.25, nil},
+	)
+	if err := tbl.Cols.AddComputed("total", "qty * price"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Cols.AddComputed("label", "Name || ':' || CAST(total AS TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Cols.AddComputed("fn", func(r Row) interface{} { return "f" }); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Rows.AddTag(0, Tag{Name: "x", Data: 1})
+	tbl.Rows.AddTag(0, Tag{Name: "y"})
+	tbl.Rows.AddTag(2, Tag{Name: "x"})
+	if err := tbl.Rows.AddSharedData(SharedDataItem{TagName: "x", Data: "shared"}); err != nil {
+		t.Fatal(err)
+	}
+	return tbl
+}
+
+func TestBinaryStorageAndComputedColumns(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		src := binaryTestTable(t, storage)
+		data, err := encodeTable(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl, err := decodeTable(data)
+		if err != nil {
+			t.Fatalf("storage %d: %v", storage, err)
+		}
+
+		if _, columnar := tbl.Rows.(*ColumnarRows); columnar != (storage == ColumnStorage) {
+			t.Fatalf("storage %d: read as %T", storage, tbl.Rows)
+		}
+		if got, want := fmt.Sprint(tableValues(tbl)), fmt.Sprint(tableValues(src)); got != want {
+			t.Fatalf("storage %d:\n got %s\nwant %s", storage, got, want)
+		}
+		for _, c := range tbl.Cols.Get() {
+			if c.IsComputed() != (c.Name == "total" || c.Name == "label") {
+				t.Fatalf("storage %d: column %s computed %v", storage, c.Name, c.IsComputed())
+			}
+		}
+		if got := fmt.Sprintf("%v %v %v", tbl.Rows.GetTags(0), tbl.Rows.GetRowIndexesByTag("x"), tbl.Rows.GetSharedData("x").Data); got != "[{x 1} {y <nil>}] [0 2] shared" {
+			t.Fatalf("storage %d: tags %s", storage, got)
+		}
+
+		// the expressions still work
+		if err := tbl.Rows.SetValue(1, "price", 2.0); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := tbl.Rows.GetValue(1, "label"); v != "b:6" {
+			t.Fatalf("storage %d: label = %v", storage, v)
+		}
+		row := tbl.Rows.New()
+		row["qty"], row["price"], row["Name"] = int64(5), 2.0, "c"
+		if v, _ := tbl.Rows.GetValue(3, "total"); v != 10.0 {
+			t.Fatalf("storage %d: total = %v", storage, v)
+		}
+	}
+}
+
+// binaryV1 writes a table in version 1 of the format, with one
+// column "a", a value and a tag per row.
+func binaryV1(ids []interface{}, vals []interface{}, tags []string) []byte {
+	w := &binaryWriter{}
+	w.buf.WriteString(binaryMagic)
+	w.buf.Write([]byte{0, 1})
+	w.str("old")
+	w.uvarint(1)
+	w.str("a")
+	w.str(ColTypeInteger)
+	w.str("")
+	w.uvarint(uint64(len(ids)))
+	for i := range ids {
+		w.value(ids[i])
+		w.value(vals[i])
+		w.uvarint(0)
+	}
+	w.uvarint(uint64(len(tags)))
+	for _, tag := range tags {
+		w.str(tag)
+		w.value(nil)
+	}
+	w.uvarint(0)
+	w.uvarint(0)
+	binary.BigEndian.PutUint32(w.tmp[:4], crc32.ChecksumIEEE(w.buf.Bytes()))
+	w.buf.Write(w.tmp[:4])
+	return w.buf.Bytes()
+}
+
+func TestBinaryVersion1(t *testing.T) {
+	tbl, err := decodeTable(binaryV1([]interface{}{0, 1}, []interface{}{int64(7), int64(8)}, []string{"", "g"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s %v %v %v", tbl.Name, tableValues(tbl), tbl.Rows.GetTags(0), tbl.Rows.GetTags(1)); got != "old [[7] [8]] [] [{g <nil>}]" {
+		t.Fatal(got)
+	}
+
+	// versions after 2 are not read
+	data := binaryV1(nil, nil, nil)
+	data[len(binaryMagic)+1] = 3
+	body := data[:len(data)-4]
+	binary.BigEndian.PutUint32(data[len(body):], crc32.ChecksumIEEE(body))
+	if _, err := decodeTable(data); err == nil || !strings.Contains(err.Error(), "version 3") {
+		t.Fatalf("version 3: %v", err)
+	}
+}
+
+func TestBinaryInvalidRowID(t *testing.T) {
+	for _, ids := range [][]interface{}{{0, 0}, {1, 2}, {0, "1"}, {0, int64(1)}, {0, nil}} {
+		data := binaryV1(ids, []interface{}{int64(1), int64(2)}, nil)
+		if _, err := decodeTable(data); err == nil {
+			t.Fatalf("row ids %v: no error", ids)
+		}
+	}
+}
+
+// A renamed column is renamed in the expressions written.
+func TestBinaryRenamedComputedColumns(t *testing.T) {
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		src := binaryTestTable(t, storage)
+		if err := src.Cols.Rename("Name", "the name"); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.Cols.Rename("total", "sum"); err != nil {
+			t.Fatal(err)
+		}
+		data, err := encodeTable(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl, err := decodeTable(data)
+		if err != nil {
+			t.Fatalf("storage %d: %v", storage, err)
+		}
+		if err := tbl.Rows.SetValue(0, "qty", int64(4)); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := tbl.Rows.GetValue(0, "label"); v != "a:6" {
+			t.Fatalf("storage %d: label = %v", storage, v)
+		}
+	}
+}
+
+func TestBinaryDeterministic(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"m"},
+		[]interface{}{map[string]interface{}{"a": 1, "b": "x", "c": []interface{}{map[string]interface{}{"d": true, "e": 2.5}}}},
+		[]interface{}{[]string{"s", "t"}},
+	)
+	row := tbl.Rows.GetRow(0)
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		row[k] = k
+	}
+
+	first, err := encodeTable(tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		data, err := encodeTable(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, first) {
+			t.Fatalf("encoding %d differs", i)
+		}
+	}
+
+	got, err := decodeTable(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(got.Rows.GetRow(1)["m"]); s != "[s t]" {
+		t.Fatalf("registered slice read as %s", s)
+	}
+}
+
+func TestBinaryUnregisteredType(t *testing.T) {
+	type point struct{ X, Y int }
+	tbl := newTestTable(t, RowStorage, []string{"p"}, []interface{}{point{1, 2}})
+	if _, err := encodeTable(tbl); err == nil || !strings.Contains(err.Error(), "point") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,651 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CSVHeader tells whether the first record of a CSV file holds
+// the column names.
+type CSVHeader int
+
+const (
+	// HeaderAuto detects the header when reading: the first record
+	// is a header if all of its fields are unique, non-blank and are
+	// not numbers, booleans or dates. WriteCSV writes a header.
+	HeaderAuto CSVHeader = iota
+
+	// HeaderPresent: the first record is the header.
+	HeaderPresent
+
+	// HeaderNone: there is no header; columns are named by
+	// CSVOptions.Columns, the existing columns of the table, or
+	// col_1, col_2...
+	HeaderNone
+)
+
+// RaggedPolicy tells ReadCSV what to do with records that do not
+// have the same number of fields as there are columns.
+type RaggedPolicy int
+
+const (
+	// RaggedError stops reading with a *CSVError.
+	RaggedError RaggedPolicy = iota
+
+	// RaggedPad fills missing fields with nil and drops extra ones.
+	RaggedPad
+
+	// RaggedSkip leaves out the record.
+	RaggedSkip
+
+	// RaggedExpand fills missing fields with nil and adds columns
+	// (col_N) for extra fields.
+	RaggedExpand
+)
+
+// CSVOptions configures ReadCSV and WriteCSV. The zero value reads
+// and writes RFC 4180 CSV with a header.
+type CSVOptions struct {
+	// Comma is the field delimiter; default ','.
+	Comma rune
+
+	// Quote is the quote character; default '"'. A quote inside a
+	// quoted field is written twice.
+	Quote rune
+
+	// Comment, if set, marks lines that are skipped when reading.
+	Comment rune
+
+	// LazyQuotes accepts quotes in unquoted fields, and a single
+	// quote in a quoted field that is not followed by a delimiter.
+	LazyQuotes bool
+
+	Header CSVHeader
+
+	// Columns are the column names when there is no header (with
+	// HeaderAuto, setting Columns means there is none). When
+	// writing, it selects (and orders) the columns to write.
+	Columns []string
+
+	Ragged RaggedPolicy
+
+	// NullValue is the text of a nil value; unquoted fields equal
+	// to it are read as nil (by default empty fields). A quoted
+	// empty field ("") is an empty string.
+	NullValue string
+
+	// InferTypes sets the column types with ResetColTypes after
+	// reading and converts the values to those types.
+	InferTypes bool
+
+	// TimeLayout is the layout used to write time.Time values;
+	// default time.RFC3339Nano.
+	TimeLayout string
+
+	// UseCRLF ends written records with \r\n instead of \n.
+	UseCRLF bool
+
+	// MaxRows stops reading after that many records (0 for all).
+	MaxRows int
+
+	// BatchSize and OnBatch stream large files: after every
+	// BatchSize records (and once at the end) OnBatch is called
+	// with the table, and the rows are then cleared. With
+	// InferTypes, the types are inferred from the first batch, so
+	// a later value may not fit its column (see Convert).
+	BatchSize int
+	OnBatch   func(tbl *Table) error
+
+	// Convert tells what to do with a value that cannot be
+	// converted to the type of its column. By default
+	// (ConvertError) the read stops with a CSVError giving the
+	// line and field of the value.
+	Convert ConvertPolicy
+}
+
+// CSVError is returned for malformed CSV input; Line and Field
+// are 1-based.
+type CSVError struct {
+	Line  int
+	Field int
+	Msg   string
+}
+
+func (e *CSVError) Error() string {
+	if e.Field > 0 {
+		return fmt.Sprintf("csv: line %d, field %d: %s", e.Line, e.Field, e.Msg)
+	}
+	return fmt.Sprintf("csv: line %d: %s", e.Line, e.Msg)
+}
+
+func (o *CSVOptions) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+	return o.Comma
+}
+
+func (o *CSVOptions) quote() rune {
+	if o.Quote == 0 {
+		return '"'
+	}
+	return o.Quote
+}
+
+func (o *CSVOptions) validate() error {
+	c, q := o.comma(), o.quote()
+	if c == q || c == '\r' || c == '\n' || q == '\r' || q == '\n' ||
+		c == utf8.RuneError || q == utf8.RuneError {
+		return errors.New("invalid delimiter or quote character")
+	}
+	if o.Comment != 0 && (o.Comment == c || o.Comment == q) {
+		return errors.New("comment character must differ from the delimiter and quote")
+	}
+	if o.BatchSize < 0 || o.MaxRows < 0 {
+		return errors.New("BatchSize and MaxRows cannot be negative")
+	}
+	if o.Convert < ConvertError || o.Convert > ConvertKeep {
+		return fmt.Errorf("unknown convert policy %d", o.Convert)
+	}
+	return nil
+}
+
+// csvReader reads one record at a time.
+type csvReader struct {
+	r    *bufio.Reader
+	opts *CSVOptions
+	line int  // current line
+	bom  bool // the start of the input has been checked for a BOM
+}
+
+// readRecord reads the next record; it returns io.EOF at the end.
+// quoted[i] tells whether field i was quoted; line is the line the
+// record starts on.
+func (cr *csvReader) readRecord() (fields []string, quoted []bool, line int, err error) {
+	comma, quote := cr.opts.comma(), cr.opts.quote()
+
+	// skip empty lines and comments
+	for {
+		c, err := cr.next()
+		if err != nil {
+			return nil, nil, cr.line, err
+		}
+		if c == '\n' || c == '\r' {
+			continue
+		}
+		if cr.opts.Comment != 0 && c == cr.opts.Comment {
+			if err := cr.skipLine(); err != nil {
+				return nil, nil, cr.line, err
+			}
+			continue
+		}
+		cr.unread(c)
+		break
+	}
+
+	line = cr.line
+	var field strings.Builder
+
+	for {
+		field.Reset()
+		c, err := cr.next()
+
+		if err == nil && c == quote {
+			// quoted field
+			for {
+				c, err = cr.next()
+				if err == io.EOF {
+					if !cr.opts.LazyQuotes {
+						return nil, nil, line, &CSVError{Line: cr.line, Field: len(fields) + 1, Msg: "extraneous or missing quote in quoted field"}
+					}
+					break
+				}
+				if err != nil {
+					return nil, nil, line, err
+				}
+				if c != quote {
+					field.WriteRune(c)
+					continue
+				}
+				c, err = cr.next()
+				if err == nil && c == quote {
+					field.WriteRune(quote)
+					continue
+				}
+				if err != nil || c == comma || c == '\n' || c == '\r' {
+					break
+				}
+				if !cr.opts.LazyQuotes {
+					return nil, nil, line, &CSVError{Line: cr.line, Field: len(fields) + 1, Msg: fmt.Sprintf("extraneous %q in field", quote)}
+				}
+				field.WriteRune(quote)
+				field.WriteRune(c)
+			}
+			fields = append(fields, field.String())
+			quoted = append(quoted, true)
+		} else {
+			// unquoted field
+			for err == nil && c != comma && c != '\n' && c != '\r' {
+				if c == quote && !cr.opts.LazyQuotes {
+					return nil, nil, line, &CSVError{Line: cr.line, Field: len(fields) + 1, Msg: fmt.Sprintf("bare %q in non-quoted field", quote)}
+				}
+				field.WriteRune(c)
+				c, err = cr.next()
+			}
+			fields = append(fields, field.String())
+			quoted = append(quoted, false)
+		}
+
+		switch {
+		case err == io.EOF:
+			return fields, quoted, line, nil
+		case err != nil:
+			return nil, nil, line, err
+		case c == '\r':
+			// \r\n or a lone \r end the record
+			if n, err := cr.next(); err == nil && n != '\n' {
+				cr.unread(n)
+			}
+			return fields, quoted, line, nil
+		case c == '\n':
+			return fields, quoted, line, nil
+		}
+	}
+}
+
+// next reads one rune, counting lines and dropping a leading BOM.
+func (cr *csvReader) next() (rune, error) {
+	c, _, err := cr.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if !cr.bom {
+		cr.bom = true
+		if c == '\uFEFF' {
+			return cr.next()
+		}
+	}
+	if c == '\n' {
+		cr.line++
+	}
+	return c, nil
+}
+
+// unread puts back the rune that was just read.
+func (cr *csvReader) unread(c rune) {
+	cr.r.UnreadRune()
+	if c == '\n' {
+		cr.line--
+	}
+}
+
+func (cr *csvReader) skipLine() error {
+	for {
+		c, err := cr.next()
+		if err != nil {
+			return err
+		}
+		if c == '\n' {
+			return nil
+		}
+	}
+}
+
+// ReadCSV reads CSV data from r into the table, one record at a
+// time. Columns are created from the header (or named by opts);
+// when the table already has columns, header fields are matched to
+// them by name and fields without a header by position. Values are
+// stored as strings, unless the column has a type (see
+// CSVOptions.InferTypes) in which case they are converted.
+func (t *Table) ReadCSV(r io.Reader, opts CSVOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	cr := &csvReader{r: bufio.NewReaderSize(r, 64*1024), opts: &opts, line: 1}
+
+	// fieldCols maps the field positions to column names.
+	var fieldCols []string
+	addColumn := func(name string) {
+		name = t.Cols.Add(name).Name
+		// existing rows get the new column
+		for i := 0; i < t.Rows.Count(); i++ {
+			t.Rows.SetValue(i, name, nil)
+		}
+		fieldCols = append(fieldCols, name)
+	}
+	uniqueName := func(name string) string {
+		name = t.Cols.NamePolicy().name(name)
+		if name == "" {
+			name = fmt.Sprintf("col_%d", len(fieldCols)+1)
+		}
+		base := name
+		for n := 2; t.Cols.Exists(name) || strings.EqualFold(name, row_id); n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		return name
+	}
+
+	first, firstQuoted, firstLine, err := cr.readRecord()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	hasHeader := opts.Header == HeaderPresent ||
+		(opts.Header == HeaderAuto && len(opts.Columns) == 0 && looksLikeHeader(first))
+
+	cols := t.Cols.Get()
+	switch {
+	case hasHeader:
+		for i := 0; i < len(first); i++ {
+			name := strings.TrimSpace(first[i])
+			if col, ok := t.Cols.Lookup(name); ok && name != "" && !containsString(fieldCols, col.Name) {
+				fieldCols = append(fieldCols, col.Name)
+				continue
+			}
+			addColumn(uniqueName(name))
+		}
+	case len(opts.Columns) > 0:
+		for i := 0; i < len(opts.Columns); i++ {
+			if col, ok := t.Cols.Lookup(opts.Columns[i]); ok {
+				fieldCols = append(fieldCols, col.Name)
+				continue
+			}
+			addColumn(uniqueName(opts.Columns[i]))
+		}
+	case len(cols) > 0:
+		for i := 0; i < len(cols); i++ {
+			fieldCols = append(fieldCols, cols[i].Name)
+		}
+	default:
+		for i := 0; i < len(first); i++ {
+			addColumn(uniqueName(""))
+		}
+	}
+
+	startRow := t.Rows.Count()
+	inferred := false
+	count := 0
+
+	// the line of each row from startRow on
+	var lines []int
+
+	flush := func() error {
+		if opts.InferTypes && !inferred {
+			t.Cols.ResetColTypes()
+			inferred = true
+		}
+		if err := convertColumnValues(t, fieldCols, startRow, lines, opts.Convert); err != nil {
+			return err
+		}
+		if opts.OnBatch == nil {
+			return nil
+		}
+		if err := opts.OnBatch(t); err != nil {
+			return err
+		}
+		t.Rows.Clear()
+		startRow = 0
+		lines = lines[:0]
+		return nil
+	}
+
+	insert := func(fields []string, quoted []bool, line int) error {
+		if len(fields) != len(fieldCols) {
+			switch opts.Ragged {
+			case RaggedSkip:
+				return nil
+			case RaggedExpand:
+				for len(fieldCols) < len(fields) {
+					addColumn(uniqueName(""))
+				}
+			case RaggedPad:
+			default:
+				return &CSVError{Line: line, Msg: fmt.Sprintf("wrong number of fields: have %d, want %d", len(fields), len(fieldCols))}
+			}
+		}
+
+		row := t.Rows.New()
+		for i := 0; i < len(fields) && i < len(fieldCols); i++ {
+			if !quoted[i] && fields[i] == opts.NullValue {
+				continue
+			}
+			row[fieldCols[i]] = fields[i]
+		}
+		lines = append(lines, line)
+
+		count++
+		if opts.BatchSize > 0 && opts.OnBatch != nil && count%opts.BatchSize == 0 {
+			return flush()
+		}
+		return nil
+	}
+
+	if !hasHeader {
+		if err := insert(first, firstQuoted, firstLine); err != nil {
+			return err
+		}
+	}
+
+	for opts.MaxRows == 0 || count < opts.MaxRows {
+		fields, quoted, line, err := cr.readRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := insert(fields, quoted, line); err != nil {
+			return err
+		}
+	}
+
+	if opts.OnBatch != nil && t.Rows.Count() == 0 {
+		return nil
+	}
+	return flush()
+}
+
+// looksLikeHeader reports whether a record looks like a header.
+func looksLikeHeader(fields []string) bool {
+	seen := make(map[string]bool, len(fields))
+	for i := 0; i < len(fields); i++ {
+		s := strings.ToLower(strings.TrimSpace(fields[i]))
+		if s == "" || seen[s] {
+			return false
+		}
+		seen[s] = true
+		if _, ok := toNumber(s); ok {
+			return false
+		}
+		if s == "true" || s == "false" {
+			return false
+		}
+		if _, ok := parseTime(s); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// convertColumnValues converts the values of cols, from row start
+// on, to the types of the columns; lines are the input lines of
+// those rows, and policy tells what to do with a value that does
+// not convert.
+func convertColumnValues(t *Table, cols []string, start int, lines []int, policy ConvertPolicy) error {
+	all := t.Cols.Get()
+	rows := t.Rows.GetRows()
+
+	for f, name := range cols {
+		j := indexOfColumn(all, name)
+		if j < 0 {
+			continue
+		}
+		typ := normalizeColType(all[j].Type)
+		switch typ {
+		case ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+		default:
+			continue
+		}
+		for i := start; i < len(rows); i++ {
+			s, ok := rows[i][name].(string)
+			if !ok {
+				continue
+			}
+			v, err := castValue(s, typ)
+			if err != nil {
+				switch policy {
+				case ConvertNull:
+					v = nil
+				case ConvertKeep:
+					continue
+				default:
+					return &CSVError{Line: lines[i-start], Field: f + 1, Msg: fmt.Sprintf("column %s: %v", name, err)}
+				}
+			}
+			t.Rows.SetValue(i, name, v)
+		}
+	}
+	return nil
+}
+
+func containsString(a []string, s string) bool {
+	for i := 0; i < len(a); i++ {
+		if a[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCSV writes the table as CSV to w, one row at a time. nil is
+// written as opts.NullValue and time.Time with opts.TimeLayout.
+func (t *Table) WriteCSV(w io.Writer, opts CSVOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	cols := t.Cols.Get()
+	var names []string
+	if len(opts.Columns) > 0 {
+		for i := 0; i < len(opts.Columns); i++ {
+			col, ok := t.Cols.Lookup(opts.Columns[i])
+			if !ok {
+				return fmt.Errorf("column not found: %s", opts.Columns[i])
+			}
+			names = append(names, col.Name)
+		}
+	} else {
+		for i := 0; i < len(cols); i++ {
+			names = append(names, cols[i].Name)
+		}
+	}
+
+	layout := opts.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	eol := "\n"
+	if opts.UseCRLF {
+		eol = "\r\n"
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	record := make([]string, len(names))
+	isNil := make([]bool, len(names))
+
+	if opts.Header != HeaderNone {
+		copy(record, names)
+		if err := writeCSVRecord(bw, record, isNil, &opts, eol); err != nil {
+			return err
+		}
+	}
+
+	rows := t.Rows.GetRows()
+	for i := 0; i < len(rows); i++ {
+		for j := 0; j < len(names); j++ {
+			v := rows[i][names[j]]
+			isNil[j] = isNull(v)
+			switch x := v.(type) {
+			case time.Time:
+				record[j] = x.Format(layout)
+			case *time.Time:
+				if x != nil {
+					record[j] = x.Format(layout)
+				}
+			default:
+				record[j] = toString(v)
+			}
+			if isNil[j] {
+				record[j] = opts.NullValue
+			}
+		}
+		if err := writeCSVRecord(bw, record, isNil, &opts, eol); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeCSVRecord writes one record; fields are quoted when needed,
+// and non-nil values that would read back as nil are quoted too.
+func writeCSVRecord(w *bufio.Writer, record []string, isNil []bool, opts *CSVOptions, eol string) error {
+	comma, quote := opts.comma(), opts.quote()
+
+	for i := 0; i < len(record); i++ {
+		if i > 0 {
+			w.WriteRune(comma)
+		}
+		f := record[i]
+
+		needQuotes := strings.ContainsRune(f, comma) || strings.ContainsRune(f, quote) ||
+			strings.ContainsAny(f, "\r\n") ||
+			(i == 0 && opts.Comment != 0 && strings.HasPrefix(f, string(opts.Comment))) ||
+			(!isNil[i] && f == opts.NullValue)
+
+		if !needQuotes {
+			if _, err := w.WriteString(f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		w.WriteRune(quote)
+		for _, c := range f {
+			if c == quote {
+				w.WriteRune(quote)
+			}
+			w.WriteRune(c)
+		}
+		if _, err := w.WriteRune(quote); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.WriteString(eol)
+	return err
+}
@@ -0,0 +1,208 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// With batches, the types come from the first batch; a later value
+// that does not fit is reported by its line, or handled by Convert.
+func TestReadCSVBatchConvert(t *testing.T) {
+	const input = "a,b\n1,x\n2,y\n3,z\nx,w\n"
+
+	read := func(policy ConvertPolicy) (string, error) {
+		tbl, _ := (&Table{}).Create("t")
+		var got []string
+		err := tbl.ReadCSV(strings.NewReader(input), CSVOptions{
+			InferTypes: true,
+			BatchSize:  2,
+			Convert:    policy,
+			OnBatch: func(b *Table) error {
+				got = append(got, fmt.Sprint(b.Cols.GetData("a")))
+				return nil
+			},
+		})
+		return strings.Join(got, " "), err
+	}
+
+	got, err := read(ConvertError)
+	cerr, ok := err.(*CSVError)
+	if !ok || cerr.Line != 5 || cerr.Field != 1 {
+		t.Fatalf("got %v (%T)", err, err)
+	}
+	if got != "[1 2]" {
+		t.Fatalf("batches before the error: %s", got)
+	}
+
+	if got, err = read(ConvertNull); err != nil || got != "[1 2] [3 <nil>]" {
+		t.Fatalf("ConvertNull: %s, %v", got, err)
+	}
+	if got, err = read(ConvertKeep); err != nil || got != "[1 2] [3 x]" {
+		t.Fatalf("ConvertKeep: %s, %v", got, err)
+	}
+
+	tbl, _ := (&Table{}).Create("t")
+	if err := tbl.ReadCSV(strings.NewReader(input), CSVOptions{Convert: ConvertPolicy(9)}); err == nil {
+		t.Fatal("unknown policy: no error")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	const input = "\uFEFFname,age,joined\r\n" +
+		"\"Smith, J\",42,2020-01-02 10:00:00\n" +
+		"# a comment\n" +
+		"\n" +
+		"\"say \"\"hi\"\"\",,2021-03-04 10:00:00\n" +
+		"\"\",7,\n"
+
+	tbl, _ := (&Table{}).Create("t")
+	if err := tbl.ReadCSV(strings.NewReader(input), CSVOptions{InferTypes: true, Comment: '#'}); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, c := range tbl.Cols.Get() {
+		types = append(types, c.Name+":"+c.Type)
+	}
+	if got := fmt.Sprint(types); got != "[name:String age:Integer joined:DateTime]" {
+		t.Fatalf("columns %s", got)
+	}
+
+	rows := tbl.Rows.GetRows()
+	if len(rows) != 3 {
+		t.Fatalf("%d rows", len(rows))
+	}
+	if rows[0]["name"] != "Smith, J" || rows[1]["name"] != `say "hi"` || rows[2]["name"] != "" {
+		t.Fatalf("names %v", tbl.Cols.GetData("name"))
+	}
+	if rows[0]["age"] != int64(42) || rows[1]["age"] != nil {
+		t.Fatalf("ages %v", tbl.Cols.GetData("age"))
+	}
+	if at, ok := rows[1]["joined"].(time.Time); !ok || at.Year() != 2021 || rows[2]["joined"] != nil {
+		t.Fatalf("joined %v", tbl.Cols.GetData("joined"))
+	}
+}
+
+func TestReadCSVHeaderAndOptions(t *testing.T) {
+	read := func(input string, opts CSVOptions) *Table {
+		t.Helper()
+		tbl, _ := (&Table{}).Create("t")
+		if err := tbl.ReadCSV(strings.NewReader(input), opts); err != nil {
+			t.Fatal(err)
+		}
+		return tbl
+	}
+	names := func(tbl *Table) string {
+		var s []string
+		for _, c := range tbl.Cols.Get() {
+			s = append(s, c.Name)
+		}
+		return strings.Join(s, ",")
+	}
+
+	// a first record of numbers is not a header
+	tbl := read("1,2\n3,4\n", CSVOptions{})
+	if got := names(tbl); got != "col_1,col_2" || tbl.Rows.Count() != 2 {
+		t.Fatalf("auto: %s, %d rows", got, tbl.Rows.Count())
+	}
+	tbl = read("a,b\n3,4\n", CSVOptions{Header: HeaderNone, Columns: []string{"x", "y"}})
+	if got := names(tbl); got != "x,y" || tbl.Rows.Count() != 2 {
+		t.Fatalf("none: %s, %d rows", got, tbl.Rows.Count())
+	}
+
+	tbl = read("1;'a;b'\n2;'it''s'\n3;NA\n", CSVOptions{Comma: ';', Quote: '\'', NullValue: "NA", Columns: []string{"n", "s"}})
+	if got := fmt.Sprint(tableValues(tbl)); got != "[[1 a;b] [2 it's] [3 <nil>]]" {
+		t.Fatalf("options: %s", got)
+	}
+
+	tbl = read("a\n1\n2\n3\n", CSVOptions{MaxRows: 2})
+	if tbl.Rows.Count() != 2 {
+		t.Fatalf("MaxRows: %d rows", tbl.Rows.Count())
+	}
+}
+
+func TestReadCSVRagged(t *testing.T) {
+	const input = "a,b\n1\n1,2,3\n4,5\n"
+
+	tbl, _ := (&Table{}).Create("t")
+	err := tbl.ReadCSV(strings.NewReader(input), CSVOptions{})
+	if cerr, ok := err.(*CSVError); !ok || cerr.Line != 2 {
+		t.Fatalf("RaggedError: %v", err)
+	}
+
+	for policy, want := range map[RaggedPolicy]string{
+		RaggedPad:    "[[1 <nil>] [1 2] [4 5]]",
+		RaggedSkip:   "[[4 5]]",
+		RaggedExpand: "[[1 <nil> <nil>] [1 2 3] [4 5 <nil>]]",
+	} {
+		tbl, _ := (&Table{}).Create("t")
+		if err := tbl.ReadCSV(strings.NewReader(input), CSVOptions{Ragged: policy}); err != nil {
+			t.Fatalf("policy %d: %v", policy, err)
+		}
+		if got := fmt.Sprint(tableValues(tbl)); got != want {
+			t.Fatalf("policy %d: %s", policy, got)
+		}
+	}
+}
+
+func TestReadCSVErrorLine(t *testing.T) {
+	// the quoted field spans lines 2 and 3; the bad quote is on 4
+	tbl, _ := (&Table{}).Create("t")
+	err := tbl.ReadCSV(strings.NewReader("a,b\n1,\"x\ny\"\n3,4\"\n"), CSVOptions{})
+	if cerr, ok := err.(*CSVError); !ok || cerr.Line != 4 {
+		t.Fatalf("got %v", err)
+	}
+
+	tbl, _ = (&Table{}).Create("t")
+	if err := tbl.ReadCSV(strings.NewReader("a,b\n1,\"x\ny\"\n3,4\"\n"), CSVOptions{LazyQuotes: true}); err != nil {
+		t.Fatalf("LazyQuotes: %v", err)
+	}
+}
+
+func TestWriteCSVRoundTrip(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.SetColumns([]Column{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	for _, r := range [][]interface{}{
+		{"x,y", nil, at},
+		{"", 1.5, at},
+		{"line\nbreak", true, nil},
+	} {
+		row := tbl.Rows.New()
+		row["a"], row["b"], row["c"] = r[0], r[1], r[2]
+	}
+
+	var buf bytes.Buffer
+	if err := tbl.WriteCSV(&buf, CSVOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "a,b,c\n" +
+		"\"x,y\",,2020-01-02T03:04:05Z\n" +
+		"\"\",1.5,2020-01-02T03:04:05Z\n" +
+		"\"line\nbreak\",true,\n"
+	if buf.String() != want {
+		t.Fatalf("written:\n%s", buf.String())
+	}
+
+	back, _ := (&Table{}).Create("t")
+	if err := back.ReadCSV(&buf, CSVOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tableValues(back)); got != "[[x,y <nil> 2020-01-02T03:04:05Z] [ 1.5 2020-01-02T03:04:05Z] [line\nbreak true <nil>]]" {
+		t.Fatalf("read back %q", got)
+	}
+
+	// with a NullValue, an empty string needs no quotes
+	buf.Reset()
+	err := tbl.WriteCSV(&buf, CSVOptions{Columns: []string{"c", "a"}, NullValue: "NULL", UseCRLF: true, TimeLayout: "2006-01-02", Header: HeaderNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2020-01-02,\"x,y\"\r\n2020-01-02,\r\nNULL,\"line\nbreak\"\r\n"; buf.String() != want {
+		t.Fatalf("written with options: %q", buf.String())
+	}
+}
@@ -0,0 +1,302 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Aggregate describes an aggregate function applied to a column of
+// each group; it is created by Count, Sum, Avg, Min, Max,
+// CountDistinct, StdDev or Percentile.
+type Aggregate struct {
+	// Func is the aggregate function (count, sum, avg, min, max,
+	// count_distinct, stddev, percentile).
+	Func string
+
+	// Col is the column the function reads; it is blank for Count().
+	Col string
+
+	// Name is the name of the result column; a name is derived
+	// from Func and Col when it is blank.
+	Name string
+
+	// P is the percentile (0..1) for Percentile.
+	P float64
+}
+
+// Grouping is a table whose rows are grouped by one or more
+// columns; call Agg to compute the result.
+type Grouping struct {
+	tbl  *Table
+	cols []string
+}
+
+// Count counts the rows of each group.
+func Count() Aggregate {
+	return Aggregate{Func: "count"}
+}
+
+// CountOf counts the non-NULL values of a column.
+func CountOf(col string) Aggregate {
+	return Aggregate{Func: "count", Col: col}
+}
+
+// CountDistinct counts the distinct non-NULL values of a column.
+func CountDistinct(col string) Aggregate {
+	return Aggregate{Func: "count_distinct", Col: col}
+}
+
+// Sum adds up the values of a column; the result is an integer
+// unless a float value is found.
+func Sum(col string) Aggregate {
+	return Aggregate{Func: "sum", Col: col}
+}
+
+// Avg computes the mean of a column.
+func Avg(col string) Aggregate {
+	return Aggregate{Func: "avg", Col: col}
+}
+
+// Min gets the smallest value of a column.
+func Min(col string) Aggregate {
+	return Aggregate{Func: "min", Col: col}
+}
+
+// Max gets the largest value of a column.
+func Max(col string) Aggregate {
+	return Aggregate{Func: "max", Col: col}
+}
+
+// StdDev computes the sample standard deviation of a column.
+func StdDev(col string) Aggregate {
+	return Aggregate{Func: "stddev", Col: col}
+}
+
+// Percentile computes the p-th percentile (0 <= p <= 1) of a
+// column, e.g. 0.5 for the median.
+func Percentile(col string, p float64) Aggregate {
+	return Aggregate{Func: "percentile", Col: col, P: p}
+}
+
+// As sets the name of the result column.
+func (a Aggregate) As(name string) Aggregate {
+	a.Name = name
+	return a
+}
+
+// resultName is the name of the result column of an aggregate.
+func (a Aggregate) resultName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if a.Col == "" {
+		return a.Func
+	}
+	if a.Func == "percentile" {
+		return fmt.Sprintf("p%s_%s", strconv.FormatFloat(a.P*100, 'f', -1, 64), a.Col)
+	}
+	return fmt.Sprintf("%s_%s", a.Func, a.Col)
+}
+
+// newState creates the accumulator of an aggregate.
+func (a Aggregate) newState() (aggState, error) {
+	switch strings.ToLower(a.Func) {
+	case "count":
+		if a.Col == "" {
+			return &aggCountStar{}, nil
+		}
+		return &aggCount{}, nil
+	case "count_distinct":
+		return newAggState("count", true)
+	case "percentile":
+		if a.P < 0 || a.P > 1 {
+			return nil, fmt.Errorf("percentile must be between 0 and 1; have %v", a.P)
+		}
+		return &aggPercentile{p: a.P}, nil
+	}
+	return newAggState(a.Func, false)
+}
+
+// GroupBy groups the rows of the table by the values of cols. Rows
+// with NULL in a grouping column form their own group.
+func (t *Table) GroupBy(cols ...string) *Grouping {
+	return &Grouping{tbl: t, cols: cols}
+}
+
+// Agg computes the aggregates for each group and returns a new table
+// with the grouping columns followed by one column per aggregate.
+// Groups are in order of their first row. Without grouping columns
+// the whole table is one group.
+func (g *Grouping) Agg(aggs ...Aggregate) (*Table, error) {
+
+	if g.tbl == nil || g.tbl.Cols == nil || g.tbl.Rows == nil {
+		return nil, errors.New("table is not initialized")
+	}
+	if len(aggs) == 0 {
+		return nil, errors.New("no aggregates specified")
+	}
+
+	srcCols := g.tbl.Cols.Get()
+
+	// Resolve the columns.
+	var outCols []Column
+	keyCols := make([]string, len(g.cols))
+	for i := 0; i < len(g.cols); i++ {
+		j := indexOfColumn(srcCols, g.cols[i])
+		if j < 0 {
+			return nil, fmt.Errorf("column not found: %s", g.cols[i])
+		}
+		keyCols[i] = srcCols[j].Name
+		outCols = append(outCols, srcCols[j])
+	}
+
+	aggCols := make([]string, len(aggs))
+	for i := 0; i < len(aggs); i++ {
+		if aggs[i].Col == "" {
+			if aggs[i].Func != "count" {
+				return nil, fmt.Errorf("%s requires a column", aggs[i].Func)
+			}
+		} else {
+			j := indexOfColumn(srcCols, aggs[i].Col)
+			if j < 0 {
+				return nil, fmt.Errorf("column not found: %s", aggs[i].Col)
+			}
+			aggCols[i] = srcCols[j].Name
+		}
+		if _, err := aggs[i].newState(); err != nil {
+			return nil, err
+		}
+		outCols = append(outCols, Column{Name: aggs[i].resultName()})
+	}
+	for i := 0; i < len(outCols); i++ {
+		for j := 0; j < i; j++ {
+			if strings.EqualFold(outCols[i].Name, outCols[j].Name) {
+				return nil, fmt.Errorf("duplicate result column: %s", outCols[i].Name)
+			}
+		}
+	}
+
+	// Group the rows.
+	type group struct {
+		key    []interface{}
+		states []aggState
+	}
+	var groups []*group
+	index := make(map[string]*group)
+
+	newGroup := func(key []interface{}) *group {
+		grp := &group{key: key}
+		for i := 0; i < len(aggs); i++ {
+			st, _ := aggs[i].newState()
+			grp.states = append(grp.states, st)
+		}
+		groups = append(groups, grp)
+		return grp
+	}
+
+	rows := g.tbl.Rows.GetRows()
+	for i := 0; i < len(rows); i++ {
+		key := make([]interface{}, len(keyCols))
+		for j := 0; j < len(keyCols); j++ {
+			key[j] = rows[i][keyCols[j]]
+		}
+		k := valuesKey(key)
+
+		grp := index[k]
+		if grp == nil {
+			grp = newGroup(key)
+			index[k] = grp
+		}
+
+		for j := 0; j < len(aggs); j++ {
+			var v interface{}
+			if aggCols[j] != "" {
+				v = rows[i][aggCols[j]]
+			}
+			if err := grp.states[j].add(v); err != nil {
+				return nil, fmt.Errorf("%s: %v", aggs[j].resultName(), err)
+			}
+		}
+	}
+
+	if len(groups) == 0 && len(keyCols) == 0 {
+		newGroup(nil)
+	}
+
+	// Build the result.
+	var outRows [][]interface{}
+	for i := 0; i < len(groups); i++ {
+		vals := append([]interface{}{}, groups[i].key...)
+		for j := 0; j < len(aggs); j++ {
+			vals = append(vals, groups[i].states[j].result())
+		}
+		outRows = append(outRows, vals)
+	}
+
+	for j := 0; j < len(aggs); j++ {
+		srcType := ""
+		if aggCols[j] != "" {
+			srcType = srcCols[indexOfColumn(srcCols, aggCols[j])].Type
+		}
+		c := len(keyCols) + j
+		outCols[c].Type = aggColType(aggs[j], srcType, outRows, c)
+	}
+
+	tbl, err := (&Table{}).Create(g.tbl.Name)
+	if err != nil {
+		return nil, err
+	}
+	return fillTable(tbl, outCols, outRows), nil
+}
+
+// aggColType determines the type of the result column c of an
+// aggregate. Sums are integers unless any value is a float, in
+// which case all values of the column are made floats.
+func aggColType(a Aggregate, srcType string, rows [][]interface{}, c int) string {
+	switch a.Func {
+	case "count", "count_distinct":
+		return ColTypeInteger
+	case "avg", "stddev", "percentile":
+		return ColTypeFloat
+	case "min", "max":
+		return srcType
+	}
+
+	typ := ColTypeInteger
+	if normalizeColType(srcType) == ColTypeFloat {
+		typ = ColTypeFloat
+	}
+	for i := 0; i < len(rows); i++ {
+		if _, ok := rows[i][c].(float64); ok {
+			typ = ColTypeFloat
+			break
+		}
+	}
+	if typ == ColTypeFloat {
+		for i := 0; i < len(rows); i++ {
+			if n, ok := rows[i][c].(int64); ok {
+				rows[i][c] = float64(n)
+			}
+		}
+	}
+
+	return typ
+}
+
+// fillTable sets the columns of an empty table and adds one row
+// per values-slice (in column order).
+func fillTable(tbl *Table, cols []Column, vals [][]interface{}) *Table {
+	tbl.Cols.SetColumns(cols)
+
+	for i := 0; i < len(vals); i++ {
+		row := tbl.Rows.New()
+		for j := 0; j < len(cols); j++ {
+			row[cols[j].Name] = vals[i][j]
+		}
+	}
+
+	return tbl
+}
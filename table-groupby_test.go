@@ -0,0 +1,132 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func salesTable(t *testing.T) *Table {
+	tbl, err := (&Table{}).Create("sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl.Cols.SetColumns([]Column{
+		{Name: "region", Type: ColTypeString},
+		{Name: "qty", Type: ColTypeInteger},
+		{Name: "amount", Type: ColTypeFloat},
+	})
+	for _, r := range [][]interface{}{
+		{"east", int64(1), 10.0},
+		{"west", int64(2), 5.5},
+		{"east", int64(3), nil},
+		{nil, int64(4), 1.0},
+		{"east", nil, 20.0},
+		{"west", int64(2), 4.5},
+	} {
+		row := tbl.Rows.New()
+		row["region"], row["qty"], row["amount"] = r[0], r[1], r[2]
+	}
+	return tbl
+}
+
+func TestGroupByAgg(t *testing.T) {
+	res, err := salesTable(t).GroupBy("region").Agg(
+		Count(), CountOf("qty"), CountDistinct("qty"), Sum("qty"), Sum("amount"),
+		Avg("amount"), Min("qty"), Max("amount").As("top"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, c := range res.Cols.Get() {
+		names = append(names, c.Name+":"+c.Type)
+	}
+	want := "[region:String count:Integer count_qty:Integer count_distinct_qty:Integer sum_qty:Integer sum_amount:Float avg_amount:Float min_qty:Integer top:Float]"
+	if got := fmt.Sprint(names); got != want {
+		t.Fatalf("columns %s", got)
+	}
+
+	// groups are in order of their first row; NULL is a group
+	want = "[[east 3 2 2 4 30 15 1 20] [west 2 2 1 4 10 5 2 5.5] [<nil> 1 1 1 4 1 1 4 1]]"
+	if got := fmt.Sprint(tableValues(res)); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	if _, ok := res.Rows.GetRow(0)["sum_qty"].(int64); !ok {
+		t.Fatalf("sum of integers is %T", res.Rows.GetRow(0)["sum_qty"])
+	}
+	if _, ok := res.Rows.GetRow(0)["sum_amount"].(float64); !ok {
+		t.Fatalf("sum of floats is %T", res.Rows.GetRow(0)["sum_amount"])
+	}
+}
+
+func TestGroupByStdDevPercentile(t *testing.T) {
+	res, err := salesTable(t).GroupBy().Agg(StdDev("qty"), Percentile("qty", 0.5), Percentile("amount", 0.25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := res.Rows.GetRow(0)
+	// qty: 1 2 3 4 2 -> mean 2.4
+	if sd := row["stddev_qty"].(float64); math.Abs(sd-math.Sqrt(1.3)) > 1e-9 {
+		t.Fatalf("stddev %v", sd)
+	}
+	if p := row["p50_qty"]; p != 2.0 {
+		t.Fatalf("p50 %v", p)
+	}
+	// amount: 1 4.5 5.5 10 20 -> rank 1
+	if p := row["p25_amount"]; p != 4.5 {
+		t.Fatalf("p25 %v", p)
+	}
+}
+
+func TestGroupByNullsAndEmpty(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.SetColumns([]Column{{Name: "k"}, {Name: "v", Type: ColTypeInteger}})
+
+	// an empty table without grouping columns is one group
+	res, err := tbl.GroupBy().Agg(Count(), Sum("v"), Avg("v"), StdDev("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tableValues(res)); got != "[[0 <nil> <nil> <nil>]]" {
+		t.Fatalf("empty: %s", got)
+	}
+	res, err = tbl.GroupBy("k").Agg(Count())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows.Count() != 0 {
+		t.Fatalf("empty grouped: %d rows", res.Rows.Count())
+	}
+
+	row := tbl.Rows.New()
+	row["k"], row["v"] = "a", nil
+	res, err = tbl.GroupBy("k").Agg(Count(), CountOf("v"), Sum("v"), Min("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tableValues(res)); got != "[[a 1 0 <nil> <nil>]]" {
+		t.Fatalf("nulls: %s", got)
+	}
+}
+
+func TestGroupByErrors(t *testing.T) {
+	tbl := salesTable(t)
+	for _, c := range []struct {
+		g    *Grouping
+		aggs []Aggregate
+	}{
+		{tbl.GroupBy("nope"), []Aggregate{Count()}},
+		{tbl.GroupBy("region"), nil},
+		{tbl.GroupBy("region"), []Aggregate{Sum("nope")}},
+		{tbl.GroupBy("region"), []Aggregate{Sum("region")}},
+		{tbl.GroupBy("region"), []Aggregate{Percentile("qty", 1.5)}},
+		{tbl.GroupBy("region"), []Aggregate{Count().As("region")}},
+	} {
+		if _, err := c.g.Agg(c.aggs...); err == nil {
+			t.Fatalf("%v %v: no error", c.g.cols, c.aggs)
+		}
+	}
+}
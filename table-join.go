@@ -0,0 +1,343 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//go:generate stringer -type=JoinKind
+
+// JoinKind is the type of a join between two tables.
+type JoinKind int
+
+const (
+	// InnerJoin keeps the pairs of rows that match.
+	InnerJoin JoinKind = iota
+
+	// LeftJoin keeps all left rows; right columns are nil
+	// when there is no match.
+	LeftJoin
+
+	// RightJoin keeps all right rows; left columns are nil
+	// when there is no match.
+	RightJoin
+
+	// FullJoin keeps all rows of both tables.
+	FullJoin
+
+	// CrossJoin pairs every left row with every right row.
+	CrossJoin
+
+	// SemiJoin keeps the left rows that have a match (left
+	// columns only).
+	SemiJoin
+
+	// AntiJoin keeps the left rows that have no match (left
+	// columns only).
+	AntiJoin
+)
+
+// JoinSpec describes how rows of two tables are matched and how
+// the result columns are named.
+type JoinSpec struct {
+	// LeftCols and RightCols are pairs of columns that must be
+	// equal; they are matched with a hash join. NULLs never match.
+	LeftCols  []string
+	RightCols []string
+
+	// On is an optional condition that is checked for each pair
+	// of rows (after the equality columns, if any).
+	On func(left Row, right Row) bool
+
+	// Prefixes/suffixes added to the names of columns that exist
+	// in both tables. When none is set, right columns get the
+	// suffix "_right".
+	LeftPrefix  string
+	LeftSuffix  string
+	RightPrefix string
+	RightSuffix string
+}
+
+// JoinOn creates a JoinSpec on columns that have the same name in
+// both tables. Each such column appears once in the result.
+func JoinOn(cols ...string) JoinSpec {
+	return JoinSpec{LeftCols: cols, RightCols: cols}
+}
+
+// joinSource tells where a result column comes from.
+type joinSource struct {
+	left  string // column in the left table, or ""
+	right string // column in the right table, or ""
+}
+
+// Join combines the rows of two tables into a new table. The left
+// columns come first, followed by the right columns; columns used
+// as equal keys with the same name on both sides are merged into
+// one column (taking the right value for unmatched right rows).
+func Join(left, right *Table, on JoinSpec, kind JoinKind) (*Table, error) {
+
+	if left == nil || right == nil || left.Cols == nil || right.Cols == nil {
+		return nil, errors.New("table is not initialized")
+	}
+	if len(on.LeftCols) != len(on.RightCols) {
+		return nil, errors.New("LeftCols and RightCols must have the same number of columns")
+	}
+	if kind < InnerJoin || kind > AntiJoin {
+		return nil, fmt.Errorf("invalid join kind: %v", kind)
+	}
+	if kind != CrossJoin && len(on.LeftCols) == 0 && on.On == nil {
+		return nil, errors.New("join condition is missing")
+	}
+
+	lCols := left.Cols.Get()
+	rCols := right.Cols.Get()
+
+	lKeys := make([]string, len(on.LeftCols))
+	rKeys := make([]string, len(on.RightCols))
+
+	// key columns with the same name on both sides are merged
+	merged := make(map[string]string)
+	for i := 0; i < len(on.LeftCols); i++ {
+		l := indexOfColumn(lCols, on.LeftCols[i])
+		if l < 0 {
+			return nil, fmt.Errorf("column not found in %s: %s", left.Name, on.LeftCols[i])
+		}
+		r := indexOfColumn(rCols, on.RightCols[i])
+		if r < 0 {
+			return nil, fmt.Errorf("column not found in %s: %s", right.Name, on.RightCols[i])
+		}
+		lKeys[i] = lCols[l].Name
+		rKeys[i] = rCols[r].Name
+		if kind != CrossJoin && strings.EqualFold(lKeys[i], rKeys[i]) {
+			merged[lKeys[i]] = rKeys[i]
+		}
+	}
+
+	cols, srcs, err := joinColumns(lCols, rCols, on, kind, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	lRows := left.Rows.GetRows()
+	rRows := right.Rows.GetRows()
+
+	var out [][]interface{}
+	addPair := func(l, r Row) {
+		vals := make([]interface{}, len(srcs))
+		for j := 0; j < len(srcs); j++ {
+			if srcs[j].left != "" && l != nil {
+				vals[j] = l[srcs[j].left]
+			}
+			if srcs[j].right != "" && r != nil && (l == nil || srcs[j].left == "") {
+				vals[j] = r[srcs[j].right]
+			}
+		}
+		out = append(out, vals)
+	}
+
+	var index map[string][]int
+	if kind != CrossJoin && len(rKeys) > 0 {
+		index = buildHashIndex(rRows, rKeys)
+	}
+
+	rMatched := make([]bool, len(rRows))
+
+	for i := 0; i < len(lRows); i++ {
+		var candidates []int
+
+		switch {
+		case kind == CrossJoin:
+			candidates = allIndexes(len(rRows))
+		case index != nil:
+			k, ok := rowKey(lRows[i], lKeys)
+			if ok {
+				candidates = index[k]
+			}
+		default:
+			candidates = allIndexes(len(rRows))
+		}
+
+		matched := false
+		for _, j := range candidates {
+			if index != nil && !keysEqual(lRows[i], rRows[j], lKeys, rKeys) {
+				continue
+			}
+			if kind != CrossJoin && on.On != nil && !on.On(lRows[i], rRows[j]) {
+				continue
+			}
+			matched = true
+			rMatched[j] = true
+
+			if kind == SemiJoin || kind == AntiJoin {
+				break
+			}
+			addPair(lRows[i], rRows[j])
+		}
+
+		switch {
+		case kind == SemiJoin && matched:
+			addPair(lRows[i], nil)
+		case kind == AntiJoin && !matched:
+			addPair(lRows[i], nil)
+		case !matched && (kind == LeftJoin || kind == FullJoin):
+			addPair(lRows[i], nil)
+		}
+	}
+
+	if kind == RightJoin || kind == FullJoin {
+		for j := 0; j < len(rRows); j++ {
+			if !rMatched[j] {
+				addPair(nil, rRows[j])
+			}
+		}
+	}
+
+	name := left.Name + "_" + right.Name
+	if len(name) > maxTableNameLength {
+		name = left.Name
+	}
+	tbl, err := (&Table{}).Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fillTable(tbl, cols, out), nil
+}
+
+// joinColumns builds the result columns of a join and where each
+// one is read from; merged maps left key columns to the right key
+// columns they are merged with.
+func joinColumns(lCols, rCols []Column, on JoinSpec, kind JoinKind, merged map[string]string) ([]Column, []joinSource, error) {
+	var cols []Column
+	var srcs []joinSource
+
+	leftOnly := kind == SemiJoin || kind == AntiJoin
+
+	rightSuffix := on.RightSuffix
+	if on.LeftPrefix == "" && on.LeftSuffix == "" && on.RightPrefix == "" && on.RightSuffix == "" {
+		rightSuffix = "_right"
+	}
+
+	isMergedRight := func(name string) bool {
+		for _, r := range merged {
+			if r == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(lCols); i++ {
+		c := lCols[i]
+		src := joinSource{left: c.Name}
+
+		if r, ok := merged[c.Name]; ok {
+			src.right = r
+		} else if r := indexOfColumn(rCols, c.Name); !leftOnly && r >= 0 && !isMergedRight(rCols[r].Name) {
+			c.Name = on.LeftPrefix + c.Name + on.LeftSuffix
+		}
+		c.Tag = ""
+		cols = append(cols, c)
+		srcs = append(srcs, src)
+	}
+
+	if !leftOnly {
+		for i := 0; i < len(rCols); i++ {
+			c := rCols[i]
+			if isMergedRight(c.Name) {
+				continue
+			}
+			if indexOfColumn(lCols, c.Name) >= 0 {
+				c.Name = on.RightPrefix + c.Name + rightSuffix
+			}
+			c.Tag = ""
+			cols = append(cols, c)
+			srcs = append(srcs, joinSource{right: rCols[i].Name})
+		}
+	}
+
+	for i := 0; i < len(cols); i++ {
+		for j := 0; j < i; j++ {
+			if strings.EqualFold(cols[i].Name, cols[j].Name) {
+				return nil, nil, fmt.Errorf("duplicate column in join result: %s", cols[i].Name)
+			}
+		}
+	}
+
+	return cols, srcs, nil
+}
+
+// keysEqual compares the key columns of two rows.
+func keysEqual(l, r Row, lKeys, rKeys []string) bool {
+	for i := 0; i < len(lKeys); i++ {
+		if compareValues(l[lKeys[i]], r[rKeys[i]]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// buildHashIndex maps the key of each row (by cols) to the indexes
+// of the rows with that key. Rows with a NULL key are left out.
+func buildHashIndex(rows []Row, cols []string) map[string][]int {
+	index := make(map[string][]int, len(rows))
+	for i := 0; i < len(rows); i++ {
+		k, ok := rowKey(rows[i], cols)
+		if !ok {
+			continue
+		}
+		index[k] = append(index[k], i)
+	}
+	return index
+}
+
+// rowKey returns the hash key of the values of cols in a row; the
+// second return value is false if any of the values is NULL.
+func rowKey(row Row, cols []string) (string, bool) {
+	vals := make([]interface{}, len(cols))
+	for i := 0; i < len(cols); i++ {
+		vals[i] = row[cols[i]]
+		if isNull(vals[i]) {
+			return "", false
+		}
+	}
+	return joinKey(vals), true
+}
+
+// joinKey is the hash key of a set of join values. Values that are
+// equal in comparisons get the same key: numeric strings are keyed
+// as numbers so that "7" finds 7, date strings as times, and bools
+// as their text ("true" equals true). Candidates are compared again
+// after the lookup.
+func joinKey(vals []interface{}) string {
+	keyed := make([]interface{}, len(vals))
+	for i := 0; i < len(vals); i++ {
+		keyed[i] = vals[i]
+		switch x := vals[i].(type) {
+		case string:
+			if n, ok := toNumber(x); ok {
+				keyed[i] = n
+			} else if t, ok := parseTime(x); ok {
+				keyed[i] = t
+			}
+		case bool:
+			keyed[i] = toString(x)
+		case *time.Time:
+			if x != nil {
+				keyed[i] = *x
+			}
+		}
+	}
+	return valuesKey(keyed)
+}
+
+func allIndexes(n int) []int {
+	idx := make([]int, n)
+	for i := 0; i < n; i++ {
+		idx[i] = i
+	}
+	return idx
+}
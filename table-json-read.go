@@ -0,0 +1,500 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONReadOptions configures ReadJSON and ReadJSONLines.
+type JSONReadOptions struct {
+	// Separator joins the keys of nested objects into column
+	// names (e.g. "address.city"); default ".".
+	Separator string
+
+	// NoFlatten keeps nested objects as map[string]interface{}
+	// values instead of flattening them into columns.
+	NoFlatten bool
+
+	// KeepStrings leaves date/time strings as strings; by default a
+	// column whose strings all parse as dates becomes DateTime.
+	KeepStrings bool
+
+	// MaxRows stops reading after that many records (0 for all).
+	MaxRows int
+}
+
+// JSONError is returned for malformed JSON input; Line is 1-based.
+type JSONError struct {
+	Line int
+	Msg  string
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("json: line %d: %s", e.Line, e.Msg)
+}
+
+// jsonObject is a decoded JSON object that keeps its key order.
+type jsonObject struct {
+	keys []string
+	vals []interface{}
+}
+
+// ReadJSON reads a JSON array into the table. The elements are
+// either objects, or arrays of values of which the first one holds
+// the column names (as written by WriteJSON with JSONArrays). The
+// columns are the union of all keys in order of appearance; keys
+// that are missing in a record are nil. Values are typed per
+// column: Integer, Float, Bool, DateTime or String.
+func (t *Table) ReadJSON(r io.Reader, opts JSONReadOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	lc := &lineCounter{r: r}
+	dec := json.NewDecoder(lc)
+	dec.UseNumber()
+
+	jr := newJSONRecordReader(t, &opts)
+
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return jsonErrorAt(lc, dec, err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return &JSONError{Line: lc.lineAt(dec.InputOffset()), Msg: "expected an array of records"}
+	}
+
+	for dec.More() {
+		if opts.MaxRows > 0 && jr.count >= opts.MaxRows {
+			break
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return jsonErrorAt(lc, dec, err)
+		}
+		line := lc.lineAt(dec.InputOffset() - 1)
+		v, err := readJSONValueFrom(dec, tok)
+		if err != nil {
+			return jsonErrorAt(lc, dec, err)
+		}
+		if err := jr.add(v); err != nil {
+			return &JSONError{Line: line, Msg: err.Error()}
+		}
+		lc.forget(dec.InputOffset())
+	}
+
+	if opts.MaxRows == 0 || jr.count < opts.MaxRows {
+		if _, err := dec.Token(); err != nil {
+			return jsonErrorAt(lc, dec, err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return &JSONError{Line: lc.lineAt(dec.InputOffset()), Msg: "unexpected data after the array"}
+		}
+	}
+
+	return jr.finish()
+}
+
+// ReadJSONLines reads JSON Lines (NDJSON) into the table: one
+// object (or array, the first one holding the column names) per
+// line. Blank lines are skipped. See ReadJSON for the columns and
+// their types.
+func (t *Table) ReadJSONLines(r io.Reader, opts JSONReadOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	jr := newJSONRecordReader(t, &opts)
+
+	for line := 1; opts.MaxRows == 0 || jr.count < opts.MaxRows; line++ {
+		b, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.UseNumber()
+
+			v, derr := readJSONValue(dec)
+			if derr != nil {
+				return &JSONError{Line: line, Msg: jsonErrorMsg(derr)}
+			}
+			if _, derr := dec.Token(); derr != io.EOF {
+				return &JSONError{Line: line, Msg: "unexpected data after the record"}
+			}
+			if aerr := jr.add(v); aerr != nil {
+				return &JSONError{Line: line, Msg: aerr.Error()}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return jr.finish()
+}
+
+// jsonRecordReader adds decoded records to a table.
+type jsonRecordReader struct {
+	tbl    *Table
+	opts   *JSONReadOptions
+	sep    string
+	start  int      // first row added by this read
+	header []string // column names of array records
+	cols   []string // columns that received values
+	added  map[string]bool
+	count  int
+}
+
+func newJSONRecordReader(t *Table, opts *JSONReadOptions) *jsonRecordReader {
+	sep := opts.Separator
+	if sep == "" {
+		sep = "."
+	}
+	return &jsonRecordReader{tbl: t, opts: opts, sep: sep, start: t.Rows.Count(), added: make(map[string]bool)}
+}
+
+// column returns the name of the table column for a key, adding
+// the column if needed.
+func (jr *jsonRecordReader) column(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("blank key")
+	}
+	if strings.EqualFold(key, row_id) {
+		return "", fmt.Errorf("%s is a reserved column name", key)
+	}
+
+	if col, ok := jr.tbl.Cols.Lookup(key); ok {
+		if !containsString(jr.cols, col.Name) {
+			jr.cols = append(jr.cols, col.Name)
+		}
+		return col.Name, nil
+	}
+	if jr.tbl.Cols.NamePolicy().name(key) == "" {
+		return "", fmt.Errorf("key %q has no %s name", key, jr.tbl.Cols.NamePolicy())
+	}
+
+	name := jr.tbl.Cols.Add(key).Name
+	jr.added[name] = true
+	for i := 0; i < jr.tbl.Rows.Count(); i++ {
+		jr.tbl.Rows.SetValue(i, name, nil)
+	}
+	jr.cols = append(jr.cols, name)
+
+	return name, nil
+}
+
+// add adds one record: an object, or an array of values (the first
+// array is the header).
+func (jr *jsonRecordReader) add(v interface{}) error {
+	switch x := v.(type) {
+	case *jsonObject:
+		flat := &jsonObject{}
+		jr.flatten("", x, flat)
+
+		names := make([]string, len(flat.keys))
+		for i := 0; i < len(flat.keys); i++ {
+			name, err := jr.column(flat.keys[i])
+			if err != nil {
+				return err
+			}
+			names[i] = name
+		}
+		row := jr.tbl.Rows.New()
+		for i := 0; i < len(names); i++ {
+			row[names[i]] = flat.vals[i]
+		}
+
+	case []interface{}:
+		if jr.header == nil {
+			for i := 0; i < len(x); i++ {
+				s, ok := x[i].(string)
+				if !ok {
+					return errors.New("the first array must hold the column names")
+				}
+				name, err := jr.column(s)
+				if err != nil {
+					return err
+				}
+				jr.header = append(jr.header, name)
+			}
+			return nil
+		}
+		if len(x) != len(jr.header) {
+			return fmt.Errorf("wrong number of values: have %d, want %d", len(x), len(jr.header))
+		}
+		row := jr.tbl.Rows.New()
+		for i := 0; i < len(x); i++ {
+			row[jr.header[i]] = plainJSONValue(x[i])
+		}
+
+	default:
+		return errors.New("a record must be an object or an array")
+	}
+
+	jr.count++
+	return nil
+}
+
+// flatten copies the members of obj to flat; nested objects become
+// prefixed keys (unless NoFlatten is set).
+func (jr *jsonRecordReader) flatten(prefix string, obj *jsonObject, flat *jsonObject) {
+	for i := 0; i < len(obj.keys); i++ {
+		key := obj.keys[i]
+		if prefix != "" {
+			key = prefix + jr.sep + key
+		}
+		if nested, ok := obj.vals[i].(*jsonObject); ok && !jr.opts.NoFlatten {
+			if len(nested.keys) == 0 {
+				flat.keys = append(flat.keys, key)
+				flat.vals = append(flat.vals, nil)
+				continue
+			}
+			jr.flatten(key, nested, flat)
+			continue
+		}
+		flat.keys = append(flat.keys, key)
+		flat.vals = append(flat.vals, plainJSONValue(obj.vals[i]))
+	}
+}
+
+// finish sets the types of the columns that were read.
+func (jr *jsonRecordReader) finish() error {
+	cols := jr.tbl.Cols.Get()
+	rows := jr.tbl.Rows.GetRows()
+
+	for _, name := range jr.cols {
+		j := indexOfColumn(cols, name)
+
+		// Existing columns keep their type; values are converted
+		// to it, or left as they are for untyped columns.
+		if !jr.added[name] && (jr.start > 0 || normalizeColType(cols[j].Type) != ColTypeString) {
+			typ := normalizeColType(cols[j].Type)
+			switch typ {
+			case ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+				for i := jr.start; i < len(rows); i++ {
+					v, err := castValue(rows[i][name], typ)
+					if err != nil {
+						return fmt.Errorf("column %s, row %d: %v", name, i, err)
+					}
+					jr.tbl.Rows.SetValue(i, name, v)
+				}
+			}
+			continue
+		}
+
+		cols[j].Type = jr.inferType(rows, name)
+	}
+
+	return nil
+}
+
+// inferType determines the type of a column from its values and
+// converts the values to it.
+func (jr *jsonRecordReader) inferType(rows []Row, name string) string {
+	var nInt, nFloat, nBool, nStr, nTime, nOther, n int
+
+	for i := jr.start; i < len(rows); i++ {
+		v := rows[i][name]
+		if isNull(v) {
+			continue
+		}
+		n++
+		switch x := v.(type) {
+		case int64:
+			nInt++
+		case float64:
+			nFloat++
+		case bool:
+			nBool++
+		case time.Time:
+			nTime++
+		case string:
+			nStr++
+			if !jr.opts.KeepStrings {
+				if _, ok := parseTime(x); ok {
+					nTime++
+				}
+			}
+		default:
+			nOther++
+		}
+	}
+
+	typ := ColTypeString
+	switch {
+	case n == 0:
+		return typ
+	case nOther > 0:
+		return "interface {}"
+	case nInt == n:
+		typ = ColTypeInteger
+	case nInt+nFloat == n:
+		typ = ColTypeFloat
+	case nBool == n:
+		typ = ColTypeBool
+	case nTime == n:
+		typ = ColTypeDateTime
+	}
+
+	for i := jr.start; i < len(rows); i++ {
+		if v, err := castValue(rows[i][name], typ); err == nil {
+			jr.tbl.Rows.SetValue(i, name, v)
+		}
+	}
+
+	return typ
+}
+
+// readJSONValue decodes the next value, keeping the key order of
+// objects.
+func readJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return readJSONValueFrom(dec, tok)
+}
+
+// readJSONValueFrom decodes the value that starts with tok.
+func readJSONValueFrom(dec *json.Decoder, tok json.Token) (interface{}, error) {
+	switch x := tok.(type) {
+	case json.Delim:
+		switch x {
+		case '{':
+			obj := &jsonObject{}
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := k.(string)
+				v, err := readJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.keys = append(obj.keys, key)
+				obj.vals = append(obj.vals, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return obj, nil
+
+		case '[':
+			arr := make([]interface{}, 0)
+			for dec.More() {
+				v, err := readJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return arr, nil
+		}
+		return nil, fmt.Errorf("unexpected %v", x)
+
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i, nil
+		}
+		return x.Float64()
+	}
+
+	return tok, nil
+}
+
+// plainJSONValue converts ordered objects (also inside arrays) to
+// map[string]interface{}.
+func plainJSONValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case *jsonObject:
+		m := make(map[string]interface{}, len(x.keys))
+		for i := 0; i < len(x.keys); i++ {
+			m[x.keys[i]] = plainJSONValue(x.vals[i])
+		}
+		return m
+	case []interface{}:
+		for i := 0; i < len(x); i++ {
+			x[i] = plainJSONValue(x[i])
+		}
+	}
+	return v
+}
+
+// jsonErrorAt converts a decoding error to a *JSONError.
+func jsonErrorAt(lc *lineCounter, dec *json.Decoder, err error) error {
+	off := dec.InputOffset()
+	if se, ok := err.(*json.SyntaxError); ok {
+		off = se.Offset
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		off = lc.pos
+	}
+	return &JSONError{Line: lc.lineAt(off), Msg: jsonErrorMsg(err)}
+}
+
+func jsonErrorMsg(err error) string {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "unexpected end of input"
+	}
+	return err.Error()
+}
+
+// lineCounter keeps the offsets of the newlines read from r, so
+// that a byte offset can be turned into a line number. Offsets
+// before the ones that are forgotten are only counted.
+type lineCounter struct {
+	r      io.Reader
+	pos    int64
+	nl     []int64
+	passed int
+}
+
+func (lc *lineCounter) Read(p []byte) (int, error) {
+	n, err := lc.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\n' {
+			lc.nl = append(lc.nl, lc.pos+int64(i))
+		}
+	}
+	lc.pos += int64(n)
+	return n, err
+}
+
+// lineAt returns the line of a byte offset.
+func (lc *lineCounter) lineAt(off int64) int {
+	return lc.passed + sort.Search(len(lc.nl), func(i int) bool { return lc.nl[i] >= off }) + 1
+}
+
+// forget drops the newlines before off.
+func (lc *lineCounter) forget(off int64) {
+	k := sort.Search(len(lc.nl), func(i int) bool { return lc.nl[i] >= off })
+	if k > 0 {
+		lc.passed += k
+		lc.nl = append(lc.nl[:0], lc.nl[k:]...)
+	}
+}
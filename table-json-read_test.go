@@ -0,0 +1,128 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// colTypes returns the names and types of the columns of a table.
+func colTypes(tbl *Table) string {
+	var s []string
+	for _, c := range tbl.Cols.Get() {
+		s = append(s, c.Name+":"+c.Type)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestReadJSON(t *testing.T) {
+	const input = `[
+  {"id": 1, "name": "a", "addr": {"city": "X", "geo": {"lat": 1.5}}, "at": "2020-01-02T03:04:05Z"},
+  {"id": 2, "score": 3, "addr": {"city": "Y"}, "ok": true, "tags": ["p", {"q": 1}]},
+  {"id": 3, "score": 2.5, "at": null, "ok": false}
+]`
+	tbl, _ := (&Table{}).Create("t")
+	if err := tbl.ReadJSON(strings.NewReader(input), JSONReadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the union of the keys, in order of appearance
+	want := "id:Integer name:String addr.city:String addr.geo.lat:Float at:DateTime score:Float ok:Bool tags:interface {}"
+	if got := colTypes(tbl); got != want {
+		t.Fatalf("columns %s", got)
+	}
+
+	rows := tbl.Rows.GetRows()
+	if rows[0]["id"] != int64(1) || rows[1]["score"] != 3.0 || rows[2]["name"] != nil {
+		t.Fatalf("values %v", tableValues(tbl))
+	}
+	if at, ok := rows[0]["at"].(time.Time); !ok || !at.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("at %v (%T)", rows[0]["at"], rows[0]["at"])
+	}
+	if got := fmt.Sprint(rows[1]["tags"]); got != "[p map[q:1]]" {
+		t.Fatalf("tags %s", got)
+	}
+}
+
+func TestReadJSONOptions(t *testing.T) {
+	const input = `[{"a": {"b": 1}, "at": "2020-01-02"}, {"a": {"b": 2}, "at": "2020-01-03"}, {"a": {"b": 3}}]`
+
+	tbl, _ := (&Table{}).Create("t")
+	if err := tbl.ReadJSON(strings.NewReader(input), JSONReadOptions{Separator: "_", KeepStrings: true, MaxRows: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := colTypes(tbl); got != "a_b:Integer at:String" || tbl.Rows.Count() != 2 {
+		t.Fatalf("columns %s, %d rows", got, tbl.Rows.Count())
+	}
+
+	tbl, _ = (&Table{}).Create("t")
+	if err := tbl.ReadJSON(strings.NewReader(input), JSONReadOptions{NoFlatten: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tbl.Cols.GetData("a")); got != "[map[b:1] map[b:2] map[b:3]]" {
+		t.Fatalf("NoFlatten: %s", got)
+	}
+
+	// arrays: the first one holds the column names
+	tbl, _ = (&Table{}).Create("t")
+	if err := tbl.ReadJSON(strings.NewReader(`[["n","s"],[1,"x"],[2.5,null]]`), JSONReadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := colTypes(tbl) + " " + fmt.Sprint(tableValues(tbl)); got != "n:Float s:String [[1 x] [2.5 <nil>]]" {
+		t.Fatalf("arrays: %s", got)
+	}
+}
+
+func TestReadJSONErrorLine(t *testing.T) {
+	for input, line := range map[string]int{
+		"[\n{\"a\":1},\n{\"a\":2,}\n]": 3,
+		"[\n{\"a\":1},\n\n5\n]":        4,
+		"{\"a\":1}":                    1,
+		"[\n{\"a\":1}\n] x":            3,
+	} {
+		tbl, _ := (&Table{}).Create("t")
+		err := tbl.ReadJSON(strings.NewReader(input), JSONReadOptions{})
+		if jerr, ok := err.(*JSONError); !ok || jerr.Line != line {
+			t.Fatalf("%q: got %v, want line %d", input, err, line)
+		}
+	}
+}
+
+func TestReadJSONLines(t *testing.T) {
+	const input = "{\"a\":1}\n\n{\"b\":\"x\",\"a\":2}\r\n{\"a\":3"
+
+	tbl, _ := (&Table{}).Create("t")
+	err := tbl.ReadJSONLines(strings.NewReader(input), JSONReadOptions{})
+	if jerr, ok := err.(*JSONError); !ok || jerr.Line != 4 {
+		t.Fatalf("got %v", err)
+	}
+	tbl, _ = (&Table{}).Create("t")
+	err = tbl.ReadJSONLines(strings.NewReader("{\"a\":1} {\"a\":2}\n"), JSONReadOptions{})
+	if jerr, ok := err.(*JSONError); !ok || jerr.Line != 1 {
+		t.Fatalf("two records on a line: %v", err)
+	}
+
+	tbl, _ = (&Table{}).Create("t")
+	if err := tbl.ReadJSONLines(strings.NewReader(input[:len(input)-6]), JSONReadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := colTypes(tbl) + " " + fmt.Sprint(tableValues(tbl)); got != "a:Integer b:String [[1 <nil>] [2 x]]" {
+		t.Fatalf("got %s", got)
+	}
+
+	// what WriteJSON writes is read back
+	var buf bytes.Buffer
+	if err := tbl.WriteJSON(&buf, JSONOptions{Format: JSONLines}); err != nil {
+		t.Fatal(err)
+	}
+	back, _ := (&Table{}).Create("t")
+	if err := back.ReadJSONLines(&buf, JSONReadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(tableValues(back)), fmt.Sprint(tableValues(tbl)); got != want {
+		t.Fatalf("read back %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,468 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// JSONFormat is the layout of the JSON written by WriteJSON.
+type JSONFormat int
+
+const (
+	// JSONObjects writes an array with one object per row; the
+	// keys are in column order.
+	JSONObjects JSONFormat = iota
+
+	// JSONArrays writes an array of arrays; the first array holds
+	// the column names, followed by one array per row.
+	JSONArrays
+
+	// JSONLines writes one object per line (NDJSON).
+	JSONLines
+)
+
+// JSONOptions configures WriteJSON.
+type JSONOptions struct {
+	Format JSONFormat
+
+	// Indent, if set, is used to indent the rows of JSONObjects
+	// and JSONArrays (e.g. "  ").
+	Indent string
+
+	// Columns selects (and orders) the columns to write; default all.
+	Columns []string
+
+	// IncludeRowID adds the _rowid_ of each row.
+	IncludeRowID bool
+}
+
+// WriteJSON writes the rows of the table to w as JSON, one row at a
+// time. nil is written as null, time.Time in RFC 3339 and NaN or
+// infinite floats as null.
+func (t *Table) WriteJSON(w io.Writer, opts JSONOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if opts.Format < JSONObjects || opts.Format > JSONLines {
+		return fmt.Errorf("invalid JSON format: %d", opts.Format)
+	}
+
+	cols := t.Cols.Get()
+	var names []string
+	if len(opts.Columns) > 0 {
+		for i := 0; i < len(opts.Columns); i++ {
+			col, ok := t.Cols.Lookup(opts.Columns[i])
+			if !ok {
+				return fmt.Errorf("column not found: %s", opts.Columns[i])
+			}
+			names = append(names, col.Name)
+		}
+	} else {
+		for i := 0; i < len(cols); i++ {
+			names = append(names, cols[i].Name)
+		}
+	}
+	if opts.IncludeRowID {
+		names = append([]string{row_id}, names...)
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	var buf bytes.Buffer
+
+	// writeItem writes one element of the outer array.
+	n := 0
+	writeItem := func(b []byte) error {
+		if opts.Format == JSONLines {
+			bw.Write(b)
+			return bw.WriteByte('\n')
+		}
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		n++
+		if opts.Indent == "" {
+			_, err := bw.Write(b)
+			return err
+		}
+		var ib bytes.Buffer
+		if err := json.Indent(&ib, b, opts.Indent, opts.Indent); err != nil {
+			return err
+		}
+		bw.WriteString("\n" + opts.Indent)
+		_, err := bw.Write(ib.Bytes())
+		return err
+	}
+
+	if opts.Format != JSONLines {
+		bw.WriteByte('[')
+	}
+
+	if opts.Format == JSONArrays {
+		b, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		if err := writeItem(b); err != nil {
+			return err
+		}
+	}
+
+	rows := t.Rows.GetRows()
+	for i := 0; i < len(rows); i++ {
+		buf.Reset()
+		var err error
+		if opts.Format == JSONArrays {
+			err = encodeJSONArray(&buf, rows[i], names)
+		} else {
+			err = encodeJSONObject(&buf, rows[i], names)
+		}
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		if err := writeItem(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if opts.Format != JSONLines {
+		if opts.Indent != "" && n > 0 {
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte(']')
+	}
+
+	return bw.Flush()
+}
+
+// encodeJSONObject writes a row as an object with the keys in the
+// order of names.
+func encodeJSONObject(buf *bytes.Buffer, row Row, names []string) error {
+	buf.WriteByte('{')
+	for j := 0; j < len(names); j++ {
+		if j > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(names[j])
+		buf.Write(k)
+		buf.WriteByte(':')
+		if err := encodeJSONValue(buf, row[names[j]]); err != nil {
+			return fmt.Errorf("%s: %v", names[j], err)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeJSONArray writes the values of a row as an array.
+func encodeJSONArray(buf *bytes.Buffer, row Row, names []string) error {
+	buf.WriteByte('[')
+	for j := 0; j < len(names); j++ {
+		if j > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSONValue(buf, row[names[j]]); err != nil {
+			return fmt.Errorf("%s: %v", names[j], err)
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// encodeJSONValue writes one cell value.
+func encodeJSONValue(buf *bytes.Buffer, v interface{}) error {
+	if isNull(v) {
+		buf.WriteString("null")
+		return nil
+	}
+	switch x := v.(type) {
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			buf.WriteString("null")
+			return nil
+		}
+	case float32:
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			buf.WriteString("null")
+			return nil
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// jsonString writes the table with WriteJSON and returns the
+// output; on error the result is empty.
+func jsonString(t *Table, opts JSONOptions) string {
+	var sb strings.Builder
+	if err := t.WriteJSON(&sb, opts); err != nil {
+		return ""
+	}
+	return sb.String()
+}
+
+// tableJSON is the document written by Table.MarshalJSON.
+type tableJSON struct {
+	Name        string          `json:"name"`
+	ColumnNames string          `json:"columnNames,omitempty"`
+	Columns     []columnJSON    `json:"columns"`
+	Rows        [][]interface{} `json:"rows"`
+	Tags        []tagJSON       `json:"tags,omitempty"`
+	SharedData  []sharedJSON    `json:"sharedData,omitempty"`
+}
+
+type tagJSON struct {
+	Row  int         `json:"row"`
+	Name string      `json:"name"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+type sharedJSON struct {
+	TagName string      `json:"tagName"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type columnJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// MarshalJSON encodes the table as an object with its name, its
+// columns (name and type) and its rows as arrays of values:
+//
+//	{"name":"t","columns":[{"name":"id","type":"Integer"}],"rows":[[1]]}
+//
+// A column name policy other than the default is written as
+// "columnNames" (e.g. "snake_case"), the tags of the rows as
+// "tags":[{"row":0,"name":"new","data":...}] and shared data as
+// "sharedData":[{"tagName":"new","data":...}].
+func (t *Table) MarshalJSON() ([]byte, error) {
+
+	if t.Cols == nil || t.Rows == nil {
+		return nil, errors.New("table is not initialized")
+	}
+
+	cols := t.Cols.Get()
+	names := make([]string, len(cols))
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"name":`)
+	b, _ := json.Marshal(t.Name)
+	buf.Write(b)
+	if p := t.Cols.NamePolicy(); p != ColumnNamesCaseInsensitive {
+		buf.WriteString(`,"columnNames":`)
+		b, _ = json.Marshal(p.String())
+		buf.Write(b)
+	}
+	buf.WriteString(`,"columns":[`)
+	for i := 0; i < len(cols); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		names[i] = cols[i].Name
+		b, err := json.Marshal(columnJSON{Name: cols[i].Name, Type: cols[i].Type})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteString(`],"rows":[`)
+
+	rows := t.Rows.GetRows()
+	for i := 0; i < len(rows); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSONArray(&buf, rows[i], names); err != nil {
+			return nil, fmt.Errorf("row %d: %v", i, err)
+		}
+	}
+	buf.WriteByte(']')
+
+	n := 0
+	for i := 0; i < len(rows); i++ {
+		for _, tg := range t.Rows.GetTags(i) {
+			if n == 0 {
+				buf.WriteString(`,"tags":[`)
+			} else {
+				buf.WriteByte(',')
+			}
+			b, err := json.Marshal(tagJSON{Row: i, Name: tg.Name, Data: tg.Data})
+			if err != nil {
+				return nil, fmt.Errorf("row %d, tag %s: %v", i, tg.Name, err)
+			}
+			buf.Write(b)
+			n++
+		}
+	}
+	if n > 0 {
+		buf.WriteByte(']')
+	}
+
+	if items := t.Rows.GetSharedDataItems(); len(items) > 0 {
+		buf.WriteString(`,"sharedData":[`)
+		for i, it := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			b, err := json.Marshal(sharedJSON{TagName: it.TagName, Data: it.Data})
+			if err != nil {
+				return nil, fmt.Errorf("shared data %s: %v", it.TagName, err)
+			}
+			buf.Write(b)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a table written by MarshalJSON, replacing
+// the columns and rows of t. Values are converted to the types of
+// their columns; numbers in untyped columns become int64 when they
+// are whole, and float64 otherwise.
+func (t *Table) UnmarshalJSON(data []byte) error {
+
+	var doc tableJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	if len(doc.Name) > maxTableNameLength {
+		return fmt.Errorf("maximum length for a table name is %d characters", maxTableNameLength)
+	}
+
+	policy, err := parseColumnNamePolicy(doc.ColumnNames)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]Column, len(doc.Columns))
+	for i := 0; i < len(doc.Columns); i++ {
+		name := policy.name(doc.Columns[i].Name)
+		if name == "" {
+			return fmt.Errorf("column %d has no name", i)
+		}
+		if policy.find(cols[:i], name) >= 0 {
+			return fmt.Errorf("duplicate column: %s", doc.Columns[i].Name)
+		}
+		cols[i] = Column{Name: name, Type: doc.Columns[i].Type}
+	}
+
+	vals := make([][]interface{}, len(doc.Rows))
+	for i := 0; i < len(doc.Rows); i++ {
+		if len(doc.Rows[i]) != len(cols) {
+			return fmt.Errorf("row %d: have %d values, want %d", i, len(doc.Rows[i]), len(cols))
+		}
+		vals[i] = make([]interface{}, len(cols))
+		for j := 0; j < len(cols); j++ {
+			v, err := fromJSONValue(doc.Rows[i][j], cols[j].Type)
+			if err != nil {
+				return fmt.Errorf("row %d, column %s: %v", i, cols[j].Name, err)
+			}
+			vals[i][j] = v
+		}
+	}
+
+	tbl, err := (&Table{}).Create(doc.Name)
+	if err != nil {
+		return err
+	}
+	if err := tbl.Cols.SetNamePolicy(policy); err != nil {
+		return err
+	}
+	fillTable(tbl, cols, vals)
+
+	for _, tg := range doc.Tags {
+		data, err := fromJSONValue(tg.Data, "")
+		if err != nil {
+			return fmt.Errorf("row %d, tag %s: %v", tg.Row, tg.Name, err)
+		}
+		if err := tbl.Rows.AddTag(tg.Row, Tag{Name: tg.Name, Data: data}); err != nil {
+			return fmt.Errorf("row %d, tag %s: %v", tg.Row, tg.Name, err)
+		}
+	}
+	for _, it := range doc.SharedData {
+		data, err := fromJSONValue(it.Data, "")
+		if err != nil {
+			return fmt.Errorf("shared data %s: %v", it.TagName, err)
+		}
+		if err := tbl.Rows.AddSharedData(SharedDataItem{TagName: it.TagName, Data: data}); err != nil {
+			return fmt.Errorf("shared data %s: %v", it.TagName, err)
+		}
+	}
+	*t = *tbl
+
+	return nil
+}
+
+// fromJSONValue converts a decoded JSON value (decoded with
+// UseNumber) to a cell value of the column type typ.
+func fromJSONValue(v interface{}, typ string) (interface{}, error) {
+	v, err := jsonNumbers(v)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch normalizeColType(typ) {
+	case ColTypeInteger, ColTypeFloat, ColTypeBool:
+		return castValue(v, typ)
+	case ColTypeDateTime:
+		if s, ok := v.(string); ok {
+			if tm, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return tm, nil
+			}
+		}
+		return castValue(v, typ)
+	}
+	return v, nil
+}
+
+// jsonNumbers converts the json.Numbers of v, also inside objects
+// and arrays, to int64 when they are whole and float64 otherwise.
+func jsonNumbers(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i, nil
+		}
+		return x.Float64()
+	case map[string]interface{}:
+		for k, e := range x {
+			n, err := jsonNumbers(e)
+			if err != nil {
+				return nil, err
+			}
+			x[k] = n
+		}
+	case []interface{}:
+		for i, e := range x {
+			n, err := jsonNumbers(e)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = n
+		}
+	}
+	return v, nil
+}
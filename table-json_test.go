@@ -0,0 +1,33 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Numbers inside objects and arrays are read as int64 or float64,
+// in cells, tag data and shared data.
+func TestUnmarshalJSONNestedNumbers(t *testing.T) {
+	nested := map[string]interface{}{"n": int64(1), "list": []interface{}{int64(2), 2.5, map[string]interface{}{"f": 0.5}}}
+	src := newTestTable(t, RowStorage, []string{"v"}, []interface{}{nested})
+	src.Rows.AddTag(0, Tag{Name: "x", Data: []interface{}{int64(7)}})
+	if err := src.Rows.AddSharedData(SharedDataItem{TagName: "x", Data: map[string]interface{}{"k": 1.25}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := src.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tbl Table
+	if err := tbl.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("%#v %#v %#v", tableValues(&tbl)[0][0], tbl.Rows.GetTag(0).Data, tbl.Rows.GetSharedData("x").Data)
+	want := fmt.Sprintf("%#v %#v %#v", nested, []interface{}{int64(7)}, map[string]interface{}{"k": 1.25})
+	if got != want {
+		t.Fatalf("\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,756 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"time"
+)
+
+// parquetLeaf is a (leaf) column of a Parquet file that is read,
+// with the name of the table column it goes to.
+type parquetLeaf struct {
+	name       string
+	col        string
+	physical   int64
+	typeLength int
+	maxDef     uint32
+	kind       int
+	unit       int16
+	scale      int
+}
+
+// kinds of values, by the logical (or converted) type
+const (
+	parquetKindPlain = iota
+	parquetKindNull
+	parquetKindString
+	parquetKindDate
+	parquetKindTimestamp
+	parquetKindDecimal
+	parquetKindUnsigned
+)
+
+// ReadParquet reads a Parquet file into the table. Columns are
+// matched by name; new columns get the type of the column in the
+// file: Integer for ints, Float for floats and decimals, Bool,
+// DateTime for timestamps, dates and INT96 (in UTC), and String for
+// strings. Other byte arrays are read as []byte. Columns of nested
+// groups are named by their path (e.g. "address.city"); lists and
+// maps are not supported. Pages may be snappy, gzip or zstd
+// compressed.
+//
+// If r is an io.ReaderAt and an io.Seeker (e.g. an *os.File) only
+// the footer and the column chunks are read; otherwise the file is
+// read into memory first.
+func (t *Table) ReadParquet(r io.Reader) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	ra, size, err := readerAtOf(r)
+	if err != nil {
+		return err
+	}
+
+	pr := &parquetReader{tbl: t, r: ra, size: size}
+	return pr.read()
+}
+
+// parquetReader reads the row groups of a file into a table.
+type parquetReader struct {
+	tbl    *Table
+	r      io.ReaderAt
+	size   int64
+	leaves []parquetLeaf
+}
+
+func (pr *parquetReader) readAt(offset, n int64) ([]byte, error) {
+	if offset < 0 || n < 0 || offset+n > pr.size {
+		return nil, errors.New("parquet: offset out of range")
+	}
+	p := make([]byte, n)
+	if k, err := pr.r.ReadAt(p, offset); k < len(p) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (pr *parquetReader) read() error {
+	notParquet := errors.New("parquet: not a Parquet file")
+	if pr.size < 12 {
+		return notParquet
+	}
+
+	head, err := pr.readAt(0, 4)
+	if err != nil {
+		return err
+	}
+	tail, err := pr.readAt(pr.size-8, 8)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(tail[4:], []byte("PARE")) {
+		return errors.New("parquet: encrypted files are not supported")
+	}
+	if !bytes.Equal(head, parquetMagic) || !bytes.Equal(tail[4:], parquetMagic) {
+		return notParquet
+	}
+
+	n := int64(binary.LittleEndian.Uint32(tail))
+	if n > pr.size-12 {
+		return notParquet
+	}
+	footer, err := pr.readAt(pr.size-8-n, n)
+	if err != nil {
+		return err
+	}
+	meta, _, err := decodeThrift(footer)
+	if err != nil {
+		return err
+	}
+
+	if err := pr.schema(meta.list(2)); err != nil {
+		return err
+	}
+
+	for _, g := range meta.list(4) {
+		rg, _ := g.(tStruct)
+		if err := pr.rowGroup(rg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schema reads the leaf columns and adds the missing columns.
+func (pr *parquetReader) schema(list []interface{}) error {
+	elems := make([]tStruct, len(list))
+	for i := 0; i < len(list); i++ {
+		elems[i], _ = list[i].(tStruct)
+	}
+	if len(elems) == 0 {
+		return errThrift
+	}
+
+	// walk reads element i and its children; def is the definition
+	// level of the parent
+	var walk func(i int, path string, def uint32) (int, error)
+	walk = func(i int, path string, def uint32) (int, error) {
+		if i >= len(elems) {
+			return 0, errThrift
+		}
+		e := elems[i]
+		name := e.str(4)
+		if path != "" {
+			name = path + "." + name
+		}
+
+		switch e.int(3, parquetRequired) {
+		case parquetOptional:
+			def++
+		case parquetRepeated:
+			return 0, fmt.Errorf("parquet: column %s: repeated fields (lists and maps) are not supported", name)
+		}
+
+		if children := e.int(5, 0); children > 0 || !e.has(1) {
+			i++
+			for c := int64(0); c < children; c++ {
+				var err error
+				if i, err = walk(i, name, def); err != nil {
+					return 0, err
+				}
+			}
+			return i, nil
+		}
+
+		leaf, err := newParquetLeaf(name, e)
+		if err != nil {
+			return 0, err
+		}
+		leaf.maxDef = def
+		pr.leaves = append(pr.leaves, leaf)
+		return i + 1, nil
+	}
+
+	root := elems[0]
+	i := 1
+	for c := int64(0); c < root.int(5, 0); c++ {
+		var err error
+		if i, err = walk(i, "", 0); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, len(pr.leaves))
+	types := make([]string, len(pr.leaves))
+	for j := 0; j < len(pr.leaves); j++ {
+		names[j] = pr.leaves[j].name
+		types[j] = pr.leaves[j].colType()
+	}
+	cols, err := resolveReadColumns(pr.tbl, "parquet", names, types)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < len(pr.leaves); j++ {
+		pr.leaves[j].col = cols[j]
+	}
+
+	return nil
+}
+
+// newParquetLeaf reads the types of a leaf column.
+func newParquetLeaf(name string, e tStruct) (parquetLeaf, error) {
+	leaf := parquetLeaf{
+		name:       name,
+		physical:   e.int(1, 0),
+		typeLength: int(e.int(2, 0)),
+		scale:      int(e.int(7, 0)),
+	}
+	if leaf.physical < parquetBoolean || leaf.physical > parquetFixedLenByteArray {
+		return leaf, fmt.Errorf("parquet: column %s: unknown type %d", name, leaf.physical)
+	}
+	if leaf.physical == parquetFixedLenByteArray && leaf.typeLength <= 0 {
+		return leaf, fmt.Errorf("parquet: column %s: invalid type length", name)
+	}
+
+	if logical := e.sub(10); logical.has(logical.union()) {
+		lt := logical.sub(logical.union())
+		switch logical.union() {
+		case 1, 4, 12: // STRING, ENUM, JSON
+			leaf.kind = parquetKindString
+		case 5: // DECIMAL
+			leaf.kind = parquetKindDecimal
+			leaf.scale = int(lt.int(1, 0))
+		case 6: // DATE
+			leaf.kind = parquetKindDate
+		case 8: // TIMESTAMP
+			leaf.kind = parquetKindTimestamp
+			switch lt.sub(2).union() {
+			case 1:
+				leaf.unit = arrowMillisecond
+			case 2:
+				leaf.unit = arrowMicrosecond
+			default:
+				leaf.unit = arrowNanosecond
+			}
+		case 10: // INTEGER
+			if !lt.bool(2, true) {
+				leaf.kind = parquetKindUnsigned
+			}
+		case 11: // UNKNOWN (always null)
+			leaf.kind = parquetKindNull
+		}
+	} else {
+		switch e.int(6, -1) {
+		case 0, 4, 19: // UTF8, ENUM, JSON
+			leaf.kind = parquetKindString
+		case 5:
+			leaf.kind = parquetKindDecimal
+		case 6:
+			leaf.kind = parquetKindDate
+		case 9:
+			leaf.kind, leaf.unit = parquetKindTimestamp, arrowMillisecond
+		case 10:
+			leaf.kind, leaf.unit = parquetKindTimestamp, arrowMicrosecond
+		case 11, 12, 13, 14: // UINT_8 to UINT_64
+			leaf.kind = parquetKindUnsigned
+		}
+	}
+
+	return leaf, nil
+}
+
+// colType returns the column type for a leaf; "" for null columns,
+// which are left untyped.
+func (leaf *parquetLeaf) colType() string {
+	switch leaf.kind {
+	case parquetKindNull:
+		return ""
+	case parquetKindString:
+		return ColTypeString
+	case parquetKindDate, parquetKindTimestamp:
+		return ColTypeDateTime
+	case parquetKindDecimal:
+		return ColTypeFloat
+	}
+
+	switch leaf.physical {
+	case parquetBoolean:
+		return ColTypeBool
+	case parquetInt32, parquetInt64:
+		return ColTypeInteger
+	case parquetInt96:
+		return ColTypeDateTime
+	case parquetFloat, parquetDouble:
+		return ColTypeFloat
+	}
+	return "[]uint8"
+}
+
+// rowGroup reads a row group into new rows.
+func (pr *parquetReader) rowGroup(rg tStruct) error {
+	n := rg.int(3, 0)
+	chunks := rg.list(1)
+	if n < 0 || len(chunks) != len(pr.leaves) {
+		return errors.New("parquet: row group does not match the schema")
+	}
+
+	vals := make([][]interface{}, len(pr.leaves))
+	for j := 0; j < len(pr.leaves); j++ {
+		cc, _ := chunks[j].(tStruct)
+		var err error
+		if vals[j], err = pr.chunk(&pr.leaves[j], cc, int(n)); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < int(n); i++ {
+		row := pr.tbl.Rows.New()
+		for j := 0; j < len(pr.leaves); j++ {
+			row[pr.leaves[j].col] = vals[j][i]
+		}
+	}
+
+	return nil
+}
+
+// chunk reads the n values of a column chunk.
+func (pr *parquetReader) chunk(leaf *parquetLeaf, cc tStruct, n int) ([]interface{}, error) {
+	if cc.str(1) != "" {
+		return nil, fmt.Errorf("parquet: column %s: column chunks in other files are not supported", leaf.name)
+	}
+	md := cc.sub(3)
+	if md == nil {
+		return nil, errThrift
+	}
+
+	codec := md.int(4, parquetCodecNone)
+	start := md.int(9, 0)
+	if d := md.int(11, 0); d > 0 && d < start {
+		start = d
+	}
+	buf, err := pr.readAt(start, md.int(7, 0))
+	if err != nil {
+		return nil, fmt.Errorf("parquet: column %s: %v", leaf.name, err)
+	}
+
+	vals, err := leaf.pages(buf, codec, n)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: column %s: %v", leaf.name, err)
+	}
+	return vals, nil
+}
+
+// pages decodes the pages of a column chunk.
+func (leaf *parquetLeaf) pages(buf []byte, codec int64, n int) ([]interface{}, error) {
+	// the count is in the metadata; values are appended as they
+	// are decoded
+	vals := make([]interface{}, 0, minInt(n, 1<<16))
+	var dict []interface{}
+	width := bitWidth(uint64(leaf.maxDef))
+
+	pos := 0
+	for len(vals) < n {
+		if pos >= len(buf) {
+			return nil, errors.New("missing values")
+		}
+		header, k, err := decodeThrift(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += k
+		size := header.int(3, -1)
+		if size < 0 || int64(pos)+size > int64(len(buf)) {
+			return nil, errParquetData
+		}
+		data := buf[pos : pos+int(size)]
+		pos += int(size)
+		rawSize := header.int(2, -1)
+
+		var count int
+		var defs []uint32
+		var enc int64
+
+		switch header.int(1, -1) {
+		case parquetDictionaryPage:
+			raw, err := parquetDecompress(codec, data, rawSize)
+			if err != nil {
+				return nil, err
+			}
+			dh := header.sub(7)
+			dn := dh.int(1, 0)
+			if dn < 0 || dn > int64(8*len(raw)) {
+				return nil, errParquetData
+			}
+			if dict, err = leaf.decode(parquetPlain, raw, int(dn), nil); err != nil {
+				return nil, err
+			}
+			continue
+
+		case parquetDataPage:
+			raw, err := parquetDecompress(codec, data, rawSize)
+			if err != nil {
+				return nil, err
+			}
+			dh := header.sub(5)
+			c := dh.int(1, 0)
+			if c < 0 || c > int64(n-len(vals)) {
+				return nil, errParquetData
+			}
+			count, enc = int(c), dh.int(2, parquetPlain)
+			if leaf.maxDef > 0 {
+				if dh.int(3, parquetRLE) != parquetRLE {
+					return nil, errors.New("unsupported definition level encoding")
+				}
+				if len(raw) < 4 {
+					return nil, errParquetData
+				}
+				l := int64(binary.LittleEndian.Uint32(raw))
+				if l > int64(len(raw)-4) {
+					return nil, errParquetData
+				}
+				if defs, err = rleDecode(raw[4:4+l], width, count); err != nil {
+					return nil, err
+				}
+				raw = raw[4+l:]
+			}
+			data = raw
+
+		case parquetDataPageV2:
+			dh := header.sub(8)
+			c := dh.int(1, 0)
+			count, enc = int(c), dh.int(4, parquetPlain)
+			defLen, repLen := dh.int(5, 0), dh.int(6, 0)
+			if c < 0 || c > int64(n-len(vals)) || defLen < 0 || repLen < 0 || defLen+repLen > int64(len(data)) {
+				return nil, errParquetData
+			}
+			levels := data[repLen : repLen+defLen]
+			data = data[repLen+defLen:]
+			if dh.bool(7, true) {
+				if data, err = parquetDecompress(codec, data, rawSize-defLen-repLen); err != nil {
+					return nil, err
+				}
+			}
+			if leaf.maxDef > 0 {
+				if defs, err = rleDecode(levels, width, count); err != nil {
+					return nil, err
+				}
+			}
+
+		default:
+			// index pages
+			continue
+		}
+
+		valid := count
+		if defs != nil {
+			valid = 0
+			for i := 0; i < count; i++ {
+				if defs[i] == leaf.maxDef {
+					valid++
+				}
+			}
+		}
+
+		page, err := leaf.decode(enc, data, valid, dict)
+		if err != nil {
+			return nil, err
+		}
+
+		vi := 0
+		for i := 0; i < count; i++ {
+			if defs != nil && defs[i] != leaf.maxDef || leaf.kind == parquetKindNull {
+				vals = append(vals, nil)
+				continue
+			}
+			vals = append(vals, page[vi])
+			vi++
+		}
+	}
+
+	return vals, nil
+}
+
+// parquetDecompress decompresses a page; size is its uncompressed
+// size.
+func parquetDecompress(codec int64, data []byte, size int64) ([]byte, error) {
+	var raw []byte
+	var err error
+
+	// a page is never larger than its header says
+	limit := -1
+	if size >= 0 && size <= math.MaxInt32 {
+		limit = int(size)
+	}
+
+	switch codec {
+	case parquetCodecNone:
+		raw = data
+	case parquetCodecSnappy:
+		raw, err = snappyDecode(data, limit)
+	case parquetCodecZstd:
+		raw, err = zstdDecode(data, limit)
+	case parquetCodecGzip:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			var src io.Reader = zr
+			if limit >= 0 {
+				src = io.LimitReader(zr, int64(limit)+1)
+			}
+			raw, err = ioutil.ReadAll(src)
+		}
+	default:
+		names := []string{3: "LZO", 4: "BROTLI", 5: "LZ4", 7: "LZ4_RAW"}
+		if codec > 0 && codec < int64(len(names)) && names[codec] != "" {
+			return nil, fmt.Errorf("unsupported compression %s", names[codec])
+		}
+		return nil, fmt.Errorf("unsupported compression %d", codec)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && int64(len(raw)) != size {
+		return nil, errParquetData
+	}
+	return raw, nil
+}
+
+// decode reads n values in the given encoding.
+func (leaf *parquetLeaf) decode(enc int64, data []byte, n int, dict []interface{}) ([]interface{}, error) {
+	if n < 0 {
+		return nil, errParquetData
+	}
+	if leaf.kind == parquetKindNull {
+		return nil, nil
+	}
+
+	switch enc {
+	case parquetPlain:
+		return leaf.plain(data, n)
+
+	case parquetPlainDictionary, parquetRLEDictionary:
+		if dict == nil {
+			return nil, errors.New("dictionary page missing")
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		if len(data) == 0 {
+			return nil, errParquetData
+		}
+		ids, err := rleDecode(data[1:], uint(data[0]), n)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			if int(ids[i]) >= len(dict) {
+				return nil, errParquetData
+			}
+			vals[i] = dict[ids[i]]
+			if p, ok := vals[i].([]byte); ok {
+				vals[i] = append([]byte{}, p...)
+			}
+		}
+		return vals, nil
+
+	case parquetRLE:
+		if leaf.physical != parquetBoolean || len(data) < 4 {
+			return nil, errParquetData
+		}
+		bits, err := rleDecode(data[4:], 1, n)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			vals[i] = bits[i] != 0
+		}
+		return vals, nil
+
+	case parquetDeltaBinaryPacked:
+		if leaf.physical != parquetInt32 && leaf.physical != parquetInt64 {
+			return nil, errParquetData
+		}
+		ints, _, err := deltaDecode(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(ints) < n {
+			return nil, errParquetData
+		}
+		vals := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			v := ints[i]
+			if leaf.physical == parquetInt32 {
+				v = int64(int32(v))
+			}
+			vals[i] = leaf.int(v)
+		}
+		return vals, nil
+
+	case parquetDeltaLengthByteArray, parquetDeltaByteArray:
+		if leaf.physical != parquetByteArray && leaf.physical != parquetFixedLenByteArray {
+			return nil, errParquetData
+		}
+		var arrays [][]byte
+		var err error
+		if enc == parquetDeltaLengthByteArray {
+			arrays, err = deltaLengthDecode(data, n)
+		} else {
+			arrays, err = deltaByteArrayDecode(data, n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			vals[i] = leaf.bytes(arrays[i])
+		}
+		return vals, nil
+
+	case parquetByteStreamSplit:
+		width := 0
+		switch leaf.physical {
+		case parquetInt32, parquetFloat:
+			width = 4
+		case parquetInt64, parquetDouble:
+			width = 8
+		case parquetFixedLenByteArray:
+			width = leaf.typeLength
+		default:
+			return nil, errParquetData
+		}
+		joined, err := byteStreamSplitDecode(data, width, n)
+		if err != nil {
+			return nil, err
+		}
+		return leaf.plain(joined, n)
+	}
+
+	return nil, fmt.Errorf("unsupported encoding %d", enc)
+}
+
+// plain reads n values in the PLAIN encoding.
+func (leaf *parquetLeaf) plain(data []byte, n int) ([]interface{}, error) {
+	if n < 0 || n > 8*len(data) {
+		return nil, errParquetData
+	}
+	vals := make([]interface{}, n)
+
+	width := 0
+	switch leaf.physical {
+	case parquetInt32, parquetFloat:
+		width = 4
+	case parquetInt64, parquetDouble:
+		width = 8
+	case parquetInt96:
+		width = 12
+	case parquetFixedLenByteArray:
+		width = leaf.typeLength
+	case parquetBoolean:
+		if len(data) < (n+7)/8 {
+			return nil, errParquetData
+		}
+		for i := 0; i < n; i++ {
+			vals[i] = data[i/8]&(1<<uint(i%8)) != 0
+		}
+		return vals, nil
+	case parquetByteArray:
+		pos := 0
+		for i := 0; i < n; i++ {
+			if pos+4 > len(data) {
+				return nil, errParquetData
+			}
+			l := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if l < 0 || l > len(data)-pos {
+				return nil, errParquetData
+			}
+			vals[i] = leaf.bytes(data[pos : pos+l])
+			pos += l
+		}
+		return vals, nil
+	}
+
+	if int64(len(data)) < int64(width)*int64(n) {
+		return nil, errParquetData
+	}
+	for i := 0; i < n; i++ {
+		p := data[width*i : width*(i+1)]
+		switch leaf.physical {
+		case parquetInt32:
+			vals[i] = leaf.int(int64(int32(binary.LittleEndian.Uint32(p))))
+		case parquetInt64:
+			vals[i] = leaf.int(int64(binary.LittleEndian.Uint64(p)))
+		case parquetFloat:
+			vals[i] = float32FromBits(p)
+		case parquetDouble:
+			vals[i] = float64FromBits(p)
+		case parquetInt96:
+			nanos := int64(binary.LittleEndian.Uint64(p))
+			days := int64(binary.LittleEndian.Uint32(p[8:])) - 2440588 // Julian day of 1970-01-01
+			vals[i] = time.Unix(days*86400, nanos).UTC()
+		default:
+			vals[i] = leaf.bytes(p)
+		}
+	}
+
+	return vals, nil
+}
+
+// int converts an INT32 or INT64 value by its logical type; uint64
+// values that do not fit in an int64 are returned as uint64.
+func (leaf *parquetLeaf) int(v int64) interface{} {
+	switch leaf.kind {
+	case parquetKindDate:
+		return time.Unix(v*86400, 0).UTC()
+	case parquetKindTimestamp:
+		return arrowTime(v, leaf.unit)
+	case parquetKindDecimal:
+		return float64(v) / math.Pow10(leaf.scale)
+	case parquetKindUnsigned:
+		if leaf.physical == parquetInt32 {
+			return int64(uint32(v))
+		}
+		if v < 0 {
+			return uint64(v)
+		}
+	}
+	return v
+}
+
+// bytes converts a byte array by its logical type; decimals are
+// big-endian two's complement integers.
+func (leaf *parquetLeaf) bytes(p []byte) interface{} {
+	switch leaf.kind {
+	case parquetKindString:
+		return string(p)
+	case parquetKindDecimal:
+		x := new(big.Int).SetBytes(p)
+		if len(p) > 0 && p[0]&0x80 != 0 {
+			x.Sub(x, new(big.Int).Lsh(big.NewInt(1), uint(8*len(p))))
+		}
+		scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(leaf.scale)), nil)
+		f, _ := new(big.Rat).SetFrac(x, scale).Float64()
+		return f
+	}
+	return append([]byte{}, p...)
+}
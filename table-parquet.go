@@ -0,0 +1,648 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ParquetCompression is the codec that compresses the pages of a
+// Parquet file.
+type ParquetCompression int
+
+const (
+	ParquetSnappy ParquetCompression = iota // the default
+	ParquetGzip
+	ParquetZstd
+	ParquetUncompressed
+)
+
+// ParquetOptions are the options of WriteParquet; the zero value
+// writes snappy-compressed, dictionary-encoded columns.
+type ParquetOptions struct {
+	Compression ParquetCompression
+
+	// RowGroupSize is the number of rows per row group; default
+	// 1048576.
+	RowGroupSize int
+
+	// PageSize is the target size of a data page in bytes, before
+	// compression; default 1 MB.
+	PageSize int
+
+	// NoDictionary writes all values with the PLAIN encoding.
+	NoDictionary bool
+
+	// Columns selects (and orders) the columns to write; default all.
+	Columns []string
+}
+
+// Parquet physical types (the Type enum of parquet.thrift).
+const (
+	parquetBoolean           = 0
+	parquetInt32             = 1
+	parquetInt64             = 2
+	parquetInt96             = 3
+	parquetFloat             = 4
+	parquetDouble            = 5
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+)
+
+// Parquet encodings.
+const (
+	parquetPlain                = 0
+	parquetPlainDictionary      = 2
+	parquetRLE                  = 3
+	parquetBitPacked            = 4
+	parquetDeltaBinaryPacked    = 5
+	parquetDeltaLengthByteArray = 6
+	parquetDeltaByteArray       = 7
+	parquetRLEDictionary        = 8
+	parquetByteStreamSplit      = 9
+)
+
+const (
+	// page types
+	parquetDataPage       = 0
+	parquetDictionaryPage = 2
+	parquetDataPageV2     = 3
+
+	// compression codecs
+	parquetCodecNone   = 0
+	parquetCodecSnappy = 1
+	parquetCodecGzip   = 2
+	parquetCodecZstd   = 6
+
+	// repetition types
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	// dictionaries larger than this fall back to PLAIN
+	parquetMaxDictionary = 1 << 20
+
+	// min/max statistics of longer byte arrays are not written
+	parquetMaxStatistics = 4096
+)
+
+var parquetMagic = []byte("PAR1")
+
+// WriteParquet writes the table as a Parquet file, which can be read
+// with pyarrow, pandas, polars, DuckDB or Spark. Columns are typed
+// as by WriteArrowIPC, and all are optional (nullable): Integer is
+// written as INT64, Float as DOUBLE, Bool as BOOLEAN, DateTime as a
+// TIMESTAMP(MICROS, UTC) and String as a UTF8 BYTE_ARRAY. Columns
+// with few distinct values are dictionary encoded; the row groups
+// hold the null count and the min and max of each column.
+func (t *Table) WriteParquet(w io.Writer, opts ParquetOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if opts.Compression < ParquetSnappy || opts.Compression > ParquetUncompressed {
+		return fmt.Errorf("invalid Parquet compression: %d", opts.Compression)
+	}
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = 1 << 20
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 1 << 20
+	}
+
+	cols := t.Cols.Get()
+	var selected []Column
+	if len(opts.Columns) > 0 {
+		for i := 0; i < len(opts.Columns); i++ {
+			j := indexOfColumn(cols, opts.Columns[i])
+			if j < 0 {
+				return fmt.Errorf("column not found: %s", opts.Columns[i])
+			}
+			selected = append(selected, cols[j])
+		}
+	} else {
+		selected = cols
+	}
+
+	data := make([][]interface{}, len(selected))
+	types := make([]uint8, len(selected))
+	for j := 0; j < len(selected); j++ {
+		data[j] = t.Cols.GetData(selected[j].Name)
+		types[j] = arrowTypeOf(selected[j], data[j])
+	}
+
+	pw := &parquetWriter{w: bufio.NewWriterSize(w, 64*1024), opts: opts}
+	if err := pw.write(parquetMagic); err != nil {
+		return err
+	}
+
+	n := t.Rows.Count()
+	var rowGroups []tStruct
+	for start := 0; start < n; start += opts.RowGroupSize {
+		end := start + opts.RowGroupSize
+		if end > n {
+			end = n
+		}
+
+		offset := pw.pos
+		var chunks []tStruct
+		var size int64
+		for j := 0; j < len(selected); j++ {
+			chunk, err := pw.chunk(selected[j].Name, types[j], data[j][start:end], start)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+			size += chunk.sub(3).int(6, 0)
+		}
+
+		rg := tStruct{
+			{1, chunks},
+			{2, size},
+			{3, int64(end - start)},
+			{5, offset},
+			{6, pw.pos - offset},
+		}
+		if len(rowGroups) <= math.MaxInt16 {
+			rg = append(rg, tField{7, int16(len(rowGroups))})
+		}
+		rowGroups = append(rowGroups, rg)
+	}
+
+	schema := []tStruct{{{4, "schema"}, {5, int32(len(selected))}}}
+	orders := make([]tStruct, len(selected))
+	for j := 0; j < len(selected); j++ {
+		schema = append(schema, parquetSchemaElement(selected[j].Name, types[j]))
+		orders[j] = tStruct{{1, tStruct{}}} // TYPE_ORDER
+	}
+
+	footer := encodeThrift(tStruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, int64(n)},
+		{4, rowGroups},
+		{6, "go-collections"},
+		{7, orders},
+	})
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	if err := pw.write(size[:]); err != nil {
+		return err
+	}
+	if err := pw.write(parquetMagic); err != nil {
+		return err
+	}
+
+	return pw.w.Flush()
+}
+
+// parquetPhysicalType returns the physical type of a column of the
+// given (Arrow) type.
+func parquetPhysicalType(typ uint8) int32 {
+	switch typ {
+	case arrowNull:
+		return parquetInt32
+	case arrowInt, arrowTimestamp:
+		return parquetInt64
+	case arrowFloat:
+		return parquetDouble
+	case arrowBool:
+		return parquetBoolean
+	}
+	return parquetByteArray
+}
+
+// parquetSchemaElement returns the SchemaElement of a column of the
+// given (Arrow) type.
+func parquetSchemaElement(name string, typ uint8) tStruct {
+	var converted int32 = -1
+	var logical tStruct
+
+	switch typ {
+	case arrowNull:
+		logical = tStruct{{11, tStruct{}}} // UNKNOWN
+	case arrowInt:
+		converted = 18 // INT_64
+		logical = tStruct{{10, tStruct{{1, int8(64)}, {2, true}}}}
+	case arrowTimestamp:
+		converted = 10 // TIMESTAMP_MICROS
+		logical = tStruct{{8, tStruct{{1, true}, {2, tStruct{{2, tStruct{}}}}}}}
+	case arrowUtf8:
+		converted = 0 // UTF8
+		logical = tStruct{{1, tStruct{}}}
+	}
+
+	e := tStruct{{1, parquetPhysicalType(typ)}, {3, int32(parquetOptional)}, {4, name}}
+	if converted >= 0 {
+		e = append(e, tField{6, converted})
+	}
+	if logical != nil {
+		e = append(e, tField{10, logical})
+	}
+	return e
+}
+
+// parquetWriter writes the pages of the column chunks and keeps
+// track of the position.
+type parquetWriter struct {
+	w    *bufio.Writer
+	pos  int64
+	opts ParquetOptions
+}
+
+func (pw *parquetWriter) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.pos += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) codec() int32 {
+	switch pw.opts.Compression {
+	case ParquetSnappy:
+		return parquetCodecSnappy
+	case ParquetGzip:
+		return parquetCodecGzip
+	case ParquetZstd:
+		return parquetCodecZstd
+	}
+	return parquetCodecNone
+}
+
+func (pw *parquetWriter) compress(p []byte) ([]byte, error) {
+	switch pw.opts.Compression {
+	case ParquetSnappy:
+		return snappyEncode(p), nil
+	case ParquetZstd:
+		return zstdEncode(p), nil
+	case ParquetGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(p); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return p, nil
+}
+
+// page writes a page with its header; sub is the header of the page
+// type (field id subID of PageHeader). It returns the uncompressed
+// size of the page.
+func (pw *parquetWriter) page(pageType int32, subID int16, sub tStruct, raw []byte) (int64, error) {
+	if len(raw) > math.MaxInt32 {
+		return 0, errors.New("parquet: page too large")
+	}
+	data, err := pw.compress(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	header := encodeThrift(tStruct{
+		{1, pageType},
+		{2, int32(len(raw))},
+		{3, int32(len(data))},
+		{subID, sub},
+	})
+	if err := pw.write(header); err != nil {
+		return 0, err
+	}
+	if err := pw.write(data); err != nil {
+		return 0, err
+	}
+	return int64(len(header) + len(raw)), nil
+}
+
+// parquetValues holds the non-null values of a column chunk in
+// their physical type.
+type parquetValues struct {
+	typ    uint8
+	ints   []int64
+	floats []float64
+	bools  []bool
+	arrays [][]byte
+}
+
+func (pv *parquetValues) len() int {
+	switch pv.typ {
+	case arrowFloat:
+		return len(pv.floats)
+	case arrowBool:
+		return len(pv.bools)
+	case arrowUtf8, arrowBinary:
+		return len(pv.arrays)
+	}
+	return len(pv.ints)
+}
+
+// size returns the PLAIN size of value i.
+func (pv *parquetValues) size(i int) int {
+	switch pv.typ {
+	case arrowBool:
+		return 1
+	case arrowUtf8, arrowBinary:
+		return 4 + len(pv.arrays[i])
+	}
+	return 8
+}
+
+// plain appends values i to j in the PLAIN encoding.
+func (pv *parquetValues) plain(dst []byte, i, j int) []byte {
+	var b [8]byte
+	switch pv.typ {
+	case arrowBool:
+		packed := make([]byte, (j-i+7)/8)
+		for k := i; k < j; k++ {
+			if pv.bools[k] {
+				packed[(k-i)/8] |= 1 << uint((k-i)%8)
+			}
+		}
+		return append(dst, packed...)
+	case arrowFloat:
+		for k := i; k < j; k++ {
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(pv.floats[k]))
+			dst = append(dst, b[:]...)
+		}
+	case arrowUtf8, arrowBinary:
+		for k := i; k < j; k++ {
+			binary.LittleEndian.PutUint32(b[:], uint32(len(pv.arrays[k])))
+			dst = append(append(dst, b[:4]...), pv.arrays[k]...)
+		}
+	default:
+		for k := i; k < j; k++ {
+			binary.LittleEndian.PutUint64(b[:], uint64(pv.ints[k]))
+			dst = append(dst, b[:]...)
+		}
+	}
+	return dst
+}
+
+// stat returns the PLAIN encoding of value i, for the statistics.
+func (pv *parquetValues) stat(i int) []byte {
+	if pv.typ == arrowBool {
+		if pv.bools[i] {
+			return []byte{1}
+		}
+		return []byte{0}
+	}
+	if pv.typ == arrowUtf8 || pv.typ == arrowBinary {
+		return pv.arrays[i]
+	}
+	return pv.plain(nil, i, i+1)
+}
+
+// less compares values i and j; NaN is not ordered.
+func (pv *parquetValues) less(i, j int) bool {
+	switch pv.typ {
+	case arrowFloat:
+		return pv.floats[i] < pv.floats[j]
+	case arrowBool:
+		return !pv.bools[i] && pv.bools[j]
+	case arrowUtf8, arrowBinary:
+		return bytes.Compare(pv.arrays[i], pv.arrays[j]) < 0
+	}
+	return pv.ints[i] < pv.ints[j]
+}
+
+// statistics returns the Statistics of a column chunk.
+func (pv *parquetValues) statistics(nulls int) tStruct {
+	s := tStruct{{3, int64(nulls)}}
+
+	min, max := -1, -1
+	for i := 0; i < pv.len(); i++ {
+		if pv.typ == arrowFloat && math.IsNaN(pv.floats[i]) {
+			continue
+		}
+		if min < 0 || pv.less(i, min) {
+			min = i
+		}
+		if max < 0 || pv.less(max, i) {
+			max = i
+		}
+	}
+	if min < 0 {
+		return s
+	}
+
+	lo, hi := pv.stat(min), pv.stat(max)
+	if pv.typ == arrowFloat {
+		// a zero min is written as -0 and a zero max as +0
+		if pv.floats[min] == 0 {
+			lo = make([]byte, 8)
+			binary.LittleEndian.PutUint64(lo, math.Float64bits(math.Copysign(0, -1)))
+		}
+		if pv.floats[max] == 0 {
+			hi = make([]byte, 8)
+		}
+	}
+	if len(lo) > parquetMaxStatistics || len(hi) > parquetMaxStatistics {
+		return s
+	}
+	return append(s, tField{5, hi}, tField{6, lo})
+}
+
+// chunk writes a column chunk and returns its ColumnChunk; first is
+// the index of the first row (for errors).
+func (pw *parquetWriter) chunk(name string, typ uint8, vals []interface{}, first int) (tStruct, error) {
+	n := len(vals)
+	defs := make([]uint32, n)
+	pv := &parquetValues{typ: typ}
+	invalid := func(i int, v interface{}, colType string) error {
+		return fmt.Errorf("parquet: column %s, row %d: cannot convert %v to %s", name, first+i, v, colType)
+	}
+
+	nulls := 0
+	for i := 0; i < n; i++ {
+		v := vals[i]
+		if typ == arrowNull || isNull(v) {
+			nulls++
+			continue
+		}
+		defs[i] = 1
+
+		switch typ {
+		case arrowInt:
+			x, ok := toInt64(v)
+			if !ok {
+				return nil, invalid(i, v, ColTypeInteger)
+			}
+			pv.ints = append(pv.ints, x)
+		case arrowFloat:
+			x, ok := toFloat64(v)
+			if !ok {
+				return nil, invalid(i, v, ColTypeFloat)
+			}
+			pv.floats = append(pv.floats, x)
+		case arrowBool:
+			x, ok := toBool(v)
+			if !ok {
+				return nil, invalid(i, v, ColTypeBool)
+			}
+			pv.bools = append(pv.bools, x)
+		case arrowTimestamp:
+			x, ok := toTime(v)
+			if !ok {
+				return nil, invalid(i, v, ColTypeDateTime)
+			}
+			pv.ints = append(pv.ints, x.Unix()*1000000+int64(x.Nanosecond()/1000))
+		default:
+			if p, ok := v.([]byte); ok {
+				pv.arrays = append(pv.arrays, p)
+			} else {
+				pv.arrays = append(pv.arrays, []byte(toString(v)))
+			}
+		}
+	}
+
+	var dict *parquetValues
+	var ids []uint32
+	if !pw.opts.NoDictionary && typ != arrowBool && typ != arrowNull {
+		dict, ids = pv.dictionary()
+	}
+
+	start := pw.pos
+	var uncompressed int64
+	var dictOffset int64 = -1
+	encodings := []int32{parquetPlain, parquetRLE}
+
+	if dict != nil {
+		dictOffset = pw.pos
+		size, err := pw.page(parquetDictionaryPage, 7, tStruct{
+			{1, int32(dict.len())},
+			{2, int32(parquetPlain)},
+		}, dict.plain(nil, 0, dict.len()))
+		if err != nil {
+			return nil, err
+		}
+		uncompressed += size
+		encodings = append(encodings, parquetRLEDictionary)
+	}
+	dataOffset := pw.pos
+
+	var width uint
+	if dict != nil {
+		width = bitWidth(uint64(dict.len() - 1))
+	}
+
+	// pages of about PageSize bytes
+	vi := 0
+	for p0 := 0; p0 < n; {
+		v0 := vi
+		est := 0
+		p1 := p0
+		for p1 < n && est < pw.opts.PageSize {
+			if defs[p1] == 1 {
+				if dict != nil {
+					est += int(width+7) / 8
+				} else {
+					est += pv.size(vi)
+				}
+				vi++
+			}
+			p1++
+		}
+
+		levels := rleEncode(nil, defs[p0:p1], 1)
+		raw := make([]byte, 4, 4+len(levels)+est+8)
+		binary.LittleEndian.PutUint32(raw, uint32(len(levels)))
+		raw = append(raw, levels...)
+
+		enc := int32(parquetPlain)
+		if dict != nil {
+			enc = parquetRLEDictionary
+			raw = append(raw, byte(width))
+			raw = rleEncode(raw, ids[v0:vi], width)
+		} else {
+			raw = pv.plain(raw, v0, vi)
+		}
+
+		size, err := pw.page(parquetDataPage, 5, tStruct{
+			{1, int32(p1 - p0)},
+			{2, enc},
+			{3, int32(parquetRLE)},
+			{4, int32(parquetRLE)},
+		}, raw)
+		if err != nil {
+			return nil, err
+		}
+		uncompressed += size
+		p0 = p1
+	}
+
+	meta := tStruct{
+		{1, parquetPhysicalType(typ)},
+		{2, encodings},
+		{3, []string{name}},
+		{4, pw.codec()},
+		{5, int64(n)},
+		{6, uncompressed},
+		{7, pw.pos - start},
+		{9, dataOffset},
+	}
+	if dictOffset >= 0 {
+		meta = append(meta, tField{11, dictOffset})
+	}
+	meta = append(meta, tField{12, pv.statistics(nulls)})
+
+	return tStruct{{2, start}, {3, meta}}, nil
+}
+
+// dictionary returns the distinct values and the index of each
+// value, or nil if a dictionary would not make the chunk smaller.
+func (pv *parquetValues) dictionary() (*parquetValues, []uint32) {
+	n := pv.len()
+	dict := &parquetValues{typ: pv.typ}
+	ids := make([]uint32, n)
+	index := make(map[interface{}]uint32)
+	size := 0
+
+	for i := 0; i < n; i++ {
+		var key interface{}
+		switch pv.typ {
+		case arrowFloat:
+			key = math.Float64bits(pv.floats[i])
+		case arrowUtf8, arrowBinary:
+			key = string(pv.arrays[i])
+		default:
+			key = pv.ints[i]
+		}
+
+		id, ok := index[key]
+		if !ok {
+			id = uint32(len(index))
+			index[key] = id
+			switch pv.typ {
+			case arrowFloat:
+				dict.floats = append(dict.floats, pv.floats[i])
+			case arrowUtf8, arrowBinary:
+				dict.arrays = append(dict.arrays, pv.arrays[i])
+			default:
+				dict.ints = append(dict.ints, pv.ints[i])
+			}
+			size += pv.size(i)
+			if size > parquetMaxDictionary || len(index) > n/2 {
+				return nil, nil
+			}
+		}
+		ids[i] = id
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+	return dict, ids
+}
@@ -0,0 +1,142 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var parquetCompressions = []ParquetCompression{ParquetSnappy, ParquetGzip, ParquetZstd, ParquetUncompressed}
+
+func TestParquetWriteReadAllCodecs(t *testing.T) {
+	for _, c := range parquetCompressions {
+		for _, noDict := range []bool{false, true} {
+			src := arrowTestTable(t)
+			var buf bytes.Buffer
+			if err := src.WriteParquet(&buf, ParquetOptions{Compression: c, NoDictionary: noDict, PageSize: 64}); err != nil {
+				t.Fatal(err)
+			}
+			dst, _ := (&Table{}).Create("t")
+			if err := dst.ReadParquet(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatalf("compression %d, no dictionary %v: %v", c, noDict, err)
+			}
+			if got, want := fmt.Sprint(tableValues(dst)), fmt.Sprint(tableValues(src)); got != want {
+				t.Fatalf("compression %d, no dictionary %v:\n got %s\nwant %s", c, noDict, got, want)
+			}
+		}
+	}
+}
+
+// The files in testdata/parquet were written by another Parquet
+// writer (xitongsys/parquet-go), with v1 and v2 data pages and each
+// compression; all hold the same 40 rows.
+func TestParquetForeignFiles(t *testing.T) {
+	base := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	want := func(i int) map[string]interface{} {
+		r := map[string]interface{}{
+			"boolrle":   i%3 == 0,
+			"i64d":      int64(i) * 1000003,
+			"u32":       int64(4294967295 - i),
+			"i96":       base.Add(time.Duration(i) * time.Second),
+			"f64":       float64(i%10) / 4,
+			"strdl":     fmt.Sprintf("dl-%d", i),
+			"strdb":     fmt.Sprintf("prefix-common-%05d", i),
+			"bin":       []byte{byte(i), 0, 255},
+			"date":      time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 18000+i),
+			"tsms":      base.Add(time.Duration(i) * time.Millisecond),
+			"dec1":      float64(i*101-1000) / 100,
+			"bool":      nil,
+			"i32":       nil,
+			"str":       nil,
+			"addr.city": nil,
+		}
+		if i%4 != 1 {
+			r["bool"] = i%2 == 0
+			r["i32"] = int64(-i)
+			r["str"] = []string{"a", "bb", "ccc"}[i%3]
+			if i%5 != 0 {
+				r["addr.city"] = fmt.Sprintf("c%d", i%5)
+			}
+		}
+		return r
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "parquet", "*.parquet"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("no test files", err)
+	}
+	for _, p := range files {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl, _ := (&Table{}).Create("t")
+		err = tbl.ReadParquet(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		rows := tbl.Rows.GetRows()
+		if len(rows) != 40 {
+			t.Fatalf("%s: %d rows", p, len(rows))
+		}
+		for i, row := range rows {
+			for c, v := range want(i) {
+				if got := fmt.Sprint(row[c]); got != fmt.Sprint(v) {
+					t.Fatalf("%s: row %d, %s = %s, want %v", p, i, c, got, v)
+				}
+			}
+		}
+	}
+}
+
+// A negative value count in a page header is an error.
+func TestParquetNegativeValueCount(t *testing.T) {
+	leaf := &parquetLeaf{name: "x", col: "x", physical: parquetInt64}
+	for _, page := range []tStruct{
+		{{1, int32(parquetDictionaryPage)}, {2, int32(0)}, {3, int32(0)}, {7, tStruct{{1, int32(-1)}, {2, int32(parquetPlain)}}}},
+		{{1, int32(parquetDataPage)}, {2, int32(0)}, {3, int32(0)}, {5, tStruct{{1, int32(-1)}, {2, int32(parquetPlain)}}}},
+	} {
+		if _, err := leaf.pages(encodeThrift(page), parquetCodecNone, 1); err != errParquetData {
+			t.Fatalf("got %v, want %v", err, errParquetData)
+		}
+	}
+	if _, err := leaf.plain(nil, -1); err != errParquetData {
+		t.Fatalf("plain: got %v, want %v", err, errParquetData)
+	}
+}
+
+// Corrupted input must give an error, not a panic.
+func TestParquetCorruptInput(t *testing.T) {
+	for _, c := range parquetCompressions {
+		var buf bytes.Buffer
+		if err := arrowTestTable(t).WriteParquet(&buf, ParquetOptions{Compression: c}); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		for i := 0; i < len(data); i++ {
+			for _, b := range []byte{0x00, 0xff, 0x80, 0x7f, data[i] ^ 1} {
+				mutated := append([]byte(nil), data...)
+				mutated[i] = b
+				readParquetNoPanic(t, mutated, fmt.Sprintf("compression %d: byte %d = %#x", c, i, b))
+			}
+		}
+		for n := 0; n < len(data); n++ {
+			readParquetNoPanic(t, data[:n], fmt.Sprintf("compression %d: truncated to %d", c, n))
+		}
+	}
+}
+
+func readParquetNoPanic(t *testing.T, data []byte, what string) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s: panic: %v", what, r)
+		}
+	}()
+	tbl, _ := (&Table{}).Create("t")
+	tbl.ReadParquet(bytes.NewReader(data))
+}
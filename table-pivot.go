@@ -0,0 +1,275 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Pivot turns the distinct values of columnsFrom into columns. The
+// result has one row per distinct combination of the index columns;
+// each new column holds aggFunc (e.g. Sum, Avg, Max, CountOf) of
+// valuesFrom for the rows with that value. Rows with a NULL in
+// columnsFrom are skipped; combinations without rows are nil.
+// Values with the same text (1 and "1") share a column, and the
+// columns are in the order of the values. A value that gives a
+// blank or taken column name is numbered (e.g. "A_2" after "a").
+func (t *Table) Pivot(index []string, columnsFrom string, valuesFrom string, aggFunc func(col string) Aggregate) (*Table, error) {
+
+	if t.Cols == nil || t.Rows == nil {
+		return nil, errors.New("table is not initialized")
+	}
+	if aggFunc == nil {
+		return nil, errors.New("aggregate function is nil")
+	}
+
+	cols := t.Cols.Get()
+
+	indexCols, err := resolveColumns(cols, index)
+	if err != nil {
+		return nil, err
+	}
+	pivotCols, err := resolveColumns(cols, []string{columnsFrom, valuesFrom})
+	if err != nil {
+		return nil, err
+	}
+	colFrom, valFrom := pivotCols[0], pivotCols[1]
+
+	agg := aggFunc(valFrom)
+	if _, err := agg.newState(); err != nil {
+		return nil, err
+	}
+
+	// The new columns are the distinct values of columnsFrom (by
+	// their text, as GetDataDistinct), in sorted order; a value of
+	// each is kept to sort numbers as numbers.
+	keys, data := t.Cols.GetDataDistinct(colFrom)
+	first := make(map[string]interface{}, len(keys))
+	for _, v := range data {
+		if k := fmt.Sprintf("%v", v); !isNull(v) && first[k] == nil {
+			first[k] = v
+		}
+	}
+	var dist []interface{}
+	for _, k := range keys {
+		if v := first[k.(string)]; v != nil {
+			dist = append(dist, v)
+		}
+	}
+	sort.SliceStable(dist, func(i, j int) bool {
+		return compareValues(dist[i], dist[j]) < 0
+	})
+
+	var outCols []Column
+	for i := 0; i < len(indexCols); i++ {
+		outCols = append(outCols, cols[indexOfColumn(cols, indexCols[i])])
+	}
+
+	// Values whose text is blank, or the same as an earlier column
+	// (regardless of case), get a numbered name: "a", "A_2".
+	uniqueName := func(name string) string {
+		if name == "" {
+			name = fmt.Sprintf("col_%d", len(outCols)+1)
+		}
+		base := name
+		for n := 2; indexOfColumn(outCols, name) >= 0 || strings.EqualFold(name, row_id); n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		return name
+	}
+
+	pivotPos := make(map[string]int)
+	for i := 0; i < len(dist); i++ {
+		pivotPos[fmt.Sprintf("%v", dist[i])] = len(outCols)
+		outCols = append(outCols, Column{Name: uniqueName(fmt.Sprintf("%v", dist[i]))})
+	}
+
+	// Aggregate per index-key and pivot column.
+	type group struct {
+		key    []interface{}
+		states map[int]aggState
+	}
+	var groups []*group
+	lookup := make(map[string]*group)
+
+	rows := t.Rows.GetRows()
+	for i := 0; i < len(rows); i++ {
+		pv := rows[i][colFrom]
+		if isNull(pv) {
+			continue
+		}
+		pos, ok := pivotPos[fmt.Sprintf("%v", pv)]
+		if !ok {
+			return nil, fmt.Errorf("row %d: no pivot column for value %v", i, pv)
+		}
+
+		key := make([]interface{}, len(indexCols))
+		for j := 0; j < len(indexCols); j++ {
+			key[j] = rows[i][indexCols[j]]
+		}
+		k := valuesKey(key)
+		g := lookup[k]
+		if g == nil {
+			g = &group{key: key, states: make(map[int]aggState)}
+			lookup[k] = g
+			groups = append(groups, g)
+		}
+
+		st := g.states[pos]
+		if st == nil {
+			st, _ = agg.newState()
+			g.states[pos] = st
+		}
+		if err := st.add(rows[i][valFrom]); err != nil {
+			return nil, fmt.Errorf("%s: %v", outCols[pos].Name, err)
+		}
+	}
+
+	var outRows [][]interface{}
+	for i := 0; i < len(groups); i++ {
+		vals := make([]interface{}, len(outCols))
+		copy(vals, groups[i].key)
+		for pos, st := range groups[i].states {
+			vals[pos] = st.result()
+		}
+		outRows = append(outRows, vals)
+	}
+
+	srcType := cols[indexOfColumn(cols, valFrom)].Type
+	for j := len(indexCols); j < len(outCols); j++ {
+		outCols[j].Type = aggColType(agg, srcType, outRows, j)
+	}
+
+	tbl, err := (&Table{}).Create(t.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fillTable(tbl, outCols, outRows), nil
+}
+
+// Unpivot (melt) turns columns into rows: for each row and each of
+// valueCols, the result has a row with the idCols, the name of the
+// column in nameCol and its value in valueCol. When valueCols is
+// empty all columns that are not idCols are used. If the value
+// columns have different types (the types of the values, for
+// untyped columns), integers are widened to floats, and any other
+// mix is stored as strings.
+func (t *Table) Unpivot(idCols []string, valueCols []string, nameCol string, valueCol string) (*Table, error) {
+
+	if t.Cols == nil || t.Rows == nil {
+		return nil, errors.New("table is not initialized")
+	}
+	if nameCol == "" || valueCol == "" {
+		return nil, errors.New("name and value column names are required")
+	}
+	if strings.EqualFold(nameCol, valueCol) {
+		return nil, errors.New("name and value columns must be different")
+	}
+
+	cols := t.Cols.Get()
+
+	ids, err := resolveColumns(cols, idCols)
+	if err != nil {
+		return nil, err
+	}
+
+	var vals []string
+	if len(valueCols) == 0 {
+		for i := 0; i < len(cols); i++ {
+			isID := false
+			for j := 0; j < len(ids); j++ {
+				if cols[i].Name == ids[j] {
+					isID = true
+					break
+				}
+			}
+			if !isID {
+				vals = append(vals, cols[i].Name)
+			}
+		}
+	} else if vals, err = resolveColumns(cols, valueCols); err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, errors.New("no value columns to unpivot")
+	}
+
+	var outCols []Column
+	for i := 0; i < len(ids); i++ {
+		c := cols[indexOfColumn(cols, ids[i])]
+		if strings.EqualFold(c.Name, nameCol) || strings.EqualFold(c.Name, valueCol) {
+			return nil, fmt.Errorf("column already exists: %s", c.Name)
+		}
+		outCols = append(outCols, c)
+	}
+
+	// The type of the value column; untyped columns (from Cols.Add)
+	// count with the types of their values.
+	valType := ""
+	merge := func(ct string) {
+		switch ct {
+		case ColTypeString, ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+		default:
+			ct = ColTypeString
+		}
+		switch {
+		case valType == "" || valType == ct:
+			valType = ct
+		case (valType == ColTypeInteger && ct == ColTypeFloat) || (valType == ColTypeFloat && ct == ColTypeInteger):
+			valType = ColTypeFloat
+		default:
+			valType = ColTypeString
+		}
+	}
+	for i := 0; i < len(vals); i++ {
+		if ct := typedColType(cols[indexOfColumn(cols, vals[i])]); ct != "" {
+			merge(ct)
+			continue
+		}
+		for _, v := range t.Cols.GetData(vals[i]) {
+			if !isNull(v) {
+				merge(colTypeOf(v))
+			}
+		}
+	}
+	valCol := Column{Name: valueCol, Type: valType}
+	if valType == "" {
+		valCol.Type = "string" // only NULLs: untyped
+	}
+	outCols = append(outCols, Column{Name: nameCol, Type: ColTypeString}, valCol)
+
+	var outRows [][]interface{}
+	rows := t.Rows.GetRows()
+	for i := 0; i < len(rows); i++ {
+		for j := 0; j < len(vals); j++ {
+			r := make([]interface{}, len(outCols))
+			for k := 0; k < len(ids); k++ {
+				r[k] = rows[i][ids[k]]
+			}
+			v := rows[i][vals[j]]
+			if !isNull(v) {
+				switch valType {
+				case ColTypeFloat:
+					if f, ok := toFloat64(v); ok && isIntegerKind(v) {
+						v = f
+					}
+				case ColTypeString:
+					v = toString(v)
+				}
+			}
+			r[len(ids)] = vals[j]
+			r[len(ids)+1] = v
+			outRows = append(outRows, r)
+		}
+	}
+
+	tbl, err := (&Table{}).Create(t.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fillTable(tbl, outCols, outRows), nil
+}
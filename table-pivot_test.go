@@ -0,0 +1,104 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPivotBlankAndCaseValues(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"region", "q", "amount"},
+		[]interface{}{"east", "a", 1},
+		[]interface{}{"east", "", 2},
+		[]interface{}{"east", "A", 4},
+		[]interface{}{"west", "a", 8},
+		[]interface{}{"west", nil, 16},
+	)
+	p, err := tbl.Pivot([]string{"region"}, "q", "amount", Sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range p.Cols.Get() {
+		names = append(names, c.Name)
+	}
+	if got := fmt.Sprint(names); got != "[region col_2 A a_2]" {
+		t.Fatalf("columns: %s", got)
+	}
+	if got := fmt.Sprint(tableValues(p)); got != "[[east 2 4 1] [west <nil> <nil> 8]]" {
+		t.Fatalf("rows: %s", got)
+	}
+}
+
+func TestPivotColumnNamedLikeIndex(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"region", "q", "amount"},
+		[]interface{}{"east", "Region", 1},
+	)
+	p, err := tbl.Pivot([]string{"region"}, "q", "amount", Sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tableValues(p)); got != "[[east 1]]" {
+		t.Fatal(got)
+	}
+	if c := p.Cols.Get(); c[1].Name != "Region_2" {
+		t.Fatal(c)
+	}
+}
+
+// Numeric pivot values are ordered as numbers.
+func TestPivotNumericValues(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("k")
+	tbl.Cols.Add("n")
+	tbl.Cols.Add("v")
+	for _, n := range []int64{10, 2, 1, 2} {
+		row := tbl.Rows.New()
+		row["k"], row["n"], row["v"] = "x", n, n*100
+	}
+	p, err := tbl.Pivot([]string{"k"}, "n", "v", Sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range p.Cols.Get() {
+		names = append(names, c.Name)
+	}
+	if got := fmt.Sprint(names); got != "[k 1 2 10]" {
+		t.Fatalf("columns: %s", got)
+	}
+	if got := fmt.Sprint(tableValues(p)); got != "[[x 100 400 1000]]" {
+		t.Fatalf("rows: %s", got)
+	}
+}
+
+// Untyped columns unpivot with the types of their values.
+func TestUnpivotUntypedColumns(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.Add("id")
+	tbl.Cols.Add("a")
+	tbl.Cols.Add("b")
+	row := tbl.Rows.New()
+	row["id"], row["a"], row["b"] = int64(1), int64(10), int64(20)
+
+	u, err := tbl.Unpivot([]string{"id"}, nil, "name", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%#v", tableValues(u)); got != `[][]interface {}{[]interface {}{1, "a", 10}, []interface {}{1, "b", 20}}` {
+		t.Fatal(got)
+	}
+	if typ := u.Cols.Get()[2].Type; typ != ColTypeInteger {
+		t.Fatalf("value column type %s", typ)
+	}
+
+	// ints and floats widen to floats
+	row = tbl.Rows.New()
+	row["id"], row["a"], row["b"] = int64(2), 0.5, nil
+	if u, err = tbl.Unpivot([]string{"id"}, nil, "name", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v %v", u.Cols.Get()[2].Type, tableValues(u)); got != ColTypeFloat+" [[1 a 10] [1 b 20] [2 a 0.5] [2 b <nil>]]" {
+		t.Fatal(got)
+	}
+}
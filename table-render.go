@@ -0,0 +1,400 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RenderFormat is the output format of Render.
+type RenderFormat int
+
+const (
+	// RenderASCII draws the table with +, - and | characters.
+	RenderASCII RenderFormat = iota
+
+	// RenderUnicode draws the table with box-drawing characters.
+	RenderUnicode
+
+	// RenderMarkdown writes a GitHub Flavored Markdown table.
+	RenderMarkdown
+
+	// RenderHTML writes an HTML <table>.
+	RenderHTML
+)
+
+// RenderOptions configures Render. The zero value renders all
+// columns and rows as one table, without width limits.
+type RenderOptions struct {
+	// Columns selects (and orders) the columns to render.
+	Columns []string
+
+	// MaxWidth is the maximum width of a column, in terminal
+	// cells; longer values are cut and end with an ellipsis. It
+	// must be at least 4 for RenderASCII and 2 otherwise.
+	MaxWidth int
+
+	// PageSize splits the rows into tables of that many rows,
+	// each with the header (0 for one table).
+	PageSize int
+
+	// Page renders only that page (1-based) of PageSize rows; a
+	// page past the last row is an error.
+	Page int
+
+	// NullText is the text of nil values; default "".
+	NullText string
+
+	// TimeFormat is the layout of time values; default RFC 3339.
+	TimeFormat string
+}
+
+// renderBox holds the characters of a text table: the horizontal
+// and vertical lines, and the left, middle and right joints of the
+// top, header separator and bottom lines.
+type renderBox struct {
+	h, v       string
+	tl, tm, tr string
+	ml, mm, mr string
+	bl, bm, br string
+}
+
+var (
+	renderASCIIBox = renderBox{
+		h: "-", v: "|",
+		tl: "+", tm: "+", tr: "+",
+		ml: "+", mm: "+", mr: "+",
+		bl: "+", bm: "+", br: "+",
+	}
+	renderUnicodeBox = renderBox{
+		h: "─", v: "│",
+		tl: "┌", tm: "┬", tr: "┐",
+		ml: "├", mm: "┼", mr: "┤",
+		bl: "└", bm: "┴", br: "┘",
+	}
+)
+
+// Render writes the table as text: aligned ASCII or Unicode
+// box-drawing tables, a Markdown table or an HTML table. Numeric
+// columns are right-aligned, and widths account for wide (East
+// Asian) and zero-width characters.
+func (t *Table) Render(w io.Writer, format RenderFormat, opts RenderOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if format < RenderASCII || format > RenderHTML {
+		return fmt.Errorf("invalid render format: %d", format)
+	}
+	if opts.MaxWidth < 0 || opts.PageSize < 0 || opts.Page < 0 {
+		return errors.New("MaxWidth, PageSize and Page must not be negative")
+	}
+	if opts.Page > 0 && opts.PageSize == 0 {
+		return errors.New("Page requires a PageSize")
+	}
+	if ew := renderEllipsisWidth(format); opts.MaxWidth > 0 && opts.MaxWidth <= ew {
+		return fmt.Errorf("MaxWidth must be at least %d", ew+1)
+	}
+
+	cols := t.Cols.Get()
+	var selected []Column
+	if len(opts.Columns) > 0 {
+		for i := 0; i < len(opts.Columns); i++ {
+			j := indexOfColumn(cols, opts.Columns[i])
+			if j < 0 {
+				return fmt.Errorf("column not found: %s", opts.Columns[i])
+			}
+			selected = append(selected, cols[j])
+		}
+	} else {
+		selected = cols
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	// the rows to render
+	start, end := 0, t.Rows.Count()
+	if opts.Page > 0 {
+		start = (opts.Page - 1) * opts.PageSize
+		if opts.Page > 1 && start >= end {
+			return fmt.Errorf("page %d is past the end (%d rows)", opts.Page, end)
+		}
+		if start+opts.PageSize < end {
+			end = start + opts.PageSize
+		}
+	}
+
+	box := renderASCIIBox
+	if format == RenderUnicode {
+		box = renderUnicodeBox
+	}
+
+	header := make([]string, len(selected))
+	cells := make([][]string, len(selected))
+	numeric := make([]bool, len(selected))
+	for j := 0; j < len(selected); j++ {
+		data := t.Cols.GetData(selected[j].Name)[start:end]
+		numeric[j] = renderIsNumeric(selected[j], data)
+		header[j] = renderCell(selected[j].Name, format, opts.MaxWidth)
+		cells[j] = make([]string, len(data))
+		for i := 0; i < len(data); i++ {
+			cells[j][i] = renderCell(renderValue(data[i], &opts), format, opts.MaxWidth)
+		}
+	}
+
+	// the widths of all pages
+	widths := make([]int, len(selected))
+	for j := 0; j < len(selected); j++ {
+		widths[j] = displayWidth(header[j])
+		for i := 0; i < len(cells[j]); i++ {
+			if cw := displayWidth(cells[j][i]); cw > widths[j] {
+				widths[j] = cw
+			}
+		}
+		if format == RenderMarkdown && widths[j] < 3 {
+			widths[j] = 3 // the delimiter row needs ---
+		}
+	}
+
+	n := end - start
+	pageSize := n
+	if opts.PageSize > 0 && opts.Page == 0 {
+		pageSize = opts.PageSize
+	}
+
+	bw := bufio.NewWriter(w)
+	for p := 0; ; p += pageSize {
+		q := minInt(p+pageSize, n)
+		if p > 0 {
+			bw.WriteString("\n")
+		}
+		if format == RenderHTML {
+			renderHTML(bw, header, cells, numeric, p, q)
+		} else {
+			renderGrid(bw, format, box, widths, header, cells, numeric, p, q)
+		}
+		if q >= n {
+			break
+		}
+	}
+
+	return bw.Flush()
+}
+
+// renderIsNumeric reports whether a column is right-aligned: an
+// Integer or Float column, or one whose values are all numbers.
+func renderIsNumeric(col Column, data []interface{}) bool {
+	if col.Type != "string" {
+		switch normalizeColType(col.Type) {
+		case ColTypeInteger, ColTypeFloat:
+			return true
+		}
+	}
+
+	n := 0
+	for i := 0; i < len(data); i++ {
+		if isNull(data[i]) {
+			continue
+		}
+		if !isIntegerKind(data[i]) && !isFloatKind(data[i]) {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
+
+func renderValue(v interface{}, opts *RenderOptions) string {
+	if isNull(v) {
+		return opts.NullText
+	}
+	if opts.TimeFormat != "" {
+		switch x := v.(type) {
+		case time.Time:
+			return x.Format(opts.TimeFormat)
+		case *time.Time:
+			return x.Format(opts.TimeFormat)
+		}
+	}
+	return toString(v)
+}
+
+// renderCell prepares the text of a cell: control characters (line
+// breaks, tabs) become spaces, Markdown pipes are escaped, and the
+// text is cut to maxWidth.
+func renderCell(s string, format RenderFormat, maxWidth int) string {
+	if format != RenderHTML {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+
+	if maxWidth > 0 && displayWidth(s) > maxWidth {
+		ellipsis, ew := "…", renderEllipsisWidth(format)
+		if format == RenderASCII {
+			ellipsis = "..."
+		}
+		var b strings.Builder
+		width := 0
+		for _, r := range s {
+			rw := runeWidth(r)
+			if width+rw > maxWidth-ew {
+				break
+			}
+			b.WriteRune(r)
+			width += rw
+		}
+		s = b.String() + ellipsis
+	}
+
+	if format == RenderMarkdown {
+		s = strings.Replace(s, `\`, `\\`, -1)
+		s = strings.Replace(s, "|", `\|`, -1)
+	}
+	return s
+}
+
+// renderEllipsisWidth is the width of the ellipsis that ends a cut
+// cell; MaxWidth must leave room for at least one more character.
+func renderEllipsisWidth(format RenderFormat) int {
+	if format == RenderASCII {
+		return 3
+	}
+	return 1
+}
+
+// renderGrid writes rows p to q in the ASCII, Unicode or Markdown
+// format.
+func renderGrid(w *bufio.Writer, format RenderFormat, box renderBox, widths []int, header []string, cells [][]string, numeric []bool, p, q int) {
+	line := func(l, m, r string) {
+		w.WriteString(l)
+		for j := 0; j < len(widths); j++ {
+			if j > 0 {
+				w.WriteString(m)
+			}
+			w.WriteString(strings.Repeat(box.h, widths[j]+2))
+		}
+		w.WriteString(r)
+		w.WriteString("\n")
+	}
+	row := func(vals func(j int) string, alignRight func(j int) bool) {
+		w.WriteString(box.v)
+		for j := 0; j < len(widths); j++ {
+			s := vals(j)
+			pad := strings.Repeat(" ", widths[j]-displayWidth(s))
+			w.WriteString(" ")
+			if alignRight(j) {
+				w.WriteString(pad + s)
+			} else {
+				w.WriteString(s + pad)
+			}
+			w.WriteString(" ")
+			w.WriteString(box.v)
+		}
+		w.WriteString("\n")
+	}
+
+	left := func(j int) bool { return false }
+	right := func(j int) bool { return numeric[j] }
+
+	if format == RenderMarkdown {
+		row(func(j int) string { return header[j] }, left)
+		w.WriteString("|")
+		for j := 0; j < len(widths); j++ {
+			if numeric[j] {
+				w.WriteString(" " + strings.Repeat("-", widths[j]-1) + ": |")
+			} else {
+				w.WriteString(" " + strings.Repeat("-", widths[j]) + " |")
+			}
+		}
+		w.WriteString("\n")
+		for i := p; i < q; i++ {
+			row(func(j int) string { return cells[j][i] }, right)
+		}
+		return
+	}
+
+	line(box.tl, box.tm, box.tr)
+	row(func(j int) string { return header[j] }, left)
+	line(box.ml, box.mm, box.mr)
+	for i := p; i < q; i++ {
+		row(func(j int) string { return cells[j][i] }, right)
+	}
+	line(box.bl, box.bm, box.br)
+}
+
+// renderHTML writes rows p to q as an HTML table.
+func renderHTML(w *bufio.Writer, header []string, cells [][]string, numeric []bool, p, q int) {
+	text := func(s string) string {
+		return strings.Replace(html.EscapeString(s), "\n", "<br>", -1)
+	}
+
+	w.WriteString("<table>\n<thead>\n<tr>")
+	for j := 0; j < len(header); j++ {
+		w.WriteString("<th>" + text(header[j]) + "</th>")
+	}
+	w.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for i := p; i < q; i++ {
+		w.WriteString("<tr>")
+		for j := 0; j < len(header); j++ {
+			if numeric[j] {
+				w.WriteString(`<td style="text-align:right">`)
+			} else {
+				w.WriteString("<td>")
+			}
+			w.WriteString(text(cells[j][i]) + "</td>")
+		}
+		w.WriteString("</tr>\n")
+	}
+	w.WriteString("</tbody>\n</table>\n")
+}
+
+// displayWidth returns the number of terminal cells of s.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns the number of terminal cells of a rune: 0 for
+// combining marks and format characters, 2 for East Asian wide and
+// fullwidth characters (and emoji), 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x300:
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0x303E, // CJK radicals, punctuation
+		r >= 0x3041 && r <= 0x33FF, // kana, CJK symbols
+		r >= 0x3400 && r <= 0x4DBF, // CJK extension A
+		r >= 0x4E00 && r <= 0x9FFF, // CJK ideographs
+		r >= 0xA000 && r <= 0xA4CF, // Yi
+		r >= 0xAC00 && r <= 0xD7A3, // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF, // CJK compatibility
+		r >= 0xFE30 && r <= 0xFE4F, // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60, // fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F, // emoji
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions B-G
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,61 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderMaxWidth(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"name", "qty"},
+		[]interface{}{"abcdef", int64(123456)},
+	)
+	for _, tc := range []struct {
+		format RenderFormat
+		min    int
+		cut    string
+	}{
+		{RenderASCII, 4, "a..."},
+		{RenderUnicode, 2, "a…"},
+		{RenderMarkdown, 2, "a…"},
+		{RenderHTML, 2, "a…"},
+	} {
+		for w := 1; w < tc.min; w++ {
+			if err := tbl.Render(&bytes.Buffer{}, tc.format, RenderOptions{MaxWidth: w}); err == nil {
+				t.Fatalf("format %d, MaxWidth %d: no error", tc.format, w)
+			}
+		}
+		var buf bytes.Buffer
+		if err := tbl.Render(&buf, tc.format, RenderOptions{MaxWidth: tc.min}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), tc.cut) {
+			t.Fatalf("format %d: %s", tc.format, buf.String())
+		}
+	}
+}
+
+func TestRenderPages(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"n"},
+		[]interface{}{"r1"}, []interface{}{"r2"}, []interface{}{"r3"},
+	)
+	var buf bytes.Buffer
+	if err := tbl.Render(&buf, RenderMarkdown, RenderOptions{PageSize: 2, Page: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "| n   |\n| --- |\n| r3  |\n" {
+		t.Fatalf("%q", got)
+	}
+	for _, page := range []int{3, 10} {
+		if err := tbl.Render(&bytes.Buffer{}, RenderMarkdown, RenderOptions{PageSize: 2, Page: page}); err == nil {
+			t.Fatalf("page %d: no error", page)
+		}
+	}
+
+	// the first page of an empty table is the header
+	tbl.Rows.Clear()
+	if err := tbl.Render(&bytes.Buffer{}, RenderMarkdown, RenderOptions{PageSize: 2, Page: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,418 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SQLDialect sets the placeholders, the quoting of names and the
+// column types of the statements written by InsertInto.
+type SQLDialect int
+
+const (
+	// SQLDialectStandard writes ? placeholders and "quoted" names
+	// (SQLite, and the driver of this package).
+	SQLDialectStandard SQLDialect = iota
+
+	// SQLDialectPostgres writes $1, $2... and "quoted" names.
+	SQLDialectPostgres
+
+	// SQLDialectMySQL writes ? and `quoted` names.
+	SQLDialectMySQL
+
+	// SQLDialectSQLServer writes @p1, @p2... and [quoted] names.
+	SQLDialectSQLServer
+)
+
+// SQLInsertOptions configures InsertInto.
+type SQLInsertOptions struct {
+	Dialect SQLDialect
+
+	// Columns selects the columns to write; default all. The
+	// database columns have the same names.
+	Columns []string
+
+	// BatchSize is the number of rows per INSERT statement; by
+	// default a batch has at most 999 values.
+	BatchSize int
+
+	// CreateTable creates the table first, with a database type
+	// for each column (taken from the values of untyped columns).
+	CreateTable bool
+}
+
+// SQLExecer runs statements on a database; it is implemented by
+// *sql.DB and *sql.Tx.
+type SQLExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// FromSQLRows adds the rows of a database/sql query result to the
+// table, and closes rows. Missing columns are added with a type
+// taken from the database type (or the scan type) of the result
+// column, and NotNull set from its nullability. Values are
+// converted to the column types; a value that does not convert is
+// an error, and the table is not changed.
+func (t *Table) FromSQLRows(rows *sql.Rows) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if rows == nil {
+		return errors.New("FromSQLRows: rows is nil")
+	}
+	defer rows.Close()
+
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("FromSQLRows: %v", err)
+	}
+
+	n := len(cts)
+	names := make([]string, n)
+	types := make([]string, n)
+	colTypes := make([]string, n) // the types values are converted to
+	notNull := make([]bool, n)
+	for j := 0; j < n; j++ {
+		names[j] = cts[j].Name()
+		if names[j] == row_id {
+			return fmt.Errorf("FromSQLRows: %s is a reserved column name", row_id)
+		}
+		for k := 0; k < j; k++ {
+			if strings.EqualFold(names[k], names[j]) {
+				return fmt.Errorf("FromSQLRows: duplicate column: %s", names[j])
+			}
+		}
+		types[j] = sqlColType(cts[j])
+		if nullable, ok := cts[j].Nullable(); ok && !nullable {
+			notNull[j] = true
+		}
+		if k := indexOfColumn(t.Cols.Get(), names[j]); k >= 0 {
+			colTypes[j] = typedColType(t.Cols.Get()[k])
+		} else {
+			colTypes[j] = types[j]
+		}
+	}
+
+	// scan and convert all values first: a failure changes nothing
+	vals := make([]interface{}, n)
+	ptrs := make([]interface{}, n)
+	for j := 0; j < n; j++ {
+		ptrs[j] = &vals[j]
+	}
+	var data [][]interface{}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("FromSQLRows: row %d: %v", len(data), err)
+		}
+		row := make([]interface{}, n)
+		for j := 0; j < n; j++ {
+			v := vals[j]
+			if colTypes[j] != "" && !isNull(v) {
+				if b, ok := v.([]byte); ok {
+					v = string(b)
+				}
+				if v, err = castValue(v, colTypes[j]); err != nil {
+					return fmt.Errorf("FromSQLRows: row %d, column %s: %v", len(data), names[j], err)
+				}
+			}
+			row[j] = v
+		}
+		data = append(data, row)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("FromSQLRows: %v", err)
+	}
+
+	before := len(t.Cols.Get())
+	cols, err := resolveReadColumns(t, "FromSQLRows", names, types)
+	if err != nil {
+		return err
+	}
+	all := t.Cols.Get()
+	for j := 0; j < n; j++ {
+		if k := indexOfColumn(all, cols[j]); k >= before {
+			all[k].NotNull = notNull[j]
+		}
+	}
+
+	for i := 0; i < len(data); i++ {
+		row := t.Rows.New()
+		for j := 0; j < n; j++ {
+			row[cols[j]] = data[i][j]
+		}
+	}
+
+	return nil
+}
+
+// sqlColType maps the type of a result column to a ColType..., or
+// "" when it is not known.
+func sqlColType(ct *sql.ColumnType) string {
+	name := strings.ToUpper(strings.TrimSpace(ct.DatabaseTypeName()))
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = strings.TrimSpace(name[:i]) // VARCHAR(20), NUMERIC(10,2)
+	}
+	name = strings.TrimSpace(strings.TrimSuffix(name, "UNSIGNED"))
+
+	switch name {
+	case "INT2", "INT4", "INT8", "SMALLINT", "TINYINT", "MEDIUMINT", "SERIAL",
+		"SMALLSERIAL", "BIGSERIAL", "UNSIGNED BIG INT", "YEAR":
+		return ColTypeInteger
+	case "FLOAT4", "FLOAT8", "DOUBLE PRECISION", "MONEY":
+		return ColTypeFloat
+	case "CHARACTER", "CHARACTER VARYING", "NCHAR", "NVARCHAR", "VARCHAR2",
+		"NVARCHAR2", "BPCHAR", "CITEXT", "CLOB", "NTEXT", "TINYTEXT",
+		"MEDIUMTEXT", "LONGTEXT", "UUID", "UNIQUEIDENTIFIER", "ENUM",
+		"JSON", "JSONB", "XML", "NAME":
+		return ColTypeString
+	case "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITHOUT TIME ZONE",
+		"DATETIME2", "DATETIMEOFFSET", "SMALLDATETIME":
+		return ColTypeDateTime
+	case "TIME", "TIMETZ", "TIME WITH TIME ZONE", "TIME WITHOUT TIME ZONE", "INTERVAL":
+		return ColTypeString // not a point in time
+	}
+	switch typ := normalizeColType(name); typ {
+	case ColTypeString, ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+		return typ
+	}
+
+	// the Go type the driver scans the column into
+	st := ct.ScanType()
+	if st == nil {
+		return ""
+	}
+	switch st {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(sql.NullTime{}):
+		return ColTypeDateTime
+	case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullInt32{}):
+		return ColTypeInteger
+	case reflect.TypeOf(sql.NullFloat64{}):
+		return ColTypeFloat
+	case reflect.TypeOf(sql.NullBool{}):
+		return ColTypeBool
+	case reflect.TypeOf(sql.NullString{}):
+		return ColTypeString
+	}
+	switch st.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ColTypeInteger
+	case reflect.Float32, reflect.Float64:
+		return ColTypeFloat
+	case reflect.Bool:
+		return ColTypeBool
+	case reflect.String:
+		return ColTypeString
+	}
+	return ""
+}
+
+// InsertInto writes the rows of the table to a database table with
+// multi-row INSERT statements. db is a *sql.DB, or a *sql.Tx to
+// write all rows or none. Values are passed as int64, float64,
+// bool, time.Time or string, by the column types.
+func (t *Table) InsertInto(db SQLExecer, tableName string, opts SQLInsertOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if db == nil {
+		return errors.New("InsertInto: db is nil")
+	}
+	if strings.TrimSpace(tableName) == "" {
+		return errors.New("InsertInto: table name is blank")
+	}
+	if opts.Dialect < SQLDialectStandard || opts.Dialect > SQLDialectSQLServer {
+		return fmt.Errorf("InsertInto: invalid dialect: %d", opts.Dialect)
+	}
+	if opts.BatchSize < 0 {
+		return errors.New("InsertInto: BatchSize must not be negative")
+	}
+
+	cols := t.Cols.Get()
+	var selected []Column
+	if len(opts.Columns) > 0 {
+		for i := 0; i < len(opts.Columns); i++ {
+			col, ok := t.Cols.Lookup(opts.Columns[i])
+			if !ok {
+				return fmt.Errorf("column not found: %s", opts.Columns[i])
+			}
+			selected = append(selected, col)
+		}
+	} else {
+		selected = cols
+	}
+	if len(selected) == 0 {
+		return errors.New("InsertInto: the table has no columns")
+	}
+
+	data := make([][]interface{}, len(selected))
+	for j := 0; j < len(selected); j++ {
+		data[j] = t.Cols.GetData(selected[j].Name)
+	}
+
+	var parts []string
+	for _, p := range strings.Split(tableName, ".") {
+		parts = append(parts, sqlQuoteName(opts.Dialect, p))
+	}
+	table := strings.Join(parts, ".")
+
+	if opts.CreateTable {
+		var b strings.Builder
+		b.WriteString("CREATE TABLE " + table + " (")
+		for j := 0; j < len(selected); j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(sqlQuoteName(opts.Dialect, selected[j].Name))
+			b.WriteString(" " + sqlTypeName(opts.Dialect, selected[j], data[j]))
+			if selected[j].NotNull {
+				b.WriteString(" NOT NULL")
+			}
+		}
+		b.WriteString(")")
+		if _, err := db.Exec(b.String()); err != nil {
+			return fmt.Errorf("InsertInto: %v", err)
+		}
+	}
+
+	batch := opts.BatchSize
+	if batch == 0 {
+		batch = minInt(500, 999/len(selected))
+		if batch < 1 {
+			batch = 1
+		}
+	}
+
+	var names []string
+	for j := 0; j < len(selected); j++ {
+		names = append(names, sqlQuoteName(opts.Dialect, selected[j].Name))
+	}
+	head := "INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES "
+
+	// full batches share a prepared statement
+	var stmt *sql.Stmt
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+
+	n := t.Rows.Count()
+	args := make([]interface{}, 0, batch*len(selected))
+	for p := 0; p < n; p += batch {
+		q := minInt(p+batch, n)
+
+		args = args[:0]
+		for i := p; i < q; i++ {
+			for j := 0; j < len(selected); j++ {
+				args = append(args, driverColumnValue(selected[j], data[j][i]))
+			}
+		}
+
+		var err error
+		if q-p == batch {
+			if stmt == nil {
+				if stmt, err = db.Prepare(head + sqlValuesList(opts.Dialect, batch, len(selected))); err != nil {
+					return fmt.Errorf("InsertInto: %v", err)
+				}
+			}
+			_, err = stmt.Exec(args...)
+		} else {
+			_, err = db.Exec(head+sqlValuesList(opts.Dialect, q-p, len(selected)), args...)
+		}
+		if err != nil {
+			return fmt.Errorf("InsertInto: rows %d to %d: %v", p, q-1, err)
+		}
+	}
+
+	return nil
+}
+
+// sqlValuesList returns the placeholders of rows rows of n values:
+// (?, ?), (?, ?)...
+func sqlValuesList(dialect SQLDialect, rows int, n int) string {
+	var b strings.Builder
+	k := 0
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			k++
+			switch dialect {
+			case SQLDialectPostgres:
+				fmt.Fprintf(&b, "$%d", k)
+			case SQLDialectSQLServer:
+				fmt.Fprintf(&b, "@p%d", k)
+			default:
+				b.WriteString("?")
+			}
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// sqlQuoteName quotes a table or column name.
+func sqlQuoteName(dialect SQLDialect, name string) string {
+	switch dialect {
+	case SQLDialectMySQL:
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	case SQLDialectSQLServer:
+		return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// sqlTypeName returns the database type of a column; the type of
+// an untyped column is taken from its values ([]byte values make a
+// binary column).
+func sqlTypeName(dialect SQLDialect, col Column, vals []interface{}) string {
+	typ := typedColType(col)
+	if typ == "" {
+		for i := 0; i < len(vals); i++ {
+			if isNull(vals[i]) {
+				continue
+			}
+			vt := colTypeOf(vals[i])
+			if _, ok := vals[i].([]byte); ok {
+				vt = "binary"
+			}
+			switch {
+			case typ == "":
+				typ = vt
+			case typ == vt:
+			case typ == ColTypeInteger && vt == ColTypeFloat,
+				typ == ColTypeFloat && vt == ColTypeInteger:
+				typ = ColTypeFloat
+			default:
+				typ = ColTypeString
+			}
+		}
+	}
+
+	names := map[string][4]string{ // standard, postgres, mysql, sql server
+		ColTypeInteger:  {"INTEGER", "BIGINT", "BIGINT", "BIGINT"},
+		ColTypeFloat:    {"REAL", "DOUBLE PRECISION", "DOUBLE", "FLOAT"},
+		ColTypeBool:     {"BOOLEAN", "BOOLEAN", "BOOLEAN", "BIT"},
+		ColTypeDateTime: {"TIMESTAMP", "TIMESTAMPTZ", "DATETIME(6)", "DATETIME2"},
+		ColTypeString:   {"TEXT", "TEXT", "TEXT", "NVARCHAR(MAX)"},
+		"binary":        {"BLOB", "BYTEA", "LONGBLOB", "VARBINARY(MAX)"},
+	}
+	if x, ok := names[typ]; ok {
+		return x[dialect]
+	}
+	return names[ColTypeString][dialect]
+}
@@ -0,0 +1,188 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// InsertInto and FromSQLRows through the driver of this package
+// give back the table written.
+func TestInsertIntoFromSQLRowsRoundTrip(t *testing.T) {
+	cols := []Column{
+		{Name: "id", Type: ColTypeInteger},
+		{Name: "name", Type: ColTypeString},
+		{Name: "price", Type: ColTypeFloat},
+		{Name: "ok", Type: ColTypeBool},
+		{Name: "at", Type: ColTypeDateTime},
+	}
+	at := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		src, _ := (&Table{}).Create("src", storage)
+		src.Cols.SetColumns(cols)
+		for i := 0; i < 1234; i++ {
+			row := src.Rows.New()
+			row["id"] = int64(i)
+			row["name"] = fmt.Sprintf("n%d", i)
+			row["price"] = float64(i) / 4
+			row["ok"] = i%2 == 0
+			row["at"] = at.Add(time.Duration(i) * time.Hour)
+			if i%7 == 3 {
+				row["name"], row["price"], row["ok"], row["at"] = nil, nil, nil, nil
+			}
+		}
+
+		target, _ := (&Table{}).Create("items", storage)
+		target.Cols.SetColumns(cols)
+		ds := &Dataset{}
+		if err := ds.Add(*target); err != nil {
+			t.Fatal(err)
+		}
+		if err := RegisterDataset("roundtrip", ds); err != nil {
+			t.Fatal(err)
+		}
+		db, err := sql.Open(DriverName, "roundtrip")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := src.InsertInto(db, "items", SQLInsertOptions{BatchSize: 100}); err != nil {
+			t.Fatalf("storage %d: %v", storage, err)
+		}
+		rows, err := db.Query(`SELECT id, name, price, ok, at FROM items ORDER BY id`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, _ := (&Table{}).Create("dst", storage)
+		if err := dst.FromSQLRows(rows); err != nil {
+			t.Fatalf("storage %d: %v", storage, err)
+		}
+		db.Close()
+		UnregisterDataset("roundtrip")
+
+		for j, c := range dst.Cols.Get() {
+			if c.Name != cols[j].Name || c.Type != cols[j].Type {
+				t.Fatalf("storage %d: column %d is %s %s", storage, j, c.Name, c.Type)
+			}
+		}
+		if got, want := fmt.Sprint(tableValues(dst)), fmt.Sprint(tableValues(src)); got != want {
+			t.Fatalf("storage %d: values differ", storage)
+		}
+	}
+}
+
+// With DISTINCT, ORDER BY can only use the columns selected.
+func TestQueryDistinctOrderBy(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"a", "b"},
+		[]interface{}{"x", int64(3)},
+		[]interface{}{"y", int64(1)},
+		[]interface{}{"x", int64(2)},
+	)
+	ds := &Dataset{}
+	if err := ds.Add(*tbl); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{
+		`SELECT DISTINCT a FROM t ORDER BY b`,
+		`SELECT DISTINCT a FROM t ORDER BY a || b`,
+	} {
+		if _, err := ds.Query(q); err == nil {
+			t.Fatalf("%s: no error", q)
+		}
+	}
+	for _, q := range []string{
+		`SELECT DISTINCT a FROM t ORDER BY a DESC`,
+		`SELECT DISTINCT a AS n FROM t ORDER BY n DESC`,
+		`SELECT DISTINCT a FROM t ORDER BY 1 DESC`,
+		`SELECT DISTINCT a FROM t ORDER BY t.a DESC`,
+	} {
+		res, err := ds.Query(q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		if got := fmt.Sprint(tableValues(res)); got != "[[y] [x]]" {
+			t.Fatalf("%s: %s", q, got)
+		}
+	}
+}
+
+// Only CAST truncates a fraction; INSERT and UPDATE into an Integer
+// column reject it.
+func TestSQLIntegerFractions(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.SetColumns([]Column{{Name: "n", Type: ColTypeInteger}})
+	ds := &Dataset{}
+	if err := ds.Add(*tbl); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{`INSERT INTO t (n) VALUES (1.5)`, `INSERT INTO t (n) VALUES (1e20)`} {
+		if _, err := ds.Exec(q); err == nil {
+			t.Fatalf("%s: no error", q)
+		}
+	}
+	if _, err := ds.Exec(`INSERT INTO t (n) VALUES (2.0)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Exec(`UPDATE t SET n = n + 0.5`); err == nil {
+		t.Fatal("UPDATE: no error")
+	}
+	if _, err := ds.Exec(`INSERT INTO t (n) VALUES (CAST(-2.7 AS INTEGER))`); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ds.Query(`SELECT n, CAST(n * 1.75 AS INTEGER) AS c FROM t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%#v", tableValues(res)); got != "[][]interface {}{[]interface {}{2, 3}, []interface {}{-2, -3}}" {
+		t.Fatal(got)
+	}
+}
+
+// A join on = finds the same rows as the same condition in WHERE,
+// also for values that are equal across types.
+func TestSQLJoinKeysMatchComparisons(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	l, _ := (&Table{}).Create("l")
+	l.Cols.Add("k")
+	r, _ := (&Table{}).Create("r")
+	r.Cols.Add("k")
+	for _, v := range []interface{}{true, day, int64(7), "x"} {
+		l.Rows.New()["k"] = v
+	}
+	for _, v := range []interface{}{"true", "2024-01-02", "7.0", "x", false} {
+		r.Rows.New()["k"] = v
+	}
+	ds := &Dataset{}
+	if err := ds.Add(*l); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(*r); err != nil {
+		t.Fatal(err)
+	}
+
+	join, err := ds.Query(`SELECT r.k FROM l JOIN r ON l.k = r.k`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, err := ds.Query(`SELECT r.k FROM l, r WHERE l.k = r.k`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(tableValues(join)), fmt.Sprint(tableValues(where)); got != want || got != "[[true] [2024-01-02] [7.0] [x]]" {
+		t.Fatalf("join %s, where %s", got, want)
+	}
+
+	j, err := Join(l, r, JoinSpec{LeftCols: []string{"k"}, RightCols: []string{"k"}}, SemiJoin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Rows.Count(); got != 4 {
+		t.Fatalf("Join: %d rows", got)
+	}
+}
@@ -0,0 +1,595 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct fields map to columns by name, or by the name in a
+// `collections:"name,omitempty"` tag; a tag of "-" skips the field.
+// The fields of embedded structs are promoted, as with
+// encoding/json.
+
+// structField is a field of a struct that maps to a column.
+type structField struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+	tagged    bool
+}
+
+var (
+	structFieldsCache sync.Map // reflect.Type -> []structField
+
+	timeType    = reflect.TypeOf(time.Time{})
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// structFields returns the fields of a struct type that map to
+// columns, in field order.
+func structFields(t reflect.Type) []structField {
+	if f, ok := structFieldsCache.Load(t); ok {
+		return f.([]structField)
+	}
+
+	var all []structField
+	collectStructFields(t, nil, map[reflect.Type]bool{}, &all)
+
+	// A name used at several depths goes to the shallowest field;
+	// fields at the same depth are dropped unless one is tagged.
+	var fields []structField
+	for i := 0; i < len(all); i++ {
+		f, keep := all[i], true
+		for k := 0; k < len(all) && keep; k++ {
+			g := all[k]
+			if k == i || !strings.EqualFold(g.name, f.name) {
+				continue
+			}
+			if len(g.index) < len(f.index) ||
+				len(g.index) == len(f.index) && (g.tagged || !f.tagged) {
+				keep = false
+			}
+		}
+		if keep {
+			fields = append(fields, f)
+		}
+	}
+
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectStructFields(t reflect.Type, index []int, visited map[reflect.Type]bool, out *[]structField) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("collections")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if k := strings.Index(tag, ","); k >= 0 {
+			name, opts = tag[:k], tag[k+1:]
+		}
+
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			et := ft
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct && et != timeType && !ft.Implements(valuerType) {
+				collectStructFields(et, idx, visited, out)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+
+		f := structField{name: name, index: idx, typ: ft, tagged: name != ""}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, o := range strings.Split(opts, ",") {
+			if o == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		*out = append(*out, f)
+	}
+}
+
+// structColType returns the column type of a field type; "" for
+// types whose values decide (driver.Valuer).
+func structColType(t reflect.Type) string {
+	if t.Implements(valuerType) {
+		return ""
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if t.Implements(valuerType) {
+			return ""
+		}
+	}
+	if t == timeType {
+		return ColTypeDateTime
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ColTypeInteger
+	case reflect.Float32, reflect.Float64:
+		return ColTypeFloat
+	case reflect.Bool:
+		return ColTypeBool
+	case reflect.String:
+		return ColTypeString
+	}
+	return t.String()
+}
+
+// fieldByIndex returns the field of v at index; ok is false when
+// it is in a nil embedded pointer (that alloc could not set).
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// structValue returns the cell value of a field: integers as int64
+// (uint64 above the int64 range stays uint64), floats as float64,
+// named types as their base type; nil pointers, and empty values
+// of omitempty fields, are nil.
+func structValue(v reflect.Value, omitEmpty bool) (interface{}, error) {
+	if omitEmpty && isEmptyValue(v) {
+		return nil, nil
+	}
+	if v.Type().Implements(valuerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface().(driver.Valuer).Value()
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+		if v.Type().Implements(valuerType) {
+			return v.Interface().(driver.Valuer).Value()
+		}
+	}
+
+	if v.Type() == timeType {
+		return v.Interface(), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	return v.Interface(), nil
+}
+
+// isEmptyValue reports whether v is empty for omitempty: false, 0,
+// "", a nil pointer or interface, an empty slice, map or array, or
+// a zero time.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	return false
+}
+
+// FromStructs adds a row for each element of a slice (or array) of
+// structs or struct pointers. Columns are added for fields that have
+// none, typed from the field types: integers are Integer, floats
+// Float, bool Bool, string String and time.Time DateTime. Values
+// are converted to the type of typed existing columns.
+func (t *Table) FromStructs(slice interface{}) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+
+	sv := reflect.ValueOf(slice)
+	if sv.Kind() == reflect.Ptr && !sv.IsNil() {
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Slice && sv.Kind() != reflect.Array {
+		return fmt.Errorf("FromStructs: want a slice of structs, have %T", slice)
+	}
+	et := sv.Type().Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("FromStructs: want a slice of structs, have %T", slice)
+	}
+
+	fields := structFields(et)
+	names := make([]string, len(fields))
+	types := make([]string, len(fields))
+	added := make([]bool, len(fields))
+	colTypes := make([]string, len(fields)) // of typed existing columns
+	for j, f := range fields {
+		names[j] = f.name
+		types[j] = structColType(f.typ)
+		k := indexOfColumn(t.Cols.Get(), f.name)
+		added[j] = k < 0
+		if k >= 0 && t.Cols.Get()[k].Type != "string" {
+			colTypes[j] = normalizeColType(t.Cols.Get()[k].Type)
+		}
+	}
+
+	// convert all values first: a failure changes nothing
+	n := sv.Len()
+	rows := make([][]interface{}, n)
+	for i := 0; i < n; i++ {
+		ev := sv.Index(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				return fmt.Errorf("FromStructs: element %d is nil", i)
+			}
+			ev = ev.Elem()
+		}
+
+		vals := make([]interface{}, len(fields))
+		for j, f := range fields {
+			fv, ok := fieldByIndex(ev, f.index, false)
+			if !ok {
+				continue
+			}
+			v, err := structValue(fv, f.omitEmpty)
+			if err != nil {
+				return fmt.Errorf("FromStructs: element %d, field %s: %v", i, f.name, err)
+			}
+			switch colTypes[j] {
+			case ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime, ColTypeString:
+				if v, err = castValue(v, colTypes[j]); err != nil {
+					return fmt.Errorf("FromStructs: element %d, field %s: %v", i, f.name, err)
+				}
+			}
+			vals[j] = v
+		}
+		rows[i] = vals
+	}
+
+	cols, err := resolveReadColumns(t, "FromStructs", names, types)
+	if err != nil {
+		return err
+	}
+	all := t.Cols.Get()
+	for i := 0; i < n; i++ {
+		row := t.Rows.New()
+		for j := range cols {
+			row[cols[j]] = rows[i][j]
+		}
+	}
+
+	// new columns of Valuer fields are typed from their values
+	for j := range cols {
+		if !added[j] || types[j] != "" {
+			continue
+		}
+		typ := ""
+		for i := 0; i < n; i++ {
+			if vt := colTypeOf(rows[i][j]); vt != "" && typ == "" {
+				typ = vt
+			} else if vt != "" && vt != typ {
+				typ = ""
+				break
+			}
+		}
+		if typ != "" {
+			all[indexOfColumn(all, cols[j])].Type = typ
+		}
+	}
+
+	return nil
+}
+
+// ToStructs sets dst, a pointer to a slice of structs (or struct
+// pointers), to the rows of the table; see Rows.ScanStruct.
+func (t *Table) ToStructs(dst interface{}) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ToStructs: want a pointer to a slice of structs, have %T", dst)
+	}
+	sv := dv.Elem()
+	et := sv.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("ToStructs: want a pointer to a slice of structs, have %T", dst)
+	}
+
+	rows := t.Rows.GetRows()
+	out := reflect.MakeSlice(sv.Type(), len(rows), len(rows))
+	for i := 0; i < len(rows); i++ {
+		ev := out.Index(i)
+		if isPtr {
+			ev.Set(reflect.New(et))
+			ev = ev.Elem()
+		}
+		if err := scanStruct(rows[i], i, ev); err != nil {
+			return err
+		}
+	}
+	sv.Set(out)
+
+	return nil
+}
+
+// scanStruct sets the fields of the struct v from a row; fields
+// without a column are left as they are.
+func scanStruct(row Row, i int, v reflect.Value) error {
+	for _, f := range structFields(v.Type()) {
+		val, ok := row[f.name]
+		if !ok {
+			found := false
+			for k, x := range row {
+				if k != row_id && strings.EqualFold(k, f.name) {
+					val, found = x, true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		fv, ok := fieldByIndex(v, f.index, true)
+		if !ok {
+			if isNull(val) {
+				continue
+			}
+			return fmt.Errorf("row %d, column %s: cannot set embedded pointer to unexported struct (field %s)", i, f.name, fieldPath(v.Type(), f.index))
+		}
+		if err := assignValue(fv, val); err != nil {
+			return fmt.Errorf("row %d, column %s: %v (field %s)", i, f.name, err, fieldPath(v.Type(), f.index))
+		}
+	}
+	return nil
+}
+
+// fieldPath returns the Go name of a (promoted) field, e.g.
+// Address.City.
+func fieldPath(t reflect.Type, index []int) string {
+	var names []string
+	for _, x := range index {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		sf := t.Field(x)
+		names = append(names, sf.Name)
+		t = sf.Type
+	}
+	return strings.Join(names, ".")
+}
+
+// assignValue sets a field to a cell value, converting it to the
+// type of the field; nil sets the zero value.
+func assignValue(fv reflect.Value, v interface{}) error {
+	ft := fv.Type()
+
+	if isNull(v) {
+		if ft.Kind() != reflect.Ptr && reflect.PtrTo(ft).Implements(scannerType) {
+			return fv.Addr().Interface().(sql.Scanner).Scan(nil)
+		}
+		fv.Set(reflect.Zero(ft))
+		return nil
+	}
+
+	if reflect.PtrTo(ft).Implements(scannerType) {
+		return fv.Addr().Interface().(sql.Scanner).Scan(driverValue(v))
+	}
+	if ft.Kind() == reflect.Ptr {
+		p := reflect.New(ft.Elem())
+		if err := assignValue(p.Elem(), v); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cannot convert %v (%T) to %s", v, v, ft)
+	}
+
+	if ft == timeType {
+		tm, ok := toTime(v)
+		if !ok {
+			return mismatch()
+		}
+		fv.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	switch ft.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt64(v)
+		if u, isUint := v.(uint64); isUint && u > math.MaxInt64 {
+			ok = false
+		}
+		if !ok {
+			return mismatch()
+		}
+		if fv.OverflowInt(i) {
+			return fmt.Errorf("%v overflows %s", v, ft)
+		}
+		fv.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if x, isUint := v.(uint64); isUint {
+			u = x
+		} else {
+			i, ok := toInt64(v)
+			if !ok {
+				return mismatch()
+			}
+			if i < 0 {
+				return fmt.Errorf("%v overflows %s", v, ft)
+			}
+			u = uint64(i)
+		}
+		if fv.OverflowUint(u) {
+			return fmt.Errorf("%v overflows %s", v, ft)
+		}
+		fv.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(v)
+		if !ok {
+			return mismatch()
+		}
+		if fv.OverflowFloat(f) {
+			return fmt.Errorf("%v overflows %s", v, ft)
+		}
+		fv.SetFloat(f)
+
+	case reflect.Bool:
+		// of the numbers, only 0 and 1 are booleans
+		if f, num := toFloat64(v); num && f != 0 && f != 1 {
+			return mismatch()
+		}
+		b, ok := toBool(v)
+		if !ok {
+			return mismatch()
+		}
+		fv.SetBool(b)
+
+	case reflect.String:
+		if b, ok := v.([]byte); ok {
+			fv.SetString(string(b))
+		} else {
+			fv.SetString(toString(v))
+		}
+
+	default:
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Type().AssignableTo(ft):
+			fv.Set(rv)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.String:
+			fv.SetBytes([]byte(rv.String()))
+		case rv.Kind() == ft.Kind() && rv.Type().ConvertibleTo(ft):
+			fv.Set(rv.Convert(ft))
+		default:
+			return mismatch()
+		}
+	}
+
+	return nil
+}
+
+// driverValue converts v to one of the types a sql.Scanner takes:
+// int64, float64, bool, []byte, string or time.Time.
+func driverValue(v interface{}) interface{} {
+	switch {
+	case isIntegerKind(v):
+		if u, ok := v.(uint64); ok && u > math.MaxInt64 {
+			return float64(u)
+		}
+		i, _ := toInt64(v)
+		return i
+	case isFloatKind(v):
+		f, _ := toFloat64(v)
+		return f
+	}
+	if p, ok := v.(*time.Time); ok {
+		return *p
+	}
+	return v
+}
+
+// ScanStruct sets the fields of dst, a pointer to a struct, from
+// row i. Values are converted to the field types (a numeric string
+// to an int, for example); a value that does not convert is an
+// error naming the row, column and field.
+func (r *Rows) ScanStruct(i int, dst interface{}) error {
+	return scanRowStruct(r.GetRow(i), i, dst)
+}
+
+// ScanStruct sets the fields of dst, a pointer to a struct, from
+// row i; see Rows.ScanStruct.
+func (r *ColumnarRows) ScanStruct(i int, dst interface{}) error {
+	return scanRowStruct(r.GetRow(i), i, dst)
+}
+
+func scanRowStruct(row Row, i int, dst interface{}) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct: want a pointer to a struct, have %T", dst)
+	}
+	if row == nil {
+		return fmt.Errorf("row index out of range: %d", i)
+	}
+	return scanStruct(row, i, dv.Elem())
+}
@@ -0,0 +1,35 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"testing"
+)
+
+// Of the numbers, only 0 and 1 are read into a bool field.
+func TestScanStructBool(t *testing.T) {
+	type rec struct {
+		OK bool
+	}
+	for _, storage := range []Storage{RowStorage, ColumnStorage} {
+		tbl := newTestTable(t, storage, []string{"ok"},
+			[]interface{}{int64(1)}, []interface{}{0.0}, []interface{}{"true"}, []interface{}{"0"},
+			[]interface{}{int64(2)}, []interface{}{-1.0}, []interface{}{0.5}, []interface{}{"2"},
+		)
+		for i, want := range []bool{true, false, true, false} {
+			var r rec
+			if err := tbl.Rows.ScanStruct(i, &r); err != nil || r.OK != want {
+				t.Fatalf("storage %d, row %d: %v %v", storage, i, r.OK, err)
+			}
+		}
+		for i := 4; i < tbl.Rows.Count(); i++ {
+			var r rec
+			if err := tbl.Rows.ScanStruct(i, &r); err == nil {
+				t.Fatalf("storage %d, row %d: no error", storage, i)
+			}
+		}
+		var all []rec
+		if err := tbl.ToStructs(&all); err == nil {
+			t.Fatalf("storage %d: ToStructs: no error", storage)
+		}
+	}
+}
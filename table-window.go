@@ -0,0 +1,489 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Frame bounds, as offsets from the current row.
+const (
+	UnboundedPreceding = math.MinInt32
+	CurrentRow         = 0
+	UnboundedFollowing = math.MaxInt32
+)
+
+// Frame is a ROWS BETWEEN frame of a window; Start and End are
+// offsets from the current row (negative for preceding rows), or
+// UnboundedPreceding/UnboundedFollowing.
+type Frame struct {
+	Start int
+	End   int
+}
+
+// Window describes how rows are partitioned and ordered for window
+// functions; it is created by Table.PartitionBy or Table.OrderBy.
+type Window struct {
+	tbl       *Table
+	partition []string
+	orderCols []string
+	orders    []SortOrder
+	frame     *Frame
+}
+
+// WindowFunc is a function computed for each row over its window.
+type WindowFunc struct {
+	// Func is row_number, rank, dense_rank, lag, lead,
+	// first_value, last_value or "aggregate".
+	Func string
+
+	// Col is the column the function reads.
+	Col string
+
+	// Name is the name of the new column; a name is derived from
+	// Func and Col when it is blank.
+	Name string
+
+	// Offset and Default are used by Lag and Lead.
+	Offset  int
+	Default interface{}
+
+	agg   *Aggregate
+	frame *Frame
+
+	// set by a constructor given invalid arguments
+	err error
+}
+
+// PartitionBy creates a window over the table whose partitions are
+// the groups of rows with equal values in cols.
+func (t *Table) PartitionBy(cols ...string) *Window {
+	return &Window{tbl: t, partition: cols}
+}
+
+// OrderBy creates a window over the whole table ordered by col.
+func (t *Table) OrderBy(col string, order SortOrder) *Window {
+	return (&Window{tbl: t}).OrderBy(col, order)
+}
+
+// OrderBy adds a sort column to the window.
+func (w *Window) OrderBy(col string, order SortOrder) *Window {
+	w.orderCols = append(w.orderCols, col)
+	w.orders = append(w.orders, order)
+	return w
+}
+
+// Rows sets the default frame of the window's aggregate functions
+// (ROWS BETWEEN start AND end). Without it the frame is the whole
+// partition for unordered windows, and the rows from the start of
+// the partition to the current row for ordered ones.
+func (w *Window) Rows(start, end int) *Window {
+	w.frame = &Frame{Start: start, End: end}
+	return w
+}
+
+// RowNumber numbers the rows of each partition from 1.
+func RowNumber() WindowFunc {
+	return WindowFunc{Func: "row_number"}
+}
+
+// Rank ranks the rows by the window order; peers get the same rank
+// and leave gaps (1, 1, 3).
+func Rank() WindowFunc {
+	return WindowFunc{Func: "rank"}
+}
+
+// DenseRank ranks the rows by the window order without gaps (1, 1, 2).
+func DenseRank() WindowFunc {
+	return WindowFunc{Func: "dense_rank"}
+}
+
+// Lag gets the value of col offset rows before the current row, or
+// def if there is no such row in the partition.
+func Lag(col string, offset int, def interface{}) WindowFunc {
+	return WindowFunc{Func: "lag", Col: col, Offset: offset, Default: def}
+}
+
+// Lead gets the value of col offset rows after the current row, or
+// def if there is no such row in the partition.
+func Lead(col string, offset int, def interface{}) WindowFunc {
+	return WindowFunc{Func: "lead", Col: col, Offset: offset, Default: def}
+}
+
+// FirstValue gets the value of col in the first row of the frame.
+func FirstValue(col string) WindowFunc {
+	return WindowFunc{Func: "first_value", Col: col}
+}
+
+// LastValue gets the value of col in the last row of the frame.
+func LastValue(col string) WindowFunc {
+	return WindowFunc{Func: "last_value", Col: col}
+}
+
+// Over computes an aggregate (Sum, Avg, Count...) over the frame
+// of each row.
+func Over(agg Aggregate) WindowFunc {
+	return WindowFunc{Func: "aggregate", Col: agg.Col, Name: agg.Name, agg: &agg}
+}
+
+// CumSum is the running total of col within the partition.
+func CumSum(col string) WindowFunc {
+	return Over(Sum(col)).Rows(UnboundedPreceding, CurrentRow)
+}
+
+// MovingAvg is the average of col over the current row and the
+// n-1 rows before it; n must be at least 1.
+func MovingAvg(col string, n int) WindowFunc {
+	if n < 1 {
+		f := Over(Avg(col))
+		f.err = fmt.Errorf("moving average of %s: n must be at least 1, have %d", col, n)
+		return f
+	}
+	return Over(Avg(col)).Rows(-(n - 1), CurrentRow)
+}
+
+// As sets the name of the new column.
+func (f WindowFunc) As(name string) WindowFunc {
+	f.Name = name
+	return f
+}
+
+// Rows sets the frame of this function, overriding the window's.
+func (f WindowFunc) Rows(start, end int) WindowFunc {
+	f.frame = &Frame{Start: start, End: end}
+	return f
+}
+
+func (f WindowFunc) resultName() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	if f.agg != nil {
+		return f.agg.resultName()
+	}
+	if f.Col == "" {
+		return f.Func
+	}
+	return fmt.Sprintf("%s_%s", f.Func, f.Col)
+}
+
+// Apply computes the functions for every row and stores the results
+// in new columns of the table. The order of the rows in the table
+// does not change.
+func (w *Window) Apply(funcs ...WindowFunc) error {
+
+	if w.tbl == nil || w.tbl.Cols == nil || w.tbl.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if len(funcs) == 0 {
+		return errors.New("no window functions specified")
+	}
+
+	cols := w.tbl.Cols.Get()
+
+	partCols, err := resolveColumns(cols, w.partition)
+	if err != nil {
+		return err
+	}
+	orderCols, err := resolveColumns(cols, w.orderCols)
+	if err != nil {
+		return err
+	}
+
+	// Validate the functions and the new column names.
+	srcCols := make([]string, len(funcs))
+	for i := 0; i < len(funcs); i++ {
+		f := funcs[i]
+		if f.err != nil {
+			return f.err
+		}
+		framed := f.Func == "first_value" || f.Func == "last_value" || f.Func == "aggregate"
+		if fr := w.frameOf(f, len(orderCols) > 0); framed && fr.Start > fr.End {
+			return fmt.Errorf("%s: frame start %d is after its end %d", f.resultName(), fr.Start, fr.End)
+		}
+		switch f.Func {
+		case "row_number":
+		case "rank", "dense_rank":
+			if len(orderCols) == 0 {
+				return fmt.Errorf("%s requires an ordered window", f.Func)
+			}
+		case "lag", "lead":
+			if f.Offset < 0 {
+				return fmt.Errorf("%s: offset must not be negative", f.Func)
+			}
+		case "first_value", "last_value":
+		case "aggregate":
+			if _, err := f.agg.newState(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown window function: %s", f.Func)
+		}
+		if f.Col != "" {
+			j := indexOfColumn(cols, f.Col)
+			if j < 0 {
+				return fmt.Errorf("column not found: %s", f.Col)
+			}
+			srcCols[i] = cols[j].Name
+		} else if f.Func != "row_number" && f.Func != "rank" && f.Func != "dense_rank" &&
+			!(f.Func == "aggregate" && f.agg.Func == "count") {
+			return fmt.Errorf("%s requires a column", f.Func)
+		}
+
+		name := f.resultName()
+		if w.tbl.Cols.Exists(name) {
+			return fmt.Errorf("column already exists: %s", name)
+		}
+		for j := 0; j < i; j++ {
+			if strings.EqualFold(name, funcs[j].resultName()) {
+				return fmt.Errorf("duplicate result column: %s", name)
+			}
+		}
+	}
+
+	rows := w.tbl.Rows.GetRows()
+	partitions := w.partitionRows(rows, partCols, orderCols)
+
+	results := make([][]interface{}, len(funcs))
+	for i := 0; i < len(funcs); i++ {
+		results[i] = make([]interface{}, len(rows))
+	}
+
+	for _, part := range partitions {
+		for i := 0; i < len(funcs); i++ {
+			if err := w.computePartition(funcs[i], srcCols[i], rows, part, orderCols, results[i]); err != nil {
+				return fmt.Errorf("%s: %v", funcs[i].resultName(), err)
+			}
+		}
+	}
+
+	// Add the columns and store the values.
+	for i := 0; i < len(funcs); i++ {
+		name := funcs[i].resultName()
+		typ := windowColType(funcs[i], cols, srcCols[i], results[i])
+
+		w.tbl.Cols.Add(name)
+		newCols := w.tbl.Cols.Get()
+		newCols[len(newCols)-1].Type = typ
+
+		for r := 0; r < len(rows); r++ {
+			w.tbl.Rows.SetValue(r, name, results[i][r])
+		}
+	}
+
+	return nil
+}
+
+// resolveColumns maps names to the column names of the table.
+func resolveColumns(cols []Column, names []string) ([]string, error) {
+	out := make([]string, len(names))
+	for i := 0; i < len(names); i++ {
+		j := indexOfColumn(cols, names[i])
+		if j < 0 {
+			return nil, fmt.Errorf("column not found: %s", names[i])
+		}
+		out[i] = cols[j].Name
+	}
+	return out, nil
+}
+
+// partitionRows groups the row indexes by the partition columns (in
+// order of first appearance) and sorts each partition.
+func (w *Window) partitionRows(rows []Row, partCols, orderCols []string) [][]int {
+	var parts [][]int
+	index := make(map[string]int)
+
+	for i := 0; i < len(rows); i++ {
+		vals := make([]interface{}, len(partCols))
+		for j := 0; j < len(partCols); j++ {
+			vals[j] = rows[i][partCols[j]]
+		}
+		k := valuesKey(vals)
+		p, ok := index[k]
+		if !ok {
+			p = len(parts)
+			index[k] = p
+			parts = append(parts, nil)
+		}
+		parts[p] = append(parts[p], i)
+	}
+
+	if len(orderCols) > 0 {
+		for _, part := range parts {
+			sort.SliceStable(part, func(x, y int) bool {
+				return w.compareRows(rows[part[x]], rows[part[y]], orderCols) < 0
+			})
+		}
+	}
+
+	return parts
+}
+
+// compareRows compares two rows by the window order.
+func (w *Window) compareRows(a, b Row, orderCols []string) int {
+	for k := 0; k < len(orderCols); k++ {
+		c := compareValues(a[orderCols[k]], b[orderCols[k]])
+		if c == 0 {
+			continue
+		}
+		if w.orders[k] == Desc {
+			return -c
+		}
+		return c
+	}
+	return 0
+}
+
+// frameOf returns the frame of a function.
+func (w *Window) frameOf(f WindowFunc, ordered bool) Frame {
+	if f.frame != nil {
+		return *f.frame
+	}
+	if w.frame != nil {
+		return *w.frame
+	}
+	if ordered {
+		return Frame{Start: UnboundedPreceding, End: CurrentRow}
+	}
+	return Frame{Start: UnboundedPreceding, End: UnboundedFollowing}
+}
+
+// frameBounds returns the first and last position (inclusive) of
+// the frame of the row at position i in a partition of n rows.
+func frameBounds(fr Frame, i int, n int) (int, int) {
+	from, to := 0, n-1
+	if fr.Start != UnboundedPreceding {
+		from = i + fr.Start
+	}
+	if fr.End != UnboundedFollowing {
+		to = i + fr.End
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to > n-1 {
+		to = n - 1
+	}
+	return from, to
+}
+
+// computePartition computes f for the rows of one (sorted)
+// partition; out is indexed by the row's position in the table.
+func (w *Window) computePartition(f WindowFunc, col string, rows []Row, part []int, orderCols []string, out []interface{}) error {
+	n := len(part)
+
+	switch f.Func {
+	case "row_number":
+		for i := 0; i < n; i++ {
+			out[part[i]] = int64(i + 1)
+		}
+
+	case "rank", "dense_rank":
+		rank, dense := int64(1), int64(1)
+		for i := 0; i < n; i++ {
+			if i > 0 && w.compareRows(rows[part[i-1]], rows[part[i]], orderCols) != 0 {
+				rank = int64(i + 1)
+				dense++
+			}
+			if f.Func == "rank" {
+				out[part[i]] = rank
+			} else {
+				out[part[i]] = dense
+			}
+		}
+
+	case "lag", "lead":
+		off := f.Offset
+		if f.Func == "lag" {
+			off = -off
+		}
+		for i := 0; i < n; i++ {
+			j := i + off
+			if j < 0 || j >= n {
+				out[part[i]] = f.Default
+				continue
+			}
+			out[part[i]] = rows[part[j]][col]
+		}
+
+	case "first_value", "last_value":
+		fr := w.frameOf(f, len(orderCols) > 0)
+		for i := 0; i < n; i++ {
+			from, to := frameBounds(fr, i, n)
+			if from > to {
+				out[part[i]] = nil
+				continue
+			}
+			if f.Func == "first_value" {
+				out[part[i]] = rows[part[from]][col]
+			} else {
+				out[part[i]] = rows[part[to]][col]
+			}
+		}
+
+	case "aggregate":
+		fr := w.frameOf(f, len(orderCols) > 0)
+		value := func(j int) interface{} {
+			if col == "" {
+				return nil
+			}
+			return rows[part[j]][col]
+		}
+
+		// A frame that starts at the top of the partition grows
+		// row by row, so one accumulator is enough.
+		if fr.Start == UnboundedPreceding {
+			st, _ := f.agg.newState()
+			added := 0
+			for i := 0; i < n; i++ {
+				_, to := frameBounds(fr, i, n)
+				for ; added <= to; added++ {
+					if err := st.add(value(added)); err != nil {
+						return err
+					}
+				}
+				out[part[i]] = st.result()
+			}
+			return nil
+		}
+
+		for i := 0; i < n; i++ {
+			st, _ := f.agg.newState()
+			from, to := frameBounds(fr, i, n)
+			for j := from; j <= to; j++ {
+				if err := st.add(value(j)); err != nil {
+					return err
+				}
+			}
+			out[part[i]] = st.result()
+		}
+	}
+
+	return nil
+}
+
+// windowColType is the type of the column created for f; the
+// values of aggregates are made consistent with the type.
+func windowColType(f WindowFunc, cols []Column, col string, vals []interface{}) string {
+	switch f.Func {
+	case "row_number", "rank", "dense_rank":
+		return ColTypeInteger
+	case "lag", "lead", "first_value", "last_value":
+		return cols[indexOfColumn(cols, col)].Type
+	}
+
+	srcType := ""
+	if col != "" {
+		srcType = cols[indexOfColumn(cols, col)].Type
+	}
+
+	rows := make([][]interface{}, len(vals))
+	for i := 0; i < len(vals); i++ {
+		rows[i] = vals[i : i+1]
+	}
+
+	return aggColType(*f.agg, srcType, rows, 0)
+}
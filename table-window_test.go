@@ -0,0 +1,44 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMovingAvg(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"v"},
+		[]interface{}{1.0}, []interface{}{3.0}, []interface{}{5.0},
+	)
+	if err := tbl.OrderBy("v", Asc).Apply(MovingAvg("v", 2).As("avg")); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tbl.Cols.GetData("avg")); got != "[1 2 4]" {
+		t.Fatal(got)
+	}
+}
+
+// A moving average of less than one row, or a frame that starts
+// after its end, is an error.
+func TestWindowInvalidFrame(t *testing.T) {
+	tbl := newTestTable(t, RowStorage, []string{"v"}, []interface{}{1.0})
+	for _, n := range []int{0, -1} {
+		if err := tbl.OrderBy("v", Asc).Apply(MovingAvg("v", n)); err == nil {
+			t.Fatalf("n = %d: no error", n)
+		}
+	}
+	if err := tbl.OrderBy("v", Asc).Apply(Over(Sum("v")).Rows(1, -1)); err == nil {
+		t.Fatal("function frame: no error")
+	}
+	if err := tbl.OrderBy("v", Asc).Rows(CurrentRow, UnboundedPreceding).Apply(LastValue("v")); err == nil {
+		t.Fatal("window frame: no error")
+	}
+	if tbl.Cols.Exists("avg_v") || len(tbl.Cols.Get()) != 1 {
+		t.Fatal("columns were added")
+	}
+
+	// the window frame does not apply to row numbers
+	if err := tbl.OrderBy("v", Asc).Rows(1, -1).Apply(RowNumber()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,623 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxReader reads the parts of a workbook.
+type xlsxReader struct {
+	files      map[string]*zip.File
+	sheets     []xlsxSheetRef
+	strs       []string // shared strings
+	dateStyles []bool   // cell styles with a date format
+	date1904   bool
+}
+
+type xlsxSheetRef struct {
+	name string
+	path string
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbookXML struct {
+	Props struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"id,attr"` // r:id
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxStylesXML struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	Xfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSharedStringsXML struct {
+	Items []struct {
+		T    *string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+// ReadXLSX reads a sheet of an Excel workbook (opts.Sheet, default
+// the first one) into the table. The first row holds the column
+// names unless opts.NoHeader is set. The columns are added as for
+// ReadJSON and their types (Integer, Float, Bool, DateTime, String)
+// are taken from the cells; numbers with a date format are dates.
+func (t *Table) ReadXLSX(r io.Reader, opts XLSXOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	xr, err := openXLSX(r)
+	if err != nil {
+		return err
+	}
+
+	sheet := xr.sheets[0]
+	if opts.Sheet != "" {
+		found := false
+		for _, s := range xr.sheets {
+			if strings.EqualFold(s.name, opts.Sheet) {
+				sheet, found = s, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("xlsx: sheet not found: %s", opts.Sheet)
+		}
+	}
+
+	return xr.load(t, sheet, &opts)
+}
+
+// ReadXLSX adds a table for each sheet of an Excel workbook (or for
+// opts.Sheet only), named after the sheet; see Table.ReadXLSX.
+func (d *Dataset) ReadXLSX(r io.Reader, opts XLSXOptions) error {
+
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	xr, err := openXLSX(r)
+	if err != nil {
+		return err
+	}
+
+	var sheets []xlsxSheetRef
+	for _, s := range xr.sheets {
+		if opts.Sheet == "" || strings.EqualFold(s.name, opts.Sheet) {
+			sheets = append(sheets, s)
+		}
+	}
+	if len(sheets) == 0 {
+		return fmt.Errorf("xlsx: sheet not found: %s", opts.Sheet)
+	}
+	for _, s := range sheets {
+		if d.TableExists(&Table{Name: s.name}) {
+			return fmt.Errorf("table already exists: %s", s.name)
+		}
+	}
+
+	for _, s := range sheets {
+		tbl, err := (&Table{}).Create(s.name)
+		if err != nil {
+			return err
+		}
+		if err := xr.load(tbl, s, &opts); err != nil {
+			return err
+		}
+		if err := d.Add(*tbl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openXLSX reads the workbook, its relationships, the shared
+// strings and the styles.
+func openXLSX(r io.Reader) (*xlsxReader, error) {
+	ra, size, err := readerAtOf(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: not an Excel workbook: %v", err)
+	}
+
+	xr := &xlsxReader{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		xr.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	// the workbook is the office document of the package
+	wbPath := "xl/workbook.xml"
+	var rels xlsxRels
+	if err := xr.unmarshal("_rels/.rels", &rels); err == nil {
+		for _, rel := range rels.Rels {
+			if strings.HasSuffix(rel.Type, "/officeDocument") {
+				wbPath = xlsxPartPath("", rel.Target)
+				break
+			}
+		}
+	}
+
+	var wb xlsxWorkbookXML
+	if err := xr.unmarshal(wbPath, &wb); err != nil {
+		return nil, err
+	}
+	xr.date1904 = wb.Props.Date1904 == "1" || wb.Props.Date1904 == "true"
+
+	dir := path.Dir(wbPath)
+	var wbRels xlsxRels
+	if err := xr.unmarshal(path.Join(dir, "_rels", path.Base(wbPath)+".rels"), &wbRels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range wbRels.Rels {
+		target := xlsxPartPath(dir, rel.Target)
+		targets[rel.ID] = target
+		switch {
+		case strings.HasSuffix(rel.Type, "/sharedStrings"):
+			if err := xr.readSharedStrings(target); err != nil {
+				return nil, err
+			}
+		case strings.HasSuffix(rel.Type, "/styles"):
+			if err := xr.readStyles(target); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, s := range wb.Sheets {
+		if p, ok := targets[s.ID]; ok {
+			xr.sheets = append(xr.sheets, xlsxSheetRef{name: s.Name, path: p})
+		}
+	}
+	if len(xr.sheets) == 0 {
+		return nil, errors.New("xlsx: the workbook has no sheets")
+	}
+
+	return xr, nil
+}
+
+// xlsxPartPath resolves the target of a relationship.
+func xlsxPartPath(dir, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(path.Clean(target), "/")
+	}
+	return path.Join(dir, target)
+}
+
+func (xr *xlsxReader) open(name string) (io.ReadCloser, error) {
+	f, ok := xr.files[name]
+	if !ok {
+		return nil, fmt.Errorf("xlsx: missing part %s", name)
+	}
+	return f.Open()
+}
+
+func (xr *xlsxReader) unmarshal(name string, v interface{}) error {
+	rc, err := xr.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: %s: %v", name, err)
+	}
+	return nil
+}
+
+func (xr *xlsxReader) readSharedStrings(name string) error {
+	var sst xlsxSharedStringsXML
+	if err := xr.unmarshal(name, &sst); err != nil {
+		return err
+	}
+	xr.strs = make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		var s string
+		if si.T != nil {
+			s = *si.T
+		}
+		// rich text: the runs (phonetic runs are not included)
+		for _, run := range si.Runs {
+			s += run.T
+		}
+		xr.strs[i] = xlsxUnescape(s)
+	}
+	return nil
+}
+
+func (xr *xlsxReader) readStyles(name string) error {
+	var st xlsxStylesXML
+	if err := xr.unmarshal(name, &st); err != nil {
+		return err
+	}
+	custom := make(map[int]string)
+	for _, f := range st.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	xr.dateStyles = make([]bool, len(st.Xfs))
+	for i, xf := range st.Xfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			xr.dateStyles[i] = xlsxIsDateFormat(code)
+		} else {
+			xr.dateStyles[i] = xlsxIsDateFormatID(xf.NumFmtID)
+		}
+	}
+	return nil
+}
+
+// xlsxIsDateFormatID reports whether a built-in number format is a
+// date or time format.
+func xlsxIsDateFormatID(id int) bool {
+	return id >= 14 && id <= 22 || id >= 27 && id <= 36 || id >= 45 && id <= 47 || id >= 50 && id <= 58
+}
+
+// xlsxIsDateFormat reports whether a number format code has date or
+// time parts outside of quoted text, brackets (colors, conditions)
+// and escaped characters.
+func xlsxIsDateFormat(code string) bool {
+	inQuote, inBracket := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case inQuote:
+			inQuote = c != '"'
+		case inBracket:
+			inBracket = c != ']'
+		case c == '"':
+			inQuote = true
+		case c == '[':
+			inBracket = true
+		case c == '\\' || c == '_' || c == '*':
+			i++ // the next character is literal (or a fill)
+		default:
+			switch c | 0x20 {
+			case 'y', 'm', 'd', 'h', 's':
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// xlsxUnescape decodes the _xHHHH_ escapes of characters that XML
+// does not allow.
+func xlsxUnescape(s string) string {
+	if !strings.Contains(s, "_x") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if xlsxIsCharEscape(s[i:]) {
+			c, _ := strconv.ParseUint(s[i+2:i+6], 16, 16)
+			b.WriteRune(rune(c))
+			i += 6
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// xlsxRow is a row of a sheet; num is 1-based.
+type xlsxRow struct {
+	num   int
+	cells []interface{}
+}
+
+// readSheet returns the rows of a sheet that have cells, with the
+// first column that has a value.
+func (xr *xlsxReader) readSheet(name string) ([]xlsxRow, int, error) {
+	rc, err := xr.open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+
+	var rows []xlsxRow
+	var row *xlsxRow
+	var typ, text string
+	var style, col int
+	var inValue, inInline, inText, inPhonetic bool
+	minCol := -1
+
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("xlsx: %s: %v", name, err)
+		}
+
+		switch x := tok.(type) {
+		case xml.StartElement:
+			switch x.Name.Local {
+			case "row":
+				num := 1
+				if len(rows) > 0 {
+					num = rows[len(rows)-1].num + 1
+				}
+				if s := xlsxAttr(x, "r"); s != "" {
+					if num, err = strconv.Atoi(s); err != nil || num < 1 {
+						return nil, 0, fmt.Errorf("xlsx: %s: invalid row number %q", name, s)
+					}
+				}
+				rows = append(rows, xlsxRow{num: num})
+				row = &rows[len(rows)-1]
+				col = -1
+
+			case "c":
+				if row == nil {
+					return nil, 0, fmt.Errorf("xlsx: %s: cell outside of a row", name)
+				}
+				col++
+				if ref := xlsxAttr(x, "r"); ref != "" {
+					if col = xlsxColIndex(ref); col < 0 {
+						return nil, 0, fmt.Errorf("xlsx: %s: invalid cell reference %q", name, ref)
+					}
+				}
+				typ = xlsxAttr(x, "t")
+				style, _ = strconv.Atoi(xlsxAttr(x, "s"))
+				text = ""
+
+			case "v":
+				inValue = true
+			case "is":
+				inInline = true
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+
+		case xml.CharData:
+			if inValue || inInline && inText && !inPhonetic {
+				text += string(x)
+			}
+
+		case xml.EndElement:
+			switch x.Name.Local {
+			case "v":
+				inValue = false
+			case "is":
+				inInline = false
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			case "c":
+				v, err := xr.value(typ, style, text)
+				if err != nil {
+					return nil, 0, fmt.Errorf("xlsx: %s: row %d: %v", name, row.num, err)
+				}
+				if v == nil {
+					continue
+				}
+				for len(row.cells) <= col {
+					row.cells = append(row.cells, nil)
+				}
+				row.cells[col] = v
+				if minCol < 0 || col < minCol {
+					minCol = col
+				}
+			case "sheetData":
+				return rows, minCol, nil
+			}
+		}
+	}
+
+	return rows, minCol, nil
+}
+
+func xlsxAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// xlsxColIndex returns the column of a cell reference (e.g. B7);
+// -1 if it is not valid.
+func xlsxColIndex(ref string) int {
+	col := 0
+	i := 0
+	for ; i < len(ref); i++ {
+		c := ref[i] | 0x20
+		if c < 'a' || c > 'z' {
+			break
+		}
+		col = col*26 + int(c-'a') + 1
+		if col > xlsxMaxCols {
+			return -1
+		}
+	}
+	if i == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+// value converts the text of a cell to a value.
+func (xr *xlsxReader) value(typ string, style int, text string) (interface{}, error) {
+	switch typ {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil || i < 0 || i >= len(xr.strs) {
+			return nil, fmt.Errorf("invalid shared string %q", text)
+		}
+		return xr.strs[i], nil
+	case "str", "inlineStr":
+		return xlsxUnescape(text), nil
+	case "b":
+		return strings.TrimSpace(text) == "1" || strings.TrimSpace(text) == "true", nil
+	case "e":
+		return nil, nil // #N/A, #DIV/0! ...
+	case "d":
+		if tm, ok := parseTime(text); ok {
+			return tm, nil
+		}
+		return text, nil
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return text, nil
+	}
+	if style >= 0 && style < len(xr.dateStyles) && xr.dateStyles[style] {
+		if tm, ok := xr.date(f); ok {
+			return tm, nil
+		}
+	}
+	if f == math.Trunc(f) && math.Abs(f) <= xlsxMaxInteger {
+		return int64(f), nil
+	}
+	return f, nil
+}
+
+// date converts an Excel date serial to a time (UTC), rounded to
+// the millisecond.
+func (xr *xlsxReader) date(serial float64) (time.Time, bool) {
+	if serial < 0 || serial > 2958466 {
+		return time.Time{}, false
+	}
+
+	epoch := xlsxEpoch
+	if xr.date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial >= 1 && serial < 60 {
+		// before the 1900-02-29 that Excel counts
+		serial++
+	}
+
+	ms := int64(math.Round(serial * 86400000))
+	days := ms / 86400000
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(ms%86400000) * time.Millisecond), true
+}
+
+// load reads a sheet into a table.
+func (xr *xlsxReader) load(t *Table, sheet xlsxSheetRef, opts *XLSXOptions) error {
+	rows, minCol, err := xr.readSheet(sheet.path)
+	if err != nil {
+		return err
+	}
+
+	// rows without values before the first and after the last one
+	// are not read; columns start at the first one with a value
+	empty := func(r xlsxRow) bool {
+		for _, v := range r.cells {
+			if v != nil {
+				return false
+			}
+		}
+		return true
+	}
+	for len(rows) > 0 && empty(rows[0]) {
+		rows = rows[1:]
+	}
+	for len(rows) > 0 && empty(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	width := 0
+	for i := range rows {
+		rows[i].cells = rows[i].cells[minCol:]
+		if len(rows[i].cells) > width {
+			width = len(rows[i].cells)
+		}
+	}
+
+	header := make([]interface{}, width)
+	var names []string
+	for j := 0; j < width; j++ {
+		name := ""
+		if !opts.NoHeader && j < len(rows[0].cells) && rows[0].cells[j] != nil {
+			name = strings.TrimSpace(toString(rows[0].cells[j]))
+		}
+		if name == "" {
+			name = fmt.Sprintf("col_%d", j+1)
+		}
+		base := name
+		for n := 2; containsFold(names, name) || strings.EqualFold(name, row_id); n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		names = append(names, name)
+		header[j] = name
+	}
+	if !opts.NoHeader {
+		rows = rows[1:]
+	}
+
+	// the rows are added as JSON arrays, whose first one names the
+	// columns; cells keep their type (dates in text stay text)
+	jr := newJSONRecordReader(t, &JSONReadOptions{KeepStrings: true})
+	if err := jr.add(header); err != nil {
+		return fmt.Errorf("xlsx: sheet %s: %v", sheet.name, err)
+	}
+
+	prev := 0
+	if len(rows) > 0 {
+		prev = rows[0].num - 1
+	}
+	for _, r := range rows {
+		// rows that are not in the sheet are blank
+		for ; prev < r.num-1; prev++ {
+			if err := jr.add(make([]interface{}, width)); err != nil {
+				return err
+			}
+		}
+		vals := make([]interface{}, width)
+		copy(vals, r.cells)
+		if err := jr.add(vals); err != nil {
+			return err
+		}
+		prev = r.num
+	}
+
+	return jr.finish()
+}
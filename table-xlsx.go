@@ -0,0 +1,584 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// XLSXOptions configures WriteXLSX and ReadXLSX. The zero value
+// writes one sheet named after the table, with a header row, and
+// reads the first sheet of a workbook.
+type XLSXOptions struct {
+	// Sheet is the name of the sheet to write (default the table
+	// name) or to read (default the first sheet).
+	Sheet string
+
+	// NoHeader writes no header row; when reading, the first row
+	// is data and the columns are named col_1, col_2, ...
+	NoHeader bool
+
+	// Columns selects (and orders) the columns to write.
+	Columns []string
+
+	// DateFormat is the Excel number format of DateTime cells;
+	// default "yyyy-mm-dd hh:mm:ss", or "yyyy-mm-dd" for columns
+	// whose times are all midnight.
+	DateFormat string
+}
+
+// Excel limits.
+const (
+	xlsxMaxRows    = 1 << 20
+	xlsxMaxCols    = 1 << 14
+	xlsxMaxText    = 32767
+	xlsxMaxSheet   = 31
+	xlsxMaxInteger = 1 << 53 // larger integers lose precision as doubles
+)
+
+// cell styles (indexes into cellXfs of styles.xml)
+const (
+	xlsxStyleHeader   = 1
+	xlsxStyleDateTime = 2
+	xlsxStyleDate     = 3
+)
+
+const (
+	xlsxNsMain    = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxNsRels    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxNsPkgRels = "http://schemas.openxmlformats.org/package/2006/relationships"
+	xlsxXMLHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+)
+
+// Dates are stored as days since 1899-12-30 (the 1900 date system,
+// which counts 1900-02-29); dates before March 1900 are written as
+// text.
+var (
+	xlsxEpoch   = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	xlsxMinDate = time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// xlsxSheet is a table to be written as a sheet.
+type xlsxSheet struct {
+	name string
+	cols []Column
+	data [][]interface{}
+	rows int
+}
+
+// xlsxWriter writes the parts of a workbook.
+type xlsxWriter struct {
+	zw         *zip.Writer
+	opts       *XLSXOptions
+	strs       []string // shared strings
+	strIndex   map[string]int
+	stringRefs int
+}
+
+// WriteXLSX writes the table as an Excel workbook with one sheet.
+// Integer, Float, Bool and DateTime values are written as typed
+// cells (dates in their own time zone, as Excel has none); the
+// header row is bold and frozen, and the column widths fit the
+// values.
+func (t *Table) WriteXLSX(w io.Writer, opts XLSXOptions) error {
+
+	if t.Cols == nil || t.Rows == nil {
+		return errors.New("table is not initialized")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+
+	name := opts.Sheet
+	if name == "" {
+		name = t.Name
+	}
+	sh, err := newXLSXSheet(t, xlsxSheetName(name, nil), opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	return writeXLSX(w, []*xlsxSheet{sh}, &opts)
+}
+
+// WriteXLSX writes the tables of the dataset as an Excel workbook,
+// one sheet per table; opts.Sheet and opts.Columns are ignored.
+func (d *Dataset) WriteXLSX(w io.Writer, opts XLSXOptions) error {
+
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if len(d.Tables) == 0 {
+		return errors.New("dataset has no tables")
+	}
+
+	var sheets []*xlsxSheet
+	var names []string
+	for i := 0; i < len(d.Tables); i++ {
+		t := &d.Tables[i]
+		if t.Cols == nil || t.Rows == nil {
+			return fmt.Errorf("table %s is not initialized", t.Name)
+		}
+		name := xlsxSheetName(t.Name, names)
+		names = append(names, name)
+
+		sh, err := newXLSXSheet(t, name, nil)
+		if err != nil {
+			return err
+		}
+		sheets = append(sheets, sh)
+	}
+
+	return writeXLSX(w, sheets, &opts)
+}
+
+func newXLSXSheet(t *Table, name string, columns []string) (*xlsxSheet, error) {
+	cols := t.Cols.Get()
+	var selected []Column
+	if len(columns) > 0 {
+		for i := 0; i < len(columns); i++ {
+			col, ok := t.Cols.Lookup(columns[i])
+			if !ok {
+				return nil, fmt.Errorf("column not found: %s", columns[i])
+			}
+			selected = append(selected, col)
+		}
+	} else {
+		selected = cols
+	}
+
+	if len(selected) > xlsxMaxCols {
+		return nil, fmt.Errorf("xlsx: table %s has more than %d columns", t.Name, xlsxMaxCols)
+	}
+	if t.Rows.Count() >= xlsxMaxRows {
+		return nil, fmt.Errorf("xlsx: table %s has more than %d rows", t.Name, xlsxMaxRows-1)
+	}
+
+	sh := &xlsxSheet{name: name, cols: selected, rows: t.Rows.Count()}
+	for j := 0; j < len(selected); j++ {
+		sh.data = append(sh.data, t.Cols.GetData(selected[j].Name))
+	}
+	return sh, nil
+}
+
+// xlsxSheetName makes a valid sheet name, unique among used:
+// at most 31 characters, none of []:*?/\ and not blank.
+func xlsxSheetName(name string, used []string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if strings.TrimSpace(name) == "" {
+		name = "Sheet"
+	}
+
+	truncate := func(s string, n int) string {
+		if utf8.RuneCountInString(s) > n {
+			s = string([]rune(s)[:n])
+		}
+		return s
+	}
+	name = strings.TrimSpace(truncate(name, xlsxMaxSheet))
+
+	base := name
+	for n := 2; containsFold(used, name); n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		name = truncate(base, xlsxMaxSheet-len(suffix)) + suffix
+	}
+	return name
+}
+
+func containsFold(list []string, s string) bool {
+	for i := 0; i < len(list); i++ {
+		if strings.EqualFold(list[i], s) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeXLSX(w io.Writer, sheets []*xlsxSheet, opts *XLSXOptions) error {
+	xw := &xlsxWriter{zw: zip.NewWriter(w), opts: opts, strIndex: make(map[string]int)}
+
+	// the sheets first: they collect the shared strings
+	for i, sh := range sheets {
+		if err := xw.sheet(i+1, sh); err != nil {
+			return err
+		}
+	}
+
+	parts := []struct {
+		name string
+		data string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", xlsxXMLHeader +
+			`<Relationships xmlns="` + xlsxNsPkgRels + `">` +
+			`<Relationship Id="rId1" Type="` + xlsxNsRels + `/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", xw.styles()},
+		{"xl/sharedStrings.xml", xw.sharedStrings()},
+	}
+	for _, p := range parts {
+		f, err := xw.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.data); err != nil {
+			return err
+		}
+	}
+
+	return xw.zw.Close()
+}
+
+func xlsxContentTypes(nSheets int) string {
+	var b strings.Builder
+	b.WriteString(xlsxXMLHeader)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= nSheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/>`)
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(sheets []*xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(xlsxXMLHeader)
+	b.WriteString(`<workbook xmlns="` + xlsxNsMain + `" xmlns:r="` + xlsxNsRels + `"><sheets>`)
+	for i, sh := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sh.name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(nSheets int) string {
+	var b strings.Builder
+	b.WriteString(xlsxXMLHeader)
+	b.WriteString(`<Relationships xmlns="` + xlsxNsPkgRels + `">`)
+	for i := 1; i <= nSheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i, xlsxNsRels, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, nSheets+1, xlsxNsRels)
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/sharedStrings" Target="sharedStrings.xml"/>`, nSheets+2, xlsxNsRels)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// styles returns styles.xml: the default style, the header (bold
+// on a light fill, with a bottom border) and two date formats.
+func (xw *xlsxWriter) styles() string {
+	dateTime, date := "yyyy-mm-dd hh:mm:ss", "yyyy-mm-dd"
+	if xw.opts.DateFormat != "" {
+		dateTime, date = xw.opts.DateFormat, xw.opts.DateFormat
+	}
+
+	var b strings.Builder
+	b.WriteString(xlsxXMLHeader)
+	b.WriteString(`<styleSheet xmlns="` + xlsxNsMain + `">`)
+	fmt.Fprintf(&b, `<numFmts count="2"><numFmt numFmtId="164" formatCode="%s"/><numFmt numFmtId="165" formatCode="%s"/></numFmts>`,
+		xlsxEscape(dateTime), xlsxEscape(date))
+	b.WriteString(`<fonts count="2">` +
+		`<font><sz val="11"/><name val="Calibri"/><family val="2"/></font>` +
+		`<font><b/><sz val="11"/><name val="Calibri"/><family val="2"/></font></fonts>`)
+	b.WriteString(`<fills count="3">` +
+		`<fill><patternFill patternType="none"/></fill>` +
+		`<fill><patternFill patternType="gray125"/></fill>` +
+		`<fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>`)
+	b.WriteString(`<borders count="2">` +
+		`<border><left/><right/><top/><bottom/><diagonal/></border>` +
+		`<border><left/><right/><top/><bottom style="thin"><color auto="1"/></bottom><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	b.WriteString(`<cellXfs count="4">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>`)
+	b.WriteString(`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`)
+	b.WriteString(`</styleSheet>`)
+	return b.String()
+}
+
+func (xw *xlsxWriter) sharedStrings() string {
+	var b strings.Builder
+	b.WriteString(xlsxXMLHeader)
+	fmt.Fprintf(&b, `<sst xmlns="%s" count="%d" uniqueCount="%d">`, xlsxNsMain, xw.stringRefs, len(xw.strs))
+	for _, s := range xw.strs {
+		if s != strings.TrimSpace(s) {
+			b.WriteString(`<si><t xml:space="preserve">`)
+		} else {
+			b.WriteString(`<si><t>`)
+		}
+		b.WriteString(xlsxEscape(xlsxEscapeChars(s)))
+		b.WriteString(`</t></si>`)
+	}
+	b.WriteString(`</sst>`)
+	return b.String()
+}
+
+// sharedString returns the index of s in the shared strings.
+func (xw *xlsxWriter) sharedString(s string) int {
+	xw.stringRefs++
+	if i, ok := xw.strIndex[s]; ok {
+		return i
+	}
+	xw.strs = append(xw.strs, s)
+	xw.strIndex[s] = len(xw.strs) - 1
+	return len(xw.strs) - 1
+}
+
+// sheet writes xl/worksheets/sheet<n>.xml.
+func (xw *xlsxWriter) sheet(n int, sh *xlsxSheet) error {
+	nCols := len(sh.cols)
+	widths := make([]int, nCols)
+	types := make([]string, nCols)
+	dateStyles := make([]int, nCols)
+
+	for j := 0; j < nCols; j++ {
+		// "string" is the type set by Cols.Add; the values are
+		// then written by their own type
+		if sh.cols[j].Type != "string" {
+			types[j] = normalizeColType(sh.cols[j].Type)
+		}
+		dateStyles[j] = xlsxDateStyle(sh.data[j], types[j] == ColTypeDateTime)
+	}
+
+	var data bytes.Buffer
+	rowNum := 0
+	if !xw.opts.NoHeader {
+		rowNum++
+		fmt.Fprintf(&data, `<row r="%d">`, rowNum)
+		for j := 0; j < nCols; j++ {
+			name := sh.cols[j].Name
+			fmt.Fprintf(&data, `<c r="%s%d" s="%d" t="s"><v>%d</v></c>`,
+				xlsxColName(j), rowNum, xlsxStyleHeader, xw.sharedString(name))
+			widths[j] = utf8.RuneCountInString(name)
+		}
+		data.WriteString(`</row>`)
+	}
+
+	for i := 0; i < sh.rows; i++ {
+		rowNum++
+		fmt.Fprintf(&data, `<row r="%d">`, rowNum)
+		for j := 0; j < nCols; j++ {
+			v := sh.data[j][i]
+			if isNull(v) {
+				continue
+			}
+			ref := xlsxColName(j) + strconv.Itoa(rowNum)
+			width, err := xw.cell(&data, ref, v, types[j], dateStyles[j])
+			if err != nil {
+				return fmt.Errorf("xlsx: sheet %s, column %s, row %d: %v", sh.name, sh.cols[j].Name, i, err)
+			}
+			if width > widths[j] {
+				widths[j] = width
+			}
+		}
+		data.WriteString(`</row>`)
+	}
+
+	f, err := xw.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", n))
+	if err != nil {
+		return err
+	}
+
+	var head strings.Builder
+	head.WriteString(xlsxXMLHeader)
+	head.WriteString(`<worksheet xmlns="` + xlsxNsMain + `" xmlns:r="` + xlsxNsRels + `">`)
+	if nCols > 0 && rowNum > 0 {
+		fmt.Fprintf(&head, `<dimension ref="A1:%s%d"/>`, xlsxColName(nCols-1), rowNum)
+	} else {
+		head.WriteString(`<dimension ref="A1"/>`)
+	}
+	if !xw.opts.NoHeader && nCols > 0 {
+		head.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+			`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+			`<selection pane="bottomLeft"/></sheetView></sheetViews>`)
+	} else {
+		head.WriteString(`<sheetViews><sheetView workbookViewId="0"/></sheetViews>`)
+	}
+	head.WriteString(`<sheetFormatPr defaultRowHeight="15"/>`)
+	if nCols > 0 {
+		head.WriteString(`<cols>`)
+		for j := 0; j < nCols; j++ {
+			w := widths[j] + 2
+			if w < 8 {
+				w = 8
+			} else if w > 60 {
+				w = 60
+			}
+			fmt.Fprintf(&head, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, j+1, j+1, w)
+		}
+		head.WriteString(`</cols>`)
+	}
+	head.WriteString(`<sheetData>`)
+
+	if _, err := io.WriteString(f, head.String()); err != nil {
+		return err
+	}
+	if _, err := data.WriteTo(f); err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, `</sheetData></worksheet>`)
+	return err
+}
+
+// cell writes a cell and returns the width of its text. typ is the
+// column type, or "" to take the type of the value; values that do
+// not convert to it are written as text.
+func (xw *xlsxWriter) cell(b *bytes.Buffer, ref string, v interface{}, typ string, dateStyle int) (int, error) {
+	if typ == "" {
+		typ = colTypeOf(v)
+	}
+
+	switch typ {
+	case ColTypeInteger:
+		if i, ok := toInt64(v); ok && i <= xlsxMaxInteger && i >= -xlsxMaxInteger {
+			s := strconv.FormatInt(i, 10)
+			fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, s)
+			return len(s), nil
+		}
+	case ColTypeFloat:
+		if f, ok := toFloat64(v); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			s := strconv.FormatFloat(f, 'g', -1, 64)
+			fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, s)
+			return len(s), nil
+		}
+	case ColTypeBool:
+		if x, ok := toBool(v); ok {
+			if x {
+				fmt.Fprintf(b, `<c r="%s" t="b"><v>1</v></c>`, ref)
+				return 4, nil
+			}
+			fmt.Fprintf(b, `<c r="%s" t="b"><v>0</v></c>`, ref)
+			return 5, nil
+		}
+	case ColTypeDateTime:
+		if tm, ok := toTime(v); ok {
+			if serial, ok := xlsxSerial(tm); ok {
+				fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, dateStyle,
+					strconv.FormatFloat(serial, 'f', -1, 64))
+				if dateStyle == xlsxStyleDate {
+					return 10, nil
+				}
+				return 19, nil
+			}
+		}
+	}
+
+	s := toString(v)
+	if utf8.RuneCountInString(s) > xlsxMaxText {
+		return 0, fmt.Errorf("text longer than %d characters", xlsxMaxText)
+	}
+	fmt.Fprintf(b, `<c r="%s" t="s"><v>%d</v></c>`, ref, xw.sharedString(s))
+
+	// the longest line of the text
+	width := 0
+	for _, line := range strings.Split(s, "\n") {
+		if n := utf8.RuneCountInString(line); n > width {
+			width = n
+		}
+	}
+	return width, nil
+}
+
+// xlsxDateStyle returns the date style of a column: date only when
+// all its times (and date strings of a DateTime column) are midnight.
+func xlsxDateStyle(vals []interface{}, parseStrings bool) int {
+	for i := 0; i < len(vals); i++ {
+		if isNull(vals[i]) {
+			continue
+		}
+		tm, ok := vals[i].(time.Time)
+		if !ok {
+			if p, isPtr := vals[i].(*time.Time); isPtr {
+				tm, ok = *p, true
+			} else if s, isStr := vals[i].(string); isStr && parseStrings {
+				tm, ok = parseTime(s)
+			}
+		}
+		if ok && (tm.Hour() != 0 || tm.Minute() != 0 || tm.Second() != 0 || tm.Nanosecond() != 0) {
+			return xlsxStyleDateTime
+		}
+	}
+	return xlsxStyleDate
+}
+
+// xlsxSerial converts the wall clock of tm to an Excel date serial.
+func xlsxSerial(tm time.Time) (float64, bool) {
+	wall := time.Date(tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond(), time.UTC)
+	if wall.Before(xlsxMinDate) || wall.Year() > 9999 {
+		return 0, false
+	}
+	secs := wall.Unix() - xlsxEpoch.Unix()
+	serial := float64(secs)/86400 + float64(wall.Nanosecond())/86400e9
+	return serial, true
+}
+
+// xlsxColName returns the letters of a column: 0 is A, 26 is AA.
+func xlsxColName(j int) string {
+	var b [4]byte
+	i := len(b)
+	for j >= 0 {
+		i--
+		b[i] = byte('A' + j%26)
+		j = j/26 - 1
+	}
+	return string(b[i:])
+}
+
+// xlsxEscapeChars writes the control characters that XML does not
+// allow as _xHHHH_ (and a literal _xHHHH_ as _x005F_xHHHH_).
+func xlsxEscapeChars(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c < ' ' && c != '\t' && c != '\n' && c != '\r':
+			fmt.Fprintf(&b, "_x%04X_", c)
+		case c == '_' && xlsxIsCharEscape(s[i:]):
+			b.WriteString("_x005F_")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// xlsxIsCharEscape reports whether s starts with _xHHHH_.
+func xlsxIsCharEscape(s string) bool {
+	if len(s) < 7 || s[0] != '_' || s[1] != 'x' || s[6] != '_' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[2:6], 16, 16)
+	return err == nil
+}
+
+// xlsxEscape escapes text for XML; characters that XML does not
+// allow are replaced by U+FFFD.
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
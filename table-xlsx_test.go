@@ -0,0 +1,341 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xlsxParts unzips a workbook and checks that its parts are well
+// formed XML.
+func xlsxParts(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := xml.NewDecoder(bytes.NewReader(b))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = string(b)
+	}
+	return parts
+}
+
+func TestXLSXRoundTrip(t *testing.T) {
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2024, 3, 6, 13, 45, 30, 123e6, time.UTC)
+
+	tbl, _ := (&Table{}).Create("sales")
+	tbl.Cols.SetColumns([]Column{
+		{Name: "id", Type: ColTypeInteger}, {Name: "name"}, {Name: "price", Type: ColTypeFloat},
+		{Name: "ok", Type: ColTypeBool}, {Name: "day", Type: ColTypeDateTime}, {Name: "at", Type: ColTypeDateTime},
+		{Name: "note"},
+	})
+	for _, r := range [][]interface{}{
+		{int64(1), "apple", 1.5, true, day, at, nil},
+		{int64(2), " padded ", 2.0, false, day, at, "a<b>&\"c\"\nline2"},
+		{int64(3), "apple", nil, nil, nil, nil, "x"},
+		{int64(4), "ctl", 3.25, true, day, at, "\x01ctl_x0041_"},
+	} {
+		row := tbl.Rows.New()
+		for j, c := range tbl.Cols.Get() {
+			row[c.Name] = r[j]
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tbl.WriteXLSX(&buf, XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	parts := xlsxParts(t, buf.Bytes())
+	if !strings.Contains(parts["xl/workbook.xml"], `name="sales"`) {
+		t.Fatalf("workbook %s", parts["xl/workbook.xml"])
+	}
+
+	back, _ := (&Table{}).Create("x")
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := colTypes(back); got != "id:Integer name:String price:Float ok:Bool day:DateTime at:DateTime note:String" {
+		t.Fatalf("columns %s", got)
+	}
+
+	rows := back.Rows.GetRows()
+	if rows[0]["id"] != int64(1) || rows[1]["name"] != " padded " || rows[1]["price"] != 2.0 || rows[0]["ok"] != true || rows[2]["price"] != nil {
+		t.Fatalf("values %v", tableValues(back))
+	}
+	if !rows[0]["day"].(time.Time).Equal(day) || !rows[0]["at"].(time.Time).Equal(at) {
+		t.Fatalf("dates %v %v", rows[0]["day"], rows[0]["at"])
+	}
+	if rows[1]["note"] != "a<b>&\"c\"\nline2" || rows[3]["note"] != "\x01ctl_x0041_" {
+		t.Fatalf("escaped text %q %q", rows[1]["note"], rows[3]["note"])
+	}
+
+	// integers beyond 2^53 and NaN are written as text
+	big, _ := (&Table{}).Create("b")
+	big.Cols.SetColumns([]Column{{Name: "i", Type: ColTypeInteger}, {Name: "f", Type: ColTypeFloat}})
+	row := big.Rows.New()
+	row["i"], row["f"] = int64(1<<60), math.NaN()
+	row = big.Rows.New()
+	row["i"], row["f"] = int64(1), 1.5
+	buf.Reset()
+	if err := big.WriteXLSX(&buf, XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	back, _ = (&Table{}).Create("x")
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tableValues(back)); got != "[[1152921504606846976 NaN] [1 1.5]]" {
+		t.Fatalf("big: %s", got)
+	}
+}
+
+func TestXLSXOptions(t *testing.T) {
+	tbl, _ := (&Table{}).Create("t")
+	tbl.Cols.SetColumns([]Column{{Name: "a", Type: ColTypeInteger}, {Name: "b"}, {Name: "c", Type: ColTypeFloat}})
+	for _, r := range [][]interface{}{{int64(1), "x", 2.5}, {int64(2), "y", 3.5}} {
+		row := tbl.Rows.New()
+		row["a"], row["b"], row["c"] = r[0], r[1], r[2]
+	}
+
+	var buf bytes.Buffer
+	if err := tbl.WriteXLSX(&buf, XLSXOptions{Sheet: "My:Sheet/[1]", NoHeader: true, Columns: []string{"c", "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if wb := xlsxParts(t, buf.Bytes())["xl/workbook.xml"]; !strings.Contains(wb, `name="My_Sheet__1_"`) {
+		t.Fatalf("sheet name %s", wb)
+	}
+
+	back, _ := (&Table{}).Create("x")
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{NoHeader: true, Sheet: "my_sheet__1_"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := colTypes(back) + " " + fmt.Sprint(tableValues(back)); got != "col_1:Float col_2:Integer [[2.5 1] [3.5 2]]" {
+		t.Fatalf("got %s", got)
+	}
+
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{Sheet: "nope"}); err == nil {
+		t.Fatal("unknown sheet: no error")
+	}
+	if err := back.ReadXLSX(strings.NewReader("not a zip"), XLSXOptions{}); err == nil {
+		t.Fatal("not a zip: no error")
+	}
+	if err := tbl.WriteXLSX(ioutil.Discard, XLSXOptions{Columns: []string{"zz"}}); err == nil {
+		t.Fatal("unknown column: no error")
+	}
+
+	long, _ := (&Table{}).Create("l")
+	long.Cols.Add("a")
+	long.Rows.New()["a"] = strings.Repeat("x", xlsxMaxText+1)
+	if err := long.WriteXLSX(ioutil.Discard, XLSXOptions{}); err == nil {
+		t.Fatal("long text: no error")
+	}
+
+	// an empty table is an empty sheet
+	empty, _ := (&Table{}).Create("")
+	buf.Reset()
+	if err := empty.WriteXLSX(&buf, XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	back, _ = (&Table{}).Create("e")
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{}); err != nil || back.Cols.Count() != 0 {
+		t.Fatalf("empty: %v, %d columns", err, back.Cols.Count())
+	}
+}
+
+func TestXLSXDataset(t *testing.T) {
+	var ds Dataset
+	for i, name := range []string{"one", "a very long table name that is over thirty one", "a very long table name that is over thirty two"} {
+		tbl, _ := (&Table{}).Create(name)
+		tbl.Cols.Add("v")
+		tbl.Rows.New()["v"] = fmt.Sprint(i)
+		if err := ds.Add(*tbl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ds.WriteXLSX(&buf, XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// sheet names are cut to 31 characters and made unique
+	var back Dataset
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := range back.Tables {
+		names = append(names, back.Tables[i].Name+"="+fmt.Sprint(back.Tables[i].Cols.GetData("v")))
+	}
+	if got := strings.Join(names, "; "); got != "one=[0]; a very long table name that is=[1]; a very long table name that (2)=[2]" {
+		t.Fatalf("tables %s", got)
+	}
+	if err := back.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{Sheet: "one"}); err == nil {
+		t.Fatal("existing table: no error")
+	}
+
+	var empty Dataset
+	if err := empty.WriteXLSX(ioutil.Discard, XLSXOptions{}); err == nil {
+		t.Fatal("no tables: no error")
+	}
+}
+
+// A workbook as other tools write it: shared and inline strings,
+// rich text, the 1904 date system, custom formats, formulas, error
+// cells and sparse rows.
+func TestXLSXReadForeign(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, s string) {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(s))
+	}
+	add("[Content_Types].xml", `<Types/>`)
+	add("_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="/xl/workbook.xml"/></Relationships>`)
+	add("xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<workbookPr date1904="1"/><sheets>
+<sheet name="Data" sheetId="5" r:id="rId7"/>
+<sheet name="Other" sheetId="1" r:id="rId1"/></sheets></workbook>`)
+	add("xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId7" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/data.xml"/>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`)
+	add("xl/sharedStrings.xml", `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Name</t></si>
+<si><r><rPr><b/></rPr><t>Ri</t></r><r><t xml:space="preserve">ch </t></r><rPh><t>PHON</t></rPh></si>
+<si><t>line_x000D_break</t></si>
+<si><t>When</t></si></sst>`)
+	add("xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts><numFmt numFmtId="170" formatCode="[$-409]d\-mmm\-yy;@"/><numFmt numFmtId="171" formatCode="&quot;days&quot; 0.00"/></numFmts>
+<cellXfs count="4"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="170"/><xf numFmtId="171"/></cellXfs></styleSheet>`)
+	add("xl/worksheets/data.xml", `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="2"><c r="B2" t="s"><v>0</v></c><c r="C2" t="s"><v>3</v></c><c r="D2"><v>5</v></c><c r="F2" t="inlineStr"><is><t>Name</t></is></c></row>
+<row r="3"><c r="B3" t="s"><v>1</v></c><c r="C3" s="2"><v>0</v></c><c r="D3" s="3"><v>1.25</v></c><c r="E3" t="e"><v>#N/A</v></c><c r="F3" t="b"><v>1</v></c></row>
+<row r="5"><c r="B5" t="inlineStr"><is>
+  <t>inline</t>
+</is></c><c r="C5" s="1"><v>1.5</v></c><c r="D5"><f>1+1</f><v>2</v></c><c r="F5" t="str"><v>formula text</v></c></row>
+<row r="6"><c r="B6" t="s"><v>2</v></c></row>
+<row r="7" ht="20" customHeight="1"/>
+</sheetData></worksheet>`)
+	add("xl/worksheets/sheet1.xml", `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, _ := (&Table{}).Create("x")
+	if err := tbl.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(columnNames(tbl.Cols.Get())); got != "[Name When 5 col_4 Name_2]" {
+		t.Fatalf("columns %s", got)
+	}
+
+	rows := tableValues(tbl)
+	if len(rows) != 4 || rows[0][0] != "Rich " || rows[2][0] != "inline" || rows[3][0] != "line\rbreak" {
+		t.Fatalf("text %q", rows)
+	}
+	if !rows[0][1].(time.Time).Equal(time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+		!rows[2][1].(time.Time).Equal(time.Date(1904, 1, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("dates %v %v", rows[0][1], rows[2][1])
+	}
+	if rows[0][2] != 1.25 || rows[2][2] != 2.0 || rows[0][3] != nil || rows[0][4] != "true" || rows[2][4] != "formula text" {
+		t.Fatalf("values %#v", rows)
+	}
+	for _, v := range rows[1] {
+		if v != nil {
+			t.Fatalf("blank row %v", rows[1])
+		}
+	}
+
+	var ds Dataset
+	if err := ds.ReadXLSX(bytes.NewReader(buf.Bytes()), XLSXOptions{}); err != nil || len(ds.Tables) != 2 || ds.Tables[1].Rows.Count() != 0 {
+		t.Fatalf("dataset: %v", err)
+	}
+}
+
+func TestXLSXDates(t *testing.T) {
+	xr := &xlsxReader{}
+	for serial, want := range map[float64]string{
+		1:     "1900-01-01T00",
+		59:    "1900-02-28T00",
+		61:    "1900-03-01T00",
+		45357: "2024-03-06T00",
+		0.5:   "1899-12-30T12",
+	} {
+		tm, _ := xr.date(serial)
+		if got := tm.Format("2006-01-02T15"); got != want {
+			t.Errorf("serial %v: %s, want %s", serial, got, want)
+		}
+	}
+
+	for _, tm := range []time.Time{
+		time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 12, 31, 23, 59, 59, 999e6, time.UTC),
+		time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+	} {
+		s, ok := xlsxSerial(tm)
+		if back, _ := xr.date(s); !ok || !back.Equal(tm) {
+			t.Errorf("%v: serial %v read as %v", tm, s, back)
+		}
+	}
+	if _, ok := xlsxSerial(time.Date(1899, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("date before 1900 has a serial")
+	}
+
+	// the wall clock is kept
+	s, _ := xlsxSerial(time.Date(2024, 1, 1, 8, 0, 0, 0, time.FixedZone("x", 5*3600)))
+	if back, _ := xr.date(s); back.Hour() != 8 {
+		t.Errorf("zone: %v", back)
+	}
+
+	for _, f := range []string{"d-mmm-yy", "[$-409]h:mm AM/PM", "yyyy\"年\"", "[h]:mm"} {
+		if !xlsxIsDateFormat(f) {
+			t.Errorf("%s is a date format", f)
+		}
+	}
+	for _, f := range []string{"0.00", "General", `"days" 0`, "[Red]#,##0", `0\d`, "0.00E+00", "_(* #,##0_)"} {
+		if xlsxIsDateFormat(f) {
+			t.Errorf("%s is not a date format", f)
+		}
+	}
+
+	for j, s := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA", 16383: "XFD"} {
+		if xlsxColName(j) != s || xlsxColIndex(s+"12") != j {
+			t.Errorf("column %d: %s", j, s)
+		}
+	}
+	if xlsxColIndex("12") != -1 || xlsxColIndex("XFE1") != -1 {
+		t.Error("bad cell reference accepted")
+	}
+}
@@ -4,22 +4,36 @@ package collections
 import (
 	"bytes"
 	"compress/gzip"
+	"database/sql"
 	"encoding/base64"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"strings"
+	"time"
 )
 
 // ITable is the table interface.
 type ITable interface {
-	Create(name string) (*Table, error)
+	Create(name string, storage ...Storage) (*Table, error)
 
 	// GetJSON gets a json string of the entire table.
 	GetJSON(tbl *Table) string
 
+	// WriteJSON writes the rows as a JSON array of objects, an
+	// array of arrays, or JSON Lines.
+	WriteJSON(w io.Writer, opts JSONOptions) error
+
+	MarshalJSON() ([]byte, error)
+	UnmarshalJSON(data []byte) error
+
+	// ReadJSON and ReadJSONLines read records (objects) into the
+	// table, creating the columns and inferring their types.
+	ReadJSON(r io.Reader, opts JSONReadOptions) error
+	ReadJSONLines(r io.Reader, opts JSONReadOptions) error
+
 	// Serialize create a []byte representation of the entire
 	// table, which can written to disk.
 	Serialize(tbl *Table) ([]byte, error)
@@ -29,6 +43,59 @@ type ITable interface {
 
 	SerializeToFile(tbl *Table, fPath string) error
 	DeserializeFromFile(fPath string) (*Table, error)
+
+	// GroupBy groups the rows by the values of one or more
+	// columns; call Agg on the result to aggregate.
+	GroupBy(cols ...string) *Grouping
+
+	// PartitionBy and OrderBy create a window for computing
+	// window functions (row_number, rank, lag, running totals...).
+	PartitionBy(cols ...string) *Window
+	OrderBy(col string, order SortOrder) *Window
+
+	// Pivot turns the distinct values of a column into columns;
+	// Unpivot turns columns into name/value rows.
+	Pivot(index []string, columnsFrom string, valuesFrom string, aggFunc func(col string) Aggregate) (*Table, error)
+	Unpivot(idCols []string, valueCols []string, nameCol string, valueCol string) (*Table, error)
+
+	// ReadCSV and WriteCSV stream the table from/to CSV.
+	ReadCSV(r io.Reader, opts CSVOptions) error
+	WriteCSV(w io.Writer, opts CSVOptions) error
+
+	// WriteArrowIPC and WriteArrowFile write the table in the Arrow
+	// IPC stream and file (Feather v2) formats; ReadArrowIPC reads
+	// either one.
+	WriteArrowIPC(w io.Writer) error
+	WriteArrowFile(w io.Writer) error
+	ReadArrowIPC(r io.Reader) error
+
+	// WriteParquet and ReadParquet write and read the table as a
+	// Parquet file.
+	WriteParquet(w io.Writer, opts ParquetOptions) error
+	ReadParquet(r io.Reader) error
+
+	// WriteXLSX and ReadXLSX write and read the table as a sheet
+	// of an Excel workbook.
+	WriteXLSX(w io.Writer, opts XLSXOptions) error
+	ReadXLSX(r io.Reader, opts XLSXOptions) error
+
+	// Render writes the table as an aligned text (ASCII or Unicode),
+	// Markdown or HTML table.
+	Render(w io.Writer, format RenderFormat, opts RenderOptions) error
+
+	// Profile returns the statistics of every column as a table
+	// with one row per column.
+	Profile(opts ...ProfileOptions) (*Table, error)
+
+	// FromStructs adds a row for each struct of a slice; ToStructs
+	// fills a slice of structs with the rows.
+	FromStructs(slice interface{}) error
+	ToStructs(dst interface{}) error
+
+	// FromSQLRows adds the rows of a database/sql query result;
+	// InsertInto writes the rows to a database table.
+	FromSQLRows(rows *sql.Rows) error
+	InsertInto(db SQLExecer, tableName string, opts SQLInsertOptions) error
 }
 
 // Table holds the structure for the ITable interface.
@@ -56,8 +123,22 @@ func (t *Table) SerializeToFile(tbl *Table, fPath string) error {
 
 	return nil
 }
+
+// Deserialize transforms the output of Serialize back to a table.
+// Data written by earlier versions (base64 of gob-encoded rows) is
+// still read.
 func (t *Table) Deserialize(b []byte) (*Table, error) {
 
+	if isBinaryTable(b) {
+		return decodeTable(b)
+	}
+
+	return deserializeLegacy(t, b)
+}
+
+// deserializeLegacy reads the format of earlier versions.
+func deserializeLegacy(t *Table, b []byte) (*Table, error) {
+
 	var err error
 	var m []map[string]interface{}
 
@@ -72,6 +153,7 @@ func (t *Table) Deserialize(b []byte) (*Table, error) {
 	}
 
 	buf := bytes.NewReader(b)
+	gob.Register(time.Time{})
 	err = gob.NewDecoder(buf).Decode(&m)
 	if err != nil && err.Error() != "EOF" {
 		return nil, err
@@ -86,6 +168,9 @@ func (t *Table) Deserialize(b []byte) (*Table, error) {
 		return nil, errors.New(err.Error())
 	}
 	for k := range m[0] {
+		if k == row_id {
+			continue
+		}
 		tbl.Cols.Add(k)
 	}
 	cols := tbl.Cols.Get()
@@ -100,32 +185,12 @@ func (t *Table) Deserialize(b []byte) (*Table, error) {
 	return tbl, nil
 }
 
-// Serialze turns a data-table into bytes of gob.
+// Serialize turns a data-table into bytes. The format is versioned
+// and keeps the name, the columns (in order, with their types and
+// tags), the rows with their _rowid_, the tags, the row hashes and
+// the shared data; it ends with a CRC-32 checksum.
 func (t *Table) Serialize(tbl *Table) ([]byte, error) {
-	var encoded bytes.Buffer
-	rows := tbl.Rows.GetRows()
-
-	tryx := 0
-
-lblAgain:
-	encode := gob.NewEncoder(&encoded)
-	err := encode.Encode(rows)
-	if err != nil {
-		if tryx < 1 && strings.Contains(err.Error(), "type not registered for interface: time.Time") {
-			gob.Register(time.Now())
-			tryx++
-			goto lblAgain
-		}
-		return nil, err
-	}
-
-	// Add the table name to the top (first n bytes) of the byte array.
-	data := appendTableNameToData(tbl.Name, encoded.Bytes())
-
-	s64based := base64.StdEncoding.EncodeToString(data)
-	data = []byte(s64based)
-
-	return data, nil
+	return encodeTable(tbl)
 }
 func (t *Table) DeserializeFromFile(fPath string) (*Table, error) {
 
@@ -180,26 +245,10 @@ func getTableNameFromData(data []byte) (string, []byte, error) {
 	return tblName, bu.Bytes(), nil
 }
 
-func appendTableNameToData(tName string, data []byte) []byte {
-	var tblNameB [maxTableNameLength]byte
-	tblName := []byte(tName)
-	bu := new(bytes.Buffer)
-	for i := 0; i < len(tblName); i++ {
-		tblNameB[i] = tblName[i]
-	}
-	// Wirte the n bytes
-	for i := 0; i < len(tblNameB); i++ {
-		bu.WriteByte(tblNameB[i])
-	}
-	// Add the data
-	for i := 0; i < len(data); i++ {
-		bu.WriteByte(data[i])
-	}
-	return bu.Bytes()
-}
-
-// Create initializes an empty table.
-func (t *Table) Create(name string) (*Table, error) {
+// Create initializes an empty table. The rows are stored per row,
+// unless ColumnStorage is passed, which stores them per column; it
+// takes much less memory for large tables.
+func (t *Table) Create(name string, storage ...Storage) (*Table, error) {
 
 	if len(name) > 80 {
 		return nil, errors.New("maximum length for a table name is 80 characters")
@@ -210,36 +259,26 @@ func (t *Table) Create(name string) (*Table, error) {
 
 	var row []Row
 	var colArry []Column
-	var tags []Tag
+	var tags []RowTags
 	var rowHashes []RowHash
 	var sharedDataItems []SharedDataItem
 	var wrkGrpOccurenceCount int
 
-	tbl.Rows = &Rows{row, colArry, tags, rowHashes, sharedDataItems}
-	tbl.Cols = &Cols{colArry, tbl.Rows, wrkGrpOccurenceCount}
+	if len(storage) > 0 && storage[0] == ColumnStorage {
+		tbl.Rows = newColumnarRows()
+	} else {
+		tbl.Rows = &Rows{Rows: row, Columns: colArry, Tags: tags, RowHashes: rowHashes, SharedData: sharedDataItems}
+	}
+	tbl.Cols = &Cols{Columns: colArry, Rows: tbl.Rows, wrkGrpOccurenceCount: wrkGrpOccurenceCount}
 
 	return &tbl, nil
 }
 
+// GetJSON gets the rows of tbl as a JSON array of objects, with
+// the keys in column order. See WriteJSON for other layouts.
 func (t *Table) GetJSON(tbl *Table) string {
-	cols := tbl.Cols.Get()
-	rows := tbl.Rows.GetRows()
-
-	var jsnArry []string
-
-	for i := 0; i < len(rows); i++ {
-		var sa []string
-		for j := 0; j < len(cols); j++ {
-			v := rows[i][cols[j].Name]
-			if fmt.Sprintf("%v", cols[j].Type) == "string" {
-				v = fmt.Sprintf(`"%v"`, v)
-			}
-			sa = append(sa, fmt.Sprintf(`"%s":%v`, cols[j].Name, v))
-		}
-		oneJsn := fmt.Sprintf(`{%s}`, strings.Join(sa, ","))
-		jsnArry = append(jsnArry, oneJsn)
+	if tbl == nil {
+		return "null"
 	}
-	allJson := fmt.Sprintf("{[%s]}", strings.Join(jsnArry, ","))
-
-	return allJson
+	return jsonString(tbl, JSONOptions{})
 }
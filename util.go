@@ -1,7 +1,9 @@
 package collections
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -74,6 +76,33 @@ func removeItemFromArray(e []interface{}, i int) []interface{} {
 	return e[:len(e)-1]
 }
 
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// readerAtOf returns r as an io.ReaderAt with its size; readers
+// that cannot seek are read into memory.
+func readerAtOf(r io.Reader) (io.ReaderAt, int64, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if s, ok := r.(io.Seeker); ok {
+			size, err := s.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, 0, err
+			}
+			return ra, size, nil
+		}
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
 // fileOrDirExists checks to see if a file or directory exists.
 func fileOrDirExists(path string) bool {
 	if path == "" {
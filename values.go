@@ -0,0 +1,400 @@
+// (c) Kamiar Bahri
+package collections
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the layouts tried (in order) when a string
+// value has to be read as a date/time.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+// isNull reports whether a cell value is a SQL-like NULL.
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// toInt64 converts v to an int64 if v holds a whole number
+// (either as a Go integer, a whole float or a numeric string).
+func toInt64(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case uint:
+		if uint64(x) <= math.MaxInt64 {
+			return int64(x), true
+		}
+	case uint8:
+		return int64(x), true
+	case uint16:
+		return int64(x), true
+	case uint32:
+		return int64(x), true
+	case uint64:
+		if x <= math.MaxInt64 {
+			return int64(x), true
+		}
+	case float32:
+		return floatToInt64(float64(x))
+	case float64:
+		return floatToInt64(x)
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// floatToInt64 converts f to an int64 if it is a whole number in
+// the range of int64.
+func floatToInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toFloat64 converts v to a float64 if v holds a number or a
+// numeric string.
+func toFloat64(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	case bool:
+		return 0, false
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// isIntegerKind reports whether v is a Go integer type.
+func isIntegerKind(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// isFloatKind reports whether v is a Go floating point type.
+func isFloatKind(v interface{}) bool {
+	switch v.(type) {
+	case float32, float64:
+		return true
+	}
+	return false
+}
+
+// toNumber returns v as an int64 or a float64. Numeric strings
+// are parsed; integers are preferred over floats.
+func toNumber(v interface{}) (interface{}, bool) {
+	if isIntegerKind(v) {
+		i, _ := toInt64(v)
+		return i, true
+	}
+	if isFloatKind(v) {
+		f, _ := toFloat64(v)
+		return f, true
+	}
+	if s, ok := v.(string); ok {
+		if i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// toTime converts v to a time.Time; strings are parsed with
+// timeLayouts.
+func toTime(v interface{}) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case *time.Time:
+		if x != nil {
+			return *x, true
+		}
+	case string:
+		return parseTime(x)
+	}
+	return time.Time{}, false
+}
+
+// parseTime parses s with the first matching layout in timeLayouts.
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toBool converts v to a bool; the second return value is false
+// when v is NULL or cannot be read as a boolean.
+func toBool(v interface{}) (bool, bool) {
+	switch x := v.(type) {
+	case nil:
+		return false, false
+	case bool:
+		return x, true
+	case string:
+		switch strings.ToLower(strings.TrimSpace(x)) {
+		case "true", "t", "yes", "y", "1":
+			return true, true
+		case "false", "f", "no", "n", "0":
+			return false, true
+		}
+		return false, false
+	}
+	if f, ok := toFloat64(v); ok {
+		return f != 0, true
+	}
+	return false, false
+}
+
+// toString formats v the way it is shown in text output.
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// compareValues orders two cell values. NULLs sort first; numbers
+// (and numeric strings compared with numbers) compare numerically,
+// times chronologically and everything else as text.
+func compareValues(a, b interface{}) int {
+	an, bn := isNull(a), isNull(b)
+	if an || bn {
+		switch {
+		case an && bn:
+			return 0
+		case an:
+			return -1
+		}
+		return 1
+	}
+
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+
+	if !(aStr && bStr) {
+		if ai, ok := toInt64(a); ok && (isIntegerKind(a) || aStr) {
+			if bi, ok := toInt64(b); ok && (isIntegerKind(b) || bStr) {
+				return compareInt64(ai, bi)
+			}
+		}
+		if af, ok := toFloat64(a); ok {
+			if bf, ok := toFloat64(b); ok {
+				return compareFloat64(af, bf)
+			}
+		}
+		if at, ok := toTime(a); ok {
+			if bt, ok := toTime(b); ok {
+				return compareTime(at, bt)
+			}
+		}
+		if ab, ok := a.(bool); ok {
+			if bb, ok := b.(bool); ok {
+				return compareBool(ab, bb)
+			}
+		}
+	}
+
+	return strings.Compare(toString(a), toString(b))
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case math.IsNaN(a) && !math.IsNaN(b):
+		return -1
+	case !math.IsNaN(a) && math.IsNaN(b):
+		return 1
+	}
+	return 0
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
+}
+
+// valueKey returns a string that identifies v for hashing (grouping,
+// distinct, joins). Numbers of equal value map to the same key
+// regardless of their Go type.
+func valueKey(v interface{}) string {
+	if isNull(v) {
+		return "\x00n"
+	}
+	switch x := v.(type) {
+	case string:
+		return "s" + x
+	case bool:
+		if x {
+			return "b1"
+		}
+		return "b0"
+	case time.Time:
+		return "t" + x.UTC().Format(time.RFC3339Nano)
+	}
+	if i, ok := toInt64(v); ok && (isIntegerKind(v) || isFloatKind(v)) {
+		return "i" + strconv.FormatInt(i, 10)
+	}
+	if f, ok := toFloat64(v); ok {
+		return "f" + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return "x" + fmt.Sprintf("%v", v)
+}
+
+// valuesKey joins the keys of several values into one key.
+func valuesKey(vals []interface{}) string {
+	var sb strings.Builder
+	for i := 0; i < len(vals); i++ {
+		sb.WriteString(valueKey(vals[i]))
+		sb.WriteByte(0x1f)
+	}
+	return sb.String()
+}
+
+// colTypeOf returns the column type name (ColType...) of a value.
+func colTypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case string:
+		return ColTypeString
+	case bool:
+		return ColTypeBool
+	case time.Time, *time.Time:
+		return ColTypeDateTime
+	}
+	if isIntegerKind(v) {
+		return ColTypeInteger
+	}
+	if isFloatKind(v) {
+		return ColTypeFloat
+	}
+	return fmt.Sprintf("%v", reflect.TypeOf(v))
+}
+
+// typedColType returns the ColType... of a typed column, or "" for
+// an untyped one.
+func typedColType(col Column) string {
+	if col.Type == "string" { // set by Cols.Add; not a type
+		return ""
+	}
+	switch typ := normalizeColType(col.Type); typ {
+	case ColTypeString, ColTypeInteger, ColTypeFloat, ColTypeBool, ColTypeDateTime:
+		return typ
+	}
+	return ""
+}
+
+// normalizeColType maps the type names found in Column.Type (Go
+// type names set by Cols.Add, or the names set by ResetColTypes)
+// to one of the ColType... constants. Unknown names are returned
+// as-is.
+func normalizeColType(t string) string {
+	switch strings.ToLower(strings.TrimSpace(t)) {
+	case "string", "text", "varchar", "char":
+		return ColTypeString
+	case "integer", "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "byte", "bigint":
+		return ColTypeInteger
+	case "float", "float32", "float64", "double", "real", "decimal", "numeric":
+		return ColTypeFloat
+	case "bool", "boolean":
+		return ColTypeBool
+	case "datetime", "time.time", "date", "timestamp", "time":
+		return ColTypeDateTime
+	}
+	return t
+}